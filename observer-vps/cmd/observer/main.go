@@ -3,12 +3,19 @@ package main
 import (
 	"context"
 	"log"
+	"os"
 
 	"observer-vps/internal/observer"
 )
 
 func main() {
-	if err := observer.Run(context.Background()); err != nil {
+	if len(os.Args) > 1 && os.Args[1] == "archive-import" {
+		if err := observer.RunArchiveImport(context.Background(), os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := observer.Run(context.Background(), os.Args[1:]); err != nil {
 		log.Fatal(err)
 	}
 }
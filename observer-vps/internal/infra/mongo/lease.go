@@ -0,0 +1,137 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Lease is a named lock stored as one document in a Mongo collection:
+//
+//	{_id: name, holder, token, expiresAt, acquiredAt, renewedAt}
+//
+// A holder keeps it by calling Acquire again before expiresAt. Anyone may
+// take it over once it has expired, and every takeover increments token, so
+// the token works as a fencing token: a write stamped with an older token
+// came from a holder that has since lost the lease. Expiry is judged by the
+// callers' clocks, which are assumed to agree to well within the TTL.
+type Lease struct {
+	col    *driver.Collection
+	name   string
+	holder string
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	token int64
+}
+
+// LeaseState is the outcome of an Acquire: whether this holder has the
+// lease and, either way, who does and until when.
+type LeaseState struct {
+	Held      bool
+	Holder    string
+	Token     int64
+	ExpiresAt time.Time
+}
+
+type leaseDocument struct {
+	Holder     string    `bson:"holder"`
+	Token      int64     `bson:"token"`
+	ExpiresAt  time.Time `bson:"expiresAt"`
+	AcquiredAt time.Time `bson:"acquiredAt"`
+}
+
+func NewLease(col *driver.Collection, name, holder string, ttl time.Duration) *Lease {
+	return &Lease{col: col, name: name, holder: holder, ttl: ttl}
+}
+
+// Acquire renews the lease if this holder has it and takes it over if it is
+// free or expired. Losing the race to another holder is not an error.
+func (l *Lease) Acquire(ctx context.Context) (LeaseState, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now().UTC()
+	expiresAt := now.Add(l.ttl)
+
+	if l.token > 0 {
+		result, err := l.col.UpdateOne(
+			ctx,
+			bson.M{"_id": l.name, "holder": l.holder, "token": l.token},
+			bson.M{"$set": bson.M{"expiresAt": expiresAt, "renewedAt": now}},
+		)
+		if err != nil {
+			return LeaseState{}, fmt.Errorf("renew lease %s: %w", l.name, err)
+		}
+		if result.MatchedCount == 1 {
+			return LeaseState{Held: true, Holder: l.holder, Token: l.token, ExpiresAt: expiresAt}, nil
+		}
+		l.token = 0
+	}
+
+	var doc leaseDocument
+	err := l.col.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": l.name, "expiresAt": bson.M{"$lte": now}},
+		bson.M{
+			"$set": bson.M{"holder": l.holder, "expiresAt": expiresAt, "acquiredAt": now, "renewedAt": now},
+			"$inc": bson.M{"token": int64(1)},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err == nil {
+		l.token = doc.Token
+		return LeaseState{Held: true, Holder: l.holder, Token: doc.Token, ExpiresAt: doc.ExpiresAt}, nil
+	}
+	// The upsert collides on _id when someone else holds an unexpired lease.
+	if !driver.IsDuplicateKeyError(err) {
+		return LeaseState{}, fmt.Errorf("acquire lease %s: %w", l.name, err)
+	}
+	return l.current(ctx)
+}
+
+func (l *Lease) current(ctx context.Context) (LeaseState, error) {
+	var doc leaseDocument
+	if err := l.col.FindOne(ctx, bson.M{"_id": l.name}).Decode(&doc); err != nil {
+		if errors.Is(err, driver.ErrNoDocuments) {
+			return LeaseState{}, nil
+		}
+		return LeaseState{}, fmt.Errorf("read lease %s: %w", l.name, err)
+	}
+	return LeaseState{Holder: doc.Holder, Token: doc.Token, ExpiresAt: doc.ExpiresAt}, nil
+}
+
+// Release gives the lease up early so another holder need not wait for it
+// to expire. It is a no-op if this holder no longer has it.
+func (l *Lease) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.token == 0 {
+		return nil
+	}
+	_, err := l.col.UpdateOne(
+		ctx,
+		bson.M{"_id": l.name, "holder": l.holder, "token": l.token},
+		bson.M{"$set": bson.M{"expiresAt": time.Unix(0, 0).UTC()}},
+	)
+	l.token = 0
+	if err != nil {
+		return fmt.Errorf("release lease %s: %w", l.name, err)
+	}
+	return nil
+}
+
+// StillHeld reports whether token is still the lease's current, unexpired
+// token, i.e. whether work started under it may still commit its results.
+func (l *Lease) StillHeld(ctx context.Context, token int64) (bool, error) {
+	count, err := l.col.CountDocuments(ctx, bson.M{"_id": l.name, "token": token, "expiresAt": bson.M{"$gt": time.Now().UTC()}})
+	if err != nil {
+		return false, fmt.Errorf("check lease %s: %w", l.name, err)
+	}
+	return count == 1, nil
+}
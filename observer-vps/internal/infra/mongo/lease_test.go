@@ -0,0 +1,109 @@
+package mongo
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	driver "go.mongodb.org/mongo-driver/mongo"
+)
+
+// testLeaseCollection connects to OBSERVER_TEST_MONGO_URI and returns a
+// fresh collection that is dropped afterwards. The lease needs a real
+// server for its upsert and duplicate key behaviour, so without one the
+// test is skipped.
+func testLeaseCollection(t *testing.T) *driver.Collection {
+	t.Helper()
+	uri := os.Getenv("OBSERVER_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("OBSERVER_TEST_MONGO_URI is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, db, err := Connect(ctx, uri, "observer_lease_test")
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	col := db.Collection("leases_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		_ = col.Drop(context.Background())
+		_ = client.Disconnect(context.Background())
+	})
+	return col
+}
+
+func TestLeaseRenewsAndRefusesOtherHolders(t *testing.T) {
+	col := testLeaseCollection(t)
+	ctx := context.Background()
+	first := NewLease(col, "jobs", "a", time.Minute)
+	second := NewLease(col, "jobs", "b", time.Minute)
+
+	state, err := first.Acquire(ctx)
+	if err != nil || !state.Held || state.Token != 1 {
+		t.Fatalf("first acquire = %+v, %v, want held with token 1", state, err)
+	}
+	renewed, err := first.Acquire(ctx)
+	if err != nil || !renewed.Held || renewed.Token != 1 || !renewed.ExpiresAt.After(state.ExpiresAt) {
+		t.Errorf("renew = %+v, %v, want the same token with a later expiry than %s", renewed, err, state.ExpiresAt)
+	}
+
+	// The takeover upsert collides on _id while the lease is live.
+	other, err := second.Acquire(ctx)
+	if err != nil || other.Held || other.Holder != "a" || other.Token != 1 {
+		t.Errorf("second acquire = %+v, %v, want a refusal naming a", other, err)
+	}
+	if held, err := first.StillHeld(ctx, 1); err != nil || !held {
+		t.Errorf("StillHeld(1) = %v, %v, want true", held, err)
+	}
+}
+
+func TestLeaseTakeoverFencesTheOldHolder(t *testing.T) {
+	col := testLeaseCollection(t)
+	ctx := context.Background()
+	first := NewLease(col, "jobs", "a", 50*time.Millisecond)
+	second := NewLease(col, "jobs", "b", time.Minute)
+
+	if state, err := first.Acquire(ctx); err != nil || !state.Held {
+		t.Fatalf("first acquire = %+v, %v", state, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if held, err := first.StillHeld(ctx, 1); err != nil || held {
+		t.Errorf("StillHeld(1) after expiry = %v, %v, want false", held, err)
+	}
+
+	state, err := second.Acquire(ctx)
+	if err != nil || !state.Held || state.Holder != "b" || state.Token != 2 {
+		t.Fatalf("takeover = %+v, %v, want b holding token 2", state, err)
+	}
+	if held, err := second.StillHeld(ctx, 2); err != nil || !held {
+		t.Errorf("StillHeld(2) = %v, %v, want true", held, err)
+	}
+	if held, err := first.StillHeld(ctx, 1); err != nil || held {
+		t.Errorf("StillHeld(1) after takeover = %v, %v, want the stale token rejected", held, err)
+	}
+
+	// The old holder's renewal finds its token gone and cannot take the
+	// live lease back.
+	stale, err := first.Acquire(ctx)
+	if err != nil || stale.Held || stale.Holder != "b" || stale.Token != 2 {
+		t.Errorf("old holder acquire = %+v, %v, want a refusal naming b", stale, err)
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Errorf("old holder release: %v", err)
+	}
+	if held, err := second.StillHeld(ctx, 2); err != nil || !held {
+		t.Errorf("StillHeld(2) after the old holder released = %v, %v, want b unaffected", held, err)
+	}
+
+	if err := second.Release(ctx); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if held, err := second.StillHeld(ctx, 2); err != nil || held {
+		t.Errorf("StillHeld(2) after release = %v, %v, want false", held, err)
+	}
+	if state, err := first.Acquire(ctx); err != nil || !state.Held || state.Token != 3 {
+		t.Errorf("acquire after release = %+v, %v, want a with token 3", state, err)
+	}
+}
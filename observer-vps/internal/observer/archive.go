@@ -0,0 +1,511 @@
+package observer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	mongox "observer-vps/internal/infra/mongo"
+)
+
+const (
+	archiveIndexFile   = "index.json"
+	archiveDayLayout   = "2006-01-02"
+	archiveImportBatch = 500
+	archiveLineMax     = 16 << 20
+
+	// archiveCommitLag is how long a document may take between getting its
+	// _id and becoming visible; newer documents wait for the next run.
+	archiveCommitLag = 5 * time.Minute
+)
+
+var (
+	archiveKinds         = map[string]bool{"events": true, "runtime": true, "backups": true, "live-devices": true}
+	archiveCollectionRe  = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	errArchiveDisabled   = errors.New("archive directory not configured")
+	errArchiveDayMissing = errors.New("no archive files for that day")
+	errArchiveInvalid    = errors.New("invalid archive import")
+)
+
+// archiver writes documents that are about to hit their TTL into
+// <dir>/<kind>/<YYYY-MM-DD>/part-*.ndjson.gz, partitioned by the document's
+// own UTC day, and keeps index.json describing every part plus per-kind
+// expireAt and _id watermarks so each run only picks up documents no earlier
+// run saw: newly expiring ones, and ones written since the last run with an
+// expireAt already below the watermark (late or backdated writes).
+// Lines are canonical extended JSON so ObjectIDs, dates and number types
+// survive a re-import.
+type archiver struct {
+	dir   string
+	kinds []string
+	mu    sync.Mutex
+}
+
+type archiveIndex struct {
+	Watermarks   map[string]time.Time          `json:"watermarks"`
+	IDWatermarks map[string]primitive.ObjectID `json:"idWatermarks,omitempty"`
+	Files        []archiveFile                 `json:"files"`
+}
+
+type archiveFile struct {
+	Kind      string    `json:"kind"`
+	Day       string    `json:"day"`
+	Path      string    `json:"path"`
+	Count     int       `json:"count"`
+	Bytes     int64     `json:"bytes"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Sources   []string  `json:"sources"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type archivePart struct {
+	file    archiveFile
+	tmpPath string
+	handle  *os.File
+	zipper  *gzip.Writer
+	out     *bufio.Writer
+	sources map[string]bool
+}
+
+func newArchiver(cfg Config) (*archiver, error) {
+	if cfg.ArchiveDir == "" {
+		return nil, nil
+	}
+	for _, kind := range cfg.ArchiveKinds {
+		if !archiveKinds[kind] {
+			return nil, fmt.Errorf("unknown OBSERVER_ARCHIVE_KINDS entry %q", kind)
+		}
+	}
+	if err := os.MkdirAll(cfg.ArchiveDir, 0o755); err != nil {
+		return nil, fmt.Errorf("create archive dir: %w", err)
+	}
+	return &archiver{dir: cfg.ArchiveDir, kinds: cfg.ArchiveKinds}, nil
+}
+
+func (s *service) runArchiver(ctx context.Context) {
+	if s.archive == nil || s.cfg.ArchiveIntervalMs <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(s.cfg.ArchiveIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if err := s.archiveExpiring(ctx, time.Now().UTC()); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("observer archiver error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archiveExpiring archives, per kind, every document whose expireAt falls
+// between the stored watermark and now plus the configured lead time.
+func (s *service) archiveExpiring(ctx context.Context, now time.Time) error {
+	s.archive.mu.Lock()
+	defer s.archive.mu.Unlock()
+
+	index, err := s.archive.loadIndex()
+	if err != nil {
+		return err
+	}
+	until := now.Add(time.Duration(s.cfg.ArchiveLeadHours) * time.Hour)
+	cut := primitive.NewObjectIDFromTimestamp(now.Add(-archiveCommitLag))
+	for _, kind := range s.archive.kinds {
+		spec, _ := s.exportSpec(kind)
+		files, err := s.archive.archiveKind(ctx, spec, archiveRange(index.Watermarks[kind], index.IDWatermarks[kind], until, cut), now)
+		if err != nil {
+			return fmt.Errorf("archive %s: %w", kind, err)
+		}
+		index.Files = append(index.Files, files...)
+		index.Watermarks[kind] = until
+		index.IDWatermarks[kind] = cut
+		if err := checkLease(ctx); err != nil {
+			return err
+		}
+		if err := s.archive.saveIndex(index); err != nil {
+			return err
+		}
+		if _, err := spec.col.UpdateMany(ctx, archivedPending(until, cut), bson.M{"$unset": bson.M{"archivePending": ""}}); err != nil {
+			return fmt.Errorf("archive %s: clear pending: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+// archiveRange selects what a run archives: documents expiring by until and
+// older than cut, minus what the previous run (watermarks from and fromID)
+// already covered, plus any a retention backfill flagged archivePending
+// because their expireAt moved behind the watermark. Indexes written before
+// _id watermarks existed only have from.
+func archiveRange(from time.Time, fromID primitive.ObjectID, until time.Time, cut primitive.ObjectID) bson.M {
+	filter := bson.M{"expireAt": bson.M{"$lte": until}, "_id": bson.M{"$lt": cut}}
+	pending := bson.M{"archivePending": true}
+	switch {
+	case from.IsZero():
+	case fromID.IsZero():
+		filter["$or"] = bson.A{bson.M{"expireAt": bson.M{"$gt": from}}, pending}
+	default:
+		filter["$or"] = bson.A{bson.M{"expireAt": bson.M{"$gt": from}}, bson.M{"_id": bson.M{"$gte": fromID}}, pending}
+	}
+	return filter
+}
+
+// archivedPending is the subset of archiveRange's flagged documents a run
+// has written, whose flag it clears once the index is saved.
+func archivedPending(until time.Time, cut primitive.ObjectID) bson.M {
+	return bson.M{"archivePending": true, "expireAt": bson.M{"$lte": until}, "_id": bson.M{"$lt": cut}}
+}
+
+func (a *archiver) archiveKind(ctx context.Context, spec exportSpec, filter bson.M, now time.Time) ([]archiveFile, error) {
+	cursor, err := spec.col.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "expireAt", Value: 1}, {Key: "_id", Value: 1}}).SetBatchSize(exportBatchSize),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	parts := map[string]*archivePart{}
+	abort := func(err error) ([]archiveFile, error) {
+		for _, part := range parts {
+			part.close()
+			os.Remove(part.tmpPath)
+		}
+		return nil, err
+	}
+
+	for cursor.Next(ctx) {
+		var row bson.M
+		if err := cursor.Decode(&row); err != nil {
+			return abort(err)
+		}
+		delete(row, "archivePending")
+		occurredAt := parseTime(row[spec.timeField])
+		day := occurredAt.Format(archiveDayLayout)
+		part := parts[day]
+		if part == nil {
+			part, err = a.openPart(spec.name, day, now)
+			if err != nil {
+				return abort(err)
+			}
+			parts[day] = part
+		}
+		line, err := bson.MarshalExtJSON(row, true, false)
+		if err != nil {
+			return abort(err)
+		}
+		if _, err := part.out.Write(line); err != nil {
+			return abort(err)
+		}
+		if err := part.out.WriteByte('\n'); err != nil {
+			return abort(err)
+		}
+		part.file.Count++
+		if part.file.From.IsZero() || occurredAt.Before(part.file.From) {
+			part.file.From = occurredAt
+		}
+		if occurredAt.After(part.file.To) {
+			part.file.To = occurredAt
+		}
+		if source := asString(row["source"]); source != "" {
+			part.sources[source] = true
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return abort(err)
+	}
+
+	files := make([]archiveFile, 0, len(parts))
+	for _, part := range parts {
+		if err := part.close(); err != nil {
+			return abort(err)
+		}
+	}
+	for _, part := range parts {
+		finalPath := filepath.Join(a.dir, part.file.Path)
+		if err := os.Rename(part.tmpPath, finalPath); err != nil {
+			return abort(err)
+		}
+		if info, err := os.Stat(finalPath); err == nil {
+			part.file.Bytes = info.Size()
+		}
+		part.file.Sources = make([]string, 0, len(part.sources))
+		for source := range part.sources {
+			part.file.Sources = append(part.file.Sources, source)
+		}
+		sort.Strings(part.file.Sources)
+		files = append(files, part.file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Day < files[j].Day })
+	return files, nil
+}
+
+func (a *archiver) openPart(kind, day string, now time.Time) (*archivePart, error) {
+	relative := filepath.Join(kind, day, fmt.Sprintf("part-%s.ndjson.gz", now.Format("20060102T150405Z")))
+	finalPath := filepath.Join(a.dir, relative)
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0o755); err != nil {
+		return nil, err
+	}
+	handle, err := os.Create(finalPath + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	zipper := gzip.NewWriter(handle)
+	return &archivePart{
+		file:    archiveFile{Kind: kind, Day: day, Path: filepath.ToSlash(relative), CreatedAt: now},
+		tmpPath: finalPath + ".tmp",
+		handle:  handle,
+		zipper:  zipper,
+		out:     bufio.NewWriterSize(zipper, 64<<10),
+		sources: map[string]bool{},
+	}, nil
+}
+
+func (p *archivePart) close() error {
+	if p.handle == nil {
+		return nil
+	}
+	err := p.out.Flush()
+	if closeErr := p.zipper.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := p.handle.Close(); err == nil {
+		err = closeErr
+	}
+	p.handle = nil
+	return err
+}
+
+func (a *archiver) loadIndex() (archiveIndex, error) {
+	index := archiveIndex{Watermarks: map[string]time.Time{}, IDWatermarks: map[string]primitive.ObjectID{}, Files: []archiveFile{}}
+	raw, err := os.ReadFile(filepath.Join(a.dir, archiveIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return index, err
+	}
+	if err := json.Unmarshal(raw, &index); err != nil {
+		return index, fmt.Errorf("read archive index: %w", err)
+	}
+	if index.Watermarks == nil {
+		index.Watermarks = map[string]time.Time{}
+	}
+	if index.IDWatermarks == nil {
+		index.IDWatermarks = map[string]primitive.ObjectID{}
+	}
+	return index, nil
+}
+
+func (a *archiver) saveIndex(index archiveIndex) error {
+	raw, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(a.dir, archiveIndexFile)
+	if err := os.WriteFile(target+".tmp", raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(target+".tmp", target)
+}
+
+// importDay restores every archived part for kind and day into target,
+// upserting by _id so repeated imports are harmless.
+func (a *archiver) importDay(ctx context.Context, db *mongo.Database, kind, day, target string, now time.Time) (string, int, error) {
+	if !archiveKinds[kind] {
+		return "", 0, fmt.Errorf("%w: unknown kind %q", errArchiveInvalid, kind)
+	}
+	if _, err := time.Parse(archiveDayLayout, day); err != nil {
+		return "", 0, fmt.Errorf("%w: day must be YYYY-MM-DD", errArchiveInvalid)
+	}
+	if target == "" {
+		target = fmt.Sprintf("observer_archive_%s_%s", strings.ReplaceAll(kind, "-", "_"), strings.ReplaceAll(day, "-", ""))
+	}
+	if !archiveCollectionRe.MatchString(target) || !strings.HasPrefix(target, "observer_archive_") {
+		return "", 0, fmt.Errorf("%w: collection must match observer_archive_[A-Za-z0-9_]+", errArchiveInvalid)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(a.dir, kind, day, "part-*.ndjson.gz"))
+	if err != nil {
+		return "", 0, err
+	}
+	if len(paths) == 0 {
+		return target, 0, errArchiveDayMissing
+	}
+	sort.Strings(paths)
+
+	col := db.Collection(target)
+	imported := 0
+	for _, path := range paths {
+		count, err := importArchivePart(ctx, col, path, now)
+		imported += count
+		if err != nil {
+			return target, imported, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+	}
+	return target, imported, nil
+}
+
+func importArchivePart(ctx context.Context, col *mongo.Collection, path string, now time.Time) (int, error) {
+	handle, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer handle.Close()
+	zipped, err := gzip.NewReader(handle)
+	if err != nil {
+		return 0, err
+	}
+	defer zipped.Close()
+
+	scanner := bufio.NewScanner(zipped)
+	scanner.Buffer(make([]byte, 0, 64<<10), archiveLineMax)
+	models := make([]mongo.WriteModel, 0, archiveImportBatch)
+	imported := 0
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		if _, err := col.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+		imported += len(models)
+		models = models[:0]
+		return nil
+	}
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var doc bson.M
+		if err := bson.UnmarshalExtJSON(line, true, &doc); err != nil {
+			return imported, err
+		}
+		doc["restoredAt"] = now
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": doc["_id"]}).SetReplacement(doc).SetUpsert(true))
+		if len(models) == archiveImportBatch {
+			if err := flush(); err != nil {
+				return imported, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return imported, err
+	}
+	return imported, flush()
+}
+
+func (s *service) listArchives(c *gin.Context) {
+	if s.archive == nil {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "message": "Archiving is disabled", "error": errArchiveDisabled.Error()})
+		return
+	}
+	s.archive.mu.Lock()
+	index, err := s.archive.loadIndex()
+	s.archive.mu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to read archive index", "error": err.Error()})
+		return
+	}
+	kind := strings.TrimSpace(c.Query("kind"))
+	day := strings.TrimSpace(c.Query("day"))
+	items := make([]archiveFile, 0, len(index.Files))
+	for _, file := range index.Files {
+		if (kind != "" && file.Kind != kind) || (day != "" && file.Day != day) {
+			continue
+		}
+		items = append(items, file)
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "watermarks": index.Watermarks, "items": items})
+}
+
+func (s *service) importArchive(c *gin.Context) {
+	if s.archive == nil {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "message": "Archiving is disabled", "error": errArchiveDisabled.Error()})
+		return
+	}
+	body, ok := bindJSONMap(c)
+	if !ok {
+		return
+	}
+	kind := strings.TrimSpace(asString(body["kind"]))
+	day := strings.TrimSpace(asString(body["day"]))
+	target, imported, err := s.archive.importDay(c.Request.Context(), s.db, kind, day, strings.TrimSpace(asString(body["collection"])), time.Now().UTC())
+	switch {
+	case errors.Is(err, errArchiveDayMissing):
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "message": "No archive for that day", "error": err.Error()})
+		return
+	case errors.Is(err, errArchiveInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid import request", "error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Import failed", "error": err.Error(), "collection": target, "imported": imported})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "collection": target, "imported": imported})
+}
+
+// RunArchiveImport is the command-line entry point behind
+// `observer archive-import [flags] <kind> <YYYY-MM-DD> [collection]`.
+func RunArchiveImport(ctx context.Context, args []string) error {
+	cfg, args, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("usage: observer archive-import [flags] <kind> <YYYY-MM-DD> [collection]")
+	}
+	if cfg.Storage != storageMongo {
+		return fmt.Errorf("archive-import needs OBSERVER_STORAGE=%s", storageMongo)
+	}
+	archive, err := newArchiver(cfg)
+	if err != nil {
+		return err
+	}
+	if archive == nil {
+		return errArchiveDisabled
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	client, db, err := mongox.Connect(connectCtx, cfg.MongoURI, cfg.MongoDatabase)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	target := ""
+	if len(args) == 3 {
+		target = args[2]
+	}
+	target, imported, err := archive.importDay(ctx, db, args[0], args[1], target, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	log.Printf("observer archive-import: restored %d %s documents for %s into %s", imported, args[0], args[1], target)
+	return nil
+}
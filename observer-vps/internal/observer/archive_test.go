@@ -0,0 +1,46 @@
+package observer
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestArchiveRangePicksUpLateWrites(t *testing.T) {
+	previousRun := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	thisRun := previousRun.Add(time.Hour)
+	lead := 12 * time.Hour
+	idAt := func(at time.Time) primitive.ObjectID { return primitive.NewObjectIDFromTimestamp(at) }
+	filter := archiveRange(previousRun.Add(lead), idAt(previousRun.Add(-archiveCommitLag)), thisRun.Add(lead), idAt(thisRun.Add(-archiveCommitLag)))
+
+	cases := []struct {
+		name     string
+		written  time.Time
+		expireAt time.Time
+		pending  bool
+		want     bool
+	}{
+		{"archived by the previous run", previousRun.Add(-time.Hour), previousRun.Add(time.Hour), false, false},
+		{"newly expiring", previousRun.Add(-time.Hour), thisRun.Add(lead - 30*time.Minute), false, true},
+		{"late write behind the watermark", previousRun.Add(10 * time.Minute), previousRun.Add(time.Hour), false, true},
+		{"inside the previous run's lag", previousRun.Add(-time.Minute), previousRun.Add(time.Hour), false, true},
+		{"inside this run's lag", thisRun.Add(-time.Minute), thisRun.Add(time.Hour), false, false},
+		{"beyond the lead", previousRun.Add(-time.Hour), thisRun.Add(lead + time.Hour), false, false},
+		{"shortened behind the watermark", previousRun.Add(-time.Hour), previousRun.Add(time.Hour), true, true},
+		{"shortened but beyond the lead", previousRun.Add(-time.Hour), thisRun.Add(lead + time.Hour), true, false},
+	}
+	for _, tc := range cases {
+		doc := bson.M{"_id": idAt(tc.written), "expireAt": tc.expireAt}
+		if tc.pending {
+			doc["archivePending"] = true
+		}
+		if got := matchDocument(doc, filter); got != tc.want {
+			t.Errorf("%s: matched = %v, want %v", tc.name, got, tc.want)
+		}
+		if cleared := matchDocument(doc, archivedPending(thisRun.Add(lead), idAt(thisRun.Add(-archiveCommitLag)))); cleared && !tc.want {
+			t.Errorf("%s: flag cleared without being archived", tc.name)
+		}
+	}
+}
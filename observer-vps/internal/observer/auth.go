@@ -18,16 +18,23 @@ type devicePrincipal struct {
 }
 
 func (s *service) requireReadKey() gin.HandlerFunc {
-	return s.requireExactKey(s.cfg.ReadAPIKey, "observer read")
+	return s.requireExactKey(func(cfg *Config) string { return cfg.ReadAPIKey }, "observer read")
 }
 
 func (s *service) requireIngestKey() gin.HandlerFunc {
-	return s.requireExactKey(s.cfg.APIKey, "observer ingest")
+	return s.requireExactKey(func(cfg *Config) string { return cfg.APIKey }, "observer ingest")
 }
 
-func (s *service) requireExactKey(expectedKey, label string) gin.HandlerFunc {
+func (s *service) requireAdminKey() gin.HandlerFunc {
+	return s.requireExactKey(func(cfg *Config) string { return cfg.AdminAPIKey }, "observer admin")
+}
+
+// requireExactKey looks the expected key up per request so a config reload
+// can rotate it without re-registering routes.
+func (s *service) requireExactKey(key func(*Config) string, label string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		providedKey := extractObserverKey(c)
+		expectedKey := key(s.settings())
 		if expectedKey == "" {
 			c.JSON(http.StatusServiceUnavailable, gin.H{
 				"ok":      false,
@@ -50,7 +57,7 @@ func (s *service) requireExactKey(expectedKey, label string) gin.HandlerFunc {
 
 func (s *service) requireDeviceIngestAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if providedKey := extractObserverKey(c); providedKey != "" && providedKey == s.cfg.APIKey {
+		if providedKey := extractObserverKey(c); providedKey != "" && providedKey == s.settings().APIKey {
 			c.Next()
 			return
 		}
@@ -81,7 +88,7 @@ func (s *service) requireDeviceIngestAuth() gin.HandlerFunc {
 }
 
 func (s *service) verifyDeviceToken(token string) (*devicePrincipal, error) {
-	if strings.TrimSpace(s.cfg.JWTSecret) == "" {
+	if strings.TrimSpace(s.settings().JWTSecret) == "" {
 		return nil, errors.New("Device bearer auth is not configured")
 	}
 
@@ -90,7 +97,7 @@ func (s *service) verifyDeviceToken(token string) (*devicePrincipal, error) {
 		if _, ok := parsed.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("Unsupported JWT signing method")
 		}
-		return []byte(s.cfg.JWTSecret), nil
+		return []byte(s.settings().JWTSecret), nil
 	})
 	if err != nil || parsed == nil || !parsed.Valid {
 		return nil, errors.New("Invalid device bearer token")
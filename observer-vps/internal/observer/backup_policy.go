@@ -0,0 +1,385 @@
+package observer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	backupFindingOverdue      = "overdue"
+	backupFindingTooSmall     = "too_small"
+	backupFindingFailedStreak = "failed_streak"
+
+	backupPolicyHistory = 30
+	backupMedianWindow  = 7
+)
+
+var defaultBackupSuccessStatuses = []string{"ok", "success", "succeeded", "completed", "done"}
+
+// backupFailureStatuses are the reported backup statuses that count as a
+// failure; anything else that is not a success (running, unknown) does not.
+var backupFailureStatuses = []string{"failed", "failure", "error", "errored", "aborted", "timeout"}
+
+type backupPolicy struct {
+	Source                  string   `bson:"source"`
+	Scope                   string   `bson:"scope"`
+	Enabled                 bool     `bson:"enabled"`
+	ExpectedIntervalMinutes int      `bson:"expectedIntervalMinutes"`
+	GraceMinutes            int      `bson:"graceMinutes"`
+	MinSizeBytes            int64    `bson:"minSizeBytes"`
+	SizeDropRatio           float64  `bson:"sizeDropRatio"`
+	RequiredStatuses        []string `bson:"requiredStatuses"`
+	FailedStreakThreshold   int      `bson:"failedStreakThreshold"`
+}
+
+type backupFinding struct {
+	Kind     string    `json:"kind"`
+	Severity string    `json:"severity"`
+	Source   string    `json:"source"`
+	Scope    string    `json:"scope"`
+	Message  string    `json:"message"`
+	Details  gin.H     `json:"details"`
+	At       time.Time `json:"detectedAt"`
+}
+
+func (p backupPolicy) isSuccess(status string) bool {
+	statuses := p.RequiredStatuses
+	if len(statuses) == 0 {
+		statuses = defaultBackupSuccessStatuses
+	}
+	for _, candidate := range statuses {
+		if strings.EqualFold(candidate, status) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p backupPolicy) view() gin.H {
+	return gin.H{
+		"source":                  p.Source,
+		"scope":                   p.Scope,
+		"enabled":                 p.Enabled,
+		"expectedIntervalMinutes": p.ExpectedIntervalMinutes,
+		"graceMinutes":            p.GraceMinutes,
+		"minSizeBytes":            p.MinSizeBytes,
+		"sizeDropRatio":           p.SizeDropRatio,
+		"requiredStatuses":        p.RequiredStatuses,
+		"failedStreakThreshold":   p.FailedStreakThreshold,
+	}
+}
+
+func (s *service) listBackupPolicies(c *gin.Context) {
+	policies, err := s.loadBackupPolicies(c.Request.Context(), strings.TrimSpace(c.Query("source")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load backup policies", "error": err.Error()})
+		return
+	}
+	items := make([]gin.H, 0, len(policies))
+	for _, policy := range policies {
+		items = append(items, policy.view())
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "items": items})
+}
+
+func (s *service) upsertBackupPolicy(c *gin.Context) {
+	body, ok := bindJSONMap(c)
+	if !ok {
+		return
+	}
+	policy, err := parseBackupPolicy(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": err.Error()})
+		return
+	}
+	now := time.Now().UTC()
+	if _, err := s.backupPolicies.UpdateOne(
+		c.Request.Context(),
+		bson.M{"source": policy.Source, "scope": policy.Scope},
+		bson.M{
+			"$set": bson.M{
+				"enabled":                 policy.Enabled,
+				"expectedIntervalMinutes": policy.ExpectedIntervalMinutes,
+				"graceMinutes":            policy.GraceMinutes,
+				"minSizeBytes":            policy.MinSizeBytes,
+				"sizeDropRatio":           policy.SizeDropRatio,
+				"requiredStatuses":        policy.RequiredStatuses,
+				"failedStreakThreshold":   policy.FailedStreakThreshold,
+				"updatedAt":               now,
+			},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true),
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to save backup policy", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "policy": policy.view()})
+}
+
+func (s *service) deleteBackupPolicy(c *gin.Context) {
+	source := strings.TrimSpace(c.Query("source"))
+	scope := strings.TrimSpace(c.Query("scope"))
+	if source == "" || scope == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "source and scope are required"})
+		return
+	}
+	result, err := s.backupPolicies.DeleteOne(c.Request.Context(), bson.M{"source": source, "scope": scope})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to delete backup policy", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "deleted": result.DeletedCount})
+}
+
+func (s *service) listBackupFindings(c *gin.Context) {
+	now := time.Now().UTC()
+	findings, err := s.evaluateBackupPolicies(c.Request.Context(), strings.TrimSpace(c.Query("source")), now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to evaluate backup policies", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "items": findings, "evaluatedAt": now})
+}
+
+func parseBackupPolicy(body map[string]any) (backupPolicy, error) {
+	policy := backupPolicy{
+		Source:           strings.TrimSpace(asString(body["source"])),
+		Scope:            strings.TrimSpace(asString(body["scope"])),
+		Enabled:          body["enabled"] == nil || asBool(body["enabled"]),
+		RequiredStatuses: normalizeStringList(body["requiredStatuses"]),
+	}
+	// An absent graceMinutes is derived from the interval below; an explicit
+	// 0 means no grace at all.
+	for _, field := range []struct {
+		key      string
+		target   *int
+		fallback int
+	}{
+		{"expectedIntervalMinutes", &policy.ExpectedIntervalMinutes, 24 * 60},
+		{"graceMinutes", &policy.GraceMinutes, -1},
+		{"failedStreakThreshold", &policy.FailedStreakThreshold, 2},
+	} {
+		value, err := wholeNumber(body[field.key], field.fallback)
+		if err != nil {
+			return policy, fmt.Errorf("%s %v", field.key, err)
+		}
+		*field.target = value
+	}
+	minSize, err := nonNegativeNumber(body["minSizeBytes"], 0)
+	if err == nil && minSize != math.Trunc(minSize) {
+		err = fmt.Errorf("must be a whole number, got %v", body["minSizeBytes"])
+	}
+	if err != nil {
+		return policy, fmt.Errorf("minSizeBytes %v", err)
+	}
+	policy.MinSizeBytes = int64(minSize)
+	if policy.SizeDropRatio, err = nonNegativeNumber(body["sizeDropRatio"], 0.5); err != nil {
+		return policy, fmt.Errorf("sizeDropRatio %v", err)
+	}
+	switch {
+	case policy.Source == "" || policy.Scope == "":
+		return policy, errors.New("source and scope are required")
+	case policy.ExpectedIntervalMinutes <= 0:
+		return policy, errors.New("expectedIntervalMinutes must be positive")
+	case body["graceMinutes"] != nil && policy.GraceMinutes < 0:
+		return policy, errors.New("graceMinutes must not be negative")
+	case policy.SizeDropRatio <= 0 || policy.SizeDropRatio >= 1:
+		return policy, errors.New("sizeDropRatio must be between 0 and 1")
+	case policy.FailedStreakThreshold <= 0:
+		return policy, errors.New("failedStreakThreshold must be positive")
+	}
+	if policy.GraceMinutes < 0 {
+		policy.GraceMinutes = maxInt(policy.ExpectedIntervalMinutes/10, 15)
+	}
+	for index, status := range policy.RequiredStatuses {
+		policy.RequiredStatuses[index] = strings.ToLower(status)
+	}
+	return policy, nil
+}
+
+// wholeNumber reads an integer setting from a JSON body, where numbers
+// arrive as float64; missing values use fallback and fractions are errors.
+func wholeNumber(value any, fallback int) (int, error) {
+	if value == nil {
+		return fallback, nil
+	}
+	if normalizeNumber(value) == nil {
+		return 0, fmt.Errorf("must be a number, got %v", value)
+	}
+	number := asFloat(value)
+	if number != math.Trunc(number) || math.Abs(number) > math.MaxInt32 {
+		return 0, fmt.Errorf("must be a whole number, got %v", value)
+	}
+	return int(number), nil
+}
+
+// nonNegativeNumber reads an optional non-negative setting from a JSON body;
+// missing values use fallback.
+func nonNegativeNumber(value any, fallback float64) (float64, error) {
+	if value == nil {
+		return fallback, nil
+	}
+	if normalizeNumber(value) == nil {
+		return 0, fmt.Errorf("must be a number, got %v", value)
+	}
+	number := asFloat(value)
+	if number < 0 || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("must not be negative, got %v", value)
+	}
+	return number, nil
+}
+
+func (s *service) loadBackupPolicies(ctx context.Context, source string) ([]backupPolicy, error) {
+	filter := bson.M{}
+	if source != "" {
+		filter["source"] = source
+	}
+	cursor, err := s.backupPolicies.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "source", Value: 1}, {Key: "scope", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var policies []backupPolicy
+	if err := cursor.All(ctx, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// evaluateBackupPolicies checks every enabled policy against the most recent
+// snapshots for its source and scope.
+func (s *service) evaluateBackupPolicies(ctx context.Context, source string, now time.Time) ([]backupFinding, error) {
+	policies, err := s.loadBackupPolicies(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	findings := make([]backupFinding, 0)
+	for _, policy := range policies {
+		if !policy.Enabled {
+			continue
+		}
+		rows, err := s.store.backups.find(ctx, findQuery{
+			filter:     bson.M{"source": policy.Source, "scope": policy.Scope},
+			sort:       bson.D{{Key: "capturedAt", Value: -1}, {Key: "_id", Value: -1}},
+			limit:      backupPolicyHistory,
+			projection: bson.M{"status": 1, "capturedAt": 1, "sizeBytes": 1},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("load backups for %s/%s: %w", policy.Source, policy.Scope, err)
+		}
+		findings = append(findings, checkBackupPolicy(policy, rows, now)...)
+	}
+	return findings, nil
+}
+
+// checkBackupPolicy expects rows newest first.
+func checkBackupPolicy(policy backupPolicy, rows []bson.M, now time.Time) []backupFinding {
+	findings := make([]backupFinding, 0)
+	newFinding := func(kind, severity, message string, details gin.H) {
+		findings = append(findings, backupFinding{
+			Kind:     kind,
+			Severity: severity,
+			Source:   policy.Source,
+			Scope:    policy.Scope,
+			Message:  message,
+			Details:  details,
+			At:       now,
+		})
+	}
+
+	successes := make([]bson.M, 0, len(rows))
+	for _, row := range rows {
+		if policy.isSuccess(asString(row["status"])) {
+			successes = append(successes, row)
+		}
+	}
+
+	deadline := time.Duration(policy.ExpectedIntervalMinutes+policy.GraceMinutes) * time.Minute
+	if len(successes) == 0 {
+		newFinding(backupFindingOverdue, "error", "No successful backup on record", gin.H{
+			"expectedIntervalMinutes": policy.ExpectedIntervalMinutes,
+			"lastSuccessAt":           nil,
+		})
+	} else {
+		lastSuccessAt := parseTime(successes[0]["capturedAt"])
+		if age := now.Sub(lastSuccessAt); age > deadline {
+			newFinding(backupFindingOverdue, "error", fmt.Sprintf("Last successful backup was %s ago", age.Round(time.Minute)), gin.H{
+				"expectedIntervalMinutes": policy.ExpectedIntervalMinutes,
+				"graceMinutes":            policy.GraceMinutes,
+				"lastSuccessAt":           lastSuccessAt,
+				"overdueByMinutes":        int((age - deadline).Minutes()),
+			})
+		}
+
+		latestSize := asFloat(successes[0]["sizeBytes"])
+		if policy.MinSizeBytes > 0 && latestSize < float64(policy.MinSizeBytes) {
+			newFinding(backupFindingTooSmall, "error", "Latest backup is below the minimum size", gin.H{
+				"sizeBytes":    latestSize,
+				"minSizeBytes": policy.MinSizeBytes,
+				"capturedAt":   successes[0]["capturedAt"],
+			})
+		} else if len(successes) > 1 {
+			trailing := make([]float64, 0, backupMedianWindow)
+			for _, row := range successes[1:minInt(len(successes), backupMedianWindow+1)] {
+				if size := asFloat(row["sizeBytes"]); size > 0 {
+					trailing = append(trailing, size)
+				}
+			}
+			if median := medianFloat(trailing); median > 0 && latestSize < median*(1-policy.SizeDropRatio) {
+				newFinding(backupFindingTooSmall, "warn", "Latest backup is much smaller than the trailing median", gin.H{
+					"sizeBytes":       latestSize,
+					"trailingMedian":  median,
+					"trailingSamples": len(trailing),
+					"sizeDropRatio":   policy.SizeDropRatio,
+					"capturedAt":      successes[0]["capturedAt"],
+				})
+			}
+		}
+	}
+
+	// Runs still in progress or with an unknown status neither extend nor
+	// break the streak.
+	streak := 0
+	for _, row := range rows {
+		status := asString(row["status"])
+		if policy.isSuccess(status) {
+			break
+		}
+		if containsString(backupFailureStatuses, strings.ToLower(status)) {
+			streak++
+		}
+	}
+	if streak >= policy.FailedStreakThreshold {
+		newFinding(backupFindingFailedStreak, "error", fmt.Sprintf("%d backups in a row failed", streak), gin.H{
+			"streak":      streak,
+			"threshold":   policy.FailedStreakThreshold,
+			"lastStatus":  asString(rows[0]["status"]),
+			"lastAttempt": rows[0]["capturedAt"],
+		})
+	}
+	return findings
+}
+
+func medianFloat(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,84 @@
+package observer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseBackupPolicyReadsWholeNumbers(t *testing.T) {
+	policy, err := parseBackupPolicy(map[string]any{"source": "api", "scope": "mongodb", "expectedIntervalMinutes": float64(1000000)})
+	if err != nil || policy.ExpectedIntervalMinutes != 1000000 {
+		t.Fatalf("policy = %+v (%v), want the large interval kept", policy, err)
+	}
+	for _, value := range []any{1.5, "soon"} {
+		_, err := parseBackupPolicy(map[string]any{"source": "api", "scope": "mongodb", "graceMinutes": value})
+		if err == nil || !strings.Contains(err.Error(), "graceMinutes") {
+			t.Errorf("graceMinutes %v: err = %v, want it rejected", value, err)
+		}
+	}
+}
+
+func TestParseBackupPolicyValidatesSizeAndGrace(t *testing.T) {
+	parse := func(extra map[string]any) (backupPolicy, error) {
+		body := map[string]any{"source": "api", "scope": "mongodb", "expectedIntervalMinutes": float64(600)}
+		for key, value := range extra {
+			body[key] = value
+		}
+		return parseBackupPolicy(body)
+	}
+
+	policy, err := parse(nil)
+	if err != nil || policy.GraceMinutes != 60 || policy.SizeDropRatio != 0.5 || policy.MinSizeBytes != 0 {
+		t.Fatalf("defaults = %+v (%v), want 60 grace minutes and a 0.5 drop ratio", policy, err)
+	}
+	policy, err = parse(map[string]any{"graceMinutes": float64(0), "minSizeBytes": float64(5 << 30), "sizeDropRatio": 0.25})
+	if err != nil || policy.GraceMinutes != 0 || policy.MinSizeBytes != 5<<30 || policy.SizeDropRatio != 0.25 {
+		t.Fatalf("policy = %+v (%v), want an explicit 0 grace kept and the sizes read", policy, err)
+	}
+
+	for _, tc := range []struct {
+		key   string
+		value any
+	}{
+		{"graceMinutes", float64(-5)},
+		{"minSizeBytes", "large"},
+		{"minSizeBytes", float64(-1)},
+		{"minSizeBytes", 1.5},
+		{"sizeDropRatio", "half"},
+		{"sizeDropRatio", -0.5},
+		{"sizeDropRatio", float64(0)},
+		{"sizeDropRatio", float64(1)},
+	} {
+		if _, err := parse(map[string]any{tc.key: tc.value}); err == nil || !strings.Contains(err.Error(), tc.key) {
+			t.Errorf("%s %v: err = %v, want it rejected", tc.key, tc.value, err)
+		}
+	}
+}
+
+func TestCheckBackupPolicyCountsOnlyFailedRuns(t *testing.T) {
+	now := time.Now().UTC()
+	policy := backupPolicy{Source: "api", Scope: "mongodb", ExpectedIntervalMinutes: 60, GraceMinutes: 15, SizeDropRatio: 0.5, FailedStreakThreshold: 2}
+	rows := []bson.M{
+		{"status": "running", "capturedAt": now},
+		{"status": "failed", "capturedAt": now.Add(-time.Hour)},
+		{"status": "unknown", "capturedAt": now.Add(-2 * time.Hour)},
+		{"status": "ok", "capturedAt": now.Add(-3 * time.Hour)},
+	}
+	for _, finding := range checkBackupPolicy(policy, rows, now) {
+		if finding.Kind == backupFindingFailedStreak {
+			t.Fatalf("finding = %+v, want no streak from one failure", finding)
+		}
+	}
+
+	rows[0]["status"] = "timeout"
+	found := false
+	for _, finding := range checkBackupPolicy(policy, rows, now) {
+		found = found || (finding.Kind == backupFindingFailedStreak && finding.Details["streak"] == 2)
+	}
+	if !found {
+		t.Error("want a failed_streak of 2 once the latest run times out")
+	}
+}
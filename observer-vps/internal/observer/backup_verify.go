@@ -0,0 +1,537 @@
+package observer
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	verificationVerified    = "verified"
+	verificationFailed      = "failed"
+	verificationPartial     = "partial"
+	verificationUnreachable = "unreachable"
+	verificationSkipped     = "skipped"
+	verificationUnverified  = "unverified"
+
+	backupVerifyBatch      = 20
+	backupVerifyRetryAfter = time.Hour
+	backupManifestMaxBytes = 4 << 20
+)
+
+type backupArtifact struct {
+	name             string
+	location         string
+	expectedSize     int64
+	expectedChecksum string
+}
+
+type artifactResult struct {
+	Name             string `bson:"name" json:"name"`
+	Location         string `bson:"location" json:"location"`
+	Status           string `bson:"status" json:"status"`
+	Message          string `bson:"message,omitempty" json:"message,omitempty"`
+	ExpectedSize     int64  `bson:"expectedSize,omitempty" json:"expectedSize,omitempty"`
+	ActualSize       int64  `bson:"actualSize,omitempty" json:"actualSize,omitempty"`
+	ExpectedChecksum string `bson:"expectedChecksum,omitempty" json:"expectedChecksum,omitempty"`
+	ActualChecksum   string `bson:"actualChecksum,omitempty" json:"actualChecksum,omitempty"`
+}
+
+// errBackupPathRefused and errBackupHostRefused mark a location the verifier
+// will not read because it lies outside the configured root or hosts.
+var (
+	errBackupPathRefused = errors.New("local path is outside OBSERVER_BACKUP_VERIFY_ROOT")
+	errBackupHostRefused = errors.New("host is not in OBSERVER_BACKUP_VERIFY_HOSTS")
+)
+
+// backupVerifier fetches manifests for completed backups and checks the
+// artifacts they list. Manifests and artifacts may be local paths, file://
+// URLs or http(s) URLs; anything else is recorded as skipped. Local reads are
+// confined to root and remote ones to hosts, including redirects; either is
+// refused entirely when its setting is empty. Each fetch gets its own timeout.
+type backupVerifier struct {
+	client  *http.Client
+	timeout time.Duration
+	root    string
+	hosts   map[string]bool
+}
+
+func newBackupVerifier(cfg Config) *backupVerifier {
+	root := ""
+	if cfg.BackupVerifyRoot != "" {
+		root = filepath.Clean(cfg.BackupVerifyRoot)
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			root = resolved
+		}
+	}
+	v := &backupVerifier{
+		timeout: time.Duration(cfg.BackupVerifyTimeoutMs) * time.Millisecond,
+		root:    root,
+		hosts:   map[string]bool{},
+	}
+	for _, host := range cfg.BackupVerifyHosts {
+		v.hosts[strings.ToLower(host)] = true
+	}
+	v.client = &http.Client{
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return v.allowHost(request.URL)
+		},
+	}
+	return v
+}
+
+func (s *service) runBackupVerifier(ctx context.Context) {
+	if s.cfg.BackupVerifyIntervalMs <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(s.cfg.BackupVerifyIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if err := s.verifyPendingBackups(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("observer backup verifier error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// verifyPendingBackups picks up successful backups that were never checked,
+// plus unreachable ones whose last attempt is old enough to retry.
+func (s *service) verifyPendingBackups(ctx context.Context) error {
+	now := time.Now().UTC()
+	cursor, err := s.backups.Find(
+		ctx,
+		bson.M{
+			"status": bson.M{"$in": defaultBackupSuccessStatuses},
+			"$or": bson.A{
+				bson.M{"verificationStatus": bson.M{"$exists": false}},
+				bson.M{"verificationStatus": verificationUnreachable, "verifiedAt": bson.M{"$lt": now.Add(-backupVerifyRetryAfter)}},
+			},
+		},
+		options.Find().SetSort(bson.D{{Key: "capturedAt", Value: -1}}).SetLimit(backupVerifyBatch),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	var rows []bson.M
+	if err := cursor.All(ctx, &rows); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.verifyBackup(ctx, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) verifyBackup(ctx context.Context, row bson.M) error {
+	status, message, artifacts := s.verifier.verify(ctx, asString(row["manifestUrl"]), asString(row["checksum"]), int64(asFloat(row["sizeBytes"])))
+	now := time.Now().UTC()
+	set := bson.M{
+		"verificationStatus": status,
+		"verifiedAt":         now,
+		"verification": bson.M{
+			"status":    status,
+			"message":   message,
+			"checkedAt": now,
+			"artifacts": artifacts,
+		},
+		"updatedAt": now,
+	}
+	if err := checkLease(ctx); err != nil {
+		return err
+	}
+	if _, err := s.backups.UpdateOne(ctx, bson.M{"_id": row["_id"]}, bson.M{"$set": set}); err != nil {
+		return err
+	}
+	s.changes.notifyUpsert(ctx, changeTopicBackups, row, set)
+	return nil
+}
+
+func (s *service) verifyBackupNow(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(strings.TrimSpace(c.Param("id")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid backup id"})
+		return
+	}
+	var row bson.M
+	if err := s.backups.FindOne(c.Request.Context(), bson.M{"_id": id}).Decode(&row); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"ok": false, "message": "Backup not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load backup", "error": err.Error()})
+		return
+	}
+	if err := s.verifyBackup(c.Request.Context(), row); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to save verification", "error": err.Error()})
+		return
+	}
+	if err := s.backups.FindOne(c.Request.Context(), bson.M{"_id": id}).Decode(&row); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to reload backup", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "id": id.Hex(), "verification": toMap(row["verification"])})
+}
+
+// verify returns the overall status, a short message and per-artifact results.
+// A manifest that is not JSON is treated as the backup artifact itself and is
+// checked against the snapshot's own checksum and sizeBytes.
+func (v *backupVerifier) verify(ctx context.Context, manifestURL, checksum string, sizeBytes int64) (string, string, []artifactResult) {
+	if strings.TrimSpace(manifestURL) == "" {
+		return verificationSkipped, "no manifestUrl on snapshot", []artifactResult{}
+	}
+	if !verifiableLocation(manifestURL) {
+		return verificationSkipped, "unsupported manifest location", []artifactResult{}
+	}
+
+	head, err := v.readPrefix(ctx, manifestURL, backupManifestMaxBytes)
+	if backupLocationRefused(err) {
+		return verificationSkipped, err.Error(), []artifactResult{}
+	}
+	if err != nil {
+		return verificationUnreachable, err.Error(), []artifactResult{}
+	}
+	artifacts, isManifest := parseBackupManifest(head, manifestURL)
+	if !isManifest {
+		artifacts = []backupArtifact{{
+			name:             filepath.Base(manifestURL),
+			location:         manifestURL,
+			expectedSize:     sizeBytes,
+			expectedChecksum: checksum,
+		}}
+	}
+	if len(artifacts) == 0 {
+		return verificationFailed, "manifest lists no artifacts", []artifactResult{}
+	}
+
+	results := make([]artifactResult, 0, len(artifacts))
+	counts := map[string]int{}
+	for _, artifact := range artifacts {
+		result := v.checkArtifact(ctx, artifact)
+		counts[result.Status]++
+		results = append(results, result)
+	}
+
+	switch {
+	case counts[verificationFailed] > 0:
+		return verificationFailed, fmt.Sprintf("%d of %d artifacts failed verification", counts[verificationFailed], len(results)), results
+	case counts[verificationVerified] == len(results):
+		return verificationVerified, fmt.Sprintf("%d artifacts verified", len(results)), results
+	case counts[verificationVerified] > 0:
+		return verificationPartial, fmt.Sprintf("%d of %d artifacts verified", counts[verificationVerified], len(results)), results
+	default:
+		return verificationUnreachable, "no artifact could be checked", results
+	}
+}
+
+func (v *backupVerifier) checkArtifact(ctx context.Context, artifact backupArtifact) artifactResult {
+	result := artifactResult{
+		Name:             artifact.name,
+		Location:         artifact.location,
+		ExpectedSize:     artifact.expectedSize,
+		ExpectedChecksum: artifact.expectedChecksum,
+	}
+	if !verifiableLocation(artifact.location) {
+		result.Status = verificationSkipped
+		result.Message = "unsupported artifact location"
+		return result
+	}
+
+	algorithm, expectedDigest := splitChecksum(artifact.expectedChecksum)
+	var hasher hash.Hash
+	if expectedDigest != "" {
+		hasher = newChecksumHash(algorithm)
+		if hasher == nil {
+			result.Status = verificationSkipped
+			result.Message = "unsupported checksum algorithm " + algorithm
+			return result
+		}
+	}
+
+	body, err := v.open(ctx, artifact.location)
+	if backupLocationRefused(err) {
+		result.Status = verificationSkipped
+		result.Message = err.Error()
+		return result
+	}
+	if err != nil {
+		result.Status = verificationUnreachable
+		result.Message = err.Error()
+		return result
+	}
+	defer body.Close()
+
+	writer := io.Discard
+	if hasher != nil {
+		writer = hasher
+	}
+	size, err := io.Copy(writer, body)
+	if err != nil {
+		result.Status = verificationUnreachable
+		result.Message = err.Error()
+		return result
+	}
+	result.ActualSize = size
+	actualDigest := ""
+	if hasher != nil {
+		actualDigest = hex.EncodeToString(hasher.Sum(nil))
+		result.ActualChecksum = algorithm + ":" + actualDigest
+	}
+
+	switch {
+	case artifact.expectedSize > 0 && size != artifact.expectedSize:
+		result.Status = verificationFailed
+		result.Message = fmt.Sprintf("size mismatch: expected %d, got %d", artifact.expectedSize, size)
+	case hasher != nil && !strings.EqualFold(actualDigest, expectedDigest):
+		result.Status = verificationFailed
+		result.Message = "checksum mismatch"
+	case artifact.expectedSize <= 0 && hasher == nil:
+		result.Status = verificationSkipped
+		result.Message = "nothing to verify: no size or checksum listed"
+	default:
+		result.Status = verificationVerified
+	}
+	return result
+}
+
+func (v *backupVerifier) readPrefix(ctx context.Context, location string, limit int64) ([]byte, error) {
+	body, err := v.open(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(io.LimitReader(body, limit))
+}
+
+// open starts one fetch; its timeout runs until the body is closed.
+func (v *backupVerifier) open(ctx context.Context, location string) (io.ReadCloser, error) {
+	if isHTTPLocation(location) {
+		parsed, err := url.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		if err := v.allowHost(parsed); err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(ctx, v.timeout)
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		response, err := v.client.Do(request)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			cancel()
+			return nil, fmt.Errorf("GET %s: %s", location, response.Status)
+		}
+		return cancelOnClose{ReadCloser: response.Body, cancel: cancel}, nil
+	}
+	path, err := v.localFile(location)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// localFile maps a local location to a path under root. Backup reports are
+// ingested from clients, so the path is checked once as written and again
+// after resolving symlinks.
+func (v *backupVerifier) localFile(location string) (string, error) {
+	if v.root == "" {
+		return "", errBackupPathRefused
+	}
+	path := filepath.Clean(localPath(location))
+	if !withinDir(v.root, path) {
+		return "", errBackupPathRefused
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !withinDir(v.root, resolved) {
+		return "", errBackupPathRefused
+	}
+	return resolved, nil
+}
+
+// allowHost accepts a URL whose host, or host:port, is listed in hosts.
+func (v *backupVerifier) allowHost(target *url.URL) error {
+	if v.hosts[strings.ToLower(target.Hostname())] || v.hosts[strings.ToLower(target.Host)] {
+		return nil
+	}
+	return errBackupHostRefused
+}
+
+func backupLocationRefused(err error) bool {
+	return errors.Is(err, errBackupPathRefused) || errors.Is(err, errBackupHostRefused)
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// parseBackupManifest accepts {"artifacts": [...]} or {"files": [...]} where
+// each entry names a path or url plus optional size and checksum. Relative
+// entries resolve against the manifest's own location.
+func parseBackupManifest(raw []byte, manifestURL string) ([]backupArtifact, bool) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, false
+	}
+	var manifest map[string]any
+	if err := json.Unmarshal(trimmed, &manifest); err != nil {
+		return nil, false
+	}
+	entries := firstSlice(manifest["artifacts"], manifest["files"])
+	artifacts := make([]backupArtifact, 0, len(entries))
+	for _, entry := range entries {
+		item := toMap(entry)
+		location := firstString(item["url"], item["path"], item["file"])
+		if location == "" {
+			continue
+		}
+		artifacts = append(artifacts, backupArtifact{
+			name:             firstString(item["name"], filepath.Base(location)),
+			location:         resolveArtifactLocation(manifestURL, location),
+			expectedSize:     int64(asFloat(firstNonNil(item["sizeBytes"], item["size"]))),
+			expectedChecksum: firstString(item["checksum"], prefixedChecksum("sha256", item["sha256"]), prefixedChecksum("md5", item["md5"])),
+		})
+	}
+	return artifacts, true
+}
+
+func resolveArtifactLocation(manifestURL, location string) string {
+	if isHTTPLocation(location) || strings.HasPrefix(location, "file://") || filepath.IsAbs(location) {
+		return location
+	}
+	if isHTTPLocation(manifestURL) {
+		base, err := url.Parse(manifestURL)
+		if err != nil {
+			return location
+		}
+		ref, err := url.Parse(location)
+		if err != nil {
+			return location
+		}
+		return base.ResolveReference(ref).String()
+	}
+	return filepath.Join(filepath.Dir(localPath(manifestURL)), location)
+}
+
+func verifiableLocation(location string) bool {
+	return isHTTPLocation(location) || strings.HasPrefix(location, "file://") || filepath.IsAbs(location)
+}
+
+func isHTTPLocation(location string) bool {
+	lowered := strings.ToLower(location)
+	return strings.HasPrefix(lowered, "http://") || strings.HasPrefix(lowered, "https://")
+}
+
+func localPath(location string) string {
+	if strings.HasPrefix(location, "file://") {
+		if parsed, err := url.Parse(location); err == nil {
+			return parsed.Path
+		}
+	}
+	return location
+}
+
+// splitChecksum accepts "algo:hex" or bare hex, inferring the algorithm
+// from the digest length.
+func splitChecksum(checksum string) (string, string) {
+	checksum = strings.TrimSpace(checksum)
+	if checksum == "" {
+		return "", ""
+	}
+	if algorithm, digest, found := strings.Cut(checksum, ":"); found {
+		return strings.ToLower(strings.ReplaceAll(algorithm, "-", "")), strings.ToLower(digest)
+	}
+	switch len(checksum) {
+	case 32:
+		return "md5", strings.ToLower(checksum)
+	case 40:
+		return "sha1", strings.ToLower(checksum)
+	case 128:
+		return "sha512", strings.ToLower(checksum)
+	default:
+		return "sha256", strings.ToLower(checksum)
+	}
+}
+
+func newChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
+
+func prefixedChecksum(algorithm string, value any) string {
+	if digest := strings.TrimSpace(asString(value)); digest != "" {
+		return algorithm + ":" + digest
+	}
+	return ""
+}
@@ -0,0 +1,167 @@
+package observer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestVerifier(root string, hosts ...string) *backupVerifier {
+	return newBackupVerifier(Config{BackupVerifyTimeoutMs: 5000, BackupVerifyRoot: root, BackupVerifyHosts: hosts})
+}
+
+func writeBackupFile(t *testing.T, path, content string) string {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestBackupVerifierChecksArtifactChecksums(t *testing.T) {
+	root := t.TempDir()
+	good := writeBackupFile(t, filepath.Join(root, "dump.gz"), "mongo dump")
+	writeBackupFile(t, filepath.Join(root, "oplog.gz"), "tampered oplog")
+	manifest := filepath.Join(root, "manifest.json")
+	writeBackupFile(t, manifest, `{"artifacts":[
+		{"path":"dump.gz","sizeBytes":10,"checksum":"`+good+`"},
+		{"path":"oplog.gz","sha256":"`+strings.Repeat("0", 64)+`"}
+	]}`)
+	ctx := context.Background()
+	verifier := newTestVerifier(root)
+
+	status, message, results := verifier.verify(ctx, manifest, "", 0)
+	if status != verificationFailed || message != "1 of 2 artifacts failed verification" {
+		t.Fatalf("verify = %s %q, want one failed artifact", status, message)
+	}
+	if results[0].Status != verificationVerified || results[0].ActualChecksum != good {
+		t.Errorf("dump = %+v, want verified", results[0])
+	}
+	if results[1].Status != verificationFailed || results[1].Message != "checksum mismatch" {
+		t.Errorf("oplog = %+v, want a checksum mismatch", results[1])
+	}
+
+	status, _, results = verifier.verify(ctx, "file://"+filepath.Join(root, "dump.gz"), good, 10)
+	if status != verificationVerified || len(results) != 1 {
+		t.Errorf("plain artifact = %s %+v, want verified against the snapshot checksum", status, results)
+	}
+	if status, _, _ = verifier.verify(ctx, filepath.Join(root, "dump.gz"), good, 11); status != verificationFailed {
+		t.Errorf("size mismatch = %s, want failed", status)
+	}
+}
+
+func TestBackupVerifierConfinesLocalPaths(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	secret := writeBackupFile(t, filepath.Join(outside, "secret"), "not a backup")
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "link.gz")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	manifest := filepath.Join(root, "manifest.json")
+	writeBackupFile(t, manifest, `{"artifacts":[
+		{"path":"../`+filepath.Base(outside)+`/secret","checksum":"`+secret+`"},
+		{"path":"`+filepath.Join(outside, "secret")+`","checksum":"`+secret+`"},
+		{"path":"link.gz","checksum":"`+secret+`"}
+	]}`)
+	ctx := context.Background()
+
+	status, _, results := newTestVerifier(root).verify(ctx, manifest, "", 0)
+	if status != verificationUnreachable || len(results) != 3 {
+		t.Fatalf("verify = %s %+v, want every artifact refused", status, results)
+	}
+	for _, result := range results {
+		if result.Status != verificationSkipped || result.ActualSize != 0 || result.Message != errBackupPathRefused.Error() {
+			t.Errorf("%s = %+v, want skipped without reading", result.Location, result)
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		root     string
+		location string
+	}{
+		"manifest outside root": {root: root, location: filepath.Join(outside, "secret")},
+		"file url outside root": {root: root, location: "file://" + filepath.Join(root, "..", filepath.Base(outside), "secret")},
+		"no root configured":    {root: "", location: manifest},
+	} {
+		status, message, _ := newTestVerifier(tc.root).verify(ctx, tc.location, secret, 0)
+		if status != verificationSkipped || message != errBackupPathRefused.Error() {
+			t.Errorf("%s: verify = %s %q, want skipped", name, status, message)
+		}
+	}
+}
+
+func TestBackupVerifierReportsMissingFilesUnreachable(t *testing.T) {
+	root := t.TempDir()
+	status, _, _ := newTestVerifier(root).verify(context.Background(), filepath.Join(root, "gone.gz"), "", 0)
+	if status != verificationUnreachable {
+		t.Errorf("verify = %s, want unreachable for a missing file under the root", status)
+	}
+}
+
+func TestBackupVerifierConfinesRemoteHosts(t *testing.T) {
+	sum := sha256.Sum256([]byte("mongo dump"))
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "mongo dump")
+	}))
+	defer other.Close()
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/elsewhere.gz" {
+			http.Redirect(w, r, other.URL+"/dump.gz", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "mongo dump")
+	}))
+	defer allowed.Close()
+	host := func(server *httptest.Server) string {
+		parsed, _ := url.Parse(server.URL)
+		return parsed.Host
+	}
+	ctx := context.Background()
+
+	if status, _, _ := newTestVerifier("", host(allowed)).verify(ctx, allowed.URL+"/dump.gz", checksum, 0); status != verificationVerified {
+		t.Errorf("allowed host = %s, want verified", status)
+	}
+	for name, tc := range map[string]struct {
+		hosts    []string
+		location string
+	}{
+		"no hosts configured":          {hosts: nil, location: allowed.URL + "/dump.gz"},
+		"host not listed":              {hosts: []string{host(allowed)}, location: other.URL + "/dump.gz"},
+		"redirect to an unlisted host": {hosts: []string{host(allowed)}, location: allowed.URL + "/elsewhere.gz"},
+	} {
+		status, message, _ := newTestVerifier("", tc.hosts...).verify(ctx, tc.location, checksum, 0)
+		if status != verificationSkipped || !strings.Contains(message, errBackupHostRefused.Error()) {
+			t.Errorf("%s: verify = %s %q, want skipped", name, status, message)
+		}
+	}
+}
+
+func TestBackupVerifierTimesOutEachFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/manifest.json" {
+			fmt.Fprint(w, `{"artifacts":[{"path":"a.gz","sizeBytes":4},{"path":"b.gz","sizeBytes":4},{"path":"c.gz","sizeBytes":4}]}`)
+			return
+		}
+		time.Sleep(150 * time.Millisecond)
+		fmt.Fprint(w, "data")
+	}))
+	defer server.Close()
+	parsed, _ := url.Parse(server.URL)
+	verifier := newBackupVerifier(Config{BackupVerifyTimeoutMs: 400, BackupVerifyHosts: []string{parsed.Host}})
+
+	status, message, _ := verifier.verify(context.Background(), server.URL+"/manifest.json", "", 0)
+	if status != verificationVerified {
+		t.Errorf("verify = %s %q, want every artifact verified within its own timeout", status, message)
+	}
+}
@@ -0,0 +1,538 @@
+package observer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	changeTopicEvents      = "events"
+	changeTopicLiveDevices = "live-devices"
+	changeTopicBackups     = "backups"
+
+	changeModeStream    = "change-stream"
+	changeModeInProcess = "in-process"
+
+	changeStreamBuffer    = 256
+	changeStreamKeepalive = 15 * time.Second
+
+	changeTokenSaveInterval = time.Second
+	// changeNotifyWait bounds how long one in-process write waits for room
+	// at the durable subscribers before they miss its changes.
+	changeNotifyWait = 2 * time.Second
+	// changeTokenID keys the one saved resume token. Replicas share it:
+	// every replica runs the same durable subscribers and they are
+	// idempotent, so resuming from whichever replica saved last only skips
+	// changes another replica has already handled.
+	changeTokenID  = "bus"
+	changeRetryMin = time.Second
+	changeRetryMax = 30 * time.Second
+
+	// Mongo error codes: $changeStream needs a replica set, and the resume
+	// token has aged out of the oplog.
+	changeStreamUnsupportedCode = 40573
+	changeStreamHistoryLostCode = 286
+)
+
+var changeTopics = map[string]string{
+	eventsCollection:      changeTopicEvents,
+	liveDevicesCollection: changeTopicLiveDevices,
+	backupCollection:      changeTopicBackups,
+}
+
+// changeEvent is one write to a watched collection as subscribers see it.
+type changeEvent struct {
+	Topic     string    `json:"topic"`
+	Operation string    `json:"operation"`
+	ID        string    `json:"id,omitempty"`
+	Document  bson.M    `json:"document"`
+	At        time.Time `json:"at"`
+	// seq numbers the events of one bus; durable subscribers ack it.
+	seq int64
+}
+
+// changeSubscription is one consumer of the bus. A durable subscription
+// holds the feed back when its buffer is full and must ack what it has
+// handled; any other subscription is disconnected when it falls a whole
+// buffer behind.
+type changeSubscription struct {
+	name    string
+	topics  map[string]bool
+	events  chan changeEvent
+	durable bool
+	acked   atomic.Int64
+	done    chan struct{}
+	closed  atomic.Bool
+	// stalled is set when a durable subscriber was skipped; publish stops
+	// waiting for it until it has room again.
+	stalled atomic.Bool
+}
+
+// ack records that every event up to and including event has been handled.
+func (sub *changeSubscription) ack(event changeEvent) {
+	sub.acked.Store(event.seq)
+}
+
+// close ends the subscription; it reports whether this call closed it.
+func (sub *changeSubscription) close() bool {
+	if !sub.closed.CompareAndSwap(false, true) {
+		return false
+	}
+	close(sub.done)
+	return true
+}
+
+// changeBus fans writes to observer_events, observer_live_devices and
+// observer_backup_snapshots out to in-process subscribers. On a replica set
+// it is fed by one change stream per replica, which also carries writes made
+// by other observer instances. The resume token is saved only once every
+// durable subscriber has acked the change it belongs to, so after a restart
+// they see each change at least once. Without a replica set (standalone
+// Mongo, the bolt store) the write paths publish their own documents
+// instead, which covers this instance only and is lost if it stops between
+// the write and the publish.
+//
+// A full durable subscriber blocks the feed: the change stream waits for it,
+// while an in-process write waits at most changeNotifyWait. After that the
+// subscriber misses changes (counted as skipped) without further waits until
+// it has room again. Other subscribers are disconnected when their buffer
+// fills and have to reconnect.
+type changeBus struct {
+	mode string
+
+	mu   sync.RWMutex
+	subs map[*changeSubscription]struct{}
+	// retiredAck caps the acked point once a durable subscriber has gone,
+	// so changes it never handled are not saved past on shutdown.
+	retiredAck int64
+
+	published    atomic.Int64
+	disconnected atomic.Int64
+	skipped      atomic.Int64
+
+	// Change stream state; unused in-process.
+	tokens     *mongo.Collection
+	db         *mongo.Database
+	stream     *mongo.ChangeStream
+	statusMu   sync.Mutex
+	lastError  string
+	lastEvent  time.Time
+	reconnects int
+}
+
+func newChangeBus() *changeBus {
+	return &changeBus{mode: changeModeInProcess, subs: map[*changeSubscription]struct{}{}, retiredAck: math.MaxInt64}
+}
+
+// subscribe registers for the given topics (all when none are given) with a
+// buffer of size events. The subscription's done channel closes when it is
+// disconnected for falling behind.
+func (b *changeBus) subscribe(name string, size int, topics ...string) *changeSubscription {
+	sub := &changeSubscription{name: name, topics: map[string]bool{}, events: make(chan changeEvent, size), done: make(chan struct{})}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+	b.add(sub)
+	return sub
+}
+
+// subscribeDurable registers a subscriber that receives every topic, holds
+// the feed back instead of losing changes, and acks what it has handled.
+func (b *changeBus) subscribeDurable(name string, size int) *changeSubscription {
+	sub := &changeSubscription{name: name, topics: map[string]bool{}, events: make(chan changeEvent, size), durable: true, done: make(chan struct{})}
+	b.add(sub)
+	return sub
+}
+
+func (b *changeBus) add(sub *changeSubscription) {
+	b.mu.Lock()
+	sub.acked.Store(b.published.Load())
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+}
+
+func (b *changeBus) unsubscribe(sub *changeSubscription) {
+	sub.close()
+	b.mu.Lock()
+	delete(b.subs, sub)
+	if sub.durable {
+		b.retiredAck = min(b.retiredAck, sub.acked.Load())
+	}
+	b.mu.Unlock()
+}
+
+// publish hands event to every interested subscriber. It waits for room at
+// durable subscribers until ctx is done, skipping a stalled one, and
+// disconnects any other subscriber that is full.
+func (b *changeBus) publish(ctx context.Context, event changeEvent) {
+	event.seq = b.published.Add(1)
+	b.mu.RLock()
+	subs := make([]*changeSubscription, 0, len(b.subs))
+	for sub := range b.subs {
+		if len(sub.topics) == 0 || sub.topics[event.Topic] {
+			subs = append(subs, sub)
+		}
+	}
+	b.mu.RUnlock()
+	for _, sub := range subs {
+		if sub.durable {
+			select {
+			case sub.events <- event:
+				sub.stalled.Store(false)
+				continue
+			default:
+			}
+			if sub.stalled.Load() {
+				b.skipped.Add(1)
+				continue
+			}
+			select {
+			case sub.events <- event:
+			case <-sub.done:
+			case <-ctx.Done():
+				sub.stalled.Store(true)
+				b.skipped.Add(1)
+				log.Printf("observer change bus: %s is full, skipping changes until it catches up", sub.name)
+			}
+			continue
+		}
+		select {
+		case sub.events <- event:
+		case <-sub.done:
+		default:
+			if sub.close() {
+				b.disconnected.Add(1)
+				log.Printf("observer change bus: disconnected %s, %d changes behind", sub.name, cap(sub.events))
+			}
+			b.unsubscribe(sub)
+		}
+	}
+}
+
+// ackedThrough returns the newest seq, at most upTo, that every durable
+// subscriber has handled.
+func (b *changeBus) ackedThrough(upTo int64) int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	through := min(upTo, b.retiredAck)
+	for sub := range b.subs {
+		if sub.durable {
+			through = min(through, sub.acked.Load())
+		}
+	}
+	return through
+}
+
+// notify is called by the write paths after a successful write. It only
+// publishes in-process; with a change stream the write comes back through
+// the stream instead. It waits for full durable subscribers until ctx is
+// done or changeNotifyWait has passed, whichever is first.
+// Subscribers share the documents and must not modify them.
+func (b *changeBus) notify(ctx context.Context, topic, operation string, docs ...bson.M) {
+	if b == nil || b.mode != changeModeInProcess {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, changeNotifyWait)
+	defer cancel()
+	now := time.Now().UTC()
+	for _, doc := range docs {
+		b.publish(ctx, changeEvent{Topic: topic, Operation: operation, ID: formatID(doc["_id"]), Document: doc, At: now})
+	}
+}
+
+// notifyUpsert publishes an upserted document as the merge of its filter
+// and $set, which is what the stored document holds for the fields written.
+func (b *changeBus) notifyUpsert(ctx context.Context, topic string, filter, set bson.M) {
+	if b == nil || b.mode != changeModeInProcess {
+		return
+	}
+	doc := make(bson.M, len(filter)+len(set))
+	for key, value := range filter {
+		doc[key] = value
+	}
+	for key, value := range set {
+		doc[key] = value
+	}
+	b.notify(ctx, topic, "update", doc)
+}
+
+// openStream switches the bus to change-stream mode if the deployment
+// supports it. It runs before the server accepts writes, so nothing is
+// published twice across the switch.
+func (b *changeBus) openStream(ctx context.Context, db *mongo.Database) error {
+	b.db = db
+	b.tokens = db.Collection(changeStreamsCollection)
+	stream, err := b.watch(ctx)
+	if err != nil {
+		if hasErrorCode(err, changeStreamUnsupportedCode) {
+			log.Printf("observer change bus: Mongo is not a replica set, publishing this instance's writes in-process only")
+			return nil
+		}
+		return err
+	}
+	b.stream = stream
+	b.mode = changeModeStream
+	return nil
+}
+
+func (b *changeBus) watch(ctx context.Context) (*mongo.ChangeStream, error) {
+	names := make([]string, 0, len(changeTopics))
+	for name := range changeTopics {
+		names = append(names, name)
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"ns.coll":       bson.M{"$in": names},
+		"operationType": bson.M{"$in": bson.A{"insert", "update", "replace"}},
+	}}}}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+
+	var saved struct {
+		ResumeToken bson.Raw `bson:"resumeToken"`
+	}
+	err := b.tokens.FindOne(ctx, bson.M{"_id": changeTokenID}).Decode(&saved)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	if len(saved.ResumeToken) > 0 {
+		stream, err := b.db.Watch(ctx, pipeline, opts.SetResumeAfter(saved.ResumeToken))
+		if !hasErrorCode(err, changeStreamHistoryLostCode) {
+			return stream, err
+		}
+		log.Printf("observer change bus: resume token is older than the oplog, starting from now")
+		opts.SetResumeAfter(nil)
+	}
+	return b.db.Watch(ctx, pipeline, opts)
+}
+
+// run reads the change stream until ctx is done, reopening it from the last
+// token with backoff when it fails.
+func (b *changeBus) run(ctx context.Context) {
+	if b == nil || b.mode != changeModeStream {
+		return
+	}
+	retry := changeRetryMin
+	for {
+		err := b.consume(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		b.setStatus(err)
+		log.Printf("observer change stream error, reopening in %s: %v", retry, err)
+		if hasErrorCode(err, changeStreamHistoryLostCode) {
+			b.clearToken()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = minDuration(retry*2, changeRetryMax)
+		stream, err := b.watch(ctx)
+		if err != nil {
+			b.setStatus(err)
+			continue
+		}
+		b.stream = stream
+		retry = changeRetryMin
+		b.statusMu.Lock()
+		b.reconnects++
+		b.statusMu.Unlock()
+	}
+}
+
+// consume publishes the stream's changes. Each change's resume token waits
+// in pending until every durable subscriber has acked it.
+func (b *changeBus) consume(ctx context.Context) error {
+	stream := b.stream
+	type pendingToken struct {
+		seq   int64
+		token bson.Raw
+	}
+	var pending []pendingToken
+	var lastSeq int64
+	saveAcked := func() {
+		through := b.ackedThrough(lastSeq)
+		var token bson.Raw
+		acked := 0
+		for acked < len(pending) && pending[acked].seq <= through {
+			token = pending[acked].token
+			acked++
+		}
+		pending = pending[acked:]
+		b.saveToken(token)
+	}
+	defer func() {
+		saveAcked()
+		_ = stream.Close(context.Background())
+	}()
+	lastSaved := time.Now()
+	for stream.Next(ctx) {
+		var change struct {
+			OperationType string `bson:"operationType"`
+			NS            struct {
+				Coll string `bson:"coll"`
+			} `bson:"ns"`
+			DocumentKey  bson.M `bson:"documentKey"`
+			FullDocument bson.M `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&change); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		// An update whose document was deleted before the lookup has no
+		// full document; there is nothing to fan out, and its token is safe
+		// once the change before it is.
+		if change.FullDocument != nil {
+			b.publish(ctx, changeEvent{
+				Topic:     changeTopics[change.NS.Coll],
+				Operation: change.OperationType,
+				ID:        formatID(change.DocumentKey["_id"]),
+				Document:  change.FullDocument,
+				At:        now,
+			})
+			lastSeq = b.published.Load()
+			b.statusMu.Lock()
+			b.lastEvent = now
+			b.statusMu.Unlock()
+		}
+		pending = append(pending, pendingToken{seq: lastSeq, token: append(bson.Raw(nil), stream.ResumeToken()...)})
+		if now.Sub(lastSaved) >= changeTokenSaveInterval {
+			saveAcked()
+			lastSaved = now
+		}
+	}
+	return stream.Err()
+}
+
+// saveToken persists the resume token, so a restarted replica picks up
+// where the durable subscribers stopped.
+func (b *changeBus) saveToken(token bson.Raw) {
+	if len(token) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := b.tokens.UpdateOne(
+		ctx,
+		bson.M{"_id": changeTokenID},
+		bson.M{"$set": bson.M{"resumeToken": token, "updatedAt": time.Now().UTC()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("observer change stream token save error: %v", err)
+	}
+}
+
+// clearToken forgets a token the oplog no longer covers; the next open
+// starts from now. Changes in between are lost.
+func (b *changeBus) clearToken() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := b.tokens.DeleteOne(ctx, bson.M{"_id": changeTokenID}); err != nil {
+		log.Printf("observer change stream token reset error: %v", err)
+	}
+}
+
+func (b *changeBus) setStatus(err error) {
+	b.statusMu.Lock()
+	defer b.statusMu.Unlock()
+	if err != nil {
+		b.lastError = err.Error()
+	}
+}
+
+func (b *changeBus) status() map[string]any {
+	b.mu.RLock()
+	subscribers := make([]map[string]any, 0, len(b.subs))
+	for sub := range b.subs {
+		subscribers = append(subscribers, map[string]any{"name": sub.name, "queued": len(sub.events), "durable": sub.durable})
+	}
+	b.mu.RUnlock()
+	b.statusMu.Lock()
+	defer b.statusMu.Unlock()
+	return map[string]any{
+		"mode":         b.mode,
+		"published":    b.published.Load(),
+		"disconnected": b.disconnected.Load(),
+		"skipped":      b.skipped.Load(),
+		"subscribers":  subscribers,
+		"lastEventAt":  nullableTime(b.lastEvent),
+		"lastError":    b.lastError,
+		"reconnects":   b.reconnects,
+	}
+}
+
+// streamChanges serves the change bus as server-sent events: a "ready"
+// event, then one "change" event per write, with "keepalive" events in
+// between. topics narrows it to some of events, live-devices and backups;
+// source narrows it to one source. A client that falls a whole buffer
+// behind gets an "overflow" event and the stream ends.
+func (s *service) streamChanges(c *gin.Context) {
+	var topics []string
+	for _, topic := range strings.Split(c.Query("topics"), ",") {
+		topic = strings.TrimSpace(topic)
+		if topic == "" {
+			continue
+		}
+		if topic != changeTopicEvents && topic != changeTopicLiveDevices && topic != changeTopicBackups {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"ok":      false,
+				"message": "topics must be from events, live-devices, backups",
+			})
+			return
+		}
+		topics = append(topics, topic)
+	}
+	source := strings.TrimSpace(c.Query("source"))
+
+	sub := s.changes.subscribe("stream "+c.ClientIP(), changeStreamBuffer, topics...)
+	defer s.changes.unsubscribe(sub)
+	keepalive := time.NewTicker(changeStreamKeepalive)
+	defer keepalive.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ready", gin.H{"mode": s.changes.mode, "topics": topics, "source": source})
+	c.Writer.Flush()
+	c.Stream(func(io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-sub.done:
+			c.SSEvent("overflow", gin.H{"at": time.Now().UTC(), "buffer": changeStreamBuffer})
+			return false
+		case event := <-sub.events:
+			if source == "" || asString(event.Document["source"]) == source {
+				c.SSEvent("change", event)
+			}
+		case <-keepalive.C:
+			c.SSEvent("keepalive", gin.H{"at": time.Now().UTC()})
+		}
+		return true
+	})
+}
+
+func hasErrorCode(err error, code int) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(code)
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
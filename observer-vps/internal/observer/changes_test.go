@@ -0,0 +1,140 @@
+package observer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestChangeBusFansOutInProcessWrites(t *testing.T) {
+	svc, handler := newBoltTestService(t)
+	devices := svc.changes.subscribe("devices", 8, changeTopicLiveDevices)
+	everything := svc.changes.subscribe("everything", 1)
+	defer svc.changes.unsubscribe(devices)
+	defer svc.changes.unsubscribe(everything)
+
+	code, body := doJSON(t, handler, http.MethodPost, "/api/observer/ingest/events", gin.H{
+		"source": "venue-box",
+		"events": []gin.H{{"category": "http", "type": "request", "level": "error"}},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("ingest = %d %v", code, body)
+	}
+	code, body = doJSON(t, handler, http.MethodPost, "/api/observer/ingest/live-devices/heartbeat", gin.H{
+		"source":   "venue-box",
+		"deviceId": "court-1",
+		"status":   gin.H{"stream": gin.H{"state": "live"}},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("heartbeat = %d %v", code, body)
+	}
+
+	if len(devices.events) != 1 {
+		t.Fatalf("devices subscriber got %d events, want only the heartbeat", len(devices.events))
+	}
+	if event := <-devices.events; event.Topic != changeTopicLiveDevices || event.Document["deviceId"] != "court-1" || event.Document["source"] != "venue-box" {
+		t.Errorf("device change = %+v", event)
+	}
+	if event := <-everything.events; event.Topic != changeTopicEvents || event.Operation != "insert" {
+		t.Errorf("first change = %+v, want the event insert", event)
+	}
+	select {
+	case <-everything.done:
+	default:
+		t.Errorf("everything was not disconnected when the heartbeat found its buffer full")
+	}
+
+	status := svc.changes.status()
+	if status["mode"] != changeModeInProcess || status["published"] != int64(2) || status["disconnected"] != int64(1) {
+		t.Errorf("status = %v", status)
+	}
+	if subscribers := status["subscribers"].([]map[string]any); len(subscribers) != 1 || subscribers[0]["name"] != "devices" {
+		t.Errorf("subscribers = %v, want only devices left", subscribers)
+	}
+}
+
+func TestChangeBusHoldsFeedForDurableSubscribers(t *testing.T) {
+	bus := newChangeBus()
+	matcher := bus.subscribeDurable("matcher", 1)
+	if got := bus.ackedThrough(10); got != 0 {
+		t.Fatalf("ackedThrough = %d before any change, want 0", got)
+	}
+
+	published := make(chan struct{})
+	go func() {
+		for index := 0; index < 3; index++ {
+			bus.publish(context.Background(), changeEvent{Topic: changeTopicEvents, ID: fmt.Sprint(index)})
+		}
+		close(published)
+	}()
+	var last changeEvent
+	for index := 0; index < 3; index++ {
+		select {
+		case last = <-matcher.events:
+		case <-time.After(time.Second):
+			t.Fatalf("change %d never arrived", index)
+		}
+		if index == 0 {
+			if got := bus.ackedThrough(3); got != 0 {
+				t.Errorf("ackedThrough = %d with nothing acked, want 0", got)
+			}
+		}
+		matcher.ack(last)
+	}
+	<-published
+	if last.ID != "2" || bus.ackedThrough(3) != 3 {
+		t.Errorf("last = %+v, ackedThrough = %d, want all three handled in order", last, bus.ackedThrough(3))
+	}
+
+	bus.publish(context.Background(), changeEvent{Topic: changeTopicEvents})
+	bus.unsubscribe(matcher)
+	if got := bus.ackedThrough(4); got != 3 {
+		t.Errorf("ackedThrough = %d after the matcher left, want it held at its last ack", got)
+	}
+}
+
+func TestChangeBusBoundsInProcessWritesAtAFullDurableSubscriber(t *testing.T) {
+	bus := newChangeBus()
+	matcher := bus.subscribeDurable("matcher", 1)
+	defer bus.unsubscribe(matcher)
+	notify := func(id string) time.Duration {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		started := time.Now()
+		bus.notify(ctx, changeTopicEvents, "insert", bson.M{"_id": id})
+		return time.Since(started)
+	}
+
+	notify("first")
+	if waited := notify("second"); waited > time.Second {
+		t.Fatalf("write waited %s at a full subscriber, want the bound", waited)
+	}
+	withoutWait := make(chan time.Duration, 1)
+	go func() {
+		withoutWait <- notify("third")
+	}()
+	select {
+	case waited := <-withoutWait:
+		if waited >= 50*time.Millisecond {
+			t.Errorf("write waited %s at a stalled subscriber, want no wait", waited)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write blocked at a stalled subscriber")
+	}
+	if got := bus.status()["skipped"]; got != int64(2) {
+		t.Errorf("skipped = %v, want 2", got)
+	}
+
+	if event := <-matcher.events; event.ID != "first" {
+		t.Errorf("queued change = %+v, want first", event)
+	}
+	notify("fourth")
+	if event := <-matcher.events; event.ID != "fourth" {
+		t.Errorf("change after catching up = %+v, want fourth", event)
+	}
+}
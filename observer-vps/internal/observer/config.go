@@ -11,14 +11,26 @@ import (
 	"github.com/joho/godotenv"
 )
 
+const (
+	storageMongo = "mongo"
+	storageBolt  = "bolt"
+)
+
 type Config struct {
+	ConfigFile           string
 	NodeEnv              string
 	BindHost             string
 	Port                 string
+	Storage              string
 	MongoURI             string
 	MongoDatabase        string
+	BoltPath             string
+	BoltSweepIntervalMs  int
+	InstanceID           string
+	LeaseTTLMs           int
 	APIKey               string
 	ReadAPIKey           string
+	AdminAPIKey          string
 	JWTSecret            string
 	EventTTLDays         int
 	RuntimeTTLDays       int
@@ -26,77 +38,386 @@ type Config struct {
 	LiveDeviceTTLDays    int
 	LiveDeviceStaleMs    int
 	LiveDeviceSourceName string
+
+	SourceRatePerSec        int
+	SourceRateBurst         int
+	APIKeyRatePerSec        int
+	APIKeyRateBurst         int
+	DeviceRatePerSec        int
+	DeviceRateBurst         int
+	DailyEventQuota         int
+	DailyEventQuotaBySource map[string]int
+
+	RedactEnabled       bool
+	RedactQueryParams   []string
+	RedactQueryMode     string
+	RedactIPMode        string
+	RedactPayloadKeys   []string
+	RedactPatterns      []string
+	RedactExtraPatterns []string
+	RedactAllowlist     map[string][]string
+
+	SyslogUDPAddr        string
+	SyslogTCPAddr        string
+	SyslogSourceTemplate string
+
+	BackupVerifyIntervalMs int
+	BackupVerifyTimeoutMs  int
+	BackupVerifyRoot       string
+	BackupVerifyHosts      []string
+
+	ArchiveDir        string
+	ArchiveKinds      []string
+	ArchiveIntervalMs int
+	ArchiveLeadHours  int
+
+	SourceSilenceMinutes int
+
+	MemoryAnalyzeIntervalMs int
+	MemoryField             string
+	MemoryLimitMb           int
+	MemoryLimitMbBySource   map[string]int
+	MemoryHorizonHours      int
+
+	SampleRules           []string
+	SampleBudgetPerMinute int
+
+	WebhookMaxAttempts     int
+	WebhookTimeoutMs       int
+	WebhookDeliveryTTLDays int
+
+	ProbeIntervalMs int
+	ProbeTimeoutMs  int
+	ProbeTTLDays    int
+	// Probes come from the config file's probes section, with
+	// OBSERVER_PROBES adding or replacing plain name=url checks.
+	Probes []probeTarget
+
+	// RetentionPolicies and Sources come only from the config file's
+	// retention and sources sections and are upserted on load and reload.
+	RetentionPolicies []retentionPolicy
+	Sources           []map[string]any
+}
+
+// LoadConfig resolves every setting from, in increasing precedence, the
+// optional config file, the environment and command-line flags in args.
+func LoadConfig(args []string) (Config, error) {
+	cfg, rest, err := loadConfig(args)
+	if err != nil {
+		return Config{}, err
+	}
+	if len(rest) > 0 {
+		return Config{}, fmt.Errorf("unexpected argument %q", rest[0])
+	}
+	return cfg, nil
 }
 
-func LoadConfig() (Config, error) {
+// loadConfig is LoadConfig for commands that take positional arguments after
+// the flags; it returns them unparsed.
+func loadConfig(args []string) (Config, []string, error) {
 	_ = godotenv.Load("observer-vps/.env", ".env")
 
-	nodeEnv := getenv("NODE_ENV", "production")
-	mongoURI := resolveMongoURI(nodeEnv)
-	if mongoURI == "" {
-		return Config{}, fmt.Errorf("mongo uri not configured for NODE_ENV=%s", nodeEnv)
+	r, err := newConfigReader(args)
+	if err != nil {
+		return Config{}, nil, err
 	}
 
-	mongoDatabase, err := resolveMongoDatabase(mongoURI, os.Getenv("MONGO_DB_NAME"))
-	if err != nil {
-		return Config{}, err
+	nodeEnv := r.get("NODE_ENV", "production")
+	storageBackend := strings.ToLower(r.get("OBSERVER_STORAGE", storageMongo))
+	if storageBackend != storageMongo && storageBackend != storageBolt {
+		r.fail(r.name("OBSERVER_STORAGE"), "must be %s or %s, got %q", storageMongo, storageBolt, storageBackend)
+	}
+
+	// The bolt backend needs no database server; a Mongo URI is only
+	// required, and only validated, when Mongo is the store.
+	mongoURI := r.mongoURI(nodeEnv)
+	mongoDatabase := ""
+	if storageBackend == storageMongo {
+		if mongoURI == "" {
+			r.errs = append(r.errs, fmt.Errorf("mongo uri not configured for NODE_ENV=%s", nodeEnv))
+		} else if mongoDatabase, err = resolveMongoDatabase(mongoURI, r.get("MONGO_DB_NAME", "")); err != nil {
+			r.errs = append(r.errs, err)
+		}
 	}
 
-	apiKey := strings.TrimSpace(os.Getenv("OBSERVER_API_KEY"))
+	apiKey := r.get("OBSERVER_API_KEY", "")
 	if apiKey == "" {
-		return Config{}, errors.New("OBSERVER_API_KEY is required")
+		r.errs = append(r.errs, errors.New("OBSERVER_API_KEY (or apiKey in the config file) is required"))
 	}
 
-	readKey := strings.TrimSpace(os.Getenv("OBSERVER_READ_API_KEY"))
-	if readKey == "" {
-		readKey = apiKey
+	readKey := r.get("OBSERVER_READ_API_KEY", apiKey)
+
+	adminKey := r.get("OBSERVER_ADMIN_API_KEY", apiKey)
+
+	memoryField := "rss"
+	if fields, err := resolveRuntimeFields(r.get("OBSERVER_MEMORY_FIELD", memoryField)); err != nil || len(fields) != 1 {
+		r.fail(r.name("OBSERVER_MEMORY_FIELD"), "must be one runtime field: %v", err)
+	} else {
+		memoryField = fields[0]
 	}
 
-	return Config{
+	cfg := Config{
+		ConfigFile:           r.path,
 		NodeEnv:              nodeEnv,
-		BindHost:             getenv("OBSERVER_BIND_HOST", "0.0.0.0"),
-		Port:                 getenv("OBSERVER_PORT", getenv("PORT", "8787")),
+		BindHost:             r.get("OBSERVER_BIND_HOST", "0.0.0.0"),
+		Port:                 r.get("OBSERVER_PORT", r.get("PORT", "8787")),
+		Storage:              storageBackend,
 		MongoURI:             mongoURI,
 		MongoDatabase:        mongoDatabase,
+		BoltPath:             r.get("OBSERVER_BOLT_PATH", "observer.db"),
+		BoltSweepIntervalMs:  r.getInt("OBSERVER_BOLT_SWEEP_INTERVAL_MS", 60*1000),
+		InstanceID:           r.get("OBSERVER_INSTANCE_ID", defaultInstanceID()),
+		LeaseTTLMs:           r.getInt("OBSERVER_LEASE_TTL_MS", 30*1000),
 		APIKey:               apiKey,
 		ReadAPIKey:           readKey,
-		JWTSecret:            strings.TrimSpace(os.Getenv("JWT_SECRET")),
-		EventTTLDays:         getenvInt("OBSERVER_EVENT_TTL_DAYS", 7),
-		RuntimeTTLDays:       getenvInt("OBSERVER_RUNTIME_TTL_DAYS", 14),
-		BackupTTLDays:        getenvInt("OBSERVER_BACKUP_TTL_DAYS", 60),
-		LiveDeviceTTLDays:    getenvInt("OBSERVER_LIVE_DEVICE_TTL_DAYS", 3),
-		LiveDeviceStaleMs:    getenvInt("OBSERVER_LIVE_DEVICE_STALE_MS", 30_000),
-		LiveDeviceSourceName: getenv("OBSERVER_LIVE_DEVICE_SOURCE_NAME", "pickletour-live-app"),
-	}, nil
+		AdminAPIKey:          adminKey,
+		JWTSecret:            r.get("JWT_SECRET", ""),
+		EventTTLDays:         r.getInt("OBSERVER_EVENT_TTL_DAYS", 7),
+		RuntimeTTLDays:       r.getInt("OBSERVER_RUNTIME_TTL_DAYS", 14),
+		BackupTTLDays:        r.getInt("OBSERVER_BACKUP_TTL_DAYS", 60),
+		LiveDeviceTTLDays:    r.getInt("OBSERVER_LIVE_DEVICE_TTL_DAYS", 3),
+		LiveDeviceStaleMs:    r.getInt("OBSERVER_LIVE_DEVICE_STALE_MS", 30_000),
+		LiveDeviceSourceName: r.get("OBSERVER_LIVE_DEVICE_SOURCE_NAME", "pickletour-live-app"),
+
+		SourceRatePerSec:        r.getNonNegativeInt("OBSERVER_RATE_SOURCE_PER_SEC", 200),
+		SourceRateBurst:         r.getNonNegativeInt("OBSERVER_RATE_SOURCE_BURST", 2_000),
+		APIKeyRatePerSec:        r.getNonNegativeInt("OBSERVER_RATE_API_KEY_PER_SEC", 500),
+		APIKeyRateBurst:         r.getNonNegativeInt("OBSERVER_RATE_API_KEY_BURST", 5_000),
+		DeviceRatePerSec:        r.getNonNegativeInt("OBSERVER_RATE_DEVICE_PER_SEC", 5),
+		DeviceRateBurst:         r.getNonNegativeInt("OBSERVER_RATE_DEVICE_BURST", 400),
+		DailyEventQuota:         r.getNonNegativeInt("OBSERVER_DAILY_EVENT_QUOTA", 500_000),
+		DailyEventQuotaBySource: r.getIntMap("OBSERVER_DAILY_EVENT_QUOTA_BY_SOURCE"),
+
+		RedactEnabled:       r.getBool("OBSERVER_REDACT_ENABLED", true),
+		RedactQueryParams:   r.getList("OBSERVER_REDACT_QUERY_PARAMS", ",", "token,access_token,refresh_token,id_token,api_key,apikey,key,secret,password,signature,sig,code"),
+		RedactQueryMode:     r.get("OBSERVER_REDACT_QUERY_MODE", "mask"),
+		RedactIPMode:        r.get("OBSERVER_REDACT_IP_MODE", "truncate"),
+		RedactPayloadKeys:   r.getList("OBSERVER_REDACT_PAYLOAD_KEYS", ",", "password,passwd,secret,token,accessToken,refreshToken,authorization,cookie,otp"),
+		RedactPatterns:      r.getList("OBSERVER_REDACT_PATTERNS", ",", "email,phone,bearer,jwt"),
+		RedactExtraPatterns: r.getList("OBSERVER_REDACT_EXTRA_PATTERNS", "||", ""),
+		RedactAllowlist:     r.getListMap("OBSERVER_REDACT_ALLOWLIST"),
+
+		SyslogUDPAddr:        r.get("OBSERVER_SYSLOG_UDP_ADDR", ""),
+		SyslogTCPAddr:        r.get("OBSERVER_SYSLOG_TCP_ADDR", ""),
+		SyslogSourceTemplate: r.get("OBSERVER_SYSLOG_SOURCE_TEMPLATE", "{host}-{app}"),
+
+		BackupVerifyIntervalMs: r.getNonNegativeInt("OBSERVER_BACKUP_VERIFY_INTERVAL_MS", 5*60*1000),
+		BackupVerifyTimeoutMs:  r.getInt("OBSERVER_BACKUP_VERIFY_TIMEOUT_MS", 10*60*1000),
+		BackupVerifyRoot:       r.get("OBSERVER_BACKUP_VERIFY_ROOT", ""),
+		BackupVerifyHosts:      r.getList("OBSERVER_BACKUP_VERIFY_HOSTS", ",", ""),
+
+		ArchiveDir:        r.get("OBSERVER_ARCHIVE_DIR", ""),
+		ArchiveKinds:      r.getList("OBSERVER_ARCHIVE_KINDS", ",", "events,runtime,live-devices"),
+		ArchiveIntervalMs: r.getInt("OBSERVER_ARCHIVE_INTERVAL_MS", 60*60*1000),
+		ArchiveLeadHours:  r.getInt("OBSERVER_ARCHIVE_LEAD_HOURS", 12),
+
+		SourceSilenceMinutes: r.getInt("OBSERVER_SOURCE_SILENCE_MINUTES", 15),
+
+		MemoryAnalyzeIntervalMs: r.getNonNegativeInt("OBSERVER_MEMORY_ANALYZE_INTERVAL_MS", 5*60*1000),
+		MemoryField:             memoryField,
+		MemoryLimitMb:           r.getNonNegativeInt("OBSERVER_MEMORY_LIMIT_MB", 2048),
+		MemoryLimitMbBySource:   r.getIntMap("OBSERVER_MEMORY_LIMIT_MB_BY_SOURCE"),
+		MemoryHorizonHours:      r.getInt("OBSERVER_MEMORY_HORIZON_HOURS", 24),
+
+		SampleRules:           r.getList("OBSERVER_SAMPLE_RULES", ",", ""),
+		SampleBudgetPerMinute: r.getNonNegativeInt("OBSERVER_SAMPLE_BUDGET_PER_MIN", 0),
+
+		WebhookMaxAttempts:     r.getInt("OBSERVER_WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookTimeoutMs:       r.getInt("OBSERVER_WEBHOOK_TIMEOUT_MS", 10*1000),
+		WebhookDeliveryTTLDays: r.getInt("OBSERVER_WEBHOOK_DELIVERY_TTL_DAYS", 14),
+
+		ProbeIntervalMs: r.getInt("OBSERVER_PROBE_INTERVAL_MS", 60*1000),
+		ProbeTimeoutMs:  r.getInt("OBSERVER_PROBE_TIMEOUT_MS", 10*1000),
+		ProbeTTLDays:    r.getInt("OBSERVER_PROBE_TTL_DAYS", 30),
+		Probes:          r.getProbes(),
+
+		RetentionPolicies: r.retention,
+		Sources:           r.sources,
+	}
+	if err := r.err(); err != nil {
+		return Config{}, nil, err
+	}
+	return cfg, r.rest, nil
 }
 
-func getenv(key, fallback string) string {
-	value := strings.TrimSpace(os.Getenv(key))
-	if value == "" {
+// getInt returns a positive integer setting; zero keeps the fallback.
+func (r *configReader) getInt(key string, fallback int) int {
+	parsed, ok := r.parseInt(key)
+	if !ok || parsed == 0 {
 		return fallback
 	}
-	return value
+	return parsed
 }
 
-func getenvInt(key string, fallback int) int {
-	value := strings.TrimSpace(os.Getenv(key))
-	if value == "" {
+// getNonNegativeInt is like getInt but keeps an explicit 0, which the
+// limiter settings use to mean "disabled".
+func (r *configReader) getNonNegativeInt(key string, fallback int) int {
+	parsed, ok := r.parseInt(key)
+	if !ok {
 		return fallback
 	}
+	return parsed
+}
+
+func (r *configReader) parseInt(key string) (int, bool) {
+	value, origin, ok := r.lookup(key)
+	if !ok {
+		return 0, false
+	}
 	parsed, err := strconv.Atoi(value)
-	if err != nil || parsed <= 0 {
+	if err != nil || parsed < 0 {
+		r.fail(origin, "expected a non-negative integer, got %q", value)
+		return 0, false
+	}
+	return parsed, true
+}
+
+func (r *configReader) getBool(key string, fallback bool) bool {
+	value, origin, ok := r.lookup(key)
+	if !ok {
 		return fallback
 	}
-	return parsed
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	r.fail(origin, "expected true or false, got %q", value)
+	return fallback
+}
+
+// getList splits key on sep, falling back to fallback when the setting is
+// unset. Set it to "-" to get an empty list.
+func (r *configReader) getList(key, sep, fallback string) []string {
+	value, _, ok := r.lookup(key)
+	if !ok {
+		value = fallback
+	}
+	if strings.TrimSpace(value) == "-" {
+		return []string{}
+	}
+	out := []string{}
+	for _, item := range strings.Split(value, sep) {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
+
+// getListMap parses "name=a|b,name2=c" into name -> [a b].
+func (r *configReader) getListMap(key string) map[string][]string {
+	out := map[string][]string{}
+	value, origin, ok := r.lookup(key)
+	if !ok {
+		return out
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, raw, found := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			r.fail(origin, "expected name=a|b pairs, got %q", pair)
+			continue
+		}
+		for _, item := range strings.Split(raw, "|") {
+			if trimmed := strings.TrimSpace(item); trimmed != "" {
+				out[name] = append(out[name], trimmed)
+			}
+		}
+	}
+	return out
+}
+
+// getIntMap parses "name=value,name=value" pairs.
+func (r *configReader) getIntMap(key string) map[string]int {
+	out := map[string]int{}
+	value, origin, ok := r.lookup(key)
+	if !ok {
+		return out
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, raw, found := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			r.fail(origin, "expected name=value pairs, got %q", pair)
+			continue
+		}
+		parsed, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || parsed < 0 {
+			r.fail(origin, "%s: expected a non-negative integer, got %q", name, strings.TrimSpace(raw))
+			continue
+		}
+		out[name] = parsed
+	}
+	return out
+}
+
+// getProbes returns the config file's probes with OBSERVER_PROBES applied:
+// "name=url,name2=url2" pairs, each replacing the file probe of that name.
+func (r *configReader) getProbes() []probeTarget {
+	probes := append([]probeTarget{}, r.probes...)
+	value, origin, ok := r.lookup("OBSERVER_PROBES")
+	if !ok {
+		return probes
+	}
+	seen := map[string]bool{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, raw, found := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			r.fail(origin, "expected name=url pairs, got %q", pair)
+			continue
+		}
+		if seen[name] {
+			r.fail(origin, "probe %q is listed twice", name)
+			continue
+		}
+		seen[name] = true
+		probe, err := parseProbe(map[string]any{"name": name, "url": raw})
+		if err != nil {
+			r.fail(origin, "%s: %v", name, err)
+			continue
+		}
+		replaced := false
+		for index := range probes {
+			if probes[index].Name == name {
+				probes[index], replaced = probe, true
+			}
+		}
+		if !replaced {
+			probes = append(probes, probe)
+		}
+	}
+	return probes
+}
+
+// defaultInstanceID names this replica in the job lease: the hostname, which
+// is the container ID under Docker, plus the pid.
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "observer"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
 }
 
-func resolveMongoURI(nodeEnv string) string {
+func (r *configReader) mongoURI(nodeEnv string) string {
 	if strings.EqualFold(nodeEnv, "production") {
-		if value := strings.TrimSpace(os.Getenv("MONGO_URI_PROD")); value != "" {
+		if value := r.get("MONGO_URI_PROD", ""); value != "" {
 			return value
 		}
 	}
-	return strings.TrimSpace(os.Getenv("MONGO_URI"))
+	return r.get("MONGO_URI", "")
 }
 
 func resolveMongoDatabase(mongoURI, explicit string) (string, error) {
@@ -0,0 +1,414 @@
+package observer
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFieldScalar = iota
+	configFieldList
+	configFieldMap
+)
+
+// configField maps a config file key to the environment variable it stands
+// in for. Every field is also a flag named after the variable without the
+// OBSERVER_ prefix: OBSERVER_EVENT_TTL_DAYS is --event-ttl-days.
+type configField struct {
+	file string
+	env  string
+	kind int
+	sep  string
+}
+
+var configFields = []configField{
+	{file: "nodeEnv", env: "NODE_ENV"},
+	{file: "bindHost", env: "OBSERVER_BIND_HOST"},
+	{file: "port", env: "OBSERVER_PORT"},
+	{file: "storage", env: "OBSERVER_STORAGE"},
+	{file: "mongoUri", env: "MONGO_URI"},
+	{file: "mongoUriProd", env: "MONGO_URI_PROD"},
+	{file: "mongoDatabase", env: "MONGO_DB_NAME"},
+	{file: "boltPath", env: "OBSERVER_BOLT_PATH"},
+	{file: "boltSweepIntervalMs", env: "OBSERVER_BOLT_SWEEP_INTERVAL_MS"},
+	{file: "instanceId", env: "OBSERVER_INSTANCE_ID"},
+	{file: "leaseTtlMs", env: "OBSERVER_LEASE_TTL_MS"},
+	{file: "apiKey", env: "OBSERVER_API_KEY"},
+	{file: "readApiKey", env: "OBSERVER_READ_API_KEY"},
+	{file: "adminApiKey", env: "OBSERVER_ADMIN_API_KEY"},
+	{file: "jwtSecret", env: "JWT_SECRET"},
+	{file: "eventTtlDays", env: "OBSERVER_EVENT_TTL_DAYS"},
+	{file: "runtimeTtlDays", env: "OBSERVER_RUNTIME_TTL_DAYS"},
+	{file: "backupTtlDays", env: "OBSERVER_BACKUP_TTL_DAYS"},
+	{file: "liveDeviceTtlDays", env: "OBSERVER_LIVE_DEVICE_TTL_DAYS"},
+	{file: "liveDeviceStaleMs", env: "OBSERVER_LIVE_DEVICE_STALE_MS"},
+	{file: "liveDeviceSourceName", env: "OBSERVER_LIVE_DEVICE_SOURCE_NAME"},
+
+	{file: "sourceRatePerSec", env: "OBSERVER_RATE_SOURCE_PER_SEC"},
+	{file: "sourceRateBurst", env: "OBSERVER_RATE_SOURCE_BURST"},
+	{file: "apiKeyRatePerSec", env: "OBSERVER_RATE_API_KEY_PER_SEC"},
+	{file: "apiKeyRateBurst", env: "OBSERVER_RATE_API_KEY_BURST"},
+	{file: "deviceRatePerSec", env: "OBSERVER_RATE_DEVICE_PER_SEC"},
+	{file: "deviceRateBurst", env: "OBSERVER_RATE_DEVICE_BURST"},
+	{file: "dailyEventQuota", env: "OBSERVER_DAILY_EVENT_QUOTA"},
+	{file: "dailyEventQuotaBySource", env: "OBSERVER_DAILY_EVENT_QUOTA_BY_SOURCE", kind: configFieldMap},
+
+	{file: "redactEnabled", env: "OBSERVER_REDACT_ENABLED"},
+	{file: "redactQueryParams", env: "OBSERVER_REDACT_QUERY_PARAMS", kind: configFieldList, sep: ","},
+	{file: "redactQueryMode", env: "OBSERVER_REDACT_QUERY_MODE"},
+	{file: "redactIpMode", env: "OBSERVER_REDACT_IP_MODE"},
+	{file: "redactPayloadKeys", env: "OBSERVER_REDACT_PAYLOAD_KEYS", kind: configFieldList, sep: ","},
+	{file: "redactPatterns", env: "OBSERVER_REDACT_PATTERNS", kind: configFieldList, sep: ","},
+	{file: "redactExtraPatterns", env: "OBSERVER_REDACT_EXTRA_PATTERNS", kind: configFieldList, sep: "||"},
+	{file: "redactAllowlist", env: "OBSERVER_REDACT_ALLOWLIST", kind: configFieldMap},
+
+	{file: "syslogUdpAddr", env: "OBSERVER_SYSLOG_UDP_ADDR"},
+	{file: "syslogTcpAddr", env: "OBSERVER_SYSLOG_TCP_ADDR"},
+	{file: "syslogSourceTemplate", env: "OBSERVER_SYSLOG_SOURCE_TEMPLATE"},
+
+	{file: "backupVerifyIntervalMs", env: "OBSERVER_BACKUP_VERIFY_INTERVAL_MS"},
+	{file: "backupVerifyTimeoutMs", env: "OBSERVER_BACKUP_VERIFY_TIMEOUT_MS"},
+
+	{file: "archiveDir", env: "OBSERVER_ARCHIVE_DIR"},
+	{file: "archiveKinds", env: "OBSERVER_ARCHIVE_KINDS", kind: configFieldList, sep: ","},
+	{file: "archiveIntervalMs", env: "OBSERVER_ARCHIVE_INTERVAL_MS"},
+	{file: "archiveLeadHours", env: "OBSERVER_ARCHIVE_LEAD_HOURS"},
+
+	{file: "sourceSilenceMinutes", env: "OBSERVER_SOURCE_SILENCE_MINUTES"},
+
+	{file: "memoryAnalyzeIntervalMs", env: "OBSERVER_MEMORY_ANALYZE_INTERVAL_MS"},
+	{file: "memoryField", env: "OBSERVER_MEMORY_FIELD"},
+	{file: "memoryLimitMb", env: "OBSERVER_MEMORY_LIMIT_MB"},
+	{file: "memoryLimitMbBySource", env: "OBSERVER_MEMORY_LIMIT_MB_BY_SOURCE", kind: configFieldMap},
+	{file: "memoryHorizonHours", env: "OBSERVER_MEMORY_HORIZON_HOURS"},
+
+	{file: "sampleBudgetPerMinute", env: "OBSERVER_SAMPLE_BUDGET_PER_MIN"},
+
+	{file: "webhookMaxAttempts", env: "OBSERVER_WEBHOOK_MAX_ATTEMPTS"},
+	{file: "webhookTimeoutMs", env: "OBSERVER_WEBHOOK_TIMEOUT_MS"},
+	{file: "webhookDeliveryTtlDays", env: "OBSERVER_WEBHOOK_DELIVERY_TTL_DAYS"},
+
+	{file: "probeIntervalMs", env: "OBSERVER_PROBE_INTERVAL_MS"},
+	{file: "probeTimeoutMs", env: "OBSERVER_PROBE_TIMEOUT_MS"},
+	{file: "probeTtlDays", env: "OBSERVER_PROBE_TTL_DAYS"},
+}
+
+// configSections are the config file's structured parts. Rules are the
+// sampling rules that OBSERVER_SAMPLE_RULES otherwise carries and probes
+// the full form of OBSERVER_PROBES; retention policies and source
+// registrations have no env form at all.
+var configSections = map[string][]string{
+	"rules":     {"source", "category", "type", "rate"},
+	"retention": {"kind", "source", "category", "type", "level", "ttlDays", "note"},
+	"sources":   {"source", "expected", "silenceAfterMinutes", "expectedKinds", "note"},
+	"probes":    {"name", "url", "method", "headers", "intervalMs", "timeoutMs", "expectStatus", "expectBody", "tlsWarnDays", "source"},
+}
+
+const configFileEnv = "OBSERVER_CONFIG_FILE"
+
+func configFlagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(env, "OBSERVER_")), "_", "-")
+}
+
+// configReader resolves settings by environment variable name from, highest
+// precedence first, command-line flags, the environment and the config file.
+// Bad values are collected rather than returned one at a time, and every
+// message names where the value came from.
+type configReader struct {
+	path  string
+	flags map[string]string
+	file  map[string]string
+	rest  []string
+
+	retention []retentionPolicy
+	sources   []map[string]any
+	probes    []probeTarget
+
+	errs []error
+}
+
+func newConfigReader(args []string) (*configReader, error) {
+	r := &configReader{flags: map[string]string{}, file: map[string]string{}}
+
+	fs := flag.NewFlagSet("observer", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configPath := fs.String("config", "", "path to a YAML or JSON config file")
+	values := map[string]*string{}
+	for _, field := range configFields {
+		values[configFlagName(field.env)] = fs.String(configFlagName(field.env), "", field.env)
+	}
+	for _, env := range []string{"OBSERVER_SAMPLE_RULES", "OBSERVER_PROBES"} {
+		values[configFlagName(env)] = fs.String(configFlagName(env), "", env)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("observer flags: %w", err)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if value, ok := values[f.Name]; ok {
+			r.flags[f.Name] = strings.TrimSpace(*value)
+		}
+	})
+	r.rest = fs.Args()
+
+	r.path = strings.TrimSpace(*configPath)
+	if r.path == "" {
+		r.path = strings.TrimSpace(os.Getenv(configFileEnv))
+	}
+	if r.path != "" {
+		if err := r.readFile(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// lookup returns the value for key and where it came from. Empty flags and
+// variables count as unset, as they always have for the env settings.
+func (r *configReader) lookup(key string) (string, string, bool) {
+	name := configFlagName(key)
+	if value := r.flags[name]; value != "" {
+		return value, "--" + name, true
+	}
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value, key, true
+	}
+	if value, ok := r.file[key]; ok && value != "" {
+		return value, r.path + ": " + configFileName(key), true
+	}
+	return "", "", false
+}
+
+// name is the origin of key's value, or the variable name when unset.
+func (r *configReader) name(key string) string {
+	if _, origin, ok := r.lookup(key); ok {
+		return origin
+	}
+	return key
+}
+
+func (r *configReader) get(key, fallback string) string {
+	value, _, ok := r.lookup(key)
+	if !ok {
+		return fallback
+	}
+	return value
+}
+
+func (r *configReader) fail(origin, format string, args ...any) {
+	r.errs = append(r.errs, fmt.Errorf("%s: %s", origin, fmt.Sprintf(format, args...)))
+}
+
+func (r *configReader) err() error {
+	return errors.Join(r.errs...)
+}
+
+func configFileName(env string) string {
+	switch env {
+	case "OBSERVER_SAMPLE_RULES":
+		return "rules"
+	case "OBSERVER_PROBES":
+		return "probes"
+	}
+	for _, field := range configFields {
+		if field.env == env {
+			return field.file
+		}
+	}
+	return env
+}
+
+// readFile loads the config file. YAML is a superset of JSON, so one parser
+// covers both. Unknown keys and wrongly shaped values are errors.
+func (r *configReader) readFile() error {
+	raw, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	doc := map[string]any{}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("parse config file %s: %w", r.path, err)
+	}
+
+	fields := map[string]configField{}
+	for _, field := range configFields {
+		fields[field.file] = field
+	}
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		origin := r.path + ": " + key
+		if _, ok := configSections[key]; ok {
+			r.readSection(key, doc[key])
+			continue
+		}
+		field, ok := fields[key]
+		if !ok {
+			r.fail(origin, "unknown field")
+			continue
+		}
+		value, err := configFileValue(field, doc[key])
+		if err != nil {
+			r.fail(origin, "%v", err)
+			continue
+		}
+		r.file[field.env] = value
+	}
+	return nil
+}
+
+// configFileValue flattens a file value into the string form the env
+// variable would hold, so both go through the same parsing.
+func configFileValue(field configField, value any) (string, error) {
+	switch typed := value.(type) {
+	case nil:
+		return "", nil
+	case []any:
+		if field.kind != configFieldList {
+			return "", errors.New("expected a single value, got a list")
+		}
+		items := make([]string, 0, len(typed))
+		for _, item := range typed {
+			text, err := configScalar(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, text)
+		}
+		if len(items) == 0 {
+			return "-", nil
+		}
+		return strings.Join(items, field.sep), nil
+	case map[string]any:
+		if field.kind != configFieldMap {
+			return "", errors.New("expected a single value, got a mapping")
+		}
+		names := make([]string, 0, len(typed))
+		for name := range typed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		pairs := make([]string, 0, len(names))
+		for _, name := range names {
+			var text string
+			var err error
+			if list, ok := typed[name].([]any); ok {
+				text, err = configFileValue(configField{kind: configFieldList, sep: "|"}, list)
+			} else {
+				text, err = configScalar(typed[name])
+			}
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", name, err)
+			}
+			pairs = append(pairs, name+"="+text)
+		}
+		return strings.Join(pairs, ","), nil
+	}
+	if field.kind == configFieldMap {
+		return "", errors.New("expected a mapping of name: value")
+	}
+	return configScalar(value)
+}
+
+func configScalar(value any) (string, error) {
+	switch typed := value.(type) {
+	case string:
+		return strings.TrimSpace(typed), nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	case int:
+		return strconv.Itoa(typed), nil
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// readSection validates one of the structured sections entry by entry.
+func (r *configReader) readSection(section string, value any) {
+	if value == nil {
+		return
+	}
+	entries, ok := value.([]any)
+	if !ok {
+		r.fail(r.path+": "+section, "expected a list")
+		return
+	}
+	rules := make([]string, 0, len(entries))
+	for index, item := range entries {
+		origin := fmt.Sprintf("%s: %s[%d]", r.path, section, index)
+		entry, ok := item.(map[string]any)
+		if !ok {
+			r.fail(origin, "expected a mapping")
+			continue
+		}
+		unknown := false
+		for key := range entry {
+			if !containsString(configSections[section], key) {
+				r.fail(origin+"."+key, "unknown field")
+				unknown = true
+			}
+		}
+		if unknown {
+			continue
+		}
+		switch section {
+		case "rules":
+			raw := fmt.Sprintf("%s/%s/%s=%s",
+				defaultString(asString(entry["source"]), sampleWildcard),
+				defaultString(asString(entry["category"]), sampleWildcard),
+				defaultString(asString(entry["type"]), sampleWildcard),
+				asString(entry["rate"]))
+			if _, err := parseSampleRule(raw); err != nil {
+				r.fail(origin, "%v", err)
+				continue
+			}
+			rules = append(rules, raw)
+		case "retention":
+			policy, err := parseRetentionPolicy(entry)
+			if err != nil {
+				r.fail(origin, "%v", err)
+				continue
+			}
+			r.retention = append(r.retention, policy)
+		case "sources":
+			if err := validateSourceSetting(entry); err != nil {
+				r.fail(origin, "%v", err)
+				continue
+			}
+			r.sources = append(r.sources, entry)
+		case "probes":
+			probe, err := parseProbe(entry)
+			if err != nil {
+				r.fail(origin, "%v", err)
+				continue
+			}
+			duplicate := false
+			for _, existing := range r.probes {
+				duplicate = duplicate || existing.Name == probe.Name
+			}
+			if duplicate {
+				r.fail(origin, "probe %q is listed twice", probe.Name)
+				continue
+			}
+			r.probes = append(r.probes, probe)
+		}
+	}
+	if section == "rules" {
+		if len(rules) == 0 {
+			r.file["OBSERVER_SAMPLE_RULES"] = "-"
+		} else {
+			r.file["OBSERVER_SAMPLE_RULES"] = strings.Join(rules, ",")
+		}
+	}
+}
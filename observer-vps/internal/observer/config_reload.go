@@ -0,0 +1,174 @@
+package observer
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const configWatchInterval = 5 * time.Second
+
+// configReloadable lists the Config fields a reload applies in place. They
+// are read per request or per document, so changing them needs no new
+// listeners, connections or background jobs; anything else is reported as
+// needing a restart and left alone.
+var configReloadable = map[string]bool{
+	"APIKey":                true,
+	"ReadAPIKey":            true,
+	"AdminAPIKey":           true,
+	"JWTSecret":             true,
+	"EventTTLDays":          true,
+	"RuntimeTTLDays":        true,
+	"BackupTTLDays":         true,
+	"LiveDeviceTTLDays":     true,
+	"LiveDeviceStaleMs":     true,
+	"SourceSilenceMinutes":  true,
+	"SampleRules":           true,
+	"SampleBudgetPerMinute": true,
+	"RetentionPolicies":     true,
+	"Sources":               true,
+	"Probes":                true,
+	"ProbeIntervalMs":       true,
+	"ProbeTimeoutMs":        true,
+	"ProbeTTLDays":          true,
+}
+
+// settings is the config as of the last reload. Code reading a reloadable
+// field goes through it; everything else can keep using s.cfg.
+func (s *service) settings() *Config {
+	if cfg := s.current.Load(); cfg != nil {
+		return cfg
+	}
+	return &s.cfg
+}
+
+// watchConfig reloads on SIGHUP and, when a config file is in use, whenever
+// its modification time changes.
+func (s *service) watchConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	modTime := configModTime(s.cfg.ConfigFile)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("observer config reload requested by SIGHUP")
+		case <-ticker.C:
+			next := configModTime(s.cfg.ConfigFile)
+			if next.Equal(modTime) {
+				continue
+			}
+			modTime = next
+			log.Printf("observer config file %s changed, reloading", s.cfg.ConfigFile)
+		}
+		if err := s.reloadConfig(ctx); err != nil {
+			log.Printf("observer config reload rejected, keeping the running config: %v", err)
+		}
+	}
+}
+
+func configModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reloadConfig re-reads the file, environment and the original flags and
+// applies the reloadable fields. A config that fails validation is rejected
+// as a whole.
+func (s *service) reloadConfig(ctx context.Context) error {
+	next, err := LoadConfig(s.configArgs)
+	if err != nil {
+		return err
+	}
+	sampler, err := newSampler(next)
+	if err != nil {
+		return err
+	}
+
+	current := s.settings()
+	applied := *current
+	currentValue := reflect.ValueOf(current).Elem()
+	nextValue := reflect.ValueOf(next)
+	appliedValue := reflect.ValueOf(&applied).Elem()
+	for index := 0; index < nextValue.NumField(); index++ {
+		name := nextValue.Type().Field(index).Name
+		if reflect.DeepEqual(currentValue.Field(index).Interface(), nextValue.Field(index).Interface()) {
+			continue
+		}
+		if !configReloadable[name] {
+			log.Printf("observer config: %s changed but requires a restart", name)
+			continue
+		}
+		appliedValue.Field(index).Set(nextValue.Field(index))
+		log.Printf("observer config: applied new %s", name)
+	}
+
+	s.sampler.reconfigure(sampler)
+	changedKinds := s.retention.setFallback(applied)
+	s.current.Store(&applied)
+
+	if s.mongoBacked() {
+		for _, kind := range changedKinds {
+			s.retention.enqueue(kind, bson.M{}, "default ttl changed")
+		}
+	}
+	return s.applyConfigSections(ctx, &applied)
+}
+
+// applyConfigSections upserts the retention policies and source
+// registrations listed in the config file. Policies whose TTL and note are
+// already stored are skipped, so a reload does not queue needless backfills.
+// Nothing is deleted: entries removed from the file stay until removed
+// through the admin API.
+func (s *service) applyConfigSections(ctx context.Context, cfg *Config) error {
+	if len(cfg.RetentionPolicies) == 0 && len(cfg.Sources) == 0 {
+		return nil
+	}
+	if !s.mongoBacked() {
+		log.Printf("observer config: retention and sources sections need OBSERVER_STORAGE=%s; ignoring them", storageMongo)
+		return nil
+	}
+	now := time.Now().UTC()
+	saved := make([]retentionPolicy, 0)
+	for _, policy := range cfg.RetentionPolicies {
+		if existing, ok := s.retention.cached(policy); ok && existing.TTLDays == policy.TTLDays && existing.Note == policy.Note {
+			continue
+		}
+		policy.UpdatedAt = now
+		if err := s.retention.save(ctx, policy); err != nil {
+			return err
+		}
+		saved = append(saved, policy)
+	}
+	if len(saved) > 0 {
+		if err := s.retention.refresh(ctx); err != nil {
+			return err
+		}
+		for _, policy := range saved {
+			s.retention.enqueue(policy.Kind, policy.selector(), "config file")
+		}
+	}
+	for _, source := range cfg.Sources {
+		if _, err := s.saveSource(ctx, source, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package observer
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func writeConfigFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "observer.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigLayersFileEnvAndFlags(t *testing.T) {
+	t.Setenv("MONGO_URI", "mongodb://127.0.0.1:1/observer_test")
+	t.Setenv("OBSERVER_API_KEY", "")
+	t.Setenv("OBSERVER_LIVE_DEVICE_STALE_MS", "2000")
+	t.Setenv("OBSERVER_EVENT_TTL_DAYS", "")
+	t.Setenv("OBSERVER_PORT", "9001")
+	path := writeConfigFile(t, `
+apiKey: file-key
+port: 9000
+eventTtlDays: 10
+liveDeviceStaleMs: 1000
+redactPatterns: []
+redactAllowlist:
+  api-main: [email, phone]
+rules:
+  - source: api-main
+    category: http
+    rate: 0.25
+retention:
+  - kind: events
+    source: api-main
+    ttlDays: 30
+sources:
+  - source: api-main
+    expected: true
+    expectedKinds: [events, runtime]
+`)
+
+	cfg, err := LoadConfig([]string{"--config", path, "--port", "9100"})
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.APIKey != "file-key" || cfg.ReadAPIKey != "file-key" || cfg.EventTTLDays != 10 {
+		t.Errorf("file values = %q %q %d", cfg.APIKey, cfg.ReadAPIKey, cfg.EventTTLDays)
+	}
+	if cfg.LiveDeviceStaleMs != 2000 {
+		t.Errorf("LiveDeviceStaleMs = %d, want the env value over the file", cfg.LiveDeviceStaleMs)
+	}
+	if cfg.Port != "9100" {
+		t.Errorf("Port = %q, want the flag over env and file", cfg.Port)
+	}
+	if len(cfg.RedactPatterns) != 0 || strings.Join(cfg.RedactAllowlist["api-main"], "|") != "email|phone" {
+		t.Errorf("redact = %v %v", cfg.RedactPatterns, cfg.RedactAllowlist)
+	}
+	if len(cfg.SampleRules) != 1 || cfg.SampleRules[0] != "api-main/http/*=0.25" {
+		t.Errorf("SampleRules = %v", cfg.SampleRules)
+	}
+	if len(cfg.RetentionPolicies) != 1 || cfg.RetentionPolicies[0].TTLDays != 30 || len(cfg.Sources) != 1 {
+		t.Errorf("sections = %v %v", cfg.RetentionPolicies, cfg.Sources)
+	}
+}
+
+func TestLoadConfigNamesInvalidFields(t *testing.T) {
+	t.Setenv("MONGO_URI", "mongodb://127.0.0.1:1/observer_test")
+	t.Setenv("OBSERVER_API_KEY", testObserverKey)
+	t.Setenv("OBSERVER_REDACT_ENABLED", "maybe")
+	path := writeConfigFile(t, `
+eventTtlDays: soon
+bindHost: [a, b]
+liveDevicesStale: 10
+rules:
+  - source: api-main
+    rate: 2
+retention:
+  - kind: logs
+    ttlDays: 5
+sources:
+  - expected: true
+`)
+	t.Setenv("OBSERVER_CONFIG_FILE", path)
+
+	_, err := LoadConfig([]string{"--daily-event-quota", "-5"})
+	if err == nil {
+		t.Fatal("load config succeeded, want validation errors")
+	}
+	for _, want := range []string{
+		path + ": eventTtlDays: expected a non-negative integer",
+		path + ": bindHost: expected a single value",
+		path + ": liveDevicesStale: unknown field",
+		path + ": rules[0]: rate must be between 0 and 1",
+		path + ": retention[0]: kind must be",
+		path + ": sources[0]: source is required",
+		"OBSERVER_REDACT_ENABLED: expected true or false",
+		"--daily-event-quota: expected a non-negative integer",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestReloadConfigAppliesSafeFields(t *testing.T) {
+	svc, handler := newBoltTestService(t)
+	t.Setenv("OBSERVER_API_KEY", "")
+	path := writeConfigFile(t, `
+apiKey: rotated-key
+eventTtlDays: 30
+liveDeviceStaleMs: 45000
+port: 9999
+`)
+	t.Setenv("OBSERVER_CONFIG_FILE", path)
+
+	if err := svc.reloadConfig(context.Background()); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	settings := svc.settings()
+	if settings.APIKey != "rotated-key" || settings.EventTTLDays != 30 || settings.LiveDeviceStaleMs != 45000 {
+		t.Errorf("settings = %q %d %d, want the reloaded values", settings.APIKey, settings.EventTTLDays, settings.LiveDeviceStaleMs)
+	}
+	if settings.Port != svc.cfg.Port {
+		t.Errorf("Port = %q, want %q until a restart", settings.Port, svc.cfg.Port)
+	}
+	if days := svc.retention.fallbackDays(retentionKindEvents); days != 30 {
+		t.Errorf("event fallback ttl = %d, want 30", days)
+	}
+
+	code, _ := doJSON(t, handler, http.MethodPost, "/api/observer/ingest/events", gin.H{"source": "a", "events": []gin.H{{"type": "x"}}})
+	if code != http.StatusUnauthorized {
+		t.Errorf("old key after rotation = %d, want 401", code)
+	}
+
+	if err := os.WriteFile(path, []byte("eventTtlDays: never\n"), 0o600); err != nil {
+		t.Fatalf("rewrite config file: %v", err)
+	}
+	if err := svc.reloadConfig(context.Background()); err == nil || !strings.Contains(err.Error(), "eventTtlDays") {
+		t.Fatalf("reload of a bad file = %v, want an eventTtlDays error", err)
+	}
+	if svc.settings().EventTTLDays != 30 {
+		t.Errorf("EventTTLDays = %d after a rejected reload, want 30", svc.settings().EventTTLDays)
+	}
+}
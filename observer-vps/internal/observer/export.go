@@ -0,0 +1,352 @@
+package observer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	exportFormatNDJSON = "ndjson"
+	exportFormatCSV    = "csv"
+
+	exportBatchSize  = 500
+	exportFlushEvery = 500
+)
+
+// exportSpec describes one exportable collection. Rows are shaped with the same
+// item mapper as the matching list endpoint so exports and the API agree.
+// Exports read through docs, so they work on every backend; the archiver
+// still needs col.
+type exportSpec struct {
+	name      string
+	col       *mongo.Collection
+	docs      documentStore
+	timeField string
+	filter    func(*gin.Context) (bson.M, error)
+	item      func(bson.M) gin.H
+	columns   []string
+}
+
+func (s *service) exportSpec(kind string) (exportSpec, bool) {
+	switch kind {
+	case "events":
+		return exportSpec{
+			name:      "events",
+			col:       s.events,
+			docs:      s.store.events,
+			timeField: "occurredAt",
+			filter:    eventFilter,
+			item:      eventItem,
+			columns:   []string{"id", "occurredAt", "source", "category", "type", "level", "requestId", "method", "path", "statusCode", "durationMs", "ip", "tags"},
+		}, true
+	case "runtime":
+		return exportSpec{
+			name:      "runtime",
+			col:       s.runtime,
+			docs:      s.store.runtime,
+			timeField: "capturedAt",
+			filter:    plainFilter(runtimeFilter),
+			item:      runtimeItem,
+			columns:   []string{"id", "capturedAt", "source", "totals", "process"},
+		}, true
+	case "backups":
+		return exportSpec{
+			name:      "backups",
+			col:       s.backups,
+			docs:      s.store.backups,
+			timeField: "capturedAt",
+			filter:    plainFilter(backupFilter),
+			item:      backupItem,
+			columns:   []string{"id", "capturedAt", "source", "scope", "backupType", "status", "sizeBytes", "durationMs", "manifestUrl", "checksum", "verificationStatus", "verifiedAt", "note"},
+		}, true
+	case "live-devices":
+		return exportSpec{
+			name:      "live-devices",
+			col:       s.liveDevices,
+			docs:      s.store.liveDevices,
+			timeField: "lastSeenAt",
+			filter:    plainFilter(liveDeviceFilter),
+			item: func(row bson.M) gin.H {
+				return s.liveDeviceItem(row, time.Now().UTC())
+			},
+			columns: []string{"id", "lastSeenAt", "source", "deviceId", "platform", "deviceName", "operatorName", "courtName", "matchCode", "streamState", "overlayIssue", "recoverySeverity", "isOnline", "suspectedCrash", "suspectedCrashReason"},
+		}, true
+	}
+	return exportSpec{}, false
+}
+
+func plainFilter(build func(*gin.Context) bson.M) func(*gin.Context) (bson.M, error) {
+	return func(c *gin.Context) (bson.M, error) {
+		return build(c), nil
+	}
+}
+
+// exportRows streams a collection as NDJSON or CSV straight from the cursor,
+// so memory stays flat no matter how many rows match. Query parameters:
+// the list endpoint's filters, from/to on the collection's time field,
+// format=ndjson|csv, columns=a,b.c, gzip=1 and an optional limit.
+func (s *service) exportRows(c *gin.Context) {
+	spec, ok := s.exportSpec(strings.TrimSpace(c.Param("kind")))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "message": "Unknown export kind"})
+		return
+	}
+
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", exportFormatNDJSON)))
+	if format != exportFormatNDJSON && format != exportFormatCSV {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "format must be ndjson or csv"})
+		return
+	}
+	columns := []string{}
+	for _, column := range strings.Split(c.Query("columns"), ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 && format == exportFormatCSV {
+		columns = spec.columns
+	}
+
+	filter, err := spec.filter(c)
+	if err != nil {
+		writeQueryError(c, err)
+		return
+	}
+	timeRange := bson.M{}
+	for param, operator := range map[string]string{"from": "$gte", "to": "$lt"} {
+		raw := strings.TrimSpace(c.Query(param))
+		if raw == "" {
+			continue
+		}
+		parsed, err := parseTimeParam(raw, time.Now().UTC())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid " + param, "error": err.Error()})
+			return
+		}
+		timeRange[operator] = parsed
+	}
+	if len(timeRange) > 0 {
+		filter[spec.timeField] = timeRange
+	}
+
+	query := findQuery{
+		filter: filter,
+		sort:   bson.D{{Key: spec.timeField, Value: -1}, {Key: "_id", Value: -1}},
+	}
+	if limit := parseInt(c.Query("limit"), 0); limit > 0 {
+		query.limit = int64(limit)
+	}
+
+	compress := asBool(c.Query("gzip"))
+	filename := fmt.Sprintf("observer-%s-%s.%s", spec.name, time.Now().UTC().Format("20060102-150405"), format)
+	contentType := "application/x-ndjson"
+	if format == exportFormatCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	if compress {
+		filename += ".gz"
+		contentType = "application/gzip"
+	}
+
+	// The response starts with the first row, or once the query turns out
+	// empty, so a query that fails outright still answers with a 500.
+	var (
+		writer   *exportWriter
+		zipper   *gzip.Writer
+		writeErr error
+	)
+	start := func() error {
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+
+		var out io.Writer = c.Writer
+		if compress {
+			zipper = gzip.NewWriter(c.Writer)
+			out = zipper
+		}
+		var err error
+		writer, err = newExportWriter(format, bufio.NewWriterSize(out, 64<<10), columns)
+		return err
+	}
+
+	ctx := c.Request.Context()
+	rows := 0
+	err = spec.docs.each(ctx, query, func(row bson.M) error {
+		if writer == nil {
+			if writeErr = start(); writeErr != nil {
+				return writeErr
+			}
+		}
+		if writeErr = writer.write(spec.item(row)); writeErr != nil {
+			return writeErr
+		}
+		rows++
+		if rows%exportFlushEvery == 0 {
+			if writeErr = writer.flush(); writeErr != nil {
+				return writeErr
+			}
+			if zipper != nil {
+				zipper.Flush()
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	switch {
+	case err != nil && writer == nil && writeErr == nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load rows", "error": err.Error()})
+		return
+	case writeErr != nil:
+		// The client went away; there is nobody left to report to.
+		return
+	case err != nil:
+		log.Printf("observer export %s cursor error after %d rows: %v", spec.name, rows, err)
+	case writer == nil:
+		if err := start(); err != nil {
+			log.Printf("observer export %s header error: %v", spec.name, err)
+			return
+		}
+	}
+	writer.flush()
+	if zipper != nil {
+		zipper.Close()
+	}
+	c.Writer.Flush()
+}
+
+type exportWriter struct {
+	out     *bufio.Writer
+	csv     *csv.Writer
+	columns []string
+}
+
+// newExportWriter writes the CSV header up front so an empty result is still
+// a valid file with the requested columns.
+func newExportWriter(format string, out *bufio.Writer, columns []string) (*exportWriter, error) {
+	writer := &exportWriter{out: out, columns: columns}
+	if format == exportFormatCSV {
+		writer.csv = csv.NewWriter(out)
+		if err := writer.csv.Write(columns); err != nil {
+			return nil, err
+		}
+	}
+	return writer, nil
+}
+
+func (w *exportWriter) write(item gin.H) error {
+	if w.csv != nil {
+		record := make([]string, len(w.columns))
+		for index, column := range w.columns {
+			record[index] = exportCell(lookupPath(item, column))
+		}
+		return w.csv.Write(record)
+	}
+
+	var line any = item
+	if len(w.columns) > 0 {
+		projected := make(map[string]any, len(w.columns))
+		for _, column := range w.columns {
+			projected[column] = lookupPath(item, column)
+		}
+		line = projected
+	}
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if _, err := w.out.Write(encoded); err != nil {
+		return err
+	}
+	return w.out.WriteByte('\n')
+}
+
+func (w *exportWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return w.out.Flush()
+}
+
+// lookupPath resolves a dotted column such as "payload.deviceId".
+func lookupPath(item map[string]any, path string) any {
+	var current any = item
+	for _, part := range strings.Split(path, ".") {
+		object := toMap(current)
+		value, ok := object[part]
+		if !ok {
+			return nil
+		}
+		current = value
+	}
+	return current
+}
+
+func exportCell(value any) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case bool:
+		return strconv.FormatBool(typed)
+	case int:
+		return strconv.Itoa(typed)
+	case int32:
+		return strconv.FormatInt(int64(typed), 10)
+	case int64:
+		return strconv.FormatInt(typed, 10)
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case time.Time:
+		if typed.IsZero() {
+			return ""
+		}
+		return typed.UTC().Format(time.RFC3339Nano)
+	case primitive.DateTime:
+		return typed.Time().UTC().Format(time.RFC3339Nano)
+	case primitive.ObjectID:
+		return typed.Hex()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// parseTimeParam accepts RFC3339, a bare date, unix milliseconds or a
+// duration meaning "that long before now" (for example 24h).
+func parseTimeParam(raw string, now time.Time) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return parsed.UTC(), nil
+	}
+	if parsed, err := time.Parse("2006-01-02", raw); err == nil {
+		return parsed.UTC(), nil
+	}
+	if millis, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(millis).UTC(), nil
+	}
+	if duration, err := time.ParseDuration(strings.TrimPrefix(raw, "-")); err == nil {
+		return now.Add(-duration), nil
+	}
+	return time.Time{}, fmt.Errorf("expected RFC3339, YYYY-MM-DD, unix milliseconds or a duration, got %q", raw)
+}
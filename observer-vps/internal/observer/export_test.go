@@ -0,0 +1,132 @@
+package observer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// getExport fetches an export and returns the decompressed body.
+func getExport(t *testing.T, handler http.Handler, path string) (*httptest.ResponseRecorder, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("x-pkt-observer-key", testObserverKey)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	body := rec.Body.Bytes()
+	if rec.Header().Get("Content-Type") == "application/gzip" {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("%s: open gzip: %v", path, err)
+		}
+		if body, err = io.ReadAll(reader); err != nil {
+			t.Fatalf("%s: read gzip: %v", path, err)
+		}
+	}
+	return rec, body
+}
+
+func TestExportStreamsEventsAsNDJSONAndCSV(t *testing.T) {
+	svc, handler := newTestService(t)
+	base := time.Date(2026, 4, 8, 9, 0, 0, 0, time.UTC)
+	docs := []any{}
+	for index, deviceID := range []string{"court-1", "court-2", "court-3"} {
+		docs = append(docs, bson.M{
+			"source":     "api",
+			"category":   "http",
+			"type":       "request",
+			"level":      "info",
+			"tags":       []any{"live", deviceID},
+			"occurredAt": base.Add(time.Duration(index) * time.Hour),
+			"payload":    bson.M{"deviceId": deviceID},
+		})
+	}
+	docs = append(docs, bson.M{"source": "worker", "level": "error", "occurredAt": base})
+	if err := svc.store.events.insertMany(context.Background(), docs); err != nil {
+		t.Fatalf("seed events: %v", err)
+	}
+
+	rec, body := getExport(t, handler, "/api/observer/read/export/events?source=api")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("ndjson export = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	lines := []map[string]any{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("decode line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("ndjson export has %d lines, want the 3 api events", len(lines))
+	}
+	if device := toMap(lines[0]["payload"])["deviceId"]; device != "court-3" || lines[0]["category"] != "http" || lines[0]["id"] == "" {
+		t.Errorf("first line = %v, want the newest event as a full item", lines[0])
+	}
+
+	_, body = getExport(t, handler, "/api/observer/read/export/events?source=api&limit=1&columns=payload.deviceId,level,missing.path")
+	var projected map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(body), &projected); err != nil {
+		t.Fatalf("decode projected line %q: %v", body, err)
+	}
+	want := map[string]any{"payload.deviceId": "court-3", "level": "info", "missing.path": nil}
+	if !reflect.DeepEqual(projected, want) {
+		t.Errorf("projected line = %v, want %v", projected, want)
+	}
+
+	rec, body = getExport(t, handler, "/api/observer/read/export/events?source=api&format=csv")
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") || len(records) != 4 {
+		t.Fatalf("csv export = %s with %d records, want a header and 3 rows", rec.Header().Get("Content-Type"), len(records))
+	}
+	if spec, _ := svc.exportSpec("events"); !reflect.DeepEqual(records[0], spec.columns) {
+		t.Errorf("csv header = %v, want the default columns", records[0])
+	}
+
+	rec, body = getExport(t, handler, "/api/observer/read/export/events?source=api&format=csv&gzip=1&columns=occurredAt,payload.deviceId,tags&from=2026-04-08T09:30:00Z&to=2026-04-08T10:30:00Z")
+	if rec.Header().Get("Content-Type") != "application/gzip" || !strings.Contains(rec.Header().Get("Content-Disposition"), ".csv.gz") {
+		t.Errorf("gzip export headers = %v", rec.Header())
+	}
+	records, err = csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatalf("parse gzipped csv: %v", err)
+	}
+	wantRecords := [][]string{
+		{"occurredAt", "payload.deviceId", "tags"},
+		{"2026-04-08T10:00:00Z", "court-2", `["live","court-2"]`},
+	}
+	if !reflect.DeepEqual(records, wantRecords) {
+		t.Errorf("ranged csv = %v, want %v", records, wantRecords)
+	}
+
+	rec, body = getExport(t, handler, "/api/observer/read/export/events?source=nobody&format=csv&columns=id,level")
+	if rec.Code != http.StatusOK || string(body) != "id,level\n" {
+		t.Errorf("empty export = %d %q, want only the header", rec.Code, body)
+	}
+	for path, code := range map[string]int{
+		"/api/observer/read/export/events?from=yesterday": http.StatusBadRequest,
+		"/api/observer/read/export/events?format=xml":     http.StatusBadRequest,
+		"/api/observer/read/export/issues":                http.StatusNotFound,
+	} {
+		if rec, _ := getExport(t, handler, path); rec.Code != code {
+			t.Errorf("%s = %d, want %d", path, rec.Code, code)
+		}
+	}
+}
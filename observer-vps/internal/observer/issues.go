@@ -0,0 +1,466 @@
+package observer
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	issueStatusOpen     = "open"
+	issueStatusResolved = "resolved"
+	issueStatusIgnored  = "ignored"
+
+	issueTitleMax      = 200
+	issueMessageMax    = 500
+	issueDevicesMax    = 100
+	issueRecentEvents  = 20
+	issueSummaryLimit  = 10
+	issueFingerprintID = 16
+)
+
+var (
+	issueUUIDRe     = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	issueHexRe      = regexp.MustCompile(`(?i)\b(?:0x)?[0-9a-f]{12,}\b`)
+	issueQuotedRe   = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	issueNumberRe   = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	issueSpaceRe    = regexp.MustCompile(`\s+`)
+	issuePathIDRe   = regexp.MustCompile(`^(?:\d+|[0-9a-fA-F]{24}|[0-9a-fA-F-]{32,36}|[0-9a-fA-F]{12,})$`)
+	issueStatusList = map[string]bool{issueStatusOpen: true, issueStatusResolved: true, issueStatusIgnored: true}
+)
+
+// eventMessage picks the human readable message out of an event payload.
+func eventMessage(doc bson.M) string {
+	payload := toMap(doc["payload"])
+	errorText, _ := payload["error"].(string)
+	return firstString(payload["message"], payload["reasonText"], toMap(payload["error"])["message"], payload["errorMessage"], errorText)
+}
+
+// normalizeIssueMessage strips the parts of a message that vary between
+// occurrences of the same error: ids, numbers and quoted values.
+func normalizeIssueMessage(message string) string {
+	message = issueUUIDRe.ReplaceAllString(message, "<uuid>")
+	message = issueHexRe.ReplaceAllString(message, "<hex>")
+	message = issueQuotedRe.ReplaceAllString(message, "<str>")
+	message = issueNumberRe.ReplaceAllString(message, "<n>")
+	message = strings.TrimSpace(issueSpaceRe.ReplaceAllString(message, " "))
+	return truncateUTF8(message, issueMessageMax)
+}
+
+// truncateUTF8 cuts value to at most max bytes without splitting a
+// multi-byte character.
+func truncateUTF8(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	for max > 0 && !utf8.RuneStart(value[max]) {
+		max--
+	}
+	return value[:max]
+}
+
+// normalizeIssuePath drops the query string and replaces id-like segments.
+func normalizeIssuePath(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	segments := strings.Split(path, "/")
+	for index, segment := range segments {
+		if issuePathIDRe.MatchString(segment) {
+			segments[index] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// issueFingerprintOverride reads a client supplied fingerprint, either a
+// string or a list of strings in the Sentry style.
+func issueFingerprintOverride(value any) string {
+	if parts := toSlice(value); len(parts) > 0 {
+		return strings.Join(normalizeTags(parts), "|")
+	}
+	if text, ok := value.(string); ok {
+		return strings.TrimSpace(text)
+	}
+	return ""
+}
+
+// stampFingerprint sets doc["fingerprint"] for error events and for events
+// that carry an explicit override. It returns false for events that are not
+// tracked as issues.
+func stampFingerprint(doc bson.M) bool {
+	override := asString(doc["fingerprint"])
+	if override == "" && !isErrorEvent(doc) {
+		delete(doc, "fingerprint")
+		return false
+	}
+	key := "override\x00" + override
+	if override == "" {
+		key = strings.Join([]string{
+			asString(doc["type"]),
+			normalizeIssuePath(firstString(doc["path"], doc["url"])),
+			normalizeIssueMessage(eventMessage(doc)),
+		}, "\x00")
+	}
+	sum := sha1.Sum([]byte(key))
+	doc["fingerprint"] = hex.EncodeToString(sum[:])[:issueFingerprintID]
+	return true
+}
+
+type issueOccurrences struct {
+	fingerprint string
+	first       time.Time
+	last        time.Time
+	received    time.Time
+	count       int
+	sample      bson.M
+	sources     map[string]bool
+	devices     map[string]bool
+}
+
+// groupIssueOccurrences folds a batch of fingerprinted events per
+// fingerprint, in first-seen order.
+func groupIssueOccurrences(docs []any, now time.Time) (map[string]*issueOccurrences, []string) {
+	groups := map[string]*issueOccurrences{}
+	order := []string{}
+	for _, item := range docs {
+		doc, ok := item.(bson.M)
+		if !ok {
+			continue
+		}
+		fingerprint := asString(doc["fingerprint"])
+		if fingerprint == "" {
+			continue
+		}
+		occurredAt := parseTime(doc["occurredAt"])
+		group := groups[fingerprint]
+		if group == nil {
+			group = &issueOccurrences{fingerprint: fingerprint, first: occurredAt, last: occurredAt, sources: map[string]bool{}, devices: map[string]bool{}}
+			groups[fingerprint] = group
+			order = append(order, fingerprint)
+		}
+		group.count++
+		if occurredAt.Before(group.first) {
+			group.first = occurredAt
+		}
+		if !occurredAt.Before(group.last) {
+			group.last = occurredAt
+			group.sample = doc
+		}
+		if receivedAt := parseTime(firstNonNil(doc["receivedAt"], now)); receivedAt.After(group.received) {
+			group.received = receivedAt
+		}
+		if source := asString(doc["source"]); source != "" {
+			group.sources[source] = true
+		}
+		if deviceID := asString(toMap(doc["payload"])["deviceId"]); deviceID != "" {
+			group.devices[deviceID] = true
+		}
+	}
+	return groups, order
+}
+
+// recordIssues folds a batch of freshly inserted events into observer_issues.
+// Resolved issues that receive another occurrence after being resolved are
+// reopened.
+func (s *service) recordIssues(ctx context.Context, docs []any) error {
+	now := time.Now().UTC()
+	groups, order := groupIssueOccurrences(docs, now)
+	if len(groups) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(groups)*3)
+	for _, fingerprint := range order {
+		group := groups[fingerprint]
+		sample := group.sample
+		message := eventMessage(sample)
+		title := defaultString(message, asString(sample["type"]))
+		title = truncateUTF8(title, issueTitleMax)
+		models = append(models,
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"fingerprint": fingerprint}).
+				SetUpdate(bson.M{
+					"$setOnInsert": bson.M{
+						"fingerprint": fingerprint,
+						"status":      issueStatusOpen,
+						"createdAt":   now,
+					},
+					"$min": bson.M{"firstSeenAt": group.first},
+					"$max": bson.M{"lastSeenAt": group.last},
+					"$inc": bson.M{"count": group.count},
+					"$set": bson.M{
+						"title":       title,
+						"type":        asString(sample["type"]),
+						"category":    asString(sample["category"]),
+						"level":       asString(sample["level"]),
+						"path":        normalizeIssuePath(firstString(sample["path"], sample["url"])),
+						"lastMessage": message,
+						"lastSource":  asString(sample["source"]),
+						"updatedAt":   now,
+					},
+					"$addToSet": bson.M{
+						"sources": bson.M{"$each": sortedKeys(group.sources)},
+						"devices": bson.M{"$each": sortedKeys(group.devices)},
+					},
+				}).
+				SetUpsert(true),
+			// $addToSet appends, so trimming from the front keeps the
+			// devices seen most recently.
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"fingerprint": fingerprint, fmt.Sprintf("devices.%d", issueDevicesMax): bson.M{"$exists": true}}).
+				SetUpdate(bson.M{"$push": bson.M{"devices": bson.M{"$each": bson.A{}, "$slice": -issueDevicesMax}}}),
+			mongo.NewUpdateOneModel().
+				SetFilter(issueReopenFilter(group)).
+				SetUpdate(bson.M{
+					"$set":   bson.M{"status": issueStatusOpen, "reopenedAt": now, "updatedAt": now},
+					"$unset": bson.M{"resolvedAt": ""},
+					"$inc":   bson.M{"regressions": 1},
+				}),
+		)
+	}
+	_, err := s.issues.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(true))
+	return err
+}
+
+// issueReopenFilter matches the issue while it is resolved from before the
+// group was received. occurredAt comes from the client, so a device with a
+// slow clock or a queued offline upload would keep a regression resolved.
+func issueReopenFilter(group *issueOccurrences) bson.M {
+	return bson.M{
+		"fingerprint": group.fingerprint,
+		"status":      issueStatusResolved,
+		"resolvedAt":  bson.M{"$lt": group.received},
+	}
+}
+
+// insertEvents is the single write path into observer_events: it samples,
+// stamps fingerprints, inserts, then updates issues. Issue bookkeeping
+// failures are logged rather than failing an ingest whose events are already
+// stored.
+func (s *service) insertEvents(ctx context.Context, received []any) (int, error) {
+	now := time.Now().UTC()
+	for _, item := range received {
+		if doc, ok := item.(bson.M); ok {
+			s.registry.note(asString(doc["source"]), sourceKindEvents, 1, now)
+		}
+	}
+	docs := s.sampler.filter(received, now)
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	tracked := false
+	for _, item := range docs {
+		doc, ok := item.(bson.M)
+		if !ok {
+			continue
+		}
+		doc["expireAt"] = s.retention.expireAt(retentionKindEvents, doc, parseTime(doc["occurredAt"]))
+		if stampFingerprint(doc) {
+			tracked = true
+		}
+	}
+	err := s.store.events.insertMany(ctx, docs)
+	s.writes.record(retentionKindEvents, err, now)
+	if err != nil {
+		return 0, err
+	}
+	inserted := make([]bson.M, 0, len(docs))
+	for _, item := range docs {
+		if doc, ok := item.(bson.M); ok {
+			inserted = append(inserted, doc)
+		}
+	}
+	s.changes.notify(ctx, changeTopicEvents, "insert", inserted...)
+	if tracked && s.mongoBacked() {
+		if err := s.recordIssues(ctx, docs); err != nil {
+			log.Printf("observer issue tracking error: %v", err)
+		}
+	}
+	return len(docs), nil
+}
+
+func issueFilter(c *gin.Context) bson.M {
+	filter := bson.M{}
+	if status := strings.ToLower(strings.TrimSpace(c.Query("status"))); status != "" && status != "all" {
+		filter["status"] = status
+	}
+	if source := strings.TrimSpace(c.Query("source")); source != "" {
+		filter["sources"] = source
+	}
+	if deviceID := strings.TrimSpace(c.Query("deviceId")); deviceID != "" {
+		filter["devices"] = deviceID
+	}
+	if issueType := strings.TrimSpace(c.Query("type")); issueType != "" {
+		filter["type"] = issueType
+	}
+	return filter
+}
+
+func issueItem(row bson.M) gin.H {
+	devices := normalizeStringList(row["devices"])
+	return gin.H{
+		"fingerprint":  asString(row["fingerprint"]),
+		"status":       asString(row["status"]),
+		"title":        asString(row["title"]),
+		"type":         asString(row["type"]),
+		"category":     asString(row["category"]),
+		"level":        asString(row["level"]),
+		"path":         asString(row["path"]),
+		"lastMessage":  asString(row["lastMessage"]),
+		"lastSource":   asString(row["lastSource"]),
+		"count":        normalizeIntValue(row["count"]),
+		"regressions":  normalizeIntValue(row["regressions"]),
+		"firstSeenAt":  row["firstSeenAt"],
+		"lastSeenAt":   row["lastSeenAt"],
+		"resolvedAt":   row["resolvedAt"],
+		"reopenedAt":   row["reopenedAt"],
+		"sources":      normalizeStringList(row["sources"]),
+		"devices":      devices,
+		"deviceCount":  len(devices),
+		"note":         asString(row["note"]),
+		"statusUpdate": firstObject(row["statusUpdate"]),
+	}
+}
+
+func (s *service) listIssues(c *gin.Context) {
+	sortBy := bson.D{{Key: "lastSeenAt", Value: -1}, {Key: "_id", Value: -1}}
+	switch strings.TrimSpace(c.Query("sort")) {
+	case "count":
+		sortBy = bson.D{{Key: "count", Value: -1}, {Key: "lastSeenAt", Value: -1}}
+	case "firstSeen":
+		sortBy = bson.D{{Key: "firstSeenAt", Value: -1}, {Key: "_id", Value: -1}}
+	}
+	limit := clampInt(parseInt(c.DefaultQuery("limit", "50"), 50), 1, 200)
+	s.queryCollectionWith(c, mongoDocuments{col: s.issues}, findQuery{filter: issueFilter(c), sort: sortBy, limit: int64(limit)}, issueItem)
+}
+
+func (s *service) getIssue(c *gin.Context) {
+	fingerprint := strings.TrimSpace(c.Param("fingerprint"))
+	var row bson.M
+	if err := s.issues.FindOne(c.Request.Context(), bson.M{"fingerprint": fingerprint}).Decode(&row); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"ok": false, "message": "Issue not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load issue", "error": err.Error()})
+		return
+	}
+
+	cursor, err := s.events.Find(
+		c.Request.Context(),
+		bson.M{"fingerprint": fingerprint},
+		options.Find().SetSort(bson.D{{Key: "occurredAt", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(issueRecentEvents),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load issue events", "error": err.Error()})
+		return
+	}
+	defer cursor.Close(c.Request.Context())
+	var rows []bson.M
+	if err := cursor.All(c.Request.Context(), &rows); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to decode issue events", "error": err.Error()})
+		return
+	}
+	events := make([]gin.H, 0, len(rows))
+	for _, event := range rows {
+		events = append(events, eventItem(event))
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "issue": issueItem(row), "recentEvents": events})
+}
+
+func (s *service) updateIssue(c *gin.Context) {
+	fingerprint := strings.TrimSpace(c.Param("fingerprint"))
+	body, ok := bindJSONMap(c)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	set := bson.M{"updatedAt": now}
+	unset := bson.M{}
+	if status := strings.ToLower(strings.TrimSpace(asString(body["status"]))); status != "" {
+		if !issueStatusList[status] {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "status must be open, resolved or ignored"})
+			return
+		}
+		set["status"] = status
+		set["statusUpdate"] = bson.M{"status": status, "at": now, "by": strings.TrimSpace(asString(body["by"]))}
+		if status == issueStatusResolved {
+			set["resolvedAt"] = now
+		} else {
+			unset["resolvedAt"] = ""
+		}
+	}
+	if note, ok := body["note"]; ok {
+		set["note"] = strings.TrimSpace(asString(note))
+	}
+	if len(set) == 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Nothing to update; send status and/or note"})
+		return
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var row bson.M
+	err := s.issues.FindOneAndUpdate(
+		c.Request.Context(),
+		bson.M{"fingerprint": fingerprint},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&row)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "message": "Issue not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to update issue", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "issue": issueItem(row)})
+}
+
+// loadIssueSummary returns the most recently seen open issues for the
+// summary endpoint, optionally restricted to one source.
+func (s *service) loadIssueSummary(ctx context.Context, source string, since time.Time) ([]gin.H, error) {
+	filter := bson.M{"status": issueStatusOpen, "lastSeenAt": bson.M{"$gte": since}}
+	if source != "" {
+		filter["sources"] = source
+	}
+	cursor, err := s.issues.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}}).SetLimit(issueSummaryLimit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []bson.M
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	items := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, issueItem(row))
+	}
+	return items, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for key := range set {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,128 @@
+package observer
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNormalizeIssueMessageKeepsUTF8(t *testing.T) {
+	message := strings.Repeat("Không tìm thấy giải đấu ", 40)
+	normalized := normalizeIssueMessage(message)
+	if len(normalized) > issueMessageMax || !utf8.ValidString(normalized) {
+		t.Fatalf("normalized = %d bytes, valid UTF-8 %v", len(normalized), utf8.ValidString(normalized))
+	}
+	if got := truncateUTF8("giải", 3); got != "gi" {
+		t.Errorf("truncateUTF8 = %q, want the cut before the multi-byte ả", got)
+	}
+}
+
+func TestStampFingerprintNormalizesVaryingParts(t *testing.T) {
+	event := func(path, message string) bson.M {
+		return bson.M{"type": "request", "level": "error", "path": path, "payload": bson.M{"message": message}}
+	}
+	fingerprint := func(doc bson.M) string {
+		t.Helper()
+		if !stampFingerprint(doc) {
+			t.Fatalf("event %v was not tracked", doc)
+		}
+		return asString(doc["fingerprint"])
+	}
+
+	base := fingerprint(event("/api/matches/42?tab=1", `Match 42 not found for "An"`))
+	same := []bson.M{
+		event("/api/matches/65f1c2a9e4b0a1b2c3d4e5f6", `Match 7 not found for "Binh"`),
+		event("/api/matches/9", "Match  1001 not found for 'Chi'"),
+	}
+	for _, doc := range same {
+		if got := fingerprint(doc); got != base {
+			t.Errorf("fingerprint of %v = %s, want %s", doc["payload"], got, base)
+		}
+	}
+	different := []bson.M{
+		event("/api/tournaments/42", `Match 42 not found for "An"`),
+		event("/api/matches/42", "Court 42 not found"),
+		{"type": "job", "level": "error", "path": "/api/matches/42", "payload": bson.M{"message": `Match 42 not found for "An"`}},
+	}
+	for _, doc := range different {
+		if got := fingerprint(doc); got == base {
+			t.Errorf("fingerprint of %v matched an unrelated issue", doc)
+		}
+	}
+	if got := normalizeIssueMessage("job 550e8400-e29b-41d4-a716-446655440000 took 12.5 seconds at 0xdeadbeefcafe"); got != "job <uuid> took <n> seconds at <hex>" {
+		t.Errorf("normalizeIssueMessage = %q", got)
+	}
+
+	info := bson.M{"type": "request", "level": "info", "fingerprint": ""}
+	if stampFingerprint(info) {
+		t.Error("info event without an override was tracked")
+	}
+	if _, ok := info["fingerprint"]; ok {
+		t.Error("untracked event kept an empty fingerprint field")
+	}
+}
+
+func TestStampFingerprintHonoursClientOverride(t *testing.T) {
+	listed := bson.M{"type": "request", "level": "info", "fingerprint": issueFingerprintOverride([]any{"payments", "timeout"})}
+	joined := bson.M{"type": "job", "level": "error", "fingerprint": issueFingerprintOverride(" payments|timeout ")}
+	if !stampFingerprint(listed) || !stampFingerprint(joined) {
+		t.Fatal("events with an override were not tracked")
+	}
+	if listed["fingerprint"] != joined["fingerprint"] {
+		t.Errorf("override fingerprints %v and %v differ, want the override alone to group them", listed["fingerprint"], joined["fingerprint"])
+	}
+	derived := bson.M{"type": "job", "level": "error", "payload": bson.M{"message": "payments|timeout"}}
+	stampFingerprint(derived)
+	if derived["fingerprint"] == joined["fingerprint"] {
+		t.Error("a derived fingerprint collided with an override")
+	}
+}
+
+func TestIssueReopenUsesReceiptTime(t *testing.T) {
+	resolvedAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	issue := bson.M{"fingerprint": "abc", "status": issueStatusResolved, "resolvedAt": resolvedAt}
+	occurrence := func(occurredAt, receivedAt time.Time) bson.M {
+		return bson.M{"fingerprint": "abc", "occurredAt": occurredAt, "receivedAt": receivedAt}
+	}
+	cases := []struct {
+		name   string
+		docs   []any
+		reopen bool
+	}{
+		{
+			name:   "late upload of an occurrence from before the fix",
+			docs:   []any{occurrence(resolvedAt.Add(-time.Hour), resolvedAt.Add(time.Minute))},
+			reopen: true,
+		},
+		{
+			name: "client clock ahead of the server",
+			docs: []any{occurrence(resolvedAt.Add(time.Hour), resolvedAt.Add(-time.Minute))},
+		},
+		{
+			name:   "latest receipt in the batch",
+			docs:   []any{occurrence(resolvedAt, resolvedAt.Add(-time.Minute)), occurrence(resolvedAt.Add(-2*time.Hour), resolvedAt.Add(time.Second))},
+			reopen: true,
+		},
+	}
+	for _, tc := range cases {
+		groups, order := groupIssueOccurrences(tc.docs, resolvedAt)
+		if len(order) != 1 {
+			t.Fatalf("%s: %d groups, want 1", tc.name, len(order))
+		}
+		if got := matchDocument(issue, issueReopenFilter(groups[order[0]])); got != tc.reopen {
+			t.Errorf("%s: reopen = %v, want %v", tc.name, got, tc.reopen)
+		}
+	}
+
+	groups, order := groupIssueOccurrences([]any{bson.M{"fingerprint": "abc", "occurredAt": resolvedAt.Add(-time.Hour)}}, resolvedAt.Add(time.Minute))
+	if !matchDocument(issue, issueReopenFilter(groups[order[0]])) {
+		t.Error("occurrence without receivedAt did not fall back to the batch time")
+	}
+	open := bson.M{"fingerprint": "abc", "status": issueStatusOpen}
+	if matchDocument(open, issueReopenFilter(groups[order[0]])) {
+		t.Error("reopen filter matched an issue that is already open")
+	}
+}
@@ -8,7 +8,6 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type liveDeviceEventEnvelope struct {
@@ -49,6 +48,20 @@ func (s *service) ingestLiveDeviceHeartbeat(c *gin.Context) {
 		return
 	}
 
+	charge := newIngestCharge(false)
+	charge.add(source, deviceID, 1)
+	if !s.admitIngest(c, charge) {
+		return
+	}
+	// Scrub the report the same way event envelopes are; every stored field
+	// below is read from the redacted copies.
+	body = s.redact.payload(source, body)
+	if redacted := toMap(body["status"]); len(redacted) > 0 {
+		status = redacted
+	} else {
+		status = body
+	}
+
 	capturedAt := parseTime(firstNonNil(body["capturedAt"], status["capturedAt"]))
 	heartbeatIntervalMs := clampInt(
 		parseInt(firstString(body["heartbeatIntervalMs"], status["heartbeatIntervalMs"]), 10_000),
@@ -56,7 +69,7 @@ func (s *service) ingestLiveDeviceHeartbeat(c *gin.Context) {
 		120_000,
 	)
 	staleAfterMs := clampInt(
-		parseInt(firstString(body["staleAfterMs"], status["staleAfterMs"]), maxInt(s.cfg.LiveDeviceStaleMs, heartbeatIntervalMs*3)),
+		parseInt(firstString(body["staleAfterMs"], status["staleAfterMs"]), maxInt(s.settings().LiveDeviceStaleMs, heartbeatIntervalMs*3)),
 		heartbeatIntervalMs,
 		10*60*1000,
 	)
@@ -79,66 +92,64 @@ func (s *service) ingestLiveDeviceHeartbeat(c *gin.Context) {
 	app := firstObject(status["app"])
 	device := firstObject(status["device"])
 
-	update := bson.M{
-		"$set": bson.M{
-			"source":              source,
-			"deviceId":            deviceID,
-			"platform":            defaultString(firstString(status["platform"], device["platform"]), "ios"),
-			"deviceName":          firstString(device["name"], status["deviceName"]),
-			"deviceModel":         firstString(device["model"], status["deviceModel"]),
-			"deviceManufacturer":  firstString(device["manufacturer"], status["deviceManufacturer"]),
-			"deviceBrand":         firstString(device["brand"], status["deviceBrand"]),
-			"deviceProduct":       firstString(device["product"], status["deviceProduct"]),
-			"operatorUserId":      firstString(operator["userId"]),
-			"operatorName":        firstString(operator["displayName"], operator["name"]),
-			"operatorRole":        firstString(operator["role"]),
-			"routeLabel":          firstString(route["label"], status["routeLabel"]),
-			"screenState":         firstString(status["screenState"], presence["screenState"]),
-			"courtId":             firstString(court["id"], status["courtId"]),
-			"courtName":           firstString(court["name"], status["courtName"]),
-			"matchId":             firstString(match["id"], status["matchId"]),
-			"matchCode":           firstString(match["code"], status["matchCode"]),
-			"streamState":         firstString(stream["state"], status["streamState"]),
-			"overlayIssue":        firstString(overlay["issue"], overlay["lastIssue"], status["overlayIssue"]),
-			"recoverySeverity":    firstString(recovery["severity"]),
-			"recoveryStage":       firstString(recovery["stage"]),
-			"warningCount":        len(warnings),
-			"heartbeatIntervalMs": heartbeatIntervalMs,
-			"staleAfterMs":        staleAfterMs,
-			"capturedAt":          capturedAt,
-			"lastSeenAt":          now,
-			"receivedAt":          now,
-			"expireAt":            buildExpireAt(s.cfg.LiveDeviceTTLDays, now),
-			"app":                 app,
-			"device":              device,
-			"operator":            operator,
-			"route":               route,
-			"court":               court,
-			"match":               match,
-			"stream":              stream,
-			"recording":           recording,
-			"overlay":             overlay,
-			"presence":            presence,
-			"network":             network,
-			"battery":             battery,
-			"thermal":             thermal,
-			"recovery":            recovery,
-			"warnings":            warnings,
-			"diagnostics":         diagnostics,
-			"payload":             status,
-			"updatedAt":           now,
-		},
-		"$setOnInsert": bson.M{
-			"createdAt": now,
-		},
+	set := bson.M{
+		"source":              source,
+		"deviceId":            deviceID,
+		"platform":            defaultString(firstString(status["platform"], device["platform"]), "ios"),
+		"deviceName":          firstString(device["name"], status["deviceName"]),
+		"deviceModel":         firstString(device["model"], status["deviceModel"]),
+		"deviceManufacturer":  firstString(device["manufacturer"], status["deviceManufacturer"]),
+		"deviceBrand":         firstString(device["brand"], status["deviceBrand"]),
+		"deviceProduct":       firstString(device["product"], status["deviceProduct"]),
+		"operatorUserId":      firstString(operator["userId"]),
+		"operatorName":        firstString(operator["displayName"], operator["name"]),
+		"operatorRole":        firstString(operator["role"]),
+		"routeLabel":          firstString(route["label"], status["routeLabel"]),
+		"screenState":         firstString(status["screenState"], presence["screenState"]),
+		"courtId":             firstString(court["id"], status["courtId"]),
+		"courtName":           firstString(court["name"], status["courtName"]),
+		"matchId":             firstString(match["id"], status["matchId"]),
+		"matchCode":           firstString(match["code"], status["matchCode"]),
+		"streamState":         firstString(stream["state"], status["streamState"]),
+		"overlayIssue":        firstString(overlay["issue"], overlay["lastIssue"], status["overlayIssue"]),
+		"recoverySeverity":    firstString(recovery["severity"]),
+		"recoveryStage":       firstString(recovery["stage"]),
+		"warningCount":        len(warnings),
+		"heartbeatIntervalMs": heartbeatIntervalMs,
+		"staleAfterMs":        staleAfterMs,
+		"capturedAt":          capturedAt,
+		"lastSeenAt":          now,
+		"receivedAt":          now,
+		"expireAt":            s.retention.expireAt(retentionKindLiveDevices, bson.M{"source": source}, now),
+		"app":                 app,
+		"device":              device,
+		"operator":            operator,
+		"route":               route,
+		"court":               court,
+		"match":               match,
+		"stream":              stream,
+		"recording":           recording,
+		"overlay":             overlay,
+		"presence":            presence,
+		"network":             network,
+		"battery":             battery,
+		"thermal":             thermal,
+		"recovery":            recovery,
+		"warnings":            warnings,
+		"diagnostics":         diagnostics,
+		"payload":             status,
+		"updatedAt":           now,
 	}
 
-	if _, err := s.liveDevices.UpdateOne(
+	filter := bson.M{"source": source, "deviceId": deviceID}
+	err := s.store.liveDevices.upsert(
 		c.Request.Context(),
-		bson.M{"source": source, "deviceId": deviceID},
-		update,
-		options.Update().SetUpsert(true),
-	); err != nil {
+		filter,
+		set,
+		bson.M{"createdAt": now},
+	)
+	s.writes.record(retentionKindLiveDevices, err, now)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"ok":      false,
 			"message": "Failed to save live device heartbeat",
@@ -146,6 +157,8 @@ func (s *service) ingestLiveDeviceHeartbeat(c *gin.Context) {
 		})
 		return
 	}
+	s.changes.notifyUpsert(c.Request.Context(), changeTopicLiveDevices, filter, set)
+	s.registry.note(source, sourceKindDevices, 1, now)
 
 	c.JSON(http.StatusOK, gin.H{
 		"ok":       true,
@@ -164,7 +177,13 @@ func (s *service) ingestLiveDeviceEvent(c *gin.Context) {
 	if !ok {
 		return
 	}
-	if err := s.persistLiveDeviceEventEnvelopes(c, []liveDeviceEventEnvelope{envelope}); err != nil {
+	charge := newIngestCharge(true)
+	charge.add(envelope.source, envelope.deviceID, 1)
+	if !s.admitIngest(c, charge) {
+		return
+	}
+	kept, err := s.persistLiveDeviceEventEnvelopes(c, []liveDeviceEventEnvelope{envelope})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"ok":      false,
 			"message": "Failed to save live device event",
@@ -177,7 +196,7 @@ func (s *service) ingestLiveDeviceEvent(c *gin.Context) {
 		"ok":       true,
 		"source":   envelope.source,
 		"deviceId": envelope.deviceID,
-		"accepted": 1,
+		"accepted": kept,
 	})
 }
 
@@ -207,7 +226,19 @@ func (s *service) ingestLiveDeviceEvents(c *gin.Context) {
 		envelopes = append(envelopes, envelope)
 	}
 
-	if err := s.persistLiveDeviceEventEnvelopes(c, envelopes); err != nil {
+	charge := newIngestCharge(true)
+	for _, envelope := range envelopes {
+		charge.add(envelope.source, envelope.deviceID, 1)
+	}
+	if len(envelopes) == 0 {
+		charge.add(s.extractSourceWithFallback(c, sourceFallback, s.cfg.LiveDeviceSourceName), "", 0)
+	}
+	if !s.admitIngest(c, charge) {
+		return
+	}
+
+	kept, err := s.persistLiveDeviceEventEnvelopes(c, envelopes)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"ok":      false,
 			"message": "Failed to save live device events",
@@ -227,7 +258,7 @@ func (s *service) ingestLiveDeviceEvents(c *gin.Context) {
 		"ok":       true,
 		"source":   emptyStringToNil(firstSource),
 		"deviceId": emptyStringToNil(firstDeviceID),
-		"accepted": len(envelopes),
+		"accepted": kept,
 	})
 }
 
@@ -237,7 +268,7 @@ func (s *service) buildLiveDeviceEventEnvelope(c *gin.Context, raw map[string]an
 	if len(event) == 0 {
 		event = raw
 	}
-	status := toMap(raw["status"])
+	status := s.redact.payload(source, toMap(raw["status"]))
 	principal := devicePrincipalFromContext(c)
 	occurredAt := parseTime(firstNonNil(event["occurredAt"], event["capturedAt"], raw["capturedAt"]))
 	deviceID := firstString(
@@ -292,8 +323,8 @@ func (s *service) buildLiveDeviceEventEnvelope(c *gin.Context, raw map[string]an
 		)),
 		"occurredAt": occurredAt,
 		"receivedAt": now,
-		"expireAt":   buildExpireAt(s.cfg.EventTTLDays, occurredAt),
-		"payload": mergeMaps(payload, map[string]any{
+		"expireAt":   buildExpireAt(s.settings().EventTTLDays, occurredAt),
+		"payload": s.redact.payload(source, mergeMaps(payload, map[string]any{
 			"deviceId":       deviceID,
 			"reasonCode":     reasonCode,
 			"reasonText":     reasonText,
@@ -305,7 +336,7 @@ func (s *service) buildLiveDeviceEventEnvelope(c *gin.Context, raw map[string]an
 			"courtName":      firstString(event["courtName"], status["courtName"]),
 			"operatorUserId": firstString(event["operatorUserId"], status["operatorUserId"]),
 			"operatorName":   firstString(event["operatorName"], status["operatorName"]),
-		}),
+		})),
 		"createdAt": now,
 		"updatedAt": now,
 	}
@@ -323,17 +354,20 @@ func (s *service) buildLiveDeviceEventEnvelope(c *gin.Context, raw map[string]an
 	}, true
 }
 
-func (s *service) persistLiveDeviceEventEnvelopes(c *gin.Context, envelopes []liveDeviceEventEnvelope) error {
+// persistLiveDeviceEventEnvelopes stores the events and returns how many
+// the sampler kept; device state follows every event either way.
+func (s *service) persistLiveDeviceEventEnvelopes(c *gin.Context, envelopes []liveDeviceEventEnvelope) (int, error) {
 	if len(envelopes) == 0 {
-		return nil
+		return 0, nil
 	}
 
 	docs := make([]any, 0, len(envelopes))
 	for _, envelope := range envelopes {
 		docs = append(docs, envelope.doc)
 	}
-	if _, err := s.events.InsertMany(c.Request.Context(), docs); err != nil {
-		return err
+	kept, err := s.insertEvents(c.Request.Context(), docs)
+	if err != nil {
+		return 0, err
 	}
 
 	for _, envelope := range envelopes {
@@ -341,10 +375,10 @@ func (s *service) persistLiveDeviceEventEnvelopes(c *gin.Context, envelopes []li
 			continue
 		}
 		if err := s.updateLiveDeviceStateFromEvent(c, envelope); err != nil {
-			return err
+			return kept, err
 		}
 	}
-	return nil
+	return kept, nil
 }
 
 func (s *service) updateLiveDeviceStateFromEvent(c *gin.Context, envelope liveDeviceEventEnvelope) error {
@@ -355,7 +389,7 @@ func (s *service) updateLiveDeviceStateFromEvent(c *gin.Context, envelope liveDe
 		"capturedAt":          envelope.occurredAt,
 		"lastSeenAt":          now,
 		"receivedAt":          now,
-		"expireAt":            buildExpireAt(s.cfg.LiveDeviceTTLDays, now),
+		"expireAt":            s.retention.expireAt(retentionKindLiveDevices, bson.M{"source": envelope.source}, now),
 		"lastEventType":       envelope.eventType,
 		"lastEventLevel":      envelope.level,
 		"lastEventReasonCode": envelope.reasonCode,
@@ -414,42 +448,30 @@ func (s *service) updateLiveDeviceStateFromEvent(c *gin.Context, envelope liveDe
 		updateSet["lastLifecycleEventReason"] = envelope.reasonText
 	}
 
-	_, err := s.liveDevices.UpdateOne(
+	filter := bson.M{"source": envelope.source, "deviceId": envelope.deviceID}
+	err := s.store.liveDevices.upsert(
 		c.Request.Context(),
-		bson.M{"source": envelope.source, "deviceId": envelope.deviceID},
-		bson.M{
-			"$set": updateSet,
-			"$setOnInsert": bson.M{
-				"createdAt": now,
-			},
-		},
-		options.Update().SetUpsert(true),
+		filter,
+		updateSet,
+		bson.M{"createdAt": now},
 	)
+	s.writes.record(retentionKindLiveDevices, err, now)
+	if err == nil {
+		s.changes.notifyUpsert(c.Request.Context(), changeTopicLiveDevices, filter, updateSet)
+	}
 	return err
 }
 
 func (s *service) listLiveDevices(c *gin.Context) {
-	source := strings.TrimSpace(c.Query("source"))
-	platform := strings.TrimSpace(c.Query("platform"))
 	onlineOnly := strings.EqualFold(strings.TrimSpace(c.Query("onlineOnly")), "true") ||
 		strings.TrimSpace(c.Query("onlineOnly")) == "1"
 	limit := clampInt(parseInt(c.DefaultQuery("limit", "50"), 50), 1, 200)
 
-	filter := bson.M{}
-	if source != "" {
-		filter["source"] = source
-	}
-	if platform != "" {
-		filter["platform"] = platform
-	}
-
-	cursor, err := s.liveDevices.Find(
-		c.Request.Context(),
-		filter,
-		options.Find().
-			SetSort(bson.D{{Key: "lastSeenAt", Value: -1}, {Key: "_id", Value: -1}}).
-			SetLimit(int64(limit)),
-	)
+	rows, err := s.store.liveDevices.find(c.Request.Context(), findQuery{
+		filter: liveDeviceFilter(c),
+		sort:   bson.D{{Key: "lastSeenAt", Value: -1}, {Key: "_id", Value: -1}},
+		limit:  int64(limit),
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"ok":      false,
@@ -458,17 +480,6 @@ func (s *service) listLiveDevices(c *gin.Context) {
 		})
 		return
 	}
-	defer cursor.Close(c.Request.Context())
-
-	var rows []bson.M
-	if err := cursor.All(c.Request.Context(), &rows); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"ok":      false,
-			"message": "Failed to decode live devices",
-			"error":   err.Error(),
-		})
-		return
-	}
 
 	now := time.Now().UTC()
 	items := make([]gin.H, 0, len(rows))
@@ -479,9 +490,8 @@ func (s *service) listLiveDevices(c *gin.Context) {
 	suspectedCrashCount := 0
 
 	for _, row := range rows {
-		lastSeenAt := parseTime(firstNonNil(row["lastSeenAt"], row["capturedAt"]))
-		staleAfterMs := clampInt(parseInt(firstString(row["staleAfterMs"]), s.cfg.LiveDeviceStaleMs), 5_000, 10*60*1000)
-		isOnline := now.Sub(lastSeenAt) <= time.Duration(staleAfterMs)*time.Millisecond
+		item := s.liveDeviceItem(row, now)
+		isOnline := item["isOnline"] == true
 		if onlineOnly && !isOnline {
 			continue
 		}
@@ -498,68 +508,10 @@ func (s *service) listLiveDevices(c *gin.Context) {
 		if strings.EqualFold(firstString(row["recoverySeverity"]), "critical") {
 			criticalCount += 1
 		}
-		suspectedCrash, suspectedCrashReason, offlineForMs := detectUnexpectedDisconnect(row, now, lastSeenAt, staleAfterMs, isOnline)
-		if suspectedCrash {
+		if item["suspectedCrash"] == true {
 			suspectedCrashCount += 1
 		}
-
-		items = append(items, gin.H{
-			"id":                       formatID(row["_id"]),
-			"source":                   asString(row["source"]),
-			"deviceId":                 asString(row["deviceId"]),
-			"platform":                 asString(row["platform"]),
-			"deviceName":               asString(row["deviceName"]),
-			"deviceModel":              asString(row["deviceModel"]),
-			"deviceManufacturer":       asString(row["deviceManufacturer"]),
-			"deviceBrand":              asString(row["deviceBrand"]),
-			"deviceProduct":            asString(row["deviceProduct"]),
-			"operatorUserId":           asString(row["operatorUserId"]),
-			"operatorName":             asString(row["operatorName"]),
-			"operatorRole":             asString(row["operatorRole"]),
-			"routeLabel":               asString(row["routeLabel"]),
-			"screenState":              asString(row["screenState"]),
-			"courtId":                  asString(row["courtId"]),
-			"courtName":                asString(row["courtName"]),
-			"matchId":                  asString(row["matchId"]),
-			"matchCode":                asString(row["matchCode"]),
-			"streamState":              asString(row["streamState"]),
-			"overlayIssue":             asString(row["overlayIssue"]),
-			"recoverySeverity":         asString(row["recoverySeverity"]),
-			"recoveryStage":            asString(row["recoveryStage"]),
-			"warningCount":             clampInt(parseInt(firstString(row["warningCount"]), 0), 0, 999),
-			"heartbeatIntervalMs":      clampInt(parseInt(firstString(row["heartbeatIntervalMs"]), 10_000), 0, 120_000),
-			"staleAfterMs":             staleAfterMs,
-			"capturedAt":               row["capturedAt"],
-			"lastSeenAt":               lastSeenAt,
-			"isOnline":                 isOnline,
-			"offlineForMs":             offlineForMs,
-			"suspectedCrash":           suspectedCrash,
-			"suspectedCrashReason":     suspectedCrashReason,
-			"lastEventType":            asString(row["lastEventType"]),
-			"lastEventLevel":           asString(row["lastEventLevel"]),
-			"lastEventReasonCode":      asString(row["lastEventReasonCode"]),
-			"lastEventReasonText":      asString(row["lastEventReasonText"]),
-			"lastEventAt":              row["lastEventAt"],
-			"lastCrashRecoveredAt":     row["lastCrashRecoveredAt"],
-			"lastCrashRecoveredReason": asString(row["lastCrashRecoveredReason"]),
-			"app":                      firstObject(row["app"]),
-			"device":                   firstObject(row["device"]),
-			"operator":                 firstObject(row["operator"]),
-			"route":                    firstObject(row["route"]),
-			"court":                    firstObject(row["court"]),
-			"match":                    firstObject(row["match"]),
-			"stream":                   firstObject(row["stream"]),
-			"recording":                firstObject(row["recording"]),
-			"overlay":                  firstObject(row["overlay"]),
-			"presence":                 firstObject(row["presence"]),
-			"network":                  firstObject(row["network"]),
-			"battery":                  firstObject(row["battery"]),
-			"thermal":                  firstObject(row["thermal"]),
-			"recovery":                 firstObject(row["recovery"]),
-			"warnings":                 normalizeStringList(row["warnings"]),
-			"diagnostics":              normalizeStringList(row["diagnostics"]),
-			"payload":                  firstObject(row["payload"]),
-		})
+		items = append(items, item)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -576,33 +528,100 @@ func (s *service) listLiveDevices(c *gin.Context) {
 	})
 }
 
+func liveDeviceFilter(c *gin.Context) bson.M {
+	filter := bson.M{}
+	if source := strings.TrimSpace(c.Query("source")); source != "" {
+		filter["source"] = source
+	}
+	if platform := strings.TrimSpace(c.Query("platform")); platform != "" {
+		filter["platform"] = platform
+	}
+	return filter
+}
+
+// liveDeviceItem shapes a device row for the API, deriving online state and
+// crash suspicion relative to now.
+func (s *service) liveDeviceItem(row bson.M, now time.Time) gin.H {
+	lastSeenAt := parseTime(firstNonNil(row["lastSeenAt"], row["capturedAt"]))
+	staleAfterMs := clampInt(parseInt(firstString(row["staleAfterMs"]), s.settings().LiveDeviceStaleMs), 5_000, 10*60*1000)
+	isOnline := now.Sub(lastSeenAt) <= time.Duration(staleAfterMs)*time.Millisecond
+	suspectedCrash, suspectedCrashReason, offlineForMs := detectUnexpectedDisconnect(row, now, lastSeenAt, staleAfterMs, isOnline)
+
+	return gin.H{
+		"id":                       formatID(row["_id"]),
+		"source":                   asString(row["source"]),
+		"deviceId":                 asString(row["deviceId"]),
+		"platform":                 asString(row["platform"]),
+		"deviceName":               asString(row["deviceName"]),
+		"deviceModel":              asString(row["deviceModel"]),
+		"deviceManufacturer":       asString(row["deviceManufacturer"]),
+		"deviceBrand":              asString(row["deviceBrand"]),
+		"deviceProduct":            asString(row["deviceProduct"]),
+		"operatorUserId":           asString(row["operatorUserId"]),
+		"operatorName":             asString(row["operatorName"]),
+		"operatorRole":             asString(row["operatorRole"]),
+		"routeLabel":               asString(row["routeLabel"]),
+		"screenState":              asString(row["screenState"]),
+		"courtId":                  asString(row["courtId"]),
+		"courtName":                asString(row["courtName"]),
+		"matchId":                  asString(row["matchId"]),
+		"matchCode":                asString(row["matchCode"]),
+		"streamState":              asString(row["streamState"]),
+		"overlayIssue":             asString(row["overlayIssue"]),
+		"recoverySeverity":         asString(row["recoverySeverity"]),
+		"recoveryStage":            asString(row["recoveryStage"]),
+		"warningCount":             clampInt(parseInt(firstString(row["warningCount"]), 0), 0, 999),
+		"heartbeatIntervalMs":      clampInt(parseInt(firstString(row["heartbeatIntervalMs"]), 10_000), 0, 120_000),
+		"staleAfterMs":             staleAfterMs,
+		"capturedAt":               row["capturedAt"],
+		"lastSeenAt":               lastSeenAt,
+		"isOnline":                 isOnline,
+		"offlineForMs":             offlineForMs,
+		"suspectedCrash":           suspectedCrash,
+		"suspectedCrashReason":     suspectedCrashReason,
+		"lastEventType":            asString(row["lastEventType"]),
+		"lastEventLevel":           asString(row["lastEventLevel"]),
+		"lastEventReasonCode":      asString(row["lastEventReasonCode"]),
+		"lastEventReasonText":      asString(row["lastEventReasonText"]),
+		"lastEventAt":              row["lastEventAt"],
+		"lastCrashRecoveredAt":     row["lastCrashRecoveredAt"],
+		"lastCrashRecoveredReason": asString(row["lastCrashRecoveredReason"]),
+		"app":                      firstObject(row["app"]),
+		"device":                   firstObject(row["device"]),
+		"operator":                 firstObject(row["operator"]),
+		"route":                    firstObject(row["route"]),
+		"court":                    firstObject(row["court"]),
+		"match":                    firstObject(row["match"]),
+		"stream":                   firstObject(row["stream"]),
+		"recording":                firstObject(row["recording"]),
+		"overlay":                  firstObject(row["overlay"]),
+		"presence":                 firstObject(row["presence"]),
+		"network":                  firstObject(row["network"]),
+		"battery":                  firstObject(row["battery"]),
+		"thermal":                  firstObject(row["thermal"]),
+		"recovery":                 firstObject(row["recovery"]),
+		"warnings":                 normalizeStringList(row["warnings"]),
+		"diagnostics":              normalizeStringList(row["diagnostics"]),
+		"payload":                  firstObject(row["payload"]),
+	}
+}
+
 func (s *service) loadLiveDeviceSummary(ctx *gin.Context, source string) gin.H {
 	filter := bson.M{}
 	if strings.TrimSpace(source) != "" {
 		filter["source"] = strings.TrimSpace(source)
 	}
-	cursor, err := s.liveDevices.Find(
-		ctx.Request.Context(),
-		filter,
-		options.Find().
-			SetSort(bson.D{{Key: "lastSeenAt", Value: -1}, {Key: "_id", Value: -1}}).
-			SetLimit(12),
-	)
+	rows, err := s.store.liveDevices.find(ctx.Request.Context(), findQuery{
+		filter: filter,
+		sort:   bson.D{{Key: "lastSeenAt", Value: -1}, {Key: "_id", Value: -1}},
+		limit:  12,
+	})
 	if err != nil {
 		return gin.H{
 			"counts": gin.H{},
 			"items":  []gin.H{},
 		}
 	}
-	defer cursor.Close(ctx.Request.Context())
-
-	var rows []bson.M
-	if err := cursor.All(ctx.Request.Context(), &rows); err != nil {
-		return gin.H{
-			"counts": gin.H{},
-			"items":  []gin.H{},
-		}
-	}
 
 	now := time.Now().UTC()
 	items := make([]gin.H, 0, len(rows))
@@ -616,7 +635,7 @@ func (s *service) loadLiveDeviceSummary(ctx *gin.Context, source string) gin.H {
 	}
 	for _, row := range rows {
 		lastSeenAt := parseTime(firstNonNil(row["lastSeenAt"], row["capturedAt"]))
-		staleAfterMs := clampInt(parseInt(firstString(row["staleAfterMs"]), s.cfg.LiveDeviceStaleMs), 5_000, 10*60*1000)
+		staleAfterMs := clampInt(parseInt(firstString(row["staleAfterMs"]), s.settings().LiveDeviceStaleMs), 5_000, 10*60*1000)
 		isOnline := now.Sub(lastSeenAt) <= time.Duration(staleAfterMs)*time.Millisecond
 		suspectedCrash, suspectedCrashReason, _ := detectUnexpectedDisconnect(row, now, lastSeenAt, staleAfterMs, isOnline)
 		counts["total"] = counts["total"].(int) + 1
@@ -0,0 +1,204 @@
+package observer
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestHeartbeatUpsertsOneDevice(t *testing.T) {
+	svc, handler := newTestService(t)
+	ctx := context.Background()
+
+	heartbeat := func(streamState string) {
+		t.Helper()
+		code, body := doJSON(t, handler, http.MethodPost, "/api/observer/ingest/live-devices/heartbeat", gin.H{
+			"source":   "pickletour-live-app",
+			"deviceId": "device-1",
+			"status": gin.H{
+				"platform": "android",
+				"stream":   gin.H{"state": streamState},
+				"match":    gin.H{"id": "match-9", "code": "M9"},
+				"warnings": []string{"low_battery", "low_battery", "hot"},
+			},
+		})
+		if code != http.StatusOK || body["deviceId"] != "device-1" {
+			t.Fatalf("heartbeat = %d %v", code, body)
+		}
+	}
+
+	heartbeat("connecting")
+	first, err := svc.store.liveDevices.findOne(ctx, findQuery{filter: bson.M{"deviceId": "device-1"}})
+	if err != nil {
+		t.Fatalf("find device: %v", err)
+	}
+	heartbeat("live")
+
+	rows, err := svc.store.liveDevices.find(ctx, findQuery{filter: bson.M{"source": "pickletour-live-app"}})
+	if err != nil {
+		t.Fatalf("find devices: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("stored %d devices, want the heartbeat to upsert one", len(rows))
+	}
+	row := rows[0]
+	if row["_id"] != first["_id"] || !parseTime(row["createdAt"]).Equal(parseTime(first["createdAt"])) {
+		t.Errorf("second heartbeat replaced the document: %v vs %v", row["_id"], first["_id"])
+	}
+	if row["streamState"] != "live" || row["matchId"] != "match-9" || row["platform"] != "android" {
+		t.Errorf("device = %v, want the latest stream state and match", row)
+	}
+	if warnings := normalizeStringList(row["warnings"]); len(warnings) != 3 || warnings[0] != "hot" {
+		t.Errorf("warnings = %v, want the sorted heartbeat warnings", warnings)
+	}
+
+	code, body := doJSON(t, handler, http.MethodGet, "/api/observer/read/live-devices", nil)
+	if code != http.StatusOK {
+		t.Fatalf("list devices = %d %v", code, body)
+	}
+	counts := toMap(body["counts"])
+	if counts["total"] != float64(1) || counts["online"] != float64(1) || counts["live"] != float64(1) {
+		t.Errorf("counts = %v, want one online live device", counts)
+	}
+}
+
+func TestHeartbeatRedactsTheStatusReport(t *testing.T) {
+	svc, handler := newTestService(t)
+	code, body := doJSON(t, handler, http.MethodPost, "/api/observer/ingest/live-devices/heartbeat", gin.H{
+		"source":   "pickletour-live-app",
+		"deviceId": "device-1",
+		"status": gin.H{
+			"platform": "android",
+			"operator": gin.H{"userId": "u-1", "name": "an.nguyen@example.vn"},
+			"stream":   gin.H{"state": "live", "token": "stream-secret", "lastError": "call 0912 345 678"},
+		},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("heartbeat = %d %v", code, body)
+	}
+
+	row, err := svc.store.liveDevices.findOne(context.Background(), findQuery{filter: bson.M{"deviceId": "device-1"}})
+	if err != nil {
+		t.Fatalf("find device: %v", err)
+	}
+	if row["operatorName"] != "[email]" || toMap(row["operator"])["name"] != "[email]" {
+		t.Errorf("operator = %v / %v, want the email scrubbed", row["operatorName"], row["operator"])
+	}
+	stream := toMap(toMap(row["payload"])["stream"])
+	if stream["token"] != redactedValue || stream["lastError"] != "call [phone]" || stream["state"] != "live" {
+		t.Errorf("payload stream = %v, want the token and phone number redacted", stream)
+	}
+	if row["streamState"] != "live" || row["operatorUserId"] != "u-1" {
+		t.Errorf("device = %v, want unredacted fields kept", row)
+	}
+}
+
+func TestHeartbeatRequiresDeviceID(t *testing.T) {
+	_, handler := newTestService(t)
+	code, _ := doJSON(t, handler, http.MethodPost, "/api/observer/ingest/live-devices/heartbeat", gin.H{"status": gin.H{"platform": "ios"}})
+	if code != http.StatusBadRequest {
+		t.Fatalf("heartbeat without deviceId = %d, want 400", code)
+	}
+}
+
+func TestLiveDeviceEventEnvelopes(t *testing.T) {
+	svc, handler := newTestService(t)
+	ctx := context.Background()
+
+	code, body := doJSON(t, handler, http.MethodPost, "/api/observer/ingest/live-devices/event", gin.H{
+		"source":   "pickletour-live-app",
+		"deviceId": "device-1",
+		"event": gin.H{
+			"reasonCode": "app_crash_recovered",
+			"reasonText": "recovered after crash",
+			"severity":   "critical",
+		},
+		"status": gin.H{"stream": gin.H{"state": "reconnecting"}},
+	})
+	if code != http.StatusOK || body["accepted"] != float64(1) {
+		t.Fatalf("single event = %d %v", code, body)
+	}
+
+	code, body = doJSON(t, handler, http.MethodPost, "/api/observer/ingest/live-devices/events", gin.H{
+		"source": "pickletour-live-app",
+		"events": []gin.H{
+			{"deviceId": "device-1", "event": gin.H{"type": "overlay_stalled", "level": "error"}},
+			{"deviceId": "device-2", "event": gin.H{"type": "app_backgrounded", "level": "info"}},
+			{"event": gin.H{"type": "orphan_event"}},
+		},
+	})
+	if code != http.StatusOK || body["accepted"] != float64(3) || body["deviceId"] != "device-1" {
+		t.Fatalf("batch events = %d %v", code, body)
+	}
+
+	events, err := svc.store.events.find(ctx, findQuery{
+		filter: bson.M{"category": "live_device"},
+	})
+	if err != nil {
+		t.Fatalf("find events: %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("stored %d live device events, want 4", len(events))
+	}
+	crash, err := svc.store.events.findOne(ctx, findQuery{filter: bson.M{"payload.reasonCode": "app_crash_recovered"}})
+	if err != nil {
+		t.Fatalf("find crash event: %v", err)
+	}
+	if crash["type"] != "app_crash_recovered" || crash["level"] != "warn" {
+		t.Errorf("crash event = %v, want type from reasonCode and warn by default", crash)
+	}
+	if payload := toMap(crash["payload"]); payload["deviceId"] != "device-1" || payload["severity"] != "critical" {
+		t.Errorf("crash payload = %v", payload)
+	}
+
+	devices, err := svc.store.liveDevices.find(ctx, findQuery{sort: bson.D{{Key: "deviceId", Value: 1}}})
+	if err != nil {
+		t.Fatalf("find devices: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("stored %d devices, want events without deviceId to skip device state", len(devices))
+	}
+	first := devices[0]
+	if first["lastEventType"] != "overlay_stalled" || first["lastCrashRecoveredReason"] != "recovered after crash" || first["streamState"] != "reconnecting" {
+		t.Errorf("device-1 state = %v", first)
+	}
+	if devices[1]["lastLifecycleEventType"] != "app_backgrounded" {
+		t.Errorf("device-2 lifecycle = %v, want app_backgrounded", devices[1]["lastLifecycleEventType"])
+	}
+}
+
+func TestDetectUnexpectedDisconnect(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name        string
+		row         bson.M
+		offline     time.Duration
+		stale       int
+		online      bool
+		want        bool
+		wantWhy     string
+		wantOffline int64
+	}{
+		{name: "online", row: bson.M{"streamState": "live"}, offline: time.Second, stale: 30_000, online: true, wantOffline: 1_000},
+		{name: "recently stale", row: bson.M{"streamState": "live"}, offline: 45 * time.Second, stale: 30_000, wantOffline: 45_000},
+		{name: "idle device", row: bson.M{"streamState": "idle"}, offline: 5 * time.Minute, stale: 30_000, wantOffline: 300_000},
+		{name: "live stream", row: bson.M{"streamState": "live"}, offline: 2 * time.Minute, stale: 30_000, want: true, wantWhy: "heartbeat_timeout_while_live", wantOffline: 120_000},
+		{name: "nested stream state", row: bson.M{"stream": bson.M{"state": "Reconnecting"}}, offline: 2 * time.Minute, stale: 30_000, want: true, wantWhy: "heartbeat_timeout_while_live", wantOffline: 120_000},
+		{name: "recording", row: bson.M{"recording": bson.M{"stateText": "Recording segment"}}, offline: 2 * time.Minute, stale: 30_000, want: true, wantWhy: "heartbeat_timeout_while_live", wantOffline: 120_000},
+		{name: "active app on a match", row: bson.M{"route": bson.M{"appIsActive": true}, "match": bson.M{"id": "m1"}}, offline: 2 * time.Minute, stale: 30_000, want: true, wantWhy: "heartbeat_timeout_while_live", wantOffline: 120_000},
+		{name: "overlay issue", row: bson.M{"streamState": "live", "overlayIssue": "stalled"}, offline: 2 * time.Minute, stale: 30_000, want: true, wantWhy: "heartbeat_timeout_after_overlay_issue", wantOffline: 120_000},
+		{name: "short stale uses 20s floor", row: bson.M{"streamState": "live"}, offline: 15 * time.Second, stale: 5_000, wantOffline: 15_000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, why, offline := detectUnexpectedDisconnect(tc.row, now, now.Add(-tc.offline), tc.stale, tc.online)
+			if got != tc.want || why != tc.wantWhy || offline != tc.wantOffline {
+				t.Errorf("detectUnexpectedDisconnect = (%v, %q, %d), want (%v, %q, %d)", got, why, offline, tc.want, tc.wantWhy, tc.wantOffline)
+			}
+		})
+	}
+}
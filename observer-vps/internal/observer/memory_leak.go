@@ -0,0 +1,351 @@
+package observer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	runtimeFindingMemoryGrowth = "memory_growth"
+
+	runtimeFindingActive  = "active"
+	runtimeFindingCleared = "cleared"
+
+	memoryLookback         = 7 * 24 * time.Hour
+	memoryMaxSnapshots     = 5000
+	memoryMinSamples       = 12
+	memoryMinSpan          = time.Hour
+	memoryMinFit           = 0.6
+	memoryMinSlopePerHour  = 1.0
+	memoryRestartTolerance = 2 * time.Minute
+)
+
+// memoryTrend is the fit over one process lifetime: the snapshots since the
+// most recent restart of a source.
+type memoryTrend struct {
+	startedAt    time.Time
+	restartedAt  *time.Time
+	pid          any
+	samples      int
+	first        runtimePoint
+	last         runtimePoint
+	slopePerHour float64
+	fit          float64
+}
+
+func (s *service) runMemoryAnalyzer(ctx context.Context) {
+	if s.cfg.MemoryAnalyzeIntervalMs <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(s.cfg.MemoryAnalyzeIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if err := s.analyzeMemory(ctx, time.Now().UTC()); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("observer memory analyzer error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// analyzeMemory fits a trend per source that reported runtime snapshots in the
+// lookback window and raises or clears its memory_growth finding.
+func (s *service) analyzeMemory(ctx context.Context, now time.Time) error {
+	sources, err := s.runtime.Distinct(ctx, "source", bson.M{"capturedAt": bson.M{"$gte": now.Add(-memoryLookback)}})
+	if err != nil {
+		return err
+	}
+	for _, raw := range sources {
+		source := asString(raw)
+		if source == "" {
+			continue
+		}
+		limit := s.memoryLimit(source)
+		if limit <= 0 {
+			continue
+		}
+		trend, err := s.loadMemoryTrend(ctx, source, now)
+		if err != nil {
+			return fmt.Errorf("memory trend for %s: %w", source, err)
+		}
+		if err := s.recordMemoryFinding(ctx, source, trend, limit, now); err != nil {
+			return fmt.Errorf("memory finding for %s: %w", source, err)
+		}
+	}
+	return nil
+}
+
+func (s *service) memoryLimit(source string) float64 {
+	if limit, ok := s.cfg.MemoryLimitMbBySource[source]; ok {
+		return float64(limit)
+	}
+	return float64(s.cfg.MemoryLimitMb)
+}
+
+// loadMemoryTrend walks snapshots newest first until the process identity
+// changes, then fits the tracked field over what remains.
+func (s *service) loadMemoryTrend(ctx context.Context, source string, now time.Time) (*memoryTrend, error) {
+	cursor, err := s.runtime.Find(
+		ctx,
+		bson.M{"source": source, "capturedAt": bson.M{"$gte": now.Add(-memoryLookback)}},
+		options.Find().
+			SetSort(bson.D{{Key: "capturedAt", Value: -1}}).
+			SetProjection(bson.M{"capturedAt": 1, "process.pid": 1, "process.uptimeSeconds": 1, s.cfg.MemoryField: 1}).
+			SetLimit(memoryMaxSnapshots),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []bson.M
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return fitMemoryTrend(rows, s.cfg.MemoryField), nil
+}
+
+// fitMemoryTrend expects rows newest first. A restart is a pid change or a
+// process start time (capturedAt minus uptime) that moves by more than the
+// tolerance between neighbouring snapshots.
+func fitMemoryTrend(rows []bson.M, field string) *memoryTrend {
+	trend := &memoryTrend{}
+	points := make([]runtimePoint, 0, len(rows))
+	var lastStart, lastCapturedAt time.Time
+	for index, row := range rows {
+		process := toMap(row["process"])
+		capturedAt := parseTime(row["capturedAt"])
+		var startedAt time.Time
+		if uptime := normalizeNumber(process["uptimeSeconds"]); uptime != nil {
+			startedAt = capturedAt.Add(-time.Duration(asFloat(uptime) * float64(time.Second)))
+		}
+		if index == 0 {
+			trend.pid = normalizeNumber(process["pid"])
+		} else {
+			pidChanged := trend.pid != nil && normalizeNumber(process["pid"]) != nil && asFloat(process["pid"]) != asFloat(trend.pid)
+			startMoved := !startedAt.IsZero() && !lastStart.IsZero() && absDuration(lastStart.Sub(startedAt)) > memoryRestartTolerance
+			if pidChanged || startMoved {
+				restartedAt := lastCapturedAt
+				if !lastStart.IsZero() {
+					restartedAt = lastStart
+				}
+				trend.restartedAt = &restartedAt
+				break
+			}
+		}
+		if !startedAt.IsZero() {
+			lastStart = startedAt
+		}
+		lastCapturedAt = capturedAt
+		value := lookupPath(row, field)
+		if normalizeNumber(value) == nil {
+			continue
+		}
+		points = append(points, runtimePoint{at: capturedAt, value: asFloat(value)})
+	}
+	if len(points) == 0 {
+		return trend
+	}
+	for left, right := 0, len(points)-1; left < right; left, right = left+1, right-1 {
+		points[left], points[right] = points[right], points[left]
+	}
+	trend.startedAt = lastStart
+	if trend.startedAt.IsZero() {
+		trend.startedAt = points[0].at
+	}
+	trend.samples = len(points)
+	trend.first = points[0]
+	trend.last = points[len(points)-1]
+	trend.slopePerHour = linearSlopePerHour(points)
+	trend.fit = linearFit(points, trend.slopePerHour)
+	return trend
+}
+
+// linearFit is the coefficient of determination of the least-squares line,
+// 1 for perfectly steady growth and near 0 for noise around a flat mean.
+func linearFit(points []runtimePoint, slopePerHour float64) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+	origin := points[0].at
+	var meanX, meanY float64
+	for _, point := range points {
+		meanX += point.at.Sub(origin).Hours()
+		meanY += point.value
+	}
+	meanX /= float64(len(points))
+	meanY /= float64(len(points))
+	intercept := meanY - slopePerHour*meanX
+	var residual, total float64
+	for _, point := range points {
+		predicted := intercept + slopePerHour*point.at.Sub(origin).Hours()
+		residual += (point.value - predicted) * (point.value - predicted)
+		total += (point.value - meanY) * (point.value - meanY)
+	}
+	if total == 0 {
+		return 0
+	}
+	return 1 - residual/total
+}
+
+// sustained reports whether the trend is long, steady and steep enough to
+// project forward.
+func (t *memoryTrend) sustained() bool {
+	return t.samples >= memoryMinSamples &&
+		t.last.at.Sub(t.first.at) >= memoryMinSpan &&
+		t.slopePerHour >= memoryMinSlopePerHour &&
+		t.fit >= memoryMinFit
+}
+
+// hoursToLimit projects from the latest sample along the fitted slope.
+func (t *memoryTrend) hoursToLimit(limit float64) float64 {
+	if t.last.value >= limit {
+		return 0
+	}
+	return (limit - t.last.value) / t.slopePerHour
+}
+
+func (s *service) recordMemoryFinding(ctx context.Context, source string, trend *memoryTrend, limit float64, now time.Time) error {
+	if err := checkLease(ctx); err != nil {
+		return err
+	}
+	filter := bson.M{"source": source, "kind": runtimeFindingMemoryGrowth}
+	horizon := float64(s.cfg.MemoryHorizonHours)
+	if trend.samples == 0 || !trend.sustained() || trend.hoursToLimit(limit) > horizon {
+		reason := "growth stopped"
+		if trend.restartedAt != nil && trend.samples < memoryMinSamples {
+			reason = "process restarted"
+		}
+		_, err := s.runtimeFindings.UpdateOne(
+			ctx,
+			bson.M{"source": source, "kind": runtimeFindingMemoryGrowth, "status": runtimeFindingActive},
+			bson.M{"$set": bson.M{"status": runtimeFindingCleared, "clearedAt": now, "clearedReason": reason, "updatedAt": now}},
+		)
+		return err
+	}
+
+	hours := trend.hoursToLimit(limit)
+	severity := "warn"
+	if hours <= horizon/4 {
+		severity = "error"
+	}
+	exhaustionAt := trend.last.at.Add(time.Duration(hours * float64(time.Hour)))
+	_, err := s.runtimeFindings.UpdateOne(
+		ctx,
+		filter,
+		bson.M{
+			"$set": bson.M{
+				"status":                runtimeFindingActive,
+				"severity":              severity,
+				"message":               fmt.Sprintf("%s grows %.1f/h and is projected to reach %.0f in %.1fh", s.cfg.MemoryField, trend.slopePerHour, limit, hours),
+				"field":                 s.cfg.MemoryField,
+				"limit":                 limit,
+				"current":               roundMetric(trend.last.value),
+				"slopePerHour":          roundMetric(trend.slopePerHour),
+				"fit":                   roundMetric(trend.fit),
+				"samples":               trend.samples,
+				"processStartedAt":      trend.startedAt,
+				"pid":                   trend.pid,
+				"lastSampleAt":          trend.last.at,
+				"hoursToLimit":          roundMetric(hours),
+				"projectedExhaustionAt": exhaustionAt,
+				"updatedAt":             now,
+			},
+			"$unset": bson.M{"clearedAt": "", "clearedReason": ""},
+			"$setOnInsert": bson.M{
+				"source":          source,
+				"kind":            runtimeFindingMemoryGrowth,
+				"firstDetectedAt": now,
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func runtimeFindingItem(row bson.M) gin.H {
+	return gin.H{
+		"id":                    formatID(row["_id"]),
+		"source":                asString(row["source"]),
+		"kind":                  asString(row["kind"]),
+		"status":                asString(row["status"]),
+		"severity":              asString(row["severity"]),
+		"message":               asString(row["message"]),
+		"field":                 asString(row["field"]),
+		"limit":                 normalizeNumber(row["limit"]),
+		"current":               normalizeNumber(row["current"]),
+		"slopePerHour":          normalizeNumber(row["slopePerHour"]),
+		"fit":                   normalizeNumber(row["fit"]),
+		"samples":               normalizeIntValue(row["samples"]),
+		"processStartedAt":      row["processStartedAt"],
+		"pid":                   row["pid"],
+		"lastSampleAt":          row["lastSampleAt"],
+		"hoursToLimit":          normalizeNumber(row["hoursToLimit"]),
+		"projectedExhaustionAt": row["projectedExhaustionAt"],
+		"firstDetectedAt":       row["firstDetectedAt"],
+		"updatedAt":             row["updatedAt"],
+		"clearedAt":             row["clearedAt"],
+		"clearedReason":         asString(row["clearedReason"]),
+	}
+}
+
+func (s *service) loadRuntimeFindings(ctx context.Context, filter bson.M, limit int64) ([]gin.H, error) {
+	cursor, err := s.runtimeFindings.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "projectedExhaustionAt", Value: 1}, {Key: "updatedAt", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []bson.M
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	items := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, runtimeFindingItem(row))
+	}
+	return items, nil
+}
+
+// listRuntimeFindings returns active findings by default, soonest exhaustion
+// first; status=all includes cleared ones.
+func (s *service) listRuntimeFindings(c *gin.Context) {
+	filter := bson.M{}
+	if source := strings.TrimSpace(c.Query("source")); source != "" {
+		filter["source"] = source
+	}
+	switch status := strings.ToLower(strings.TrimSpace(c.DefaultQuery("status", runtimeFindingActive))); status {
+	case "all":
+	case runtimeFindingActive, runtimeFindingCleared:
+		filter["status"] = status
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "status must be active, cleared or all"})
+		return
+	}
+	limit := clampInt(parseInt(c.DefaultQuery("limit", "50"), 50), 1, 200)
+	items, err := s.loadRuntimeFindings(c.Request.Context(), filter, int64(limit))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load runtime findings", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "items": items})
+}
+
+func absDuration(value time.Duration) time.Duration {
+	return time.Duration(math.Abs(float64(value)))
+}
@@ -0,0 +1,173 @@
+package observer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// memorySeries describes one process lifetime of runtime snapshots taken
+// every ten minutes.
+type memorySeries struct {
+	pid     int
+	started time.Time
+	from    time.Time
+	count   int
+	value   func(index int) float64
+}
+
+// memoryRows lays the series out back to back and returns the snapshots
+// newest first, the order loadMemoryTrend reads them in.
+func memoryRows(series ...memorySeries) []bson.M {
+	var rows []bson.M
+	for _, part := range series {
+		for index := 0; index < part.count; index++ {
+			capturedAt := part.from.Add(time.Duration(index) * 10 * time.Minute)
+			rows = append(rows, bson.M{
+				"capturedAt": capturedAt,
+				"process":    bson.M{"pid": part.pid, "uptimeSeconds": capturedAt.Sub(part.started).Seconds()},
+				"memory":     bson.M{"rssMb": part.value(index)},
+			})
+		}
+	}
+	for left, right := 0, len(rows)-1; left < right; left, right = left+1, right-1 {
+		rows[left], rows[right] = rows[right], rows[left]
+	}
+	return rows
+}
+
+func TestFitMemoryTrend(t *testing.T) {
+	base := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	steady := func(index int) float64 { return 400 + float64(index)*5.0/6 } // 5 MB/h
+	noisy := func(index int) float64 {
+		if index%2 == 0 {
+			return 480
+		}
+		return 520
+	}
+
+	cases := []struct {
+		name        string
+		rows        []bson.M
+		samples     int
+		slope       float64
+		sustained   bool
+		restartedAt time.Time
+	}{
+		{
+			name:      "steady growth",
+			rows:      memoryRows(memorySeries{pid: 7, started: base, from: base, count: 24, value: steady}),
+			samples:   24,
+			slope:     5,
+			sustained: true,
+		},
+		{
+			name: "noise around a flat mean",
+			rows: memoryRows(memorySeries{pid: 7, started: base, from: base, count: 24, value: noisy}),
+			// The last sample is high, so the slope clears the minimum; the fit
+			// is what rejects it.
+			samples: 24,
+			slope:   1.25,
+		},
+		{
+			name: "too short to project",
+			rows: memoryRows(memorySeries{pid: 7, started: base, from: base, count: 6, value: steady}),
+			// Six samples span fifty minutes.
+			samples: 6,
+			slope:   5,
+		},
+		{
+			name: "pid change mid-window",
+			rows: memoryRows(
+				memorySeries{pid: 7, started: base, from: base, count: 18, value: func(int) float64 { return 900 }},
+				memorySeries{pid: 8, started: base.Add(3 * time.Hour), from: base.Add(3 * time.Hour), count: 13, value: steady},
+			),
+			samples:     13,
+			slope:       5,
+			sustained:   true,
+			restartedAt: base.Add(3 * time.Hour),
+		},
+		{
+			name: "uptime reset under the same pid",
+			rows: memoryRows(
+				memorySeries{pid: 1, started: base, from: base, count: 18, value: func(int) float64 { return 900 }},
+				memorySeries{pid: 1, started: base.Add(175 * time.Minute), from: base.Add(3 * time.Hour), count: 6, value: steady},
+			),
+			samples:     6,
+			slope:       5,
+			restartedAt: base.Add(175 * time.Minute),
+		},
+	}
+	for _, tc := range cases {
+		trend := fitMemoryTrend(tc.rows, "memory.rssMb")
+		if trend.samples != tc.samples {
+			t.Errorf("%s: samples = %d, want %d", tc.name, trend.samples, tc.samples)
+		}
+		if math.Abs(trend.slopePerHour-tc.slope) > 0.5 {
+			t.Errorf("%s: slope = %.2f/h, want %.2f/h", tc.name, trend.slopePerHour, tc.slope)
+		}
+		if got := trend.sustained(); got != tc.sustained {
+			t.Errorf("%s: sustained = %v (fit %.2f), want %v", tc.name, got, trend.fit, tc.sustained)
+		}
+		switch {
+		case tc.restartedAt.IsZero() && trend.restartedAt != nil:
+			t.Errorf("%s: restartedAt = %v, want no restart", tc.name, trend.restartedAt)
+		case !tc.restartedAt.IsZero() && (trend.restartedAt == nil || !trend.restartedAt.Equal(tc.restartedAt)):
+			t.Errorf("%s: restartedAt = %v, want %v", tc.name, trend.restartedAt, tc.restartedAt)
+		}
+	}
+}
+
+func TestMemoryTrendFitThresholdAndProjection(t *testing.T) {
+	base := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	points := func(values ...float64) []runtimePoint {
+		out := make([]runtimePoint, len(values))
+		for index, value := range values {
+			out[index] = runtimePoint{at: base.Add(time.Duration(index) * time.Hour), value: value}
+		}
+		return out
+	}
+
+	line := points(100, 110, 120, 130)
+	if fit := linearFit(line, linearSlopePerHour(line)); math.Abs(fit-1) > 1e-9 {
+		t.Errorf("fit of a straight line = %v, want 1", fit)
+	}
+	if fit := linearFit(points(200, 200, 200), 0); fit != 0 {
+		t.Errorf("fit of a flat line = %v, want 0", fit)
+	}
+	if fit := linearFit(points(100), 0); fit != 0 {
+		t.Errorf("fit of a single point = %v, want 0", fit)
+	}
+
+	// Growth that only just clears the fit threshold still counts, anything
+	// below it does not.
+	trend := &memoryTrend{
+		samples:      memoryMinSamples,
+		first:        runtimePoint{at: base, value: 400},
+		last:         runtimePoint{at: base.Add(2 * time.Hour), value: 420},
+		slopePerHour: 10,
+		fit:          memoryMinFit,
+	}
+	if !trend.sustained() {
+		t.Error("trend at the fit threshold is not sustained")
+	}
+	trend.fit = memoryMinFit - 0.01
+	if trend.sustained() {
+		t.Error("trend below the fit threshold is sustained")
+	}
+	trend.fit = 0.95
+	trend.slopePerHour = memoryMinSlopePerHour / 2
+	if trend.sustained() {
+		t.Error("trend below the minimum slope is sustained")
+	}
+
+	trend.slopePerHour = 10
+	if hours := trend.hoursToLimit(512); hours != 9.2 {
+		t.Errorf("hoursToLimit = %v, want 9.2", hours)
+	}
+	if hours := trend.hoursToLimit(400); hours != 0 {
+		t.Errorf("hoursToLimit past the limit = %v, want 0", hours)
+	}
+}
@@ -0,0 +1,396 @@
+package observer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	logsv1 "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	otlpMaxBodyBytes = 16 << 20
+	otlpMaxRecords   = 2_000
+
+	otlpContentTypeProtobuf = "application/x-protobuf"
+	otlpContentTypeJSON     = "application/json"
+)
+
+// otlpRecord is one translated log record or span, ready for buildEventDoc.
+type otlpRecord struct {
+	source string
+	event  map[string]any
+}
+
+// ingestOTLPLogs accepts OTLP/HTTP ExportLogsServiceRequest bodies. LogsData
+// shares its wire format with the export request, so the collector service
+// stubs (and their gRPC dependency) are not needed.
+func (s *service) ingestOTLPLogs(c *gin.Context) {
+	var data logsv1.LogsData
+	if !s.decodeOTLP(c, &data) {
+		return
+	}
+	records := make([]otlpRecord, 0)
+	for _, resourceLogs := range data.GetResourceLogs() {
+		resource := otlpAttributes(resourceLogs.GetResource().GetAttributes())
+		source := s.extractSource(c, asString(resource["service.name"]))
+		for _, scopeLogs := range resourceLogs.GetScopeLogs() {
+			scope := scopeLogs.GetScope()
+			for _, record := range scopeLogs.GetLogRecords() {
+				records = append(records, otlpRecord{
+					source: source,
+					event:  otlpLogEvent(record, resource, scope),
+				})
+			}
+		}
+	}
+	s.persistOTLPRecords(c, records, "rejectedLogRecords")
+}
+
+// ingestOTLPTraces stores one observer event per span.
+func (s *service) ingestOTLPTraces(c *gin.Context) {
+	var data tracev1.TracesData
+	if !s.decodeOTLP(c, &data) {
+		return
+	}
+	records := make([]otlpRecord, 0)
+	for _, resourceSpans := range data.GetResourceSpans() {
+		resource := otlpAttributes(resourceSpans.GetResource().GetAttributes())
+		source := s.extractSource(c, asString(resource["service.name"]))
+		for _, scopeSpans := range resourceSpans.GetScopeSpans() {
+			scope := scopeSpans.GetScope()
+			for _, span := range scopeSpans.GetSpans() {
+				records = append(records, otlpRecord{
+					source: source,
+					event:  otlpSpanEvent(span, resource, scope),
+				})
+			}
+		}
+	}
+	s.persistOTLPRecords(c, records, "rejectedSpans")
+}
+
+func (s *service) persistOTLPRecords(c *gin.Context, records []otlpRecord, rejectedField string) {
+	rejected := 0
+	if len(records) > otlpMaxRecords {
+		rejected = len(records) - otlpMaxRecords
+		records = records[:otlpMaxRecords]
+	}
+
+	charge := newIngestCharge(true)
+	for _, record := range records {
+		charge.add(record.source, "", 1)
+	}
+	if !s.admitIngest(c, charge) {
+		return
+	}
+	now := time.Now().UTC()
+	docs := make([]any, 0, len(records))
+	for _, record := range records {
+		docs = append(docs, s.buildEventDoc(record.source, record.event, now))
+	}
+	if _, err := s.insertEvents(c.Request.Context(), docs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to save OTLP records", "error": err.Error()})
+		return
+	}
+
+	// OTLP exporters expect an Export*ServiceResponse in the request encoding;
+	// an empty message means full success.
+	message := fmt.Sprintf("batch exceeds %d records", otlpMaxRecords)
+	if isOTLPProtobuf(c) {
+		var response []byte
+		if rejected > 0 {
+			// partial_success (1) { rejected_* (1), error_message (2) }
+			var partial []byte
+			partial = protowire.AppendTag(partial, 1, protowire.VarintType)
+			partial = protowire.AppendVarint(partial, uint64(rejected))
+			partial = protowire.AppendTag(partial, 2, protowire.BytesType)
+			partial = protowire.AppendString(partial, message)
+			response = protowire.AppendTag(response, 1, protowire.BytesType)
+			response = protowire.AppendBytes(response, partial)
+		}
+		c.Data(http.StatusOK, otlpContentTypeProtobuf, response)
+		return
+	}
+	if rejected > 0 {
+		c.JSON(http.StatusOK, gin.H{"partialSuccess": gin.H{rejectedField: rejected, "errorMessage": message}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (s *service) decodeOTLP(c *gin.Context, target proto.Message) bool {
+	reader := io.Reader(http.MaxBytesReader(c.Writer, c.Request.Body, otlpMaxBodyBytes))
+	if strings.EqualFold(strings.TrimSpace(c.GetHeader("Content-Encoding")), "gzip") {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid gzip body"})
+			return false
+		}
+		defer gz.Close()
+		reader = io.LimitReader(gz, otlpMaxBodyBytes)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"ok": false, "message": "OTLP body too large or unreadable"})
+		return false
+	}
+
+	if isOTLPProtobuf(c) {
+		err = proto.Unmarshal(body, target)
+	} else if strings.HasPrefix(strings.ToLower(c.ContentType()), otlpContentTypeJSON) {
+		body, err = otlpJSONIDsToBase64(body)
+		if err == nil {
+			err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, target)
+		}
+	} else {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"ok": false, "message": "Content-Type must be application/x-protobuf or application/json"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid OTLP payload", "error": err.Error()})
+		return false
+	}
+	return true
+}
+
+func isOTLPProtobuf(c *gin.Context) bool {
+	return strings.EqualFold(c.ContentType(), otlpContentTypeProtobuf)
+}
+
+// otlpJSONIDsToBase64 rewrites hex trace/span ids, which OTLP/JSON mandates,
+// into the base64 form protojson expects for bytes fields.
+func otlpJSONIDsToBase64(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var root any
+	if err := decoder.Decode(&root); err != nil {
+		return nil, err
+	}
+	var walk func(value any) error
+	walk = func(value any) error {
+		switch typed := value.(type) {
+		case map[string]any:
+			for key, item := range typed {
+				switch key {
+				case "traceId", "spanId", "parentSpanId":
+					if text, ok := item.(string); ok && text != "" {
+						raw, err := hex.DecodeString(text)
+						if err != nil {
+							return fmt.Errorf("%s is not hex: %w", key, err)
+						}
+						typed[key] = base64.StdEncoding.EncodeToString(raw)
+					}
+				default:
+					if err := walk(item); err != nil {
+						return err
+					}
+				}
+			}
+		case []any:
+			for _, item := range typed {
+				if err := walk(item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	return json.Marshal(root)
+}
+
+func otlpLogEvent(record *logsv1.LogRecord, resource map[string]any, scope *commonv1.InstrumentationScope) map[string]any {
+	attrs := otlpAttributes(record.GetAttributes())
+	occurredAt := otlpTime(record.GetTimeUnixNano(), record.GetObservedTimeUnixNano())
+	traceID := hex.EncodeToString(record.GetTraceId())
+	level := otlpSeverityLevel(int32(record.GetSeverityNumber()), record.GetSeverityText())
+
+	payload := map[string]any{
+		"message":      otlpValue(record.GetBody()),
+		"severityText": record.GetSeverityText(),
+		"attributes":   attrs,
+		"resource":     resource,
+		"scope":        otlpScope(scope),
+	}
+	if traceID != "" {
+		payload["traceId"] = traceID
+		payload["spanId"] = hex.EncodeToString(record.GetSpanId())
+	}
+
+	event := otlpHTTPFields(attrs)
+	event["category"] = firstString(attrs["category"], attrs["event.domain"], "otel_log")
+	event["type"] = firstString(record.GetEventName(), attrs["event.name"], attrs["type"], "log")
+	event["level"] = level
+	event["requestId"] = firstString(attrs["requestId"], attrs["request.id"], attrs["http.request_id"], traceID)
+	event["tags"] = []any{"otlp", scope.GetName()}
+	event["occurredAt"] = occurredAt
+	event["payload"] = payload
+	return event
+}
+
+func otlpSpanEvent(span *tracev1.Span, resource map[string]any, scope *commonv1.InstrumentationScope) map[string]any {
+	attrs := otlpAttributes(span.GetAttributes())
+	start := otlpTime(span.GetStartTimeUnixNano())
+	durationMs := 0.0
+	if span.GetEndTimeUnixNano() > span.GetStartTimeUnixNano() {
+		durationMs = float64(span.GetEndTimeUnixNano()-span.GetStartTimeUnixNano()) / float64(time.Millisecond)
+	}
+	kind := strings.ToLower(strings.TrimPrefix(span.GetKind().String(), "SPAN_KIND_"))
+	traceID := hex.EncodeToString(span.GetTraceId())
+
+	spanEvents := make([]any, 0, len(span.GetEvents()))
+	for _, spanEvent := range span.GetEvents() {
+		spanEvents = append(spanEvents, map[string]any{
+			"name":       spanEvent.GetName(),
+			"occurredAt": otlpTime(spanEvent.GetTimeUnixNano()),
+			"attributes": otlpAttributes(spanEvent.GetAttributes()),
+		})
+	}
+
+	event := otlpHTTPFields(attrs)
+	statusCode := parseInt(asString(event["statusCode"]), 0)
+	level := "info"
+	switch {
+	case span.GetStatus().GetCode() == tracev1.Status_STATUS_CODE_ERROR || statusCode >= 500:
+		level = "error"
+	case statusCode >= 400:
+		level = "warn"
+	}
+
+	event["category"] = firstString(attrs["category"], "otel_trace")
+	event["type"] = "span_" + kind
+	event["level"] = level
+	event["requestId"] = firstString(attrs["requestId"], attrs["request.id"], attrs["http.request_id"], traceID)
+	event["durationMs"] = durationMs
+	event["tags"] = []any{"otlp", scope.GetName(), "span." + kind}
+	event["occurredAt"] = start
+	event["payload"] = map[string]any{
+		"message":       span.GetName(),
+		"spanName":      span.GetName(),
+		"traceId":       traceID,
+		"spanId":        hex.EncodeToString(span.GetSpanId()),
+		"parentSpanId":  hex.EncodeToString(span.GetParentSpanId()),
+		"kind":          kind,
+		"statusCode":    strings.ToLower(strings.TrimPrefix(span.GetStatus().GetCode().String(), "STATUS_CODE_")),
+		"statusMessage": span.GetStatus().GetMessage(),
+		"attributes":    attrs,
+		"resource":      resource,
+		"scope":         otlpScope(scope),
+		"events":        spanEvents,
+	}
+	return event
+}
+
+// otlpHTTPFields maps both the current and the legacy OpenTelemetry HTTP
+// semantic conventions onto the observer event columns.
+func otlpHTTPFields(attrs map[string]any) map[string]any {
+	event := map[string]any{
+		"method": firstString(attrs["http.request.method"], attrs["http.method"]),
+		"path":   firstString(attrs["url.path"], attrs["http.target"], attrs["http.route"]),
+		"url":    firstString(attrs["url.full"], attrs["http.url"]),
+		"ip":     firstString(attrs["client.address"], attrs["http.client_ip"], attrs["net.sock.peer.addr"], attrs["net.peer.ip"]),
+	}
+	if statusCode := firstNonNil(attrs["http.response.status_code"], attrs["http.status_code"]); statusCode != nil {
+		event["statusCode"] = statusCode
+	}
+	if route := firstString(attrs["http.route"]); route != "" && firstString(event["path"]) == "" {
+		event["path"] = route
+	}
+	return event
+}
+
+// otlpSeverityLevel folds the 24 OTLP severity numbers into observer levels.
+func otlpSeverityLevel(number int32, text string) string {
+	switch {
+	case number >= 17:
+		return "error"
+	case number >= 13:
+		return "warn"
+	case number >= 9:
+		return "info"
+	case number >= 1:
+		return "debug"
+	}
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "fatal", "critical", "crit", "err":
+		return "error"
+	case "warning":
+		return "warn"
+	case "trace":
+		return "debug"
+	}
+	return normalizeLevel(text, "info")
+}
+
+func otlpTime(values ...uint64) time.Time {
+	for _, value := range values {
+		if value > 0 {
+			return time.Unix(0, int64(value)).UTC()
+		}
+	}
+	return time.Now().UTC()
+}
+
+func otlpScope(scope *commonv1.InstrumentationScope) map[string]any {
+	if scope == nil {
+		return map[string]any{}
+	}
+	return map[string]any{
+		"name":    scope.GetName(),
+		"version": scope.GetVersion(),
+	}
+}
+
+func otlpAttributes(attrs []*commonv1.KeyValue) map[string]any {
+	out := make(map[string]any, len(attrs))
+	for _, attr := range attrs {
+		if attr.GetKey() == "" {
+			continue
+		}
+		out[attr.GetKey()] = otlpValue(attr.GetValue())
+	}
+	return out
+}
+
+func otlpValue(value *commonv1.AnyValue) any {
+	if value == nil {
+		return nil
+	}
+	switch typed := value.GetValue().(type) {
+	case *commonv1.AnyValue_StringValue:
+		return typed.StringValue
+	case *commonv1.AnyValue_BoolValue:
+		return typed.BoolValue
+	case *commonv1.AnyValue_IntValue:
+		return typed.IntValue
+	case *commonv1.AnyValue_DoubleValue:
+		return typed.DoubleValue
+	case *commonv1.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(typed.BytesValue)
+	case *commonv1.AnyValue_ArrayValue:
+		items := make([]any, 0, len(typed.ArrayValue.GetValues()))
+		for _, item := range typed.ArrayValue.GetValues() {
+			items = append(items, otlpValue(item))
+		}
+		return items
+	case *commonv1.AnyValue_KvlistValue:
+		return otlpAttributes(typed.KvlistValue.GetValues())
+	}
+	return nil
+}
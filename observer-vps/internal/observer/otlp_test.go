@@ -0,0 +1,256 @@
+package observer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	logsv1 "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcev1 "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// postOTLP sends an OTLP/HTTP body with the observer key and returns the
+// raw response, since protobuf exports are answered in protobuf.
+func postOTLP(t *testing.T, handler http.Handler, path, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-pkt-observer-key", testObserverKey)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func otlpString(key, value string) *commonv1.KeyValue {
+	return &commonv1.KeyValue{Key: key, Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: value}}}
+}
+
+func otlpLogsBody(t *testing.T, service string, records ...*logsv1.LogRecord) []byte {
+	t.Helper()
+	raw, err := proto.Marshal(&logsv1.LogsData{ResourceLogs: []*logsv1.ResourceLogs{{
+		Resource:  &resourcev1.Resource{Attributes: []*commonv1.KeyValue{otlpString("service.name", service)}},
+		ScopeLogs: []*logsv1.ScopeLogs{{Scope: &commonv1.InstrumentationScope{Name: "pino"}, LogRecords: records}},
+	}}})
+	if err != nil {
+		t.Fatalf("marshal logs: %v", err)
+	}
+	return raw
+}
+
+func storedOTLPEvents(t *testing.T, svc *service, source string) map[string]map[string]any {
+	t.Helper()
+	rows, err := svc.store.events.find(context.Background(), findQuery{filter: bson.M{"source": source}})
+	if err != nil {
+		t.Fatalf("find events: %v", err)
+	}
+	byMessage := make(map[string]map[string]any, len(rows))
+	for _, row := range rows {
+		byMessage[asString(toMap(row["payload"])["message"])] = row
+	}
+	return byMessage
+}
+
+func TestOTLPLogsMapResourceAndSeverity(t *testing.T) {
+	svc, handler := newTestService(t)
+	occurred := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	record := func(message string, number logsv1.SeverityNumber, text string) *logsv1.LogRecord {
+		return &logsv1.LogRecord{
+			TimeUnixNano:   uint64(occurred.UnixNano()),
+			SeverityNumber: number,
+			SeverityText:   text,
+			Body:           &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: message}},
+			Attributes:     []*commonv1.KeyValue{otlpString("http.method", "post"), otlpString("http.target", "/api/matches")},
+			TraceId:        bytes.Repeat([]byte{0xab}, 16),
+			SpanId:         bytes.Repeat([]byte{0xcd}, 8),
+		}
+	}
+	body := otlpLogsBody(t, "pickletour-api-main",
+		record("trace", logsv1.SeverityNumber_SEVERITY_NUMBER_TRACE2, ""),
+		record("debug", logsv1.SeverityNumber_SEVERITY_NUMBER_DEBUG4, ""),
+		record("info", logsv1.SeverityNumber_SEVERITY_NUMBER_INFO, "INFO"),
+		record("warn", logsv1.SeverityNumber_SEVERITY_NUMBER_WARN3, ""),
+		record("error", logsv1.SeverityNumber_SEVERITY_NUMBER_ERROR, ""),
+		record("fatal", logsv1.SeverityNumber_SEVERITY_NUMBER_FATAL4, ""),
+		record("text warning", logsv1.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, "WARNING"),
+		record("text critical", logsv1.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, "critical"),
+	)
+
+	rec := postOTLP(t, handler, "/api/observer/ingest/otlp/v1/logs", otlpContentTypeProtobuf, body)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != otlpContentTypeProtobuf {
+		t.Fatalf("export = %d %q (%s), want 200 with an empty protobuf response", rec.Code, rec.Body.Bytes(), rec.Header().Get("Content-Type"))
+	}
+
+	events := storedOTLPEvents(t, svc, "pickletour-api-main")
+	levels := map[string]string{
+		"trace": "debug", "debug": "debug", "info": "info", "warn": "warn",
+		"error": "error", "fatal": "error", "text warning": "warn", "text critical": "error",
+	}
+	for message, want := range levels {
+		row, ok := events[message]
+		if !ok {
+			t.Errorf("no event stored for %q", message)
+			continue
+		}
+		if row["level"] != want {
+			t.Errorf("%s: level = %v, want %s", message, row["level"], want)
+		}
+	}
+	row := events["info"]
+	if row["category"] != "otel_log" || row["method"] != "POST" || row["path"] != "/api/matches" {
+		t.Errorf("info event = %v, want otel_log POST /api/matches", row)
+	}
+	if !parseTime(row["occurredAt"]).Equal(occurred) || row["requestId"] != strings.Repeat("ab", 16) {
+		t.Errorf("info event occurredAt = %v requestId = %v", row["occurredAt"], row["requestId"])
+	}
+	if payload := toMap(row["payload"]); payload["spanId"] != strings.Repeat("cd", 8) || toMap(payload["resource"])["service.name"] != "pickletour-api-main" {
+		t.Errorf("payload = %v, want hex ids and the resource attributes", payload)
+	}
+}
+
+func TestOTLPTracesAcceptJSONWithHexIDs(t *testing.T) {
+	svc, handler := newTestService(t)
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	traceID := "5b8efff798038103d269b633813fc60c"
+	span := func(name, statusCode string, status map[string]any, attrs ...map[string]any) map[string]any {
+		attrs = append(attrs,
+			map[string]any{"key": "http.request.method", "value": map[string]any{"stringValue": "get"}},
+			map[string]any{"key": "url.path", "value": map[string]any{"stringValue": "/api/" + name}},
+			map[string]any{"key": "http.response.status_code", "value": map[string]any{"intValue": statusCode}},
+		)
+		return map[string]any{
+			"traceId":           traceID,
+			"spanId":            "eee19b7ec3c1b174",
+			"parentSpanId":      "eee19b7ec3c1b173",
+			"name":              name,
+			"kind":              2,
+			"startTimeUnixNano": fmt.Sprint(start.UnixNano()),
+			"endTimeUnixNano":   fmt.Sprint(start.Add(250 * time.Millisecond).UnixNano()),
+			"attributes":        attrs,
+			"status":            status,
+		}
+	}
+	body, err := json.Marshal(map[string]any{"resourceSpans": []any{map[string]any{
+		"resource": map[string]any{"attributes": []any{
+			map[string]any{"key": "service.name", "value": map[string]any{"stringValue": "pickletour-worker"}},
+		}},
+		"scopeSpans": []any{map[string]any{
+			"scope": map[string]any{"name": "otel-http"},
+			"spans": []any{
+				span("ok", "200", nil),
+				span("missing", "404", nil),
+				span("broken", "503", nil),
+				span("failed", "200", map[string]any{"code": 2, "message": "boom"}),
+			},
+		}},
+	}}})
+	if err != nil {
+		t.Fatalf("marshal traces: %v", err)
+	}
+
+	code, response := doJSONBody(t, handler, "/api/observer/ingest/otlp/v1/traces", body)
+	if code != http.StatusOK || len(response) != 0 {
+		t.Fatalf("export = %d %v, want 200 with an empty response", code, response)
+	}
+
+	events := storedOTLPEvents(t, svc, "pickletour-worker")
+	levels := map[string]string{"ok": "info", "missing": "warn", "broken": "error", "failed": "error"}
+	for name, want := range levels {
+		if row := events[name]; row["level"] != want {
+			t.Errorf("%s: level = %v, want %s", name, row["level"], want)
+		}
+	}
+	row := events["broken"]
+	if row["method"] != "GET" || row["path"] != "/api/broken" || fmt.Sprint(row["statusCode"]) != "503" || fmt.Sprint(row["durationMs"]) != "250" {
+		t.Errorf("span event = %v, want GET /api/broken 503 in 250ms", row)
+	}
+	if row["type"] != "span_server" || row["category"] != "otel_trace" || row["requestId"] != traceID {
+		t.Errorf("span event type = %v category = %v requestId = %v", row["type"], row["category"], row["requestId"])
+	}
+	payload := toMap(row["payload"])
+	if payload["traceId"] != traceID || payload["spanId"] != "eee19b7ec3c1b174" || payload["parentSpanId"] != "eee19b7ec3c1b173" {
+		t.Errorf("payload ids = %v %v %v, want the hex ids round-tripped", payload["traceId"], payload["spanId"], payload["parentSpanId"])
+	}
+
+	bad := bytes.Replace(body, []byte(traceID), []byte("not-hex"), 1)
+	if code, _ := doJSONBody(t, handler, "/api/observer/ingest/otlp/v1/traces", bad); code != http.StatusBadRequest {
+		t.Errorf("export with a non-hex trace id = %d, want 400", code)
+	}
+}
+
+func TestOTLPReportsPartialSuccessPastTheRecordLimit(t *testing.T) {
+	svc, handler := newTestService(t)
+	records := make([]*logsv1.LogRecord, otlpMaxRecords+3)
+	for index := range records {
+		records[index] = &logsv1.LogRecord{SeverityNumber: logsv1.SeverityNumber_SEVERITY_NUMBER_INFO}
+	}
+
+	rec := postOTLP(t, handler, "/api/observer/ingest/otlp/v1/logs", otlpContentTypeProtobuf, otlpLogsBody(t, "bulk", records...))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export = %d %s", rec.Code, rec.Body.String())
+	}
+	// ExportLogsServiceResponse { partial_success (1) { rejected_log_records (1), error_message (2) } }
+	number, wireType, n := protowire.ConsumeTag(rec.Body.Bytes())
+	if number != 1 || wireType != protowire.BytesType || n < 0 {
+		t.Fatalf("response = %x, want a partial_success field", rec.Body.Bytes())
+	}
+	partial, _ := protowire.ConsumeBytes(rec.Body.Bytes()[n:])
+	fields := map[protowire.Number]any{}
+	for len(partial) > 0 {
+		number, wireType, n := protowire.ConsumeTag(partial)
+		partial = partial[n:]
+		switch wireType {
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(partial)
+			fields[number], partial = value, partial[n:]
+		case protowire.BytesType:
+			value, n := protowire.ConsumeString(partial)
+			fields[number], partial = value, partial[n:]
+		default:
+			t.Fatalf("unexpected wire type %v in partial_success", wireType)
+		}
+	}
+	if fields[1] != uint64(3) || !strings.Contains(asString(fields[2]), "2000") {
+		t.Errorf("partial_success = %v, want 3 rejected with the limit in the message", fields)
+	}
+	count, err := svc.store.events.count(context.Background(), bson.M{"source": "bulk"})
+	if err != nil || count != otlpMaxRecords {
+		t.Errorf("stored %d events (%v), want %d", count, err, otlpMaxRecords)
+	}
+
+	spans := make([]any, otlpMaxRecords+1)
+	for index := range spans {
+		spans[index] = map[string]any{"name": "span"}
+	}
+	body, err := json.Marshal(map[string]any{"resourceSpans": []any{map[string]any{
+		"scopeSpans": []any{map[string]any{"spans": spans}},
+	}}})
+	if err != nil {
+		t.Fatalf("marshal traces: %v", err)
+	}
+	code, response := doJSONBody(t, handler, "/api/observer/ingest/otlp/v1/traces", body)
+	partialJSON := toMap(response["partialSuccess"])
+	if code != http.StatusOK || partialJSON["rejectedSpans"] != float64(1) || asString(partialJSON["errorMessage"]) == "" {
+		t.Errorf("export = %d %v, want one rejected span", code, response)
+	}
+}
+
+// doJSONBody posts an already encoded OTLP/JSON body.
+func doJSONBody(t *testing.T, handler http.Handler, path string, body []byte) (int, map[string]any) {
+	t.Helper()
+	rec := postOTLP(t, handler, path, otlpContentTypeJSON, body)
+	var decoded map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, decoded
+}
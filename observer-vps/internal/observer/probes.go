@@ -0,0 +1,477 @@
+package observer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	probeKindHTTP = "http"
+	probeKindTCP  = "tcp"
+	probeKindTLS  = "tls"
+
+	probeDefaultSource = "observer-probes"
+	probeTickInterval  = time.Second
+	probeBodyLimit     = 256 << 10
+	probeTLSWarnDays   = 14
+	probeWriteKind     = "probes"
+)
+
+var probeNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// probeTarget is one synthetic check. Target is an http(s) URL, or
+// tcp://host:port to check that a port accepts connections, or
+// tls://host:port to also complete a TLS handshake and read the
+// certificate. Zero IntervalMs and TimeoutMs use OBSERVER_PROBE_INTERVAL_MS
+// and OBSERVER_PROBE_TIMEOUT_MS.
+type probeTarget struct {
+	Name         string
+	Kind         string
+	Target       string
+	Method       string
+	Headers      map[string]string
+	IntervalMs   int
+	TimeoutMs    int
+	ExpectStatus []int
+	ExpectBody   string
+	TLSWarnDays  int
+	Source       string
+	// rootCAs replaces the system roots; tests use it to trust their own
+	// servers.
+	rootCAs *x509.CertPool
+}
+
+// parseProbe validates a probe as listed under probes in the config file;
+// OBSERVER_PROBES entries arrive as just a name and url.
+func parseProbe(entry map[string]any) (probeTarget, error) {
+	probe := probeTarget{
+		Name:        strings.TrimSpace(asString(entry["name"])),
+		Method:      strings.ToUpper(defaultString(strings.TrimSpace(asString(entry["method"])), http.MethodGet)),
+		ExpectBody:  asString(entry["expectBody"]),
+		TLSWarnDays: probeTLSWarnDays,
+		Source:      defaultString(strings.TrimSpace(asString(entry["source"])), probeDefaultSource),
+	}
+	if !probeNamePattern.MatchString(probe.Name) {
+		return probe, errors.New("name is required and may only use letters, digits, '.', '_' and '-'")
+	}
+	target, err := url.Parse(strings.TrimSpace(asString(entry["url"])))
+	if err != nil || target.Host == "" {
+		return probe, errors.New("url must be an http(s), tcp:// or tls:// URL with a host")
+	}
+	switch target.Scheme {
+	case "http", "https":
+		probe.Kind = probeKindHTTP
+		probe.Target = target.String()
+	case probeKindTCP, probeKindTLS:
+		if target.Port() == "" {
+			return probe, fmt.Errorf("%s:// url needs a port", target.Scheme)
+		}
+		probe.Kind = target.Scheme
+		probe.Target = target.Host
+	default:
+		return probe, errors.New("url must be an http(s), tcp:// or tls:// URL with a host")
+	}
+	for key, field := range map[string]*int{"intervalMs": &probe.IntervalMs, "timeoutMs": &probe.TimeoutMs, "tlsWarnDays": &probe.TLSWarnDays} {
+		value, ok := entry[key]
+		if !ok {
+			continue
+		}
+		*field = parseInt(asString(value), -1)
+		if *field < 0 || (*field == 0 && key != "tlsWarnDays") {
+			return probe, fmt.Errorf("%s must be a positive number", key)
+		}
+	}
+	if value, ok := entry["expectStatus"]; ok {
+		items := toSlice(value)
+		if len(items) == 0 {
+			items = []any{value}
+		}
+		for _, item := range items {
+			code := parseInt(asString(item), 0)
+			if code < 100 || code > 599 {
+				return probe, fmt.Errorf("expectStatus must be HTTP status codes, got %v", item)
+			}
+			probe.ExpectStatus = append(probe.ExpectStatus, code)
+		}
+	}
+	if headers := toMap(entry["headers"]); len(headers) > 0 {
+		probe.Headers = map[string]string{}
+		for key, value := range headers {
+			probe.Headers[key] = asString(value)
+		}
+	}
+	if probe.Kind != probeKindHTTP && (probe.ExpectBody != "" || len(probe.ExpectStatus) > 0 || len(probe.Headers) > 0) {
+		return probe, errors.New("expectStatus, expectBody and headers only apply to http(s) probes")
+	}
+	return probe, nil
+}
+
+// label is the target as shown in results: the URL without credentials or
+// the host:port.
+func (p probeTarget) label() string {
+	if p.Kind != probeKindHTTP {
+		return p.Kind + "://" + p.Target
+	}
+	parsed, err := url.Parse(p.Target)
+	if err != nil {
+		return p.Target
+	}
+	parsed.User = nil
+	return parsed.String()
+}
+
+type probeResult struct {
+	Up           bool
+	StatusCode   int
+	Latency      time.Duration
+	Error        string
+	Warning      string
+	TLSExpiresAt time.Time
+}
+
+// runProber checks every configured probe on its own interval. It runs as
+// a scheduler job so only one replica probes; the list is re-read every
+// tick, so a config reload adds and removes probes in place.
+func (s *service) runProber(ctx context.Context) {
+	var mu sync.Mutex
+	var checks sync.WaitGroup
+	defer checks.Wait()
+	running := map[string]bool{}
+	next := map[string]time.Time{}
+	ticker := time.NewTicker(probeTickInterval)
+	defer ticker.Stop()
+	for {
+		cfg := s.settings()
+		now := time.Now().UTC()
+		for _, probe := range cfg.Probes {
+			mu.Lock()
+			busy := running[probe.Name]
+			if !busy && !now.Before(next[probe.Name]) {
+				running[probe.Name] = true
+			}
+			mu.Unlock()
+			if busy || now.Before(next[probe.Name]) {
+				continue
+			}
+			next[probe.Name] = now.Add(time.Duration(defaultInt(probe.IntervalMs, cfg.ProbeIntervalMs)) * time.Millisecond)
+			timeout := time.Duration(defaultInt(probe.TimeoutMs, cfg.ProbeTimeoutMs)) * time.Millisecond
+			checks.Add(1)
+			go func(probe probeTarget) {
+				defer checks.Done()
+				result := checkProbe(ctx, probe, timeout, time.Now().UTC())
+				if ctx.Err() == nil {
+					if err := s.recordProbe(ctx, probe, result, time.Now().UTC()); err != nil {
+						log.Printf("observer probe %s record error: %v", probe.Name, err)
+					}
+				}
+				mu.Lock()
+				delete(running, probe.Name)
+				mu.Unlock()
+			}(probe)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func defaultInt(value, fallback int) int {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// checkProbe runs one check. now is used to judge certificate expiry.
+func checkProbe(ctx context.Context, probe probeTarget, timeout time.Duration, now time.Time) probeResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	started := time.Now()
+	var result probeResult
+	if probe.Kind == probeKindHTTP {
+		result = checkHTTPProbe(ctx, probe)
+	} else {
+		result = checkConnectProbe(ctx, probe)
+	}
+	result.Latency = time.Since(started)
+	if result.Up && probe.TLSWarnDays > 0 && !result.TLSExpiresAt.IsZero() {
+		if left := result.TLSExpiresAt.Sub(now); left < time.Duration(probe.TLSWarnDays)*24*time.Hour {
+			result.Warning = fmt.Sprintf("certificate expires in %d days", int(left.Hours()/24))
+		}
+	}
+	return result
+}
+
+func checkHTTPProbe(ctx context.Context, probe probeTarget) probeResult {
+	req, err := http.NewRequestWithContext(ctx, probe.Method, probe.Target, nil)
+	if err != nil {
+		return probeResult{Error: err.Error()}
+	}
+	req.Header.Set("User-Agent", "pickletour-observer-probe")
+	for key, value := range probe.Headers {
+		req.Header.Set(key, value)
+	}
+	// A fresh connection per check, so the latency includes the handshake
+	// and every check sees the certificate.
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		DisableKeepAlives: true,
+		ForceAttemptHTTP2: true,
+		TLSClientConfig:   &tls.Config{RootCAs: probe.rootCAs},
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return probeResult{Error: err.Error()}
+	}
+	defer resp.Body.Close()
+	result := probeResult{StatusCode: resp.StatusCode}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		result.TLSExpiresAt = resp.TLS.PeerCertificates[0].NotAfter.UTC()
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, probeBodyLimit))
+	if err != nil {
+		result.Error = "read body: " + err.Error()
+		return result
+	}
+	switch {
+	case len(probe.ExpectStatus) > 0 && !containsInt(probe.ExpectStatus, resp.StatusCode):
+		result.Error = fmt.Sprintf("status %d, expected %v", resp.StatusCode, probe.ExpectStatus)
+	case len(probe.ExpectStatus) == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299):
+		result.Error = fmt.Sprintf("status %d, expected 2xx", resp.StatusCode)
+	case probe.ExpectBody != "" && !strings.Contains(string(body), probe.ExpectBody):
+		result.Error = fmt.Sprintf("body does not contain %q", probe.ExpectBody)
+	default:
+		result.Up = true
+	}
+	return result
+}
+
+func checkConnectProbe(ctx context.Context, probe probeTarget) probeResult {
+	dialer := &net.Dialer{}
+	if probe.Kind == probeKindTCP {
+		conn, err := dialer.DialContext(ctx, "tcp", probe.Target)
+		if err != nil {
+			return probeResult{Error: err.Error()}
+		}
+		_ = conn.Close()
+		return probeResult{Up: true}
+	}
+	host, _, _ := net.SplitHostPort(probe.Target)
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host, RootCAs: probe.rootCAs}}
+	conn, err := tlsDialer.DialContext(ctx, "tcp", probe.Target)
+	if err != nil {
+		return probeResult{Error: err.Error()}
+	}
+	defer conn.Close()
+	result := probeResult{Up: true}
+	if certs := conn.(*tls.Conn).ConnectionState().PeerCertificates; len(certs) > 0 {
+		result.TLSExpiresAt = certs[0].NotAfter.UTC()
+	}
+	return result
+}
+
+func containsInt(values []int, target int) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// recordProbe stores the result in the uptime series and as a probe.check
+// event: info when up, warn when up with a certificate close to expiry,
+// error when down. Down checks therefore also show up as issues.
+func (s *service) recordProbe(ctx context.Context, probe probeTarget, result probeResult, now time.Time) error {
+	label := probe.label()
+	latencyMs := roundMetric(float64(result.Latency.Microseconds()) / 1000)
+	var tlsExpiresAt any
+	if !result.TLSExpiresAt.IsZero() {
+		tlsExpiresAt = result.TLSExpiresAt
+	}
+	_, err := s.store.probes.insertOne(ctx, bson.M{
+		"probe":        probe.Name,
+		"kind":         probe.Kind,
+		"target":       label,
+		"source":       probe.Source,
+		"up":           result.Up,
+		"statusCode":   result.StatusCode,
+		"latencyMs":    latencyMs,
+		"error":        result.Error,
+		"warning":      result.Warning,
+		"tlsExpiresAt": tlsExpiresAt,
+		"checkedAt":    now,
+		"expireAt":     buildExpireAt(s.settings().ProbeTTLDays, now),
+	})
+	s.writes.record(probeWriteKind, err, now)
+	if err != nil {
+		return err
+	}
+
+	level, message := "info", "probe "+probe.Name+" up"
+	if !result.Up {
+		level, message = "error", "probe "+probe.Name+" down: "+result.Error
+	} else if result.Warning != "" {
+		level, message = "warn", "probe "+probe.Name+" "+result.Warning
+	}
+	event := map[string]any{
+		"category":   "probe",
+		"type":       "probe.check",
+		"level":      level,
+		"durationMs": latencyMs,
+		"occurredAt": now,
+		"tags":       []any{"probe", probe.Name},
+		"payload": map[string]any{
+			"probe":        probe.Name,
+			"target":       label,
+			"up":           result.Up,
+			"error":        result.Error,
+			"warning":      result.Warning,
+			"tlsExpiresAt": tlsExpiresAt,
+			"message":      message,
+		},
+	}
+	if probe.Kind == probeKindHTTP {
+		event["method"] = probe.Method
+		event["url"] = label
+		event["statusCode"] = result.StatusCode
+	}
+	_, err = s.insertEvents(ctx, []any{s.buildEventDoc(probe.Source, event, now)})
+	return err
+}
+
+// getUptime summarizes the recorded checks per probe between from and to
+// (default the last 24h): uptime percentage, latency and certificate
+// expiry, plus per-bucket uptime when bucketMinutes is set.
+func (s *service) getUptime(c *gin.Context) {
+	now := time.Now().UTC()
+	from, to := now.Add(-24*time.Hour), now
+	var err error
+	if raw := strings.TrimSpace(c.Query("from")); raw != "" {
+		if from, err = parseTimeParam(raw, now); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid from", "error": err.Error()})
+			return
+		}
+	}
+	if raw := strings.TrimSpace(c.Query("to")); raw != "" {
+		if to, err = parseTimeParam(raw, now); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid to", "error": err.Error()})
+			return
+		}
+	}
+	bucket := time.Duration(clampInt(parseInt(c.Query("bucketMinutes"), 0), 0, 24*60)) * time.Minute
+
+	window := bson.M{"$gte": from, "$lte": to}
+	filter := bson.M{"checkedAt": window}
+	name := strings.TrimSpace(c.Query("probe"))
+	if name != "" {
+		filter["probe"] = name
+	}
+	ctx := c.Request.Context()
+	summaries, err := s.store.probes.uptime(ctx, filter, bucket)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to summarize probe results", "error": err.Error()})
+		return
+	}
+
+	byProbe := map[string]probeUptime{}
+	for _, summary := range summaries {
+		byProbe[summary.Probe] = summary
+	}
+	configured := map[string]probeTarget{}
+	for _, probe := range s.settings().Probes {
+		configured[probe.Name] = probe
+		if _, ok := byProbe[probe.Name]; !ok && (name == "" || name == probe.Name) {
+			byProbe[probe.Name] = probeUptime{Probe: probe.Name}
+		}
+	}
+	names := make([]string, 0, len(byProbe))
+	for probeName := range byProbe {
+		names = append(names, probeName)
+	}
+	sort.Strings(names)
+	items := make([]gin.H, 0, len(names))
+	for _, probeName := range names {
+		summary := byProbe[probeName]
+		item := probeUptimeItem(summary, bucket)
+		if summary.Checks > 0 {
+			latest, err := s.store.probes.findOne(ctx, findQuery{
+				filter: bson.M{"probe": probeName, "checkedAt": window},
+				sort:   bson.D{{Key: "checkedAt", Value: -1}},
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load latest probe result", "error": err.Error()})
+				return
+			}
+			item["current"] = gin.H{
+				"up":           latest["up"] == true,
+				"checkedAt":    parseTime(latest["checkedAt"]),
+				"statusCode":   latest["statusCode"],
+				"latencyMs":    latest["latencyMs"],
+				"error":        asString(latest["error"]),
+				"warning":      asString(latest["warning"]),
+				"tlsExpiresAt": latest["tlsExpiresAt"],
+			}
+		}
+		item["probe"] = probeName
+		probe, ok := configured[probeName]
+		item["configured"] = ok
+		if ok {
+			item["kind"] = probe.Kind
+			item["target"] = probe.label()
+		}
+		items = append(items, item)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok":            true,
+		"from":          from,
+		"to":            to,
+		"bucketMinutes": int(bucket / time.Minute),
+		"items":         items,
+	})
+}
+
+// probeUptimeItem renders one probe's summary; current is added by the
+// caller from the newest check.
+func probeUptimeItem(summary probeUptime, bucket time.Duration) gin.H {
+	item := gin.H{"checks": summary.Checks, "up": summary.Up, "down": summary.Checks - summary.Up, "uptimePercent": nil}
+	if summary.Checks == 0 {
+		return item
+	}
+	item["uptimePercent"] = roundMetric(100 * float64(summary.Up) / float64(summary.Checks))
+	item["lastDownAt"] = nil
+	if !summary.LastDownAt.IsZero() {
+		item["lastDownAt"] = summary.LastDownAt.UTC()
+	}
+	if summary.Up > 0 {
+		item["avgLatencyMs"] = roundMetric(summary.AvgLatencyMs)
+		item["p95LatencyMs"] = roundMetric(summary.P95LatencyMs)
+		item["maxLatencyMs"] = summary.MaxLatencyMs
+	}
+	if bucket > 0 {
+		series := make([]gin.H, 0, len(summary.Series))
+		for _, entry := range summary.Series {
+			series = append(series, gin.H{"t": entry.Start, "checks": entry.Checks, "uptimePercent": roundMetric(100 * float64(entry.Up) / float64(entry.Checks))})
+		}
+		item["series"] = series
+	}
+	return item
+}
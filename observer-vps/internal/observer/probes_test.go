@@ -0,0 +1,187 @@
+package observer
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLoadConfigMergesProbeFileAndEnv(t *testing.T) {
+	t.Setenv("MONGO_URI", "mongodb://127.0.0.1:1/observer_test")
+	t.Setenv("OBSERVER_API_KEY", testObserverKey)
+	t.Setenv("OBSERVER_PROBES", "api-main=https://api.example.com/health,mongo=tcp://10.0.0.5:27017")
+	path := writeConfigFile(t, `
+probes:
+  - name: api-main
+    url: https://old.example.com/health
+  - name: adminsystem
+    url: https://admin.example.com/api/summary
+    expectStatus: [200, 204]
+    expectBody: '"ok":true'
+    headers:
+      Authorization: Bearer probe
+    intervalMs: 30000
+`)
+	t.Setenv("OBSERVER_CONFIG_FILE", path)
+
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	byName := map[string]probeTarget{}
+	for _, probe := range cfg.Probes {
+		byName[probe.Name] = probe
+	}
+	if len(cfg.Probes) != 3 {
+		t.Fatalf("probes = %+v, want api-main, adminsystem and mongo", cfg.Probes)
+	}
+	if byName["api-main"].Target != "https://api.example.com/health" {
+		t.Errorf("api-main = %+v, want the env url over the file", byName["api-main"])
+	}
+	admin := byName["adminsystem"]
+	if len(admin.ExpectStatus) != 2 || admin.ExpectBody != `"ok":true` || admin.Headers["Authorization"] != "Bearer probe" || admin.IntervalMs != 30000 {
+		t.Errorf("adminsystem = %+v", admin)
+	}
+	if mongo := byName["mongo"]; mongo.Kind != probeKindTCP || mongo.Target != "10.0.0.5:27017" || mongo.label() != "tcp://10.0.0.5:27017" {
+		t.Errorf("mongo = %+v", mongo)
+	}
+
+	t.Setenv("OBSERVER_PROBES", "db=tcp://10.0.0.5,db=https://x.example.com")
+	if _, err := LoadConfig(nil); err == nil || !strings.Contains(err.Error(), "tcp:// url needs a port") || !strings.Contains(err.Error(), `probe "db" is listed twice`) {
+		t.Errorf("err = %v, want the missing port and duplicate name reported", err)
+	}
+}
+
+func TestProbeResultsFeedUptime(t *testing.T) {
+	svc, handler := newBoltTestService(t)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer healthy.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC().Add(-time.Minute)
+	for index, entry := range []map[string]any{
+		{"name": "upload", "url": healthy.URL + "/health", "expectBody": `"ok":true`},
+		{"name": "upload", "url": down.URL + "/health"},
+	} {
+		probe, err := parseProbe(entry)
+		if err != nil {
+			t.Fatalf("parse probe: %v", err)
+		}
+		checkedAt := now.Add(time.Duration(index) * time.Second)
+		if err := svc.recordProbe(ctx, probe, checkProbe(ctx, probe, time.Second, checkedAt), checkedAt); err != nil {
+			t.Fatalf("record probe: %v", err)
+		}
+	}
+	if count, err := svc.store.events.count(ctx, bson.M{"type": "probe.check", "level": "error"}); err != nil || count != 1 {
+		t.Errorf("down events = %d (%v), want one error event", count, err)
+	}
+
+	code, body := doJSON(t, handler, http.MethodGet, "/api/observer/read/uptime?probe=upload&bucketMinutes=60", nil)
+	if code != http.StatusOK {
+		t.Fatalf("uptime = %d %v", code, body)
+	}
+	items := toSlice(body["items"])
+	if len(items) != 1 {
+		t.Fatalf("items = %v", items)
+	}
+	item := toMap(items[0])
+	if item["checks"] != float64(2) || item["uptimePercent"] != float64(50) || item["lastDownAt"] == nil {
+		t.Errorf("uptime item = %v", item)
+	}
+	if current := toMap(item["current"]); current["up"] != false || current["error"] == "" {
+		t.Errorf("current = %v, want the failed check", current)
+	}
+	if series := toSlice(item["series"]); len(series) != 1 {
+		t.Errorf("series = %v", series)
+	}
+}
+
+func TestProbeWarnsNearCertificateExpiry(t *testing.T) {
+	svc, _ := newBoltTestService(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	// tls:// probes hang up right after the handshake.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	notAfter := server.Certificate().NotAfter.UTC()
+
+	ctx := context.Background()
+	for _, url := range []string{server.URL + "/health", "tls://" + server.Listener.Addr().String()} {
+		probe, err := parseProbe(map[string]any{"name": "api-tls", "url": url})
+		if err != nil {
+			t.Fatalf("parse probe %s: %v", url, err)
+		}
+		probe.rootCAs = roots
+
+		result := checkProbe(ctx, probe, time.Second, notAfter.Add(-60*24*time.Hour))
+		if !result.Up || result.Warning != "" || !result.TLSExpiresAt.Equal(notAfter) {
+			t.Errorf("%s far from expiry = %+v, want up without a warning", url, result)
+		}
+		now := notAfter.Add(-3 * 24 * time.Hour)
+		result = checkProbe(ctx, probe, time.Second, now)
+		if !result.Up || result.Warning != "certificate expires in 3 days" {
+			t.Fatalf("%s near expiry = %+v, want up with a warning", url, result)
+		}
+		if err := svc.recordProbe(ctx, probe, result, now); err != nil {
+			t.Fatalf("record probe: %v", err)
+		}
+	}
+
+	rows, err := svc.store.events.find(ctx, findQuery{filter: bson.M{"type": "probe.check", "level": "warn"}})
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("warn events = %d (%v), want one per probe kind", len(rows), err)
+	}
+	if payload := toMap(rows[0]["payload"]); payload["warning"] != "certificate expires in 3 days" || payload["tlsExpiresAt"] == nil {
+		t.Errorf("payload = %v", payload)
+	}
+}
+
+func TestTCPProbeReportsClosedPort(t *testing.T) {
+	svc, _ := newBoltTestService(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	probe, err := parseProbe(map[string]any{"name": "mongo", "url": "tcp://" + listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("parse probe: %v", err)
+	}
+	ctx := context.Background()
+	if result := checkProbe(ctx, probe, time.Second, time.Now().UTC()); !result.Up {
+		t.Fatalf("open port = %+v, want up", result)
+	}
+	_ = listener.Close()
+
+	now := time.Now().UTC()
+	result := checkProbe(ctx, probe, time.Second, now)
+	if result.Up || result.Error == "" {
+		t.Fatalf("closed port = %+v, want down with an error", result)
+	}
+	if err := svc.recordProbe(ctx, probe, result, now); err != nil {
+		t.Fatalf("record probe: %v", err)
+	}
+	row, err := svc.store.events.findOne(ctx, findQuery{filter: bson.M{"type": "probe.check"}})
+	if err != nil {
+		t.Fatalf("find event: %v", err)
+	}
+	if row["level"] != "error" || !strings.HasPrefix(asString(toMap(row["payload"])["message"]), "probe mongo down: ") {
+		t.Errorf("event = %v, want an error event naming the probe", row)
+	}
+}
@@ -0,0 +1,478 @@
+package observer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	queryMaxLength = 2000
+	queryMaxTerms  = 64
+	queryMaxDepth  = 16
+)
+
+type queryFieldKind int
+
+const (
+	queryString queryFieldKind = iota
+	queryNumber
+	queryTime
+	queryLevel
+	queryTags
+	queryPayload
+)
+
+// queryFields is the whitelist of event fields the q language may touch.
+// Anything under payload.* is allowed as well; deviceId is shorthand for
+// payload.deviceId to match the deviceId query parameter.
+var queryFields = map[string]queryFieldKind{
+	"source":      queryString,
+	"category":    queryString,
+	"type":        queryString,
+	"level":       queryLevel,
+	"requestId":   queryString,
+	"method":      queryString,
+	"path":        queryString,
+	"url":         queryString,
+	"ip":          queryString,
+	"statusCode":  queryNumber,
+	"durationMs":  queryNumber,
+	"occurredAt":  queryTime,
+	"receivedAt":  queryTime,
+	"tags":        queryTags,
+	"fingerprint": queryString,
+}
+
+var (
+	queryPayloadPathRe = regexp.MustCompile(`^payload(\.[A-Za-z0-9_-]+)+$`)
+	queryStatusClassRe = regexp.MustCompile(`^[1-5]xx$`)
+)
+
+// queryError reports a problem with a q expression and the 1-based character
+// position it was found at.
+type queryError struct {
+	Position int
+	Message  string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("query syntax error at position %d: %s", e.Position, e.Message)
+}
+
+func writeQueryError(c *gin.Context, err error) {
+	response := gin.H{"ok": false, "message": "Invalid query", "error": err.Error()}
+	var syntax *queryError
+	if errors.As(err, &syntax) {
+		response["position"] = syntax.Position
+	}
+	c.JSON(http.StatusBadRequest, response)
+}
+
+type queryTokenKind int
+
+const (
+	tokenLParen queryTokenKind = iota
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenTerm
+	tokenEnd
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	pos   int
+	field string
+	op    string
+	value string
+}
+
+// parseEventQuery turns a q expression into a Mongo filter. The grammar is
+//
+//	expr   = or
+//	or     = and { OR and }
+//	and    = unary { [AND] unary }
+//	unary  = NOT unary | "(" expr ")" | term
+//	term   = field op value
+//	op     = ":" | "=" | "!=" | ">" | ">=" | "<" | "<="
+//
+// Values may be bare words or double-quoted strings. String values with * or ?
+// are wildcards, tags:x tests membership and statusCode:5xx matches a class.
+func parseEventQuery(input string, now time.Time) (bson.M, error) {
+	if len(input) > queryMaxLength {
+		return nil, &queryError{Position: queryMaxLength, Message: fmt.Sprintf("query longer than %d characters", queryMaxLength)}
+	}
+	tokens, err := lexEventQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	terms := 0
+	for _, token := range tokens {
+		if token.kind == tokenTerm {
+			terms++
+		}
+	}
+	if terms == 0 {
+		return nil, &queryError{Position: 1, Message: "query has no field comparisons"}
+	}
+	if terms > queryMaxTerms {
+		return nil, &queryError{Position: 1, Message: fmt.Sprintf("query has more than %d comparisons", queryMaxTerms)}
+	}
+
+	parser := &queryParser{tokens: tokens, now: now}
+	filter, err := parser.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if next := parser.peek(); next.kind != tokenEnd {
+		if next.kind == tokenRParen {
+			return nil, &queryError{Position: next.pos, Message: "unmatched )"}
+		}
+		return nil, &queryError{Position: next.pos, Message: "unexpected token"}
+	}
+	return filter, nil
+}
+
+func lexEventQuery(input string) ([]queryToken, error) {
+	tokens := []queryToken{}
+	index := 0
+	for index < len(input) {
+		char := input[index]
+		switch {
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			index++
+			continue
+		case char == '(':
+			tokens = append(tokens, queryToken{kind: tokenLParen, pos: index + 1})
+			index++
+			continue
+		case char == ')':
+			tokens = append(tokens, queryToken{kind: tokenRParen, pos: index + 1})
+			index++
+			continue
+		}
+
+		start := index
+		for index < len(input) && isQueryFieldChar(input[index]) {
+			index++
+		}
+		word := input[start:index]
+		if word == "" {
+			return nil, &queryError{Position: start + 1, Message: fmt.Sprintf("unexpected character %q", char)}
+		}
+
+		op := queryOperatorAt(input, index)
+		if op == "" {
+			switch strings.ToUpper(word) {
+			case "AND":
+				tokens = append(tokens, queryToken{kind: tokenAnd, pos: start + 1})
+				continue
+			case "OR":
+				tokens = append(tokens, queryToken{kind: tokenOr, pos: start + 1})
+				continue
+			case "NOT":
+				tokens = append(tokens, queryToken{kind: tokenNot, pos: start + 1})
+				continue
+			}
+			return nil, &queryError{Position: start + 1, Message: fmt.Sprintf("expected an operator after %q, e.g. %s:value", word, word)}
+		}
+		index += len(op)
+
+		value, next, err := lexQueryValue(input, index)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, queryToken{kind: tokenTerm, pos: start + 1, field: word, op: op, value: value})
+		index = next
+	}
+	return append(tokens, queryToken{kind: tokenEnd, pos: len(input) + 1}), nil
+}
+
+func isQueryFieldChar(char byte) bool {
+	return char == '.' || char == '_' || char == '-' ||
+		(char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+}
+
+func queryOperatorAt(input string, index int) string {
+	for _, op := range []string{">=", "<=", "!=", ":", "=", ">", "<"} {
+		if strings.HasPrefix(input[index:], op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func lexQueryValue(input string, index int) (string, int, error) {
+	if index >= len(input) || input[index] == ' ' || input[index] == ')' {
+		return "", index, &queryError{Position: index + 1, Message: "missing value"}
+	}
+	if input[index] != '"' {
+		start := index
+		for index < len(input) && input[index] != ' ' && input[index] != '\t' && input[index] != ')' && input[index] != '(' {
+			index++
+		}
+		return input[start:index], index, nil
+	}
+
+	start := index
+	index++
+	var value strings.Builder
+	for index < len(input) {
+		char := input[index]
+		switch {
+		case char == '\\' && index+1 < len(input):
+			value.WriteByte(input[index+1])
+			index += 2
+		case char == '"':
+			return value.String(), index + 1, nil
+		default:
+			value.WriteByte(char)
+			index++
+		}
+	}
+	return "", index, &queryError{Position: start + 1, Message: "unterminated quoted value"}
+}
+
+type queryParser struct {
+	tokens []queryToken
+	index  int
+	now    time.Time
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.index]
+}
+
+func (p *queryParser) next() queryToken {
+	token := p.tokens[p.index]
+	if token.kind != tokenEnd {
+		p.index++
+	}
+	return token
+}
+
+func (p *queryParser) parseOr(depth int) (bson.M, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	clauses := bson.A{left}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, right)
+	}
+	if len(clauses) == 1 {
+		return left, nil
+	}
+	return bson.M{"$or": clauses}, nil
+}
+
+func (p *queryParser) parseAnd(depth int) (bson.M, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	clauses := bson.A{left}
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.next()
+		case tokenNot, tokenLParen, tokenTerm:
+		default:
+			if len(clauses) == 1 {
+				return left, nil
+			}
+			return bson.M{"$and": clauses}, nil
+		}
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, right)
+	}
+}
+
+func (p *queryParser) parseUnary(depth int) (bson.M, error) {
+	if depth > queryMaxDepth {
+		return nil, &queryError{Position: p.peek().pos, Message: "query nested too deeply"}
+	}
+	token := p.next()
+	switch token.kind {
+	case tokenNot:
+		inner, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$nor": bson.A{inner}}, nil
+	case tokenLParen:
+		inner, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, &queryError{Position: token.pos, Message: "missing ) for ( opened here"}
+		}
+		return inner, nil
+	case tokenTerm:
+		return p.compile(token)
+	case tokenEnd:
+		return nil, &queryError{Position: token.pos, Message: "unexpected end of query"}
+	case tokenRParen:
+		return nil, &queryError{Position: token.pos, Message: "unexpected )"}
+	default:
+		return nil, &queryError{Position: token.pos, Message: "expected a comparison"}
+	}
+}
+
+func (p *queryParser) compile(token queryToken) (bson.M, error) {
+	field := token.field
+	if field == "deviceId" {
+		field = "payload.deviceId"
+	}
+	kind, ok := queryFields[field]
+	if !ok {
+		if !queryPayloadPathRe.MatchString(field) {
+			return nil, &queryError{Position: token.pos, Message: fmt.Sprintf("unknown field %q", token.field)}
+		}
+		kind = queryPayload
+	}
+	fail := func(message string) (bson.M, error) {
+		return nil, &queryError{Position: token.pos, Message: message}
+	}
+	ordered := token.op == ">" || token.op == ">=" || token.op == "<" || token.op == "<="
+
+	switch kind {
+	case queryNumber:
+		if token.op == ":" && queryStatusClassRe.MatchString(strings.ToLower(token.value)) {
+			base := int(token.value[0]-'0') * 100
+			return bson.M{field: bson.M{"$gte": base, "$lt": base + 100}}, nil
+		}
+		number, err := strconv.ParseFloat(token.value, 64)
+		if err != nil {
+			return fail(fmt.Sprintf("%s expects a number, got %q", token.field, token.value))
+		}
+		return bson.M{field: queryComparison(token.op, number)}, nil
+
+	case queryTime:
+		at, err := parseTimeParam(token.value, p.now)
+		if err != nil {
+			return fail(fmt.Sprintf("%s: %v", token.field, err))
+		}
+		return bson.M{field: queryComparison(token.op, at)}, nil
+
+	case queryLevel:
+		level := normalizeLevel(token.value, "")
+		if level == "" {
+			return fail(fmt.Sprintf("level must be debug, info, warn or error, got %q", token.value))
+		}
+		if ordered {
+			return bson.M{field: bson.M{"$in": queryLevelRange(token.op, level)}}, nil
+		}
+		return bson.M{field: queryComparison(token.op, level)}, nil
+
+	case queryString, queryTags:
+		if ordered {
+			return fail(fmt.Sprintf("%s only supports :, = and !=", token.field))
+		}
+		var value any = token.value
+		if strings.ContainsAny(token.value, "*?") {
+			value = wildcardRegex(token.value)
+		}
+		if token.op == "!=" {
+			if _, isRegex := value.(primitive.Regex); isRegex {
+				return bson.M{field: bson.M{"$not": value}}, nil
+			}
+			return bson.M{field: bson.M{"$ne": value}}, nil
+		}
+		return bson.M{field: value}, nil
+
+	default:
+		if ordered {
+			number, err := strconv.ParseFloat(token.value, 64)
+			if err == nil {
+				return bson.M{field: queryComparison(token.op, number)}, nil
+			}
+			at, err := parseTimeParam(token.value, p.now)
+			if err != nil {
+				return fail(fmt.Sprintf("%s %s expects a number or time, got %q", token.field, token.op, token.value))
+			}
+			return bson.M{field: queryComparison(token.op, at)}, nil
+		}
+		candidates := bson.A{token.value}
+		if strings.ContainsAny(token.value, "*?") {
+			candidates = bson.A{wildcardRegex(token.value)}
+		} else if number, err := strconv.ParseFloat(token.value, 64); err == nil {
+			candidates = append(candidates, number)
+		} else if flag, err := strconv.ParseBool(token.value); err == nil {
+			candidates = append(candidates, flag)
+		} else if token.value == "null" {
+			candidates = bson.A{nil}
+		}
+		if token.op == "!=" {
+			return bson.M{field: bson.M{"$nin": candidates}}, nil
+		}
+		return bson.M{field: bson.M{"$in": candidates}}, nil
+	}
+}
+
+func queryComparison(op string, value any) any {
+	switch op {
+	case ">":
+		return bson.M{"$gt": value}
+	case ">=":
+		return bson.M{"$gte": value}
+	case "<":
+		return bson.M{"$lt": value}
+	case "<=":
+		return bson.M{"$lte": value}
+	case "!=":
+		return bson.M{"$ne": value}
+	default:
+		return value
+	}
+}
+
+// queryLevelRange expands level>=warn and friends into the matching levels.
+func queryLevelRange(op, level string) bson.A {
+	levels := []string{"debug", "info", "warn", "error"}
+	rank := map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}[level]
+	out := bson.A{}
+	for index, candidate := range levels {
+		if (op == ">" && index > rank) || (op == ">=" && index >= rank) ||
+			(op == "<" && index < rank) || (op == "<=" && index <= rank) {
+			out = append(out, candidate)
+		}
+	}
+	return out
+}
+
+func wildcardRegex(pattern string) primitive.Regex {
+	var out strings.Builder
+	out.WriteString("^")
+	for _, char := range pattern {
+		switch char {
+		case '*':
+			out.WriteString(".*")
+		case '?':
+			out.WriteString(".")
+		default:
+			out.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+	out.WriteString("$")
+	return primitive.Regex{Pattern: out.String(), Options: "i"}
+}
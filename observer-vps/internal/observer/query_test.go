@@ -0,0 +1,91 @@
+package observer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseEventQueryPrecedence(t *testing.T) {
+	now := time.Now().UTC()
+	cases := []struct {
+		query string
+		want  bson.M
+	}{
+		{
+			query: "level:error OR source:api statusCode>=500",
+			want: bson.M{"$or": bson.A{
+				bson.M{"level": "error"},
+				bson.M{"$and": bson.A{bson.M{"source": "api"}, bson.M{"statusCode": bson.M{"$gte": float64(500)}}}},
+			}},
+		},
+		{
+			query: "NOT source:api AND level:warn",
+			want:  bson.M{"$and": bson.A{bson.M{"$nor": bson.A{bson.M{"source": "api"}}}, bson.M{"level": "warn"}}},
+		},
+		{
+			query: "(level:error or level:warn) source:api",
+			want: bson.M{"$and": bson.A{
+				bson.M{"$or": bson.A{bson.M{"level": "error"}, bson.M{"level": "warn"}}},
+				bson.M{"source": "api"},
+			}},
+		},
+		{
+			query: `path:"/api/tournaments/a b" payload.message:"match \"final\" started"`,
+			want: bson.M{"$and": bson.A{
+				bson.M{"path": "/api/tournaments/a b"},
+				bson.M{"payload.message": bson.M{"$in": bson.A{`match "final" started`}}},
+			}},
+		},
+		{
+			query: "statusCode:5xx level>=warn",
+			want: bson.M{"$and": bson.A{
+				bson.M{"statusCode": bson.M{"$gte": 500, "$lt": 600}},
+				bson.M{"level": bson.M{"$in": bson.A{"warn", "error"}}},
+			}},
+		},
+	}
+	for _, tc := range cases {
+		got, err := parseEventQuery(tc.query, now)
+		if err != nil {
+			t.Errorf("%s: %v", tc.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\n got  %v\n want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestParseEventQueryErrors(t *testing.T) {
+	cases := []struct {
+		query    string
+		position int
+		message  string
+	}{
+		{"statusCode>=abc", 1, "statusCode expects a number"},
+		{"source:api path>/x", 12, "path only supports"},
+		{"level:loud", 1, "level must be debug, info, warn or error"},
+		{`source:"api`, 8, "unterminated quoted value"},
+		{"(source:api", 1, "missing ) for ( opened here"},
+		{"source:api)", 11, "unmatched )"},
+		{"source:", 8, "missing value"},
+		{"host:web-1", 1, `unknown field "host"`},
+		{"NOT AND", 1, "query has no field comparisons"},
+	}
+	for _, tc := range cases {
+		_, err := parseEventQuery(tc.query, time.Now().UTC())
+		var syntax *queryError
+		if !errors.As(err, &syntax) {
+			t.Errorf("%s: err = %v, want a queryError", tc.query, err)
+			continue
+		}
+		if syntax.Position != tc.position || !strings.Contains(syntax.Message, tc.message) {
+			t.Errorf("%s: got %d %q, want %d %q", tc.query, syntax.Position, syntax.Message, tc.position, tc.message)
+		}
+	}
+}
@@ -0,0 +1,530 @@
+package observer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	throttleReasonSource = "source_rate"
+	throttleReasonAPIKey = "api_key_rate"
+	throttleReasonDevice = "device_rate"
+	throttleReasonQuota  = "daily_quota"
+
+	bucketIdleEviction = 10 * time.Minute
+
+	quotaDayLayout    = "2006-01-02"
+	quotaSyncInterval = 5 * time.Second
+	quotaLedgerRetain = 2 * 24 * time.Hour
+)
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// bucketSet is a family of token buckets sharing one rate and burst, keyed by
+// source, credential or device. A zero rate disables the family.
+type bucketSet struct {
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+func newBucketSet(ratePerSec, burst int) *bucketSet {
+	return &bucketSet{
+		rate:    float64(ratePerSec),
+		burst:   float64(maxInt(burst, ratePerSec)),
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+func (b *bucketSet) enabled() bool {
+	return b != nil && b.rate > 0
+}
+
+func (b *bucketSet) refill(key string, now time.Time) *tokenBucket {
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: b.burst, updated: now}
+		b.buckets[key] = bucket
+		return bucket
+	}
+	elapsed := now.Sub(bucket.updated).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(b.burst, bucket.tokens+elapsed*b.rate)
+		bucket.updated = now
+	}
+	return bucket
+}
+
+// wait reports how long key has to wait before cost tokens are available.
+// Costs larger than the burst are capped so a single oversized batch can
+// still get through on a full bucket.
+func (b *bucketSet) wait(key string, cost float64, now time.Time) time.Duration {
+	bucket := b.refill(key, now)
+	cost = math.Min(cost, b.burst)
+	if bucket.tokens >= cost {
+		return 0
+	}
+	return time.Duration((cost - bucket.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *bucketSet) take(key string, cost float64) {
+	bucket := b.buckets[key]
+	if bucket == nil {
+		return
+	}
+	bucket.tokens = math.Max(0, bucket.tokens-math.Min(cost, b.burst))
+}
+
+func (b *bucketSet) evictIdle(now time.Time) {
+	for key, bucket := range b.buckets {
+		if now.Sub(bucket.updated) > bucketIdleEviction {
+			delete(b.buckets, key)
+		}
+	}
+}
+
+// ingestCharge describes what one ingest request is about to write: the
+// number of documents per source and per device, and whether those documents
+// count against the daily event quota.
+type ingestCharge struct {
+	sources     map[string]int
+	devices     map[string]int
+	quotaEvents bool
+}
+
+func newIngestCharge(quotaEvents bool) *ingestCharge {
+	return &ingestCharge{
+		sources:     map[string]int{},
+		devices:     map[string]int{},
+		quotaEvents: quotaEvents,
+	}
+}
+
+func (ch *ingestCharge) add(source, deviceID string, count int) {
+	ch.sources[source] += count
+	if deviceID != "" {
+		ch.devices[deviceID] += count
+	}
+}
+
+func (ch *ingestCharge) total() int {
+	total := 0
+	for _, count := range ch.sources {
+		total += count
+	}
+	return total
+}
+
+type ingestDecision struct {
+	allowed    bool
+	reason     string
+	retryAfter time.Duration
+}
+
+type ingestLimiter struct {
+	mu sync.Mutex
+
+	bySource *bucketSet
+	byAPIKey *bucketSet
+	byDevice *bucketSet
+
+	dailyQuota    int
+	quotaBySource map[string]int
+	quotaDay      string
+	// quotaUsage is the day's stored total per source as of the last sync
+	// plus what this process admitted since; quotaUnsynced is the part of
+	// it the ledger has not recorded yet. Without a ledger both stay local.
+	quotaUsage       map[string]int64
+	quotaUnsynced    map[string]int64
+	ledger           quotaLedger
+	throttledTotal   int64
+	throttledReasons map[string]int64
+	throttledSources map[string]int64
+	lastEviction     time.Time
+}
+
+func newIngestLimiter(cfg Config) *ingestLimiter {
+	quotaBySource := map[string]int{}
+	for source, quota := range cfg.DailyEventQuotaBySource {
+		quotaBySource[source] = quota
+	}
+	return &ingestLimiter{
+		bySource:         newBucketSet(cfg.SourceRatePerSec, cfg.SourceRateBurst),
+		byAPIKey:         newBucketSet(cfg.APIKeyRatePerSec, cfg.APIKeyRateBurst),
+		byDevice:         newBucketSet(cfg.DeviceRatePerSec, cfg.DeviceRateBurst),
+		dailyQuota:       cfg.DailyEventQuota,
+		quotaBySource:    quotaBySource,
+		quotaUsage:       map[string]int64{},
+		quotaUnsynced:    map[string]int64{},
+		throttledReasons: map[string]int64{},
+		throttledSources: map[string]int64{},
+	}
+}
+
+func (l *ingestLimiter) quotaFor(source string) int {
+	if quota, ok := l.quotaBySource[source]; ok {
+		return quota
+	}
+	return l.dailyQuota
+}
+
+// admit checks every limit touched by the charge before consuming anything,
+// so a rejected request never drains tokens or quota.
+func (l *ingestLimiter) admit(credential string, charge *ingestCharge, now time.Time) ingestDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastEviction) > time.Minute {
+		l.bySource.evictIdle(now)
+		l.byAPIKey.evictIdle(now)
+		l.byDevice.evictIdle(now)
+		l.lastEviction = now
+	}
+	l.rollQuotaDay(now)
+
+	total := float64(maxInt(charge.total(), 1))
+	decision := ingestDecision{allowed: true}
+	reject := func(reason string, wait time.Duration) {
+		if decision.allowed || wait > decision.retryAfter {
+			decision = ingestDecision{allowed: false, reason: reason, retryAfter: wait}
+		}
+	}
+
+	if l.byAPIKey.enabled() && credential != "" {
+		if wait := l.byAPIKey.wait(credential, total, now); wait > 0 {
+			reject(throttleReasonAPIKey, wait)
+		}
+	}
+	for source, count := range charge.sources {
+		if l.bySource.enabled() {
+			if wait := l.bySource.wait(source, float64(maxInt(count, 1)), now); wait > 0 {
+				reject(throttleReasonSource, wait)
+			}
+		}
+		if charge.quotaEvents && count > 0 {
+			if quota := l.quotaFor(source); quota > 0 && l.quotaUsage[source]+int64(count) > int64(quota) {
+				reject(throttleReasonQuota, untilNextUTCDay(now))
+			}
+		}
+	}
+	if l.byDevice.enabled() {
+		for deviceID, count := range charge.devices {
+			if wait := l.byDevice.wait(deviceID, float64(maxInt(count, 1)), now); wait > 0 {
+				reject(throttleReasonDevice, wait)
+			}
+		}
+	}
+
+	if !decision.allowed {
+		l.throttledTotal += 1
+		l.throttledReasons[decision.reason] += 1
+		for source := range charge.sources {
+			l.throttledSources[source] += 1
+		}
+		return decision
+	}
+
+	if l.byAPIKey.enabled() && credential != "" {
+		l.byAPIKey.take(credential, total)
+	}
+	for source, count := range charge.sources {
+		if l.bySource.enabled() {
+			l.bySource.take(source, float64(maxInt(count, 1)))
+		}
+		if charge.quotaEvents && count > 0 {
+			l.quotaUsage[source] += int64(count)
+			l.quotaUnsynced[source] += int64(count)
+		}
+	}
+	if l.byDevice.enabled() {
+		for deviceID, count := range charge.devices {
+			l.byDevice.take(deviceID, float64(maxInt(count, 1)))
+		}
+	}
+	return decision
+}
+
+// rollQuotaDay starts a new quota day at 00:00 UTC. Increments of the old
+// day that were never synced are dropped with it.
+func (l *ingestLimiter) rollQuotaDay(now time.Time) {
+	if day := now.UTC().Format(quotaDayLayout); day != l.quotaDay {
+		l.quotaDay = day
+		l.quotaUsage = map[string]int64{}
+		l.quotaUnsynced = map[string]int64{}
+	}
+}
+
+// runQuotaSync writes admitted counts to the ledger every few seconds and
+// picks up what other replicas and earlier runs recorded for the day.
+func (l *ingestLimiter) runQuotaSync(ctx context.Context) {
+	if l.ledger == nil {
+		return
+	}
+	ticker := time.NewTicker(quotaSyncInterval)
+	defer ticker.Stop()
+	for {
+		if err := l.syncQuota(ctx, time.Now().UTC()); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("observer quota sync error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := l.syncQuota(flushCtx, time.Now().UTC()); err != nil {
+				log.Printf("observer quota sync error: %v", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncQuota adds the unsynced counts to the ledger and replaces the day's
+// usage with the ledger totals plus whatever was admitted meanwhile. Counts
+// a failed write did not record are kept for the next sync.
+func (l *ingestLimiter) syncQuota(ctx context.Context, now time.Time) error {
+	l.mu.Lock()
+	l.rollQuotaDay(now)
+	day, pending := l.quotaDay, l.quotaUnsynced
+	l.quotaUnsynced = map[string]int64{}
+	l.mu.Unlock()
+
+	totals, unrecorded, err := l.ledger.add(ctx, day, pending, now)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if day != l.quotaDay {
+		return err
+	}
+	for source, count := range unrecorded {
+		l.quotaUnsynced[source] += count
+	}
+	if err != nil {
+		return err
+	}
+	for source, total := range totals {
+		l.quotaUsage[source] = total + l.quotaUnsynced[source]
+	}
+	return nil
+}
+
+// quotaLedger stores the daily per-source event counts the quota is
+// enforced against, so they survive restarts and are shared by replicas.
+type quotaLedger interface {
+	// add records counts for day and returns the day's totals per source.
+	// On error, unrecorded holds the counts that were not written.
+	add(ctx context.Context, day string, counts map[string]int64, now time.Time) (totals, unrecorded map[string]int64, err error)
+}
+
+func quotaLedgerExpireAt(day string) time.Time {
+	start, _ := time.Parse(quotaDayLayout, day)
+	return start.Add(quotaLedgerRetain)
+}
+
+// mongoQuotaLedger increments one document per day and source, so replicas
+// add to the same totals.
+type mongoQuotaLedger struct {
+	col *mongo.Collection
+}
+
+func (m mongoQuotaLedger) add(ctx context.Context, day string, counts map[string]int64, _ time.Time) (map[string]int64, map[string]int64, error) {
+	if len(counts) > 0 {
+		sources := make([]string, 0, len(counts))
+		models := make([]mongo.WriteModel, 0, len(counts))
+		for source, count := range counts {
+			sources = append(sources, source)
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"day": day, "source": source}).
+				SetUpdate(bson.M{
+					"$inc":         bson.M{"count": count},
+					"$setOnInsert": bson.M{"expireAt": quotaLedgerExpireAt(day)},
+				}).
+				SetUpsert(true))
+		}
+		if _, err := m.col.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			unrecorded := counts
+			var bulk mongo.BulkWriteException
+			if errors.As(err, &bulk) && bulk.WriteConcernError == nil && len(bulk.WriteErrors) > 0 {
+				unrecorded = map[string]int64{}
+				for _, writeErr := range bulk.WriteErrors {
+					unrecorded[sources[writeErr.Index]] = counts[sources[writeErr.Index]]
+				}
+			}
+			return nil, unrecorded, err
+		}
+	}
+	cursor, err := m.col.Find(ctx, bson.M{"day": day}, options.Find().SetProjection(bson.M{"source": 1, "count": 1}))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []bson.M
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, nil, err
+	}
+	return quotaTotals(rows), nil, nil
+}
+
+// storeQuotaLedger keeps the totals in a documentStore that has a single
+// writer, as with the bolt file, so it can read, add and write back.
+type storeQuotaLedger struct {
+	docs documentStore
+}
+
+func (s storeQuotaLedger) add(ctx context.Context, day string, counts map[string]int64, now time.Time) (map[string]int64, map[string]int64, error) {
+	rows, err := s.docs.find(ctx, findQuery{filter: bson.M{"day": day}})
+	if err != nil {
+		return nil, counts, err
+	}
+	totals := quotaTotals(rows)
+	unrecorded := map[string]int64{}
+	for source, count := range counts {
+		if err != nil {
+			unrecorded[source] = count
+			continue
+		}
+		err = s.docs.upsert(ctx,
+			bson.M{"day": day, "source": source},
+			bson.M{"count": totals[source] + count, "updatedAt": now},
+			bson.M{"expireAt": quotaLedgerExpireAt(day)},
+		)
+		if err != nil {
+			unrecorded[source] = count
+			continue
+		}
+		totals[source] += count
+	}
+	if err != nil {
+		return nil, unrecorded, err
+	}
+	return totals, nil, nil
+}
+
+func quotaTotals(rows []bson.M) map[string]int64 {
+	totals := map[string]int64{}
+	for _, row := range rows {
+		totals[asString(row["source"])] += int64(asFloat(row["count"]))
+	}
+	return totals
+}
+
+func (l *ingestLimiter) snapshot() gin.H {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sources := make([]string, 0, len(l.quotaUsage))
+	for source := range l.quotaUsage {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	quotaUsage := make([]gin.H, 0, len(sources))
+	for _, source := range sources {
+		quotaUsage = append(quotaUsage, gin.H{
+			"source": source,
+			"used":   l.quotaUsage[source],
+			"limit":  l.quotaFor(source),
+		})
+	}
+
+	reasons := gin.H{}
+	for reason, count := range l.throttledReasons {
+		reasons[reason] = count
+	}
+	bySource := gin.H{}
+	for source, count := range l.throttledSources {
+		bySource[source] = count
+	}
+	quotaOverrides := gin.H{}
+	for source, quota := range l.quotaBySource {
+		quotaOverrides[source] = quota
+	}
+
+	return gin.H{
+		"limits": gin.H{
+			"source":                  gin.H{"ratePerSec": l.bySource.rate, "burst": l.bySource.burst},
+			"apiKey":                  gin.H{"ratePerSec": l.byAPIKey.rate, "burst": l.byAPIKey.burst},
+			"device":                  gin.H{"ratePerSec": l.byDevice.rate, "burst": l.byDevice.burst},
+			"dailyEventQuota":         l.dailyQuota,
+			"dailyEventQuotaBySource": quotaOverrides,
+		},
+		"quotaDay":   l.quotaDay,
+		"quotaUsage": quotaUsage,
+		"throttled": gin.H{
+			"total":    l.throttledTotal,
+			"byReason": reasons,
+			"bySource": bySource,
+		},
+		"trackedBuckets": gin.H{
+			"source": len(l.bySource.buckets),
+			"apiKey": len(l.byAPIKey.buckets),
+			"device": len(l.byDevice.buckets),
+		},
+	}
+}
+
+// admitIngest applies rate limits and quotas to an ingest request. It writes
+// a 429 with Retry-After and returns false when the request must be dropped.
+func (s *service) admitIngest(c *gin.Context, charge *ingestCharge) bool {
+	decision := s.limits.admit(ingestCredentialKey(c), charge, time.Now().UTC())
+	if decision.allowed {
+		return true
+	}
+	retrySeconds := int(math.Ceil(decision.retryAfter.Seconds()))
+	if retrySeconds < 1 {
+		retrySeconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retrySeconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"ok":           false,
+		"message":      "Observer ingest limit exceeded",
+		"reason":       decision.reason,
+		"retryAfterMs": decision.retryAfter.Milliseconds(),
+	})
+	return false
+}
+
+func (s *service) getIngestLimits(c *gin.Context) {
+	snapshot := s.limits.snapshot()
+	snapshot["ok"] = true
+	snapshot["syslog"] = s.syslog.stats()
+	snapshot["sampling"] = s.sampler.stats()
+	snapshot["updatedAt"] = time.Now().UTC()
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// ingestCredentialKey identifies the caller's credential without keeping the
+// secret itself in memory maps or counters.
+func ingestCredentialKey(c *gin.Context) string {
+	credential := extractObserverKey(c)
+	if credential == "" {
+		credential = extractBearerToken(c)
+	}
+	if credential == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(credential))
+	return hex.EncodeToString(sum[:8])
+}
+
+func untilNextUTCDay(now time.Time) time.Duration {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return next.Sub(now)
+}
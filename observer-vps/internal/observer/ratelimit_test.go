@@ -0,0 +1,65 @@
+package observer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIngestQuotaIsSharedThroughTheLedger(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ledger := storeQuotaLedger{&memoryDocuments{}}
+	newLimiter := func() *ingestLimiter {
+		limiter := newIngestLimiter(Config{DailyEventQuota: 10})
+		limiter.ledger = ledger
+		return limiter
+	}
+	charge := func(count int) *ingestCharge {
+		charge := newIngestCharge(true)
+		charge.add("api", "", count)
+		return charge
+	}
+
+	first := newLimiter()
+	if decision := first.admit("", charge(6), now); !decision.allowed {
+		t.Fatalf("first batch = %+v, want allowed", decision)
+	}
+	if err := first.syncQuota(ctx, now); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	restarted := newLimiter()
+	if err := restarted.syncQuota(ctx, now); err != nil {
+		t.Fatalf("sync after restart: %v", err)
+	}
+	if decision := restarted.admit("", charge(5), now); decision.allowed || decision.reason != throttleReasonQuota {
+		t.Errorf("after restart = %+v, want the stored 6 to count against the quota", decision)
+	}
+	if decision := restarted.admit("", charge(4), now); !decision.allowed {
+		t.Errorf("within the quota = %+v, want allowed", decision)
+	}
+
+	if decision := first.admit("", charge(1), now); !decision.allowed {
+		t.Fatalf("first replica before sync = %+v, want allowed on its stale view", decision)
+	}
+	if err := restarted.syncQuota(ctx, now); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if err := first.syncQuota(ctx, now); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if got := first.quotaUsage["api"]; got != 11 {
+		t.Errorf("synced usage = %d, want both replicas' 11", got)
+	}
+	if decision := first.admit("", charge(1), now); decision.allowed {
+		t.Errorf("after sync = %+v, want the quota exhausted", decision)
+	}
+
+	if err := first.syncQuota(ctx, now.Add(24*time.Hour)); err != nil {
+		t.Fatalf("sync next day: %v", err)
+	}
+	if decision := first.admit("", charge(10), now.Add(24*time.Hour)); !decision.allowed {
+		t.Errorf("next day = %+v, want a fresh quota", decision)
+	}
+}
@@ -0,0 +1,254 @@
+package observer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	readyCheckTimeout       = 2 * time.Second
+	writeHealthWindow       = 5 * time.Minute
+	writeHealthMaxFailures  = 5
+	writeHealthBucketLength = time.Minute
+)
+
+// writeHealth tracks the outcome of storage writes made by the ingest
+// handlers in one-minute buckets, so /readyz can tell an observer that
+// accepts requests but cannot persist them from a healthy one.
+type writeHealth struct {
+	mu                  sync.Mutex
+	buckets             map[time.Time]map[string]*writeTally
+	lastSuccessAt       time.Time
+	lastFailureAt       time.Time
+	lastError           string
+	consecutiveFailures int
+}
+
+type writeTally struct {
+	attempts int
+	failures int
+}
+
+func newWriteHealth() *writeHealth {
+	return &writeHealth{buckets: map[time.Time]map[string]*writeTally{}}
+}
+
+// record notes one write of kind; err is the storage error, if any. A
+// write abandoned because its request context ended (the client went away)
+// says nothing about storage and is not counted.
+func (h *writeHealth) record(kind string, err error, now time.Time) {
+	if h == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	minute := now.UTC().Truncate(writeHealthBucketLength)
+	for bucket := range h.buckets {
+		if now.Sub(bucket) > writeHealthWindow {
+			delete(h.buckets, bucket)
+		}
+	}
+	byKind := h.buckets[minute]
+	if byKind == nil {
+		byKind = map[string]*writeTally{}
+		h.buckets[minute] = byKind
+	}
+	tally := byKind[kind]
+	if tally == nil {
+		tally = &writeTally{}
+		byKind[kind] = tally
+	}
+	tally.attempts++
+	if err == nil {
+		h.lastSuccessAt = now
+		h.consecutiveFailures = 0
+		return
+	}
+	tally.failures++
+	h.lastFailureAt = now
+	h.lastError = err.Error()
+	h.consecutiveFailures++
+}
+
+// check reports the window's error rates. Writes are unhealthy once the
+// last writeHealthMaxFailures in a row failed, until one succeeds or the
+// window passes without another failure.
+func (h *writeHealth) check(now time.Time) (bool, gin.H) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	attempts, failures := 0, 0
+	byKind := gin.H{}
+	totals := map[string]*writeTally{}
+	for bucket, kinds := range h.buckets {
+		if now.Sub(bucket) > writeHealthWindow {
+			continue
+		}
+		for kind, tally := range kinds {
+			total := totals[kind]
+			if total == nil {
+				total = &writeTally{}
+				totals[kind] = total
+			}
+			total.attempts += tally.attempts
+			total.failures += tally.failures
+			attempts += tally.attempts
+			failures += tally.failures
+		}
+	}
+	for kind, total := range totals {
+		byKind[kind] = gin.H{"attempts": total.attempts, "failures": total.failures, "errorRate": writeErrorRate(total.attempts, total.failures)}
+	}
+	ok := h.consecutiveFailures < writeHealthMaxFailures || now.Sub(h.lastFailureAt) > writeHealthWindow
+	return ok, gin.H{
+		"ok":                  ok,
+		"windowMinutes":       int(writeHealthWindow / time.Minute),
+		"attempts":            attempts,
+		"failures":            failures,
+		"errorRate":           writeErrorRate(attempts, failures),
+		"byKind":              byKind,
+		"consecutiveFailures": h.consecutiveFailures,
+		"lastSuccessAt":       nullableTime(h.lastSuccessAt),
+		"lastFailureAt":       nullableTime(h.lastFailureAt),
+		"lastError":           h.lastError,
+	}
+}
+
+func writeErrorRate(attempts, failures int) float64 {
+	if attempts == 0 {
+		return 0
+	}
+	return math.Round(float64(failures)/float64(attempts)*10_000) / 10_000
+}
+
+func nullableTime(value time.Time) any {
+	if value.IsZero() {
+		return nil
+	}
+	return value
+}
+
+// getReadiness answers /readyz: 200 when the store is reachable, its
+// indexes are in place and recent writes are landing, otherwise 503 so
+// Docker and the load balancer stop routing here. /healthz stays a pure
+// liveness check.
+func (s *service) getReadiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyCheckTimeout)
+	defer cancel()
+	now := time.Now().UTC()
+
+	storageCheck := s.checkStorage(ctx)
+	indexCheck := s.checkIndexes(ctx)
+	writesOK, writesCheck := s.writes.check(now)
+	ready := storageCheck["ok"] == true && indexCheck["ok"] == true && writesOK
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{
+		"ok":        ready,
+		"service":   "pickletour-observer-go",
+		"storage":   s.cfg.Storage,
+		"checkedAt": now,
+		"checks": gin.H{
+			"storage":  storageCheck,
+			"indexes":  indexCheck,
+			"writes":   writesCheck,
+			"pipeline": s.pipelineState(),
+		},
+	})
+}
+
+func (s *service) checkStorage(ctx context.Context) gin.H {
+	startedAt := time.Now()
+	var err error
+	switch {
+	case s.mongoBacked():
+		err = s.client.Ping(ctx, nil)
+	case s.bolt != nil:
+		err = s.bolt.ping()
+	}
+	check := gin.H{"ok": err == nil, "latencyMs": time.Since(startedAt).Milliseconds()}
+	if err != nil {
+		check["error"] = err.Error()
+	}
+	return check
+}
+
+// checkIndexes lists each collection's indexes and reports any from
+// indexGroups that is missing, e.g. after a restore dropped them. The bolt
+// store has no indexes to check.
+func (s *service) checkIndexes(ctx context.Context) gin.H {
+	if !s.mongoBacked() {
+		return gin.H{"ok": true, "missing": []string{}}
+	}
+	missing := make([]string, 0)
+	for _, group := range s.indexGroups() {
+		cursor, err := group.col.Indexes().List(ctx)
+		if err != nil {
+			return gin.H{"ok": false, "missing": missing, "error": fmt.Sprintf("list indexes for %s: %v", group.col.Name(), err)}
+		}
+		var rows []bson.M
+		if err := cursor.All(ctx, &rows); err != nil {
+			return gin.H{"ok": false, "missing": missing, "error": fmt.Sprintf("list indexes for %s: %v", group.col.Name(), err)}
+		}
+		existing := map[string]bool{}
+		for _, row := range rows {
+			existing[asString(row["name"])] = true
+		}
+		for _, model := range group.models {
+			if name := indexName(model); !existing[name] {
+				missing = append(missing, group.col.Name()+"."+name)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return gin.H{"ok": len(missing) == 0, "missing": missing}
+}
+
+// indexName is the explicit name of model or the one Mongo generates from
+// its keys, e.g. "source_1_occurredAt_-1".
+func indexName(model mongo.IndexModel) string {
+	if model.Options != nil && model.Options.Name != nil {
+		return *model.Options.Name
+	}
+	keys, ok := model.Keys.(bson.D)
+	if !ok {
+		return fmt.Sprint(model.Keys)
+	}
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s_%v", key.Key, key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// pipelineState describes the work queued between accepting a request and
+// it being fully written: unflushed source registry tallies and retention
+// backfills. It is informational and does not affect readiness.
+func (s *service) pipelineState() gin.H {
+	state := gin.H{
+		"sampleBudgetFactor": s.sampler.stats()["budgetFactor"],
+	}
+	if s.registry != nil {
+		state["registryPending"] = s.registry.pendingCount()
+	}
+	if s.retention != nil {
+		state["retentionBackfillQueue"] = gin.H{"depth": len(s.retention.queue), "capacity": cap(s.retention.queue)}
+	}
+	if s.changes != nil {
+		state["changes"] = s.changes.status()
+	}
+	return state
+}
@@ -0,0 +1,59 @@
+package observer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReadyzReportsWriteFailures(t *testing.T) {
+	svc, handler := newBoltTestService(t)
+
+	code, body := doJSON(t, handler, http.MethodGet, "/readyz", nil)
+	if code != http.StatusOK || body["ok"] != true {
+		t.Fatalf("readyz = %d %v, want ready", code, body)
+	}
+
+	now := time.Now().UTC()
+	svc.writes.record(retentionKindEvents, nil, now)
+	for index := 0; index < writeHealthMaxFailures; index++ {
+		svc.writes.record(retentionKindEvents, fmt.Errorf("insert: %w", context.Canceled), now)
+	}
+	if code, body = doJSON(t, handler, http.MethodGet, "/readyz", nil); code != http.StatusOK {
+		t.Fatalf("readyz = %d %v, want cancelled writes ignored", code, body)
+	}
+	for index := 0; index < writeHealthMaxFailures; index++ {
+		svc.writes.record(retentionKindEvents, errors.New("disk full"), now)
+	}
+	code, body = doJSON(t, handler, http.MethodGet, "/readyz", nil)
+	if code != http.StatusServiceUnavailable || body["ok"] != false {
+		t.Fatalf("readyz = %d %v, want 503 after repeated write failures", code, body)
+	}
+	writes := toMap(toMap(body["checks"])["writes"])
+	if writes["failures"] != float64(writeHealthMaxFailures) || writes["lastError"] != "disk full" {
+		t.Errorf("writes = %v", writes)
+	}
+
+	svc.writes.record(retentionKindEvents, nil, now)
+	if code, body = doJSON(t, handler, http.MethodGet, "/readyz", nil); code != http.StatusOK {
+		t.Errorf("readyz = %d %v, want ready again after a successful write", code, body)
+	}
+}
+
+func TestReadyzFailsWhenMongoIsUnreachable(t *testing.T) {
+	_, handler := newTestService(t)
+
+	code, body := doJSON(t, handler, http.MethodGet, "/readyz", nil)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz = %d %v, want 503", code, body)
+	}
+	if storage := toMap(toMap(body["checks"])["storage"]); storage["ok"] != false || storage["error"] == nil {
+		t.Errorf("storage check = %v", storage)
+	}
+	if code, _ := doJSON(t, handler, http.MethodGet, "/healthz", nil); code != http.StatusOK {
+		t.Errorf("healthz = %d, want liveness to stay 200", code)
+	}
+}
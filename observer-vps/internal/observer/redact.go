@@ -0,0 +1,265 @@
+package observer
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	redactedValue = "[REDACTED]"
+	redactAll     = "*"
+	redactIPField = "ip"
+
+	ipModeKeep     = "keep"
+	ipModeTruncate = "truncate"
+	ipModeDrop     = "drop"
+)
+
+type redactPattern struct {
+	name        string
+	re          *regexp.Regexp
+	replacement string
+}
+
+// builtinRedactPatterns are enabled by name through OBSERVER_REDACT_PATTERNS.
+var builtinRedactPatterns = map[string]redactPattern{
+	"email": {
+		name:        "email",
+		re:          regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		replacement: "[email]",
+	},
+	"phone": {
+		name:        "phone",
+		re:          regexp.MustCompile(`(?:\+84|\b0)[35789]\d(?:[\s.-]?\d){7}\b|\+\d{1,3}(?:[\s.-]?\d){6,14}\b`),
+		replacement: "[phone]",
+	},
+	"bearer": {
+		name:        "bearer",
+		re:          regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`),
+		replacement: "Bearer " + redactedValue,
+	},
+	"jwt": {
+		name:        "jwt",
+		re:          regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+		replacement: "[jwt]",
+	},
+}
+
+// redactor scrubs PII and secrets out of ingested documents before they are
+// stored. Every rule can be skipped per source through the allowlist, which
+// holds query parameter names, payload keys, pattern names, "ip" or "*".
+type redactor struct {
+	enabled     bool
+	queryParams map[string]bool
+	stripQuery  bool
+	queryRe     *regexp.Regexp
+	ipMode      string
+	payloadKeys map[string]bool
+	patterns    []redactPattern
+	allowlist   map[string]map[string]bool
+}
+
+func newRedactor(cfg Config) (*redactor, error) {
+	r := &redactor{
+		enabled:     cfg.RedactEnabled,
+		queryParams: lowerSet(cfg.RedactQueryParams),
+		stripQuery:  strings.EqualFold(cfg.RedactQueryMode, "strip"),
+		ipMode:      strings.ToLower(cfg.RedactIPMode),
+		payloadKeys: lowerSet(cfg.RedactPayloadKeys),
+		allowlist:   map[string]map[string]bool{},
+	}
+	switch r.ipMode {
+	case ipModeKeep, ipModeTruncate, ipModeDrop:
+	default:
+		return nil, fmt.Errorf("invalid OBSERVER_REDACT_IP_MODE %q", cfg.RedactIPMode)
+	}
+
+	for _, name := range cfg.RedactPatterns {
+		pattern, ok := builtinRedactPatterns[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction pattern %q", name)
+		}
+		r.patterns = append(r.patterns, pattern)
+	}
+	for index, expr := range cfg.RedactExtraPatterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", expr, err)
+		}
+		r.patterns = append(r.patterns, redactPattern{
+			name:        fmt.Sprintf("custom%d", index+1),
+			re:          re,
+			replacement: redactedValue,
+		})
+	}
+
+	if len(r.queryParams) > 0 {
+		names := make([]string, 0, len(r.queryParams))
+		for name := range r.queryParams {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+		r.queryRe = regexp.MustCompile(`(?i)([?&](` + strings.Join(names, "|") + `)=)[^&#\s"']*`)
+	}
+
+	for source, names := range cfg.RedactAllowlist {
+		r.allowlist[source] = lowerSet(names)
+	}
+	return r, nil
+}
+
+func (r *redactor) allowed(source, name string) bool {
+	allow := r.allowlist[source]
+	return allow[redactAll] || allow[strings.ToLower(name)]
+}
+
+func (r *redactor) active(source string) bool {
+	return r != nil && r.enabled && !r.allowed(source, redactAll)
+}
+
+// url masks or strips sensitive query parameters in a URL or request path.
+func (r *redactor) url(source, raw string) string {
+	if !r.active(source) || raw == "" || len(r.queryParams) == 0 {
+		return raw
+	}
+	base, query, found := strings.Cut(raw, "?")
+	if !found {
+		return raw
+	}
+	query, fragment, hasFragment := strings.Cut(query, "#")
+
+	parts := strings.Split(query, "&")
+	kept := make([]string, 0, len(parts))
+	for _, part := range parts {
+		name, _, _ := strings.Cut(part, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		lowered := strings.ToLower(name)
+		if !r.queryParams[lowered] || r.allowed(source, lowered) {
+			kept = append(kept, part)
+			continue
+		}
+		if !r.stripQuery {
+			kept = append(kept, name+"="+redactedValue)
+		}
+	}
+
+	out := base
+	if len(kept) > 0 {
+		out += "?" + strings.Join(kept, "&")
+	}
+	if hasFragment {
+		out += "#" + fragment
+	}
+	return out
+}
+
+// ip truncates client addresses to their /24 (IPv4) or /48 (IPv6) network.
+// Comma separated forwarding chains are handled entry by entry.
+func (r *redactor) ip(source, raw string) string {
+	if !r.active(source) || raw == "" || r.allowed(source, redactIPField) {
+		return raw
+	}
+	switch r.ipMode {
+	case ipModeKeep:
+		return raw
+	case ipModeDrop:
+		return ""
+	}
+	entries := strings.Split(raw, ",")
+	for index, entry := range entries {
+		parsed := net.ParseIP(strings.TrimSpace(entry))
+		switch {
+		case parsed == nil:
+			entries[index] = redactedValue
+		case parsed.To4() != nil:
+			entries[index] = parsed.Mask(net.CIDRMask(24, 32)).String()
+		default:
+			entries[index] = parsed.Mask(net.CIDRMask(48, 128)).String()
+		}
+	}
+	return strings.Join(entries, ", ")
+}
+
+// payload returns a scrubbed deep copy of a payload map. Keys listed in
+// OBSERVER_REDACT_PAYLOAD_KEYS are replaced wholesale; every other string is
+// run through the enabled patterns and query parameter masking.
+func (r *redactor) payload(source string, value map[string]any) map[string]any {
+	if !r.active(source) || value == nil {
+		return value
+	}
+	return toMap(r.value(source, value))
+}
+
+func (r *redactor) value(source string, value any) any {
+	switch typed := value.(type) {
+	case string:
+		return r.text(source, typed)
+	case map[string]any:
+		out := make(map[string]any, len(typed))
+		for key, item := range typed {
+			lowered := strings.ToLower(key)
+			if r.payloadKeys[lowered] && !r.allowed(source, lowered) {
+				out[key] = redactedValue
+				continue
+			}
+			out[key] = r.value(source, item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(typed))
+		for index, item := range typed {
+			out[index] = r.value(source, item)
+		}
+		return out
+	case []string:
+		out := make([]string, len(typed))
+		for index, item := range typed {
+			out[index] = r.text(source, item)
+		}
+		return out
+	default:
+		if object := toMap(value); len(object) > 0 {
+			return r.value(source, object)
+		}
+		if items := toSlice(value); len(items) > 0 {
+			return r.value(source, items)
+		}
+		return value
+	}
+}
+
+func (r *redactor) text(source, value string) string {
+	if value == "" {
+		return value
+	}
+	for _, pattern := range r.patterns {
+		if r.allowed(source, pattern.name) {
+			continue
+		}
+		value = pattern.re.ReplaceAllString(value, pattern.replacement)
+	}
+	if r.queryRe != nil && strings.Contains(value, "=") {
+		value = r.queryRe.ReplaceAllStringFunc(value, func(match string) string {
+			name := strings.ToLower(strings.TrimLeft(strings.SplitN(match, "=", 2)[0], "?&"))
+			if r.allowed(source, name) {
+				return match
+			}
+			return match[:strings.Index(match, "=")+1] + redactedValue
+		})
+	}
+	return value
+}
+
+func lowerSet(values []string) map[string]bool {
+	out := make(map[string]bool, len(values))
+	for _, value := range values {
+		if trimmed := strings.ToLower(strings.TrimSpace(value)); trimmed != "" {
+			out[trimmed] = true
+		}
+	}
+	return out
+}
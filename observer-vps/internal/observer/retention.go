@@ -0,0 +1,541 @@
+package observer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	retentionKindEvents      = "events"
+	retentionKindRuntime     = "runtime"
+	retentionKindBackups     = "backups"
+	retentionKindLiveDevices = "live-devices"
+
+	retentionRefreshInterval = time.Minute
+	retentionMaxTTLDays      = 3650
+	retentionBackfillQueue   = 32
+	retentionBackfillHistory = 20
+)
+
+// retentionBaseFields is the timestamp each kind's expireAt is counted from,
+// matching what ingest passes to buildExpireAt.
+var retentionBaseFields = map[string]string{
+	retentionKindEvents:      "occurredAt",
+	retentionKindRuntime:     "capturedAt",
+	retentionKindBackups:     "capturedAt",
+	retentionKindLiveDevices: "lastSeenAt",
+}
+
+type retentionPolicy struct {
+	Kind      string    `bson:"kind"`
+	Source    string    `bson:"source"`
+	Category  string    `bson:"category"`
+	Type      string    `bson:"type"`
+	Level     string    `bson:"level"`
+	TTLDays   int       `bson:"ttlDays"`
+	Note      string    `bson:"note"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// specificity orders overlapping policies: source beats type beats category
+// beats level, so {source: X} wins over {level: error} for X's errors.
+func (p retentionPolicy) specificity() int {
+	score := 0
+	if p.Source != "" {
+		score += 8
+	}
+	if p.Type != "" {
+		score += 4
+	}
+	if p.Category != "" {
+		score += 2
+	}
+	if p.Level != "" {
+		score++
+	}
+	return score
+}
+
+func (p retentionPolicy) matches(doc bson.M) bool {
+	return (p.Source == "" || p.Source == asString(doc["source"])) &&
+		(p.Category == "" || p.Category == asString(doc["category"])) &&
+		(p.Type == "" || p.Type == asString(doc["type"])) &&
+		(p.Level == "" || p.Level == asString(doc["level"]))
+}
+
+// selector is the policy's match as a Mongo filter.
+func (p retentionPolicy) selector() bson.M {
+	filter := bson.M{}
+	if p.Source != "" {
+		filter["source"] = p.Source
+	}
+	if p.Category != "" {
+		filter["category"] = p.Category
+	}
+	if p.Type != "" {
+		filter["type"] = p.Type
+	}
+	if p.Level != "" {
+		filter["level"] = p.Level
+	}
+	return filter
+}
+
+func (p retentionPolicy) key() bson.M {
+	return bson.M{"kind": p.Kind, "source": p.Source, "category": p.Category, "type": p.Type, "level": p.Level}
+}
+
+func (p retentionPolicy) view() gin.H {
+	return gin.H{
+		"kind":      p.Kind,
+		"source":    p.Source,
+		"category":  p.Category,
+		"type":      p.Type,
+		"level":     p.Level,
+		"ttlDays":   p.TTLDays,
+		"note":      p.Note,
+		"updatedAt": p.UpdatedAt,
+	}
+}
+
+type retentionBackfill struct {
+	Kind       string     `json:"kind"`
+	Selector   bson.M     `json:"selector"`
+	Reason     string     `json:"reason"`
+	QueuedAt   time.Time  `json:"queuedAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Modified   int64      `json:"modified"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// retentionStore keeps the policies in memory for the ingest path, most
+// specific first, and recomputes expireAt on stored documents when a policy
+// changes.
+type retentionStore struct {
+	col         *mongo.Collection
+	collections map[string]*mongo.Collection
+	fallback    map[string]int
+
+	mu       sync.RWMutex
+	policies map[string][]retentionPolicy
+
+	queue     chan *retentionBackfill
+	historyMu sync.Mutex
+	history   []*retentionBackfill
+}
+
+// newRetentionStore with a nil db serves only the env TTLs; policies and
+// backfills need Mongo.
+func newRetentionStore(db *mongo.Database, cfg Config) *retentionStore {
+	r := &retentionStore{
+		collections: map[string]*mongo.Collection{},
+		fallback:    retentionFallback(cfg),
+		policies:    map[string][]retentionPolicy{},
+		queue:       make(chan *retentionBackfill, retentionBackfillQueue),
+	}
+	if db != nil {
+		r.col = db.Collection(retentionPolicyCollection)
+		r.collections = map[string]*mongo.Collection{
+			retentionKindEvents:      db.Collection(eventsCollection),
+			retentionKindRuntime:     db.Collection(runtimeCollection),
+			retentionKindBackups:     db.Collection(backupCollection),
+			retentionKindLiveDevices: db.Collection(liveDevicesCollection),
+		}
+	}
+	return r
+}
+
+func retentionFallback(cfg Config) map[string]int {
+	return map[string]int{
+		retentionKindEvents:      cfg.EventTTLDays,
+		retentionKindRuntime:     cfg.RuntimeTTLDays,
+		retentionKindBackups:     cfg.BackupTTLDays,
+		retentionKindLiveDevices: cfg.LiveDeviceTTLDays,
+	}
+}
+
+// setFallback swaps in the env TTLs from a reloaded config and returns the
+// kinds whose default changed, sorted, so the caller can backfill them.
+func (r *retentionStore) setFallback(cfg Config) []string {
+	next := retentionFallback(cfg)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := make([]string, 0)
+	for kind, days := range next {
+		if r.fallback[kind] != days {
+			changed = append(changed, kind)
+		}
+	}
+	sort.Strings(changed)
+	r.fallback = next
+	return changed
+}
+
+func (r *retentionStore) fallbackDays(kind string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.fallback[kind]
+}
+
+// expireAt returns base plus the TTL of the most specific matching policy,
+// or the kind's env TTL when none matches.
+func (r *retentionStore) expireAt(kind string, doc bson.M, base time.Time) time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, policy := range r.policies[kind] {
+		if policy.matches(doc) {
+			return buildExpireAt(policy.TTLDays, base)
+		}
+	}
+	return buildExpireAt(r.fallback[kind], base)
+}
+
+func (r *retentionStore) load(ctx context.Context) ([]retentionPolicy, error) {
+	cursor, err := r.col.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "kind", Value: 1}, {Key: "source", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var policies []retentionPolicy
+	if err := cursor.All(ctx, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// save upserts policy by kind and selector. The caller refreshes the cache
+// and queues the backfill.
+func (r *retentionStore) save(ctx context.Context, policy retentionPolicy) error {
+	_, err := r.col.UpdateOne(
+		ctx,
+		policy.key(),
+		bson.M{
+			"$set":         bson.M{"ttlDays": policy.TTLDays, "note": policy.Note, "updatedAt": policy.UpdatedAt},
+			"$setOnInsert": bson.M{"createdAt": policy.UpdatedAt},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// cached returns the in-memory policy with the same kind and selector.
+func (r *retentionStore) cached(policy retentionPolicy) (retentionPolicy, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, existing := range r.policies[policy.Kind] {
+		if existing.Source == policy.Source && existing.Category == policy.Category && existing.Type == policy.Type && existing.Level == policy.Level {
+			return existing, true
+		}
+	}
+	return retentionPolicy{}, false
+}
+
+func (r *retentionStore) refresh(ctx context.Context) error {
+	policies, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	r.setPolicies(policies)
+	return nil
+}
+
+// setPolicies replaces the cached policies, most specific first per kind.
+func (r *retentionStore) setPolicies(policies []retentionPolicy) {
+	byKind := map[string][]retentionPolicy{}
+	for _, policy := range policies {
+		byKind[policy.Kind] = append(byKind[policy.Kind], policy)
+	}
+	for _, list := range byKind {
+		sortRetentionPolicies(list)
+	}
+	r.mu.Lock()
+	r.policies = byKind
+	r.mu.Unlock()
+}
+
+func sortRetentionPolicies(list []retentionPolicy) {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].specificity() > list[j].specificity()
+	})
+}
+
+// run reloads policies periodically, so edits made directly in Mongo are
+// picked up, and works through queued backfills one at a time.
+func (r *retentionStore) run(ctx context.Context) {
+	ticker := time.NewTicker(retentionRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.refresh(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("observer retention refresh error: %v", err)
+			}
+		case job := <-r.queue:
+			r.backfill(ctx, job)
+		}
+	}
+}
+
+// enqueue returns a copy of the queued job for the response; the original is
+// updated by run and shows up in backfills.
+func (r *retentionStore) enqueue(kind string, selector bson.M, reason string) retentionBackfill {
+	job := &retentionBackfill{Kind: kind, Selector: selector, Reason: reason, QueuedAt: time.Now().UTC()}
+	r.historyMu.Lock()
+	r.history = append(r.history, job)
+	if len(r.history) > retentionBackfillHistory {
+		r.history = r.history[len(r.history)-retentionBackfillHistory:]
+	}
+	queued := *job
+	r.historyMu.Unlock()
+	select {
+	case r.queue <- job:
+	default:
+		r.finishBackfill(job, 0, errors.New("backfill queue is full"))
+		queued.Error = "backfill queue is full"
+	}
+	return queued
+}
+
+// backfill recomputes expireAt for the documents under selector in one
+// update, so every document gets exactly the TTL ingest would pick today.
+// Documents whose expireAt moves earlier are flagged archivePending, since
+// the archiver's watermarks may already be past their new expireAt.
+func (r *retentionStore) backfill(ctx context.Context, job *retentionBackfill) {
+	startedAt := time.Now().UTC()
+	r.historyMu.Lock()
+	job.StartedAt = &startedAt
+	r.historyMu.Unlock()
+
+	col := r.collections[job.Kind]
+	baseField := retentionBaseFields[job.Kind]
+	policies, err := r.load(ctx)
+	if err != nil {
+		r.finishBackfill(job, 0, err)
+		return
+	}
+	overlapping := make([]retentionPolicy, 0, len(policies))
+	for _, policy := range policies {
+		if policy.Kind == job.Kind && retentionSelectorsOverlap(policy.selector(), job.Selector) {
+			overlapping = append(overlapping, policy)
+		}
+	}
+
+	filter := bson.M{baseField: bson.M{"$type": "date"}}
+	for key, value := range job.Selector {
+		filter[key] = value
+	}
+	expireAt := retentionExpireExpr(baseField, r.fallbackDays(job.Kind), overlapping)
+	result, err := col.UpdateMany(ctx, filter, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"archivePending": retentionArchivePendingExpr(expireAt)}}},
+		{{Key: "$set", Value: bson.M{"expireAt": expireAt}}},
+	})
+	if err != nil {
+		r.finishBackfill(job, 0, fmt.Errorf("%s backfill: %w", job.Kind, err))
+		return
+	}
+	r.finishBackfill(job, result.ModifiedCount, nil)
+}
+
+// retentionArchivePendingExpr sets archivePending when expireAt shrinks and
+// keeps a flag the archiver has not cleared yet.
+func retentionArchivePendingExpr(expireAt any) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$or": bson.A{bson.M{"$lt": bson.A{expireAt, "$expireAt"}}, bson.M{"$eq": bson.A{"$archivePending", true}}}},
+		true,
+		"$$REMOVE",
+	}}
+}
+
+// retentionExpireExpr is the aggregation expression for expireAt: a $switch
+// over policies, most specific first, with the env TTL as the default. It
+// mirrors expireAt on the ingest path.
+func retentionExpireExpr(baseField string, fallbackDays int, policies []retentionPolicy) any {
+	ordered := append([]retentionPolicy(nil), policies...)
+	sortRetentionPolicies(ordered)
+	ttl := func(days int) bson.M {
+		return bson.M{"$add": bson.A{"$" + baseField, ttlDuration(days).Milliseconds()}}
+	}
+	if len(ordered) == 0 {
+		return ttl(fallbackDays)
+	}
+	branches := make(bson.A, 0, len(ordered))
+	for _, policy := range ordered {
+		conditions := bson.A{}
+		for _, field := range []string{"source", "category", "type", "level"} {
+			if value, ok := policy.selector()[field]; ok {
+				conditions = append(conditions, bson.M{"$eq": bson.A{"$" + field, value}})
+			}
+		}
+		branches = append(branches, bson.M{"case": bson.M{"$and": conditions}, "then": ttl(policy.TTLDays)})
+	}
+	return bson.M{"$switch": bson.M{"branches": branches, "default": ttl(fallbackDays)}}
+}
+
+func (r *retentionStore) finishBackfill(job *retentionBackfill, modified int64, err error) {
+	finishedAt := time.Now().UTC()
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+	job.FinishedAt = &finishedAt
+	job.Modified = modified
+	if err != nil {
+		job.Error = err.Error()
+		log.Printf("observer retention backfill error: %v", err)
+	}
+}
+
+func (r *retentionStore) backfills() []retentionBackfill {
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+	out := make([]retentionBackfill, 0, len(r.history))
+	for index := len(r.history) - 1; index >= 0; index-- {
+		out = append(out, *r.history[index])
+	}
+	return out
+}
+
+// retentionSelectorsOverlap is false only when both selectors pin the same
+// field to different values.
+func retentionSelectorsOverlap(a, b bson.M) bool {
+	for key, value := range a {
+		if other, ok := b[key]; ok && other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRetentionSelector reads and checks kind and the match fields.
+func parseRetentionSelector(body map[string]any) (retentionPolicy, error) {
+	policy := retentionPolicy{
+		Kind:     strings.ToLower(strings.TrimSpace(asString(body["kind"]))),
+		Source:   strings.TrimSpace(asString(body["source"])),
+		Category: strings.TrimSpace(asString(body["category"])),
+		Type:     strings.TrimSpace(asString(body["type"])),
+		Level:    strings.ToLower(strings.TrimSpace(asString(body["level"]))),
+		TTLDays:  parseInt(asString(body["ttlDays"]), 0),
+		Note:     strings.TrimSpace(asString(body["note"])),
+	}
+	if policy.Kind == "" {
+		policy.Kind = retentionKindEvents
+	}
+	if _, ok := retentionBaseFields[policy.Kind]; !ok {
+		return policy, errors.New("kind must be events, runtime, backups or live-devices")
+	}
+	if policy.Kind != retentionKindEvents && (policy.Category != "" || policy.Type != "" || policy.Level != "") {
+		return policy, errors.New("category, type and level only apply to events")
+	}
+	if policy.Level != "" && normalizeLevel(policy.Level, "") != policy.Level {
+		return policy, errors.New("level must be debug, info, warn or error")
+	}
+	return policy, nil
+}
+
+func parseRetentionPolicy(body map[string]any) (retentionPolicy, error) {
+	policy, err := parseRetentionSelector(body)
+	if err != nil {
+		return policy, err
+	}
+	if policy.TTLDays <= 0 || policy.TTLDays > retentionMaxTTLDays {
+		return policy, fmt.Errorf("ttlDays must be between 1 and %d", retentionMaxTTLDays)
+	}
+	return policy, nil
+}
+
+func (s *service) listRetentionPolicies(c *gin.Context) {
+	policies, err := s.retention.load(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load retention policies", "error": err.Error()})
+		return
+	}
+	items := make([]gin.H, 0, len(policies))
+	for _, policy := range policies {
+		items = append(items, policy.view())
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok":        true,
+		"items":     items,
+		"defaults":  retentionFallback(*s.settings()),
+		"backfills": s.retention.backfills(),
+	})
+}
+
+// upsertRetentionPolicy saves a policy keyed by kind and selector, reloads
+// the ingest cache and queues a backfill for the documents it covers.
+func (s *service) upsertRetentionPolicy(c *gin.Context) {
+	body, ok := bindJSONMap(c)
+	if !ok {
+		return
+	}
+	policy, err := parseRetentionPolicy(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": err.Error()})
+		return
+	}
+	policy.UpdatedAt = time.Now().UTC()
+	if err := s.retention.save(c.Request.Context(), policy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to save retention policy", "error": err.Error()})
+		return
+	}
+	if err := s.retention.refresh(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to reload retention policies", "error": err.Error()})
+		return
+	}
+	job := s.retention.enqueue(policy.Kind, policy.selector(), "policy updated")
+	c.JSON(http.StatusOK, gin.H{"ok": true, "policy": policy.view(), "backfill": job})
+}
+
+func (s *service) deleteRetentionPolicy(c *gin.Context) {
+	policy := retentionPolicy{
+		Kind:     strings.ToLower(strings.TrimSpace(c.DefaultQuery("kind", retentionKindEvents))),
+		Source:   strings.TrimSpace(c.Query("source")),
+		Category: strings.TrimSpace(c.Query("category")),
+		Type:     strings.TrimSpace(c.Query("type")),
+		Level:    strings.ToLower(strings.TrimSpace(c.Query("level"))),
+	}
+	result, err := s.retention.col.DeleteOne(c.Request.Context(), policy.key())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to delete retention policy", "error": err.Error()})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusOK, gin.H{"ok": true, "deleted": 0})
+		return
+	}
+	if err := s.retention.refresh(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to reload retention policies", "error": err.Error()})
+		return
+	}
+	job := s.retention.enqueue(policy.Kind, policy.selector(), "policy deleted")
+	c.JSON(http.StatusOK, gin.H{"ok": true, "deleted": result.DeletedCount, "backfill": job})
+}
+
+// backfillRetention recomputes expireAt for a whole kind, or the part of it
+// under the given source/category/type/level, without changing any policy.
+func (s *service) backfillRetention(c *gin.Context) {
+	body, ok := bindJSONMap(c)
+	if !ok {
+		return
+	}
+	policy, err := parseRetentionSelector(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": err.Error()})
+		return
+	}
+	job := s.retention.enqueue(policy.Kind, policy.selector(), "manual")
+	c.JSON(http.StatusAccepted, gin.H{"ok": true, "backfill": job})
+}
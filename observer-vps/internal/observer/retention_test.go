@@ -0,0 +1,157 @@
+package observer
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRetentionExpireAtPicksMostSpecificPolicy(t *testing.T) {
+	store := newRetentionStore(nil, Config{EventTTLDays: 7, RuntimeTTLDays: 14})
+	store.setPolicies([]retentionPolicy{
+		{Kind: retentionKindEvents, Level: "error", TTLDays: 30},
+		{Kind: retentionKindEvents, Source: "api", TTLDays: 14},
+		{Kind: retentionKindEvents, Source: "api", Type: "request", TTLDays: 3},
+		{Kind: retentionKindEvents, Category: "http", TTLDays: 5},
+	})
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		kind string
+		doc  bson.M
+		days int
+	}{
+		{"source and type beat source", retentionKindEvents, bson.M{"source": "api", "type": "request", "level": "error"}, 3},
+		{"source beats level", retentionKindEvents, bson.M{"source": "api", "type": "job", "level": "error"}, 14},
+		{"category beats level", retentionKindEvents, bson.M{"source": "web", "category": "http", "level": "error"}, 5},
+		{"level alone", retentionKindEvents, bson.M{"source": "web", "category": "ui", "level": "error"}, 30},
+		{"no match uses the default", retentionKindEvents, bson.M{"source": "web", "level": "info"}, 7},
+		{"other kinds use their own default", retentionKindRuntime, bson.M{"source": "api"}, 14},
+	}
+	for _, tc := range cases {
+		if got, want := store.expireAt(tc.kind, tc.doc, base), buildExpireAt(tc.days, base); !got.Equal(want) {
+			t.Errorf("%s: expireAt = %v, want %d days (%v)", tc.name, got, tc.days, want)
+		}
+	}
+}
+
+// evalRetentionExpr evaluates the subset of aggregation operators that
+// retentionExpireExpr emits against doc.
+func evalRetentionExpr(t *testing.T, expr any, doc bson.M) any {
+	t.Helper()
+	switch value := expr.(type) {
+	case string:
+		if value == "$$REMOVE" {
+			return nil
+		}
+		if len(value) > 0 && value[0] == '$' {
+			return doc[value[1:]]
+		}
+		return value
+	case bson.M:
+		for op, arg := range value {
+			switch op {
+			case "$switch":
+				spec := arg.(bson.M)
+				for _, branch := range spec["branches"].(bson.A) {
+					if evalRetentionExpr(t, branch.(bson.M)["case"], doc) == true {
+						return evalRetentionExpr(t, branch.(bson.M)["then"], doc)
+					}
+				}
+				return evalRetentionExpr(t, spec["default"], doc)
+			case "$cond":
+				args := arg.(bson.A)
+				if evalRetentionExpr(t, args[0], doc) == true {
+					return evalRetentionExpr(t, args[1], doc)
+				}
+				return evalRetentionExpr(t, args[2], doc)
+			case "$or":
+				for _, condition := range arg.(bson.A) {
+					if evalRetentionExpr(t, condition, doc) == true {
+						return true
+					}
+				}
+				return false
+			case "$lt":
+				args := arg.(bson.A)
+				left, _ := evalRetentionExpr(t, args[0], doc).(time.Time)
+				right, ok := evalRetentionExpr(t, args[1], doc).(time.Time)
+				return ok && left.Before(right)
+			case "$and":
+				for _, condition := range arg.(bson.A) {
+					if evalRetentionExpr(t, condition, doc) != true {
+						return false
+					}
+				}
+				return true
+			case "$eq":
+				args := arg.(bson.A)
+				return evalRetentionExpr(t, args[0], doc) == evalRetentionExpr(t, args[1], doc)
+			case "$add":
+				args := arg.(bson.A)
+				base := evalRetentionExpr(t, args[0], doc).(time.Time)
+				return base.Add(time.Duration(args[1].(int64)) * time.Millisecond)
+			}
+			t.Fatalf("unsupported operator %s", op)
+		}
+	}
+	return expr
+}
+
+func TestRetentionBackfillExprMatchesIngest(t *testing.T) {
+	policies := []retentionPolicy{
+		{Kind: retentionKindEvents, Level: "error", TTLDays: 30},
+		{Kind: retentionKindEvents, Source: "api", Type: "request", TTLDays: 3},
+		{Kind: retentionKindEvents, Category: "http", TTLDays: 5},
+		{Kind: retentionKindEvents, Source: "api", TTLDays: 14},
+	}
+	store := newRetentionStore(nil, Config{EventTTLDays: 7})
+	store.setPolicies(policies)
+	expr := retentionExpireExpr("occurredAt", 7, policies)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		doc  bson.M
+		days int
+	}{
+		{bson.M{"source": "api", "type": "request", "category": "http", "level": "error"}, 3},
+		{bson.M{"source": "api", "type": "job", "category": "http", "level": "error"}, 14},
+		{bson.M{"source": "web", "category": "http", "level": "error"}, 5},
+		{bson.M{"source": "web", "category": "ui", "level": "error"}, 30},
+		{bson.M{"source": "web", "level": "info"}, 7},
+	}
+	for _, tc := range cases {
+		tc.doc["occurredAt"] = base
+		got := evalRetentionExpr(t, expr, tc.doc)
+		if want := buildExpireAt(tc.days, base); got != want {
+			t.Errorf("%v: backfill expireAt = %v, want %d days (%v)", tc.doc, got, tc.days, want)
+		}
+		if ingest := store.expireAt(retentionKindEvents, tc.doc, base); got != ingest {
+			t.Errorf("%v: backfill expireAt = %v, ingest picks %v", tc.doc, got, ingest)
+		}
+	}
+
+	if got := evalRetentionExpr(t, retentionExpireExpr("occurredAt", 7, nil), bson.M{"occurredAt": base}); got != buildExpireAt(7, base) {
+		t.Errorf("no policies: expireAt = %v, want the env ttl", got)
+	}
+}
+
+func TestRetentionBackfillFlagsShortenedDocumentsForArchive(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	pending := retentionArchivePendingExpr(retentionExpireExpr("occurredAt", 7, nil))
+	cases := []struct {
+		name string
+		doc  bson.M
+		want any
+	}{
+		{"shortened", bson.M{"occurredAt": base, "expireAt": buildExpireAt(30, base)}, true},
+		{"extended", bson.M{"occurredAt": base, "expireAt": buildExpireAt(3, base)}, nil},
+		{"unchanged", bson.M{"occurredAt": base, "expireAt": buildExpireAt(7, base)}, nil},
+		{"extended but still pending", bson.M{"occurredAt": base, "expireAt": buildExpireAt(3, base), "archivePending": true}, true},
+	}
+	for _, tc := range cases {
+		if got := evalRetentionExpr(t, pending, tc.doc); got != tc.want {
+			t.Errorf("%s: archivePending = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,561 @@
+package observer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	runtimeSeriesMaxPoints    = 5000
+	runtimeSeriesMaxFields    = 12
+	runtimeDiffDefaultMinutes = 30
+	runtimeDiffMaxMinutes     = 24 * 60
+	runtimeDiffDefaultLimit   = 20
+	runtimeDiffMaxLimit       = 200
+)
+
+// runtimeFieldAliases are shorthands for the numbers the Node API reports in
+// its process and totals blocks. Anything else must be a dotted path under
+// one of runtimeSeriesRoots.
+var runtimeFieldAliases = map[string]string{
+	"rss":          "process.rssMb",
+	"heapUsed":     "process.heapUsedMb",
+	"heapTotal":    "process.heapTotalMb",
+	"external":     "process.externalMb",
+	"uptime":       "process.uptimeSeconds",
+	"eventLoopLag": "process.eventLoopLagMs",
+	"requests":     "totals.count",
+	"reqPerMin":    "totals.reqPerMin",
+	"avgMs":        "totals.avgMs",
+	"p95Ms":        "totals.p95Ms",
+	"errors4xx":    "totals.errors4xx",
+	"errors5xx":    "totals.errors5xx",
+}
+
+var runtimeSeriesRoots = []string{"process", "totals", "recordingExport", "payload"}
+
+var runtimeDefaultSeriesFields = []string{"process.rssMb", "process.heapUsedMb", "totals.p95Ms"}
+
+type runtimePoint struct {
+	at    time.Time
+	value float64
+}
+
+// resolveRuntimeFields expands aliases and rejects paths outside the stored
+// numeric blocks.
+func resolveRuntimeFields(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return runtimeDefaultSeriesFields, nil
+	}
+	fields := []string{}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		field := strings.TrimSpace(part)
+		if field == "" {
+			continue
+		}
+		if alias, ok := runtimeFieldAliases[field]; ok {
+			field = alias
+		}
+		root, rest, _ := strings.Cut(field, ".")
+		if rest == "" || !containsString(runtimeSeriesRoots, root) || strings.HasPrefix(rest, "$") {
+			return nil, fmt.Errorf("unsupported field %q", part)
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return runtimeDefaultSeriesFields, nil
+	}
+	if len(fields) > runtimeSeriesMaxFields {
+		return nil, fmt.Errorf("at most %d fields", runtimeSeriesMaxFields)
+	}
+	return fields, nil
+}
+
+// loadRuntimeSeries reads the chosen fields for one source, oldest first.
+// Snapshots that do not carry a field simply leave a gap in its series.
+func (s *service) loadRuntimeSeries(ctx context.Context, source string, fields []string, from, to time.Time) (map[string][]runtimePoint, bool, error) {
+	projection := bson.M{"capturedAt": 1}
+	for _, field := range fields {
+		projection[field] = 1
+	}
+	cursor, err := s.runtime.Find(
+		ctx,
+		bson.M{"source": source, "capturedAt": bson.M{"$gte": from, "$lte": to}},
+		options.Find().
+			SetSort(bson.D{{Key: "capturedAt", Value: 1}}).
+			SetProjection(projection).
+			SetLimit(runtimeSeriesMaxPoints),
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	defer cursor.Close(ctx)
+	var rows []bson.M
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, false, err
+	}
+	series := make(map[string][]runtimePoint, len(fields))
+	for _, row := range rows {
+		at := parseTime(row["capturedAt"])
+		for _, field := range fields {
+			value := lookupPath(row, field)
+			if normalizeNumber(value) == nil {
+				continue
+			}
+			series[field] = append(series[field], runtimePoint{at: at, value: asFloat(value)})
+		}
+	}
+	return series, len(rows) == runtimeSeriesMaxPoints, nil
+}
+
+// bucketRuntimePoints averages points into fixed buckets so long ranges stay
+// plottable.
+func bucketRuntimePoints(points []runtimePoint, bucket time.Duration) []runtimePoint {
+	if bucket <= 0 || len(points) == 0 {
+		return points
+	}
+	out := []runtimePoint{}
+	var current time.Time
+	var sum float64
+	var count int
+	for _, point := range points {
+		start := point.at.Truncate(bucket)
+		if count > 0 && !start.Equal(current) {
+			out = append(out, runtimePoint{at: current, value: sum / float64(count)})
+			sum, count = 0, 0
+		}
+		current = start
+		sum += point.value
+		count++
+	}
+	return append(out, runtimePoint{at: current, value: sum / float64(count)})
+}
+
+// linearSlopePerHour fits a least-squares line through the points and returns
+// its slope in units per hour.
+func linearSlopePerHour(points []runtimePoint) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+	origin := points[0].at
+	var sumX, sumY, sumXY, sumXX float64
+	for _, point := range points {
+		x := point.at.Sub(origin).Hours()
+		sumX += x
+		sumY += point.value
+		sumXY += x * point.value
+		sumXX += x * x
+	}
+	n := float64(len(points))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+func runtimeSeriesItem(field string, points []runtimePoint) gin.H {
+	values := make([]gin.H, 0, len(points))
+	if len(points) == 0 {
+		return gin.H{"field": field, "points": values}
+	}
+	minValue, maxValue := points[0].value, points[0].value
+	for _, point := range points {
+		values = append(values, gin.H{"t": point.at, "v": roundMetric(point.value)})
+		minValue = math.Min(minValue, point.value)
+		maxValue = math.Max(maxValue, point.value)
+	}
+	first, last := points[0].value, points[len(points)-1].value
+	return gin.H{
+		"field":        field,
+		"points":       values,
+		"first":        roundMetric(first),
+		"last":         roundMetric(last),
+		"min":          roundMetric(minValue),
+		"max":          roundMetric(maxValue),
+		"delta":        roundMetric(last - first),
+		"slopePerHour": roundMetric(linearSlopePerHour(points)),
+	}
+}
+
+func roundMetric(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// getRuntimeSeries returns one time series per requested field for a source.
+func (s *service) getRuntimeSeries(c *gin.Context) {
+	source := strings.TrimSpace(c.Query("source"))
+	if source == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "source is required"})
+		return
+	}
+	fields, err := resolveRuntimeFields(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid fields", "error": err.Error()})
+		return
+	}
+	now := time.Now().UTC()
+	from, to := now.Add(-24*time.Hour), now
+	if raw := strings.TrimSpace(c.Query("from")); raw != "" {
+		if from, err = parseTimeParam(raw, now); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid from", "error": err.Error()})
+			return
+		}
+	}
+	if raw := strings.TrimSpace(c.Query("to")); raw != "" {
+		if to, err = parseTimeParam(raw, now); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid to", "error": err.Error()})
+			return
+		}
+	}
+	bucket := time.Duration(clampInt(parseInt(c.Query("bucketMinutes"), 0), 0, 24*60)) * time.Minute
+
+	series, truncated, err := s.loadRuntimeSeries(c.Request.Context(), source, fields, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load runtime series", "error": err.Error()})
+		return
+	}
+	items := make([]gin.H, 0, len(fields))
+	for _, field := range fields {
+		items = append(items, runtimeSeriesItem(field, bucketRuntimePoints(series[field], bucket)))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok":            true,
+		"source":        source,
+		"from":          from,
+		"to":            to,
+		"bucketMinutes": int(bucket / time.Minute),
+		"truncated":     truncated,
+		"items":         items,
+	})
+}
+
+// runtimeEndpointStats is one endpoint's averages over a snapshot or window.
+// Latencies are weighted by request count so quiet snapshots do not dominate.
+type runtimeEndpointStats struct {
+	method    string
+	path      string
+	snapshots int
+	count     float64
+	reqPerMin float64
+	latencyN  float64
+	avgMsSum  float64
+	p95MsSum  float64
+	errors4xx float64
+	errors5xx float64
+}
+
+func (st *runtimeEndpointStats) add(row map[string]any) {
+	count := asFloat(row["count"])
+	st.snapshots++
+	st.count += count
+	st.reqPerMin += asFloat(row["reqPerMin"])
+	st.errors4xx += asFloat(row["errors4xx"])
+	st.errors5xx += asFloat(row["errors5xx"])
+	weight := math.Max(count, 1)
+	st.latencyN += weight
+	st.avgMsSum += asFloat(row["avgMs"]) * weight
+	st.p95MsSum += asFloat(row["p95Ms"]) * weight
+}
+
+func (st *runtimeEndpointStats) view() gin.H {
+	if st == nil || st.snapshots == 0 {
+		return nil
+	}
+	n := float64(st.snapshots)
+	return gin.H{
+		"snapshots": st.snapshots,
+		"count":     roundMetric(st.count / n),
+		"reqPerMin": roundMetric(st.reqPerMin / n),
+		"avgMs":     roundMetric(st.avgMsSum / st.latencyN),
+		"p95Ms":     roundMetric(st.p95MsSum / st.latencyN),
+		"errors4xx": roundMetric(st.errors4xx / n),
+		"errors5xx": roundMetric(st.errors5xx / n),
+	}
+}
+
+// runtimeWindow averages the process, totals and per-endpoint numbers over a
+// set of snapshots.
+type runtimeWindow struct {
+	snapshots int
+	from      time.Time
+	to        time.Time
+	process   map[string]float64
+	totals    runtimeEndpointStats
+	endpoints map[string]*runtimeEndpointStats
+}
+
+func newRuntimeWindow(rows []bson.M) *runtimeWindow {
+	window := &runtimeWindow{process: map[string]float64{}, endpoints: map[string]*runtimeEndpointStats{}}
+	processSums := map[string]float64{}
+	processCounts := map[string]float64{}
+	for _, row := range rows {
+		capturedAt := parseTime(row["capturedAt"])
+		if window.snapshots == 0 || capturedAt.Before(window.from) {
+			window.from = capturedAt
+		}
+		if capturedAt.After(window.to) {
+			window.to = capturedAt
+		}
+		window.snapshots++
+		for key, value := range toMap(row["process"]) {
+			if key == "pid" || normalizeNumber(value) == nil {
+				continue
+			}
+			processSums[key] += asFloat(value)
+			processCounts[key]++
+		}
+		if totals := toMap(row["totals"]); len(totals) > 0 {
+			window.totals.add(totals)
+		}
+		for _, rawEndpoint := range toSlice(row["endpoints"]) {
+			endpoint := toMap(rawEndpoint)
+			key := asString(endpoint["key"])
+			if key == "" {
+				key = strings.TrimSpace(asString(endpoint["method"]) + " " + asString(endpoint["path"]))
+			}
+			if key == "" {
+				continue
+			}
+			stats := window.endpoints[key]
+			if stats == nil {
+				stats = &runtimeEndpointStats{method: asString(endpoint["method"]), path: asString(endpoint["path"])}
+				window.endpoints[key] = stats
+			}
+			stats.add(endpoint)
+		}
+	}
+	for key, sum := range processSums {
+		window.process[key] = sum / processCounts[key]
+	}
+	return window
+}
+
+func (w *runtimeWindow) view() gin.H {
+	if w.snapshots == 0 {
+		return gin.H{"snapshots": 0}
+	}
+	process := gin.H{}
+	for key, value := range w.process {
+		process[key] = roundMetric(value)
+	}
+	return gin.H{
+		"snapshots": w.snapshots,
+		"from":      w.from,
+		"to":        w.to,
+		"process":   process,
+		"totals":    w.totals.view(),
+	}
+}
+
+// diffRuntimeWindows pairs endpoints across the two windows and ranks them by
+// how much they moved, using the sort key the caller chose.
+func diffRuntimeWindows(before, after *runtimeWindow, sortBy string, limit int) []gin.H {
+	keys := map[string]bool{}
+	for key := range before.endpoints {
+		keys[key] = true
+	}
+	for key := range after.endpoints {
+		keys[key] = true
+	}
+
+	type ranked struct {
+		item  gin.H
+		score float64
+	}
+	rows := make([]ranked, 0, len(keys))
+	for key := range keys {
+		b, a := before.endpoints[key], after.endpoints[key]
+		ref := a
+		if ref == nil {
+			ref = b
+		}
+		item := gin.H{
+			"key":    key,
+			"method": ref.method,
+			"path":   ref.path,
+			"before": b.view(),
+			"after":  a.view(),
+		}
+		switch {
+		case b == nil:
+			item["change"] = "new"
+		case a == nil:
+			item["change"] = "gone"
+		default:
+			item["change"] = "changed"
+		}
+		// A missing side counts as zero, so new and gone endpoints rank by
+		// their own traffic or latency alongside the ones that moved.
+		bv, av := b.view(), a.view()
+		deltas := gin.H{}
+		for _, metric := range []string{"count", "reqPerMin", "avgMs", "p95Ms", "errors4xx", "errors5xx"} {
+			delta := asFloat(av[metric]) - asFloat(bv[metric])
+			deltas[metric] = roundMetric(delta)
+			if base := asFloat(bv[metric]); base != 0 && a != nil {
+				deltas[metric+"Pct"] = roundMetric(delta / base * 100)
+			}
+		}
+		item["delta"] = deltas
+		var score float64
+		switch sortBy {
+		case "count":
+			score = math.Abs(asFloat(deltas["count"]))
+		case "errors":
+			score = math.Abs(asFloat(deltas["errors5xx"])) + math.Abs(asFloat(deltas["errors4xx"]))/10
+		default:
+			score = math.Abs(asFloat(deltas["p95Ms"]))
+		}
+		rows = append(rows, ranked{item: item, score: score})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].score != rows[j].score {
+			return rows[i].score > rows[j].score
+		}
+		return asString(rows[i].item["key"]) < asString(rows[j].item["key"])
+	})
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	items := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, row.item)
+	}
+	return items
+}
+
+func processDelta(before, after *runtimeWindow) gin.H {
+	deltas := gin.H{}
+	for key, afterValue := range after.process {
+		if beforeValue, ok := before.process[key]; ok {
+			deltas[key] = roundMetric(afterValue - beforeValue)
+		}
+	}
+	return deltas
+}
+
+// getRuntimeDiff compares two snapshots (a and b ids) or, given source and
+// at, the windowMinutes before and after that moment, e.g. a deploy.
+func (s *service) getRuntimeDiff(c *gin.Context) {
+	sortBy := strings.ToLower(strings.TrimSpace(c.DefaultQuery("sort", "latency")))
+	if sortBy != "latency" && sortBy != "count" && sortBy != "errors" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "sort must be latency, count or errors"})
+		return
+	}
+	limit := clampInt(parseInt(c.Query("limit"), runtimeDiffDefaultLimit), 1, runtimeDiffMaxLimit)
+	ctx := c.Request.Context()
+
+	var before, after *runtimeWindow
+	response := gin.H{"ok": true, "sort": sortBy}
+	if rawA, rawB := strings.TrimSpace(c.Query("a")), strings.TrimSpace(c.Query("b")); rawA != "" || rawB != "" {
+		rowA, err := s.loadRuntimeSnapshot(ctx, rawA)
+		if err != nil {
+			writeRuntimeSnapshotError(c, "a", err)
+			return
+		}
+		rowB, err := s.loadRuntimeSnapshot(ctx, rawB)
+		if err != nil {
+			writeRuntimeSnapshotError(c, "b", err)
+			return
+		}
+		before, after = newRuntimeWindow([]bson.M{rowA}), newRuntimeWindow([]bson.M{rowB})
+		response["mode"] = "snapshots"
+		response["a"] = gin.H{"id": formatID(rowA["_id"]), "source": asString(rowA["source"]), "capturedAt": rowA["capturedAt"]}
+		response["b"] = gin.H{"id": formatID(rowB["_id"]), "source": asString(rowB["source"]), "capturedAt": rowB["capturedAt"]}
+	} else {
+		source := strings.TrimSpace(c.Query("source"))
+		rawAt := strings.TrimSpace(c.Query("at"))
+		if source == "" || rawAt == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "a and b, or source and at, are required"})
+			return
+		}
+		at, err := parseTimeParam(rawAt, time.Now().UTC())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid at", "error": err.Error()})
+			return
+		}
+		window := time.Duration(clampInt(parseInt(c.Query("windowMinutes"), runtimeDiffDefaultMinutes), 1, runtimeDiffMaxMinutes)) * time.Minute
+		beforeRows, err := s.loadRuntimeWindow(ctx, source, bson.M{"$gte": at.Add(-window), "$lt": at})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load runtime snapshots", "error": err.Error()})
+			return
+		}
+		afterRows, err := s.loadRuntimeWindow(ctx, source, bson.M{"$gte": at, "$lte": at.Add(window)})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load runtime snapshots", "error": err.Error()})
+			return
+		}
+		before, after = newRuntimeWindow(beforeRows), newRuntimeWindow(afterRows)
+		response["mode"] = "windows"
+		response["source"] = source
+		response["at"] = at
+		response["windowMinutes"] = int(window / time.Minute)
+	}
+
+	response["before"] = before.view()
+	response["after"] = after.view()
+	response["processDelta"] = processDelta(before, after)
+	response["items"] = diffRuntimeWindows(before, after, sortBy, limit)
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *service) loadRuntimeSnapshot(ctx context.Context, rawID string) (bson.M, error) {
+	id, err := primitive.ObjectIDFromHex(rawID)
+	if err != nil {
+		return nil, errRuntimeSnapshotID
+	}
+	var row bson.M
+	if err := s.runtime.FindOne(ctx, bson.M{"_id": id}).Decode(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+func (s *service) loadRuntimeWindow(ctx context.Context, source string, capturedAt bson.M) ([]bson.M, error) {
+	cursor, err := s.runtime.Find(
+		ctx,
+		bson.M{"source": source, "capturedAt": capturedAt},
+		options.Find().
+			SetSort(bson.D{{Key: "capturedAt", Value: 1}}).
+			SetProjection(bson.M{"capturedAt": 1, "process": 1, "totals": 1, "endpoints": 1}).
+			SetLimit(runtimeSeriesMaxPoints),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []bson.M
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+var errRuntimeSnapshotID = errors.New("invalid runtime snapshot id")
+
+func writeRuntimeSnapshotError(c *gin.Context, param string, err error) {
+	switch {
+	case errors.Is(err, errRuntimeSnapshotID):
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid snapshot id in " + param})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "message": "Runtime snapshot " + param + " not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load runtime snapshot", "error": err.Error()})
+	}
+}
@@ -0,0 +1,224 @@
+package observer
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	sampleWildcard = "*"
+	sampleMinRate  = 0.01
+)
+
+// sampleWeightExpr counts a stored event as the number of events it stands
+// for; documents from before sampling have no weight and count once.
+var sampleWeightExpr = bson.M{"$ifNull": bson.A{"$sampleWeight", 1}}
+
+// sampleRule sets the keep rate for debug and info events from one
+// source/category/type combination; "*" matches anything.
+type sampleRule struct {
+	source    string
+	category  string
+	eventType string
+	rate      float64
+}
+
+func (r sampleRule) matches(doc bson.M) bool {
+	return (r.source == sampleWildcard || r.source == asString(doc["source"])) &&
+		(r.category == sampleWildcard || r.category == asString(doc["category"])) &&
+		(r.eventType == sampleWildcard || r.eventType == asString(doc["type"]))
+}
+
+func (r sampleRule) specificity() int {
+	score := 0
+	for _, part := range []string{r.source, r.category, r.eventType} {
+		if part != sampleWildcard {
+			score++
+		}
+	}
+	return score
+}
+
+func (r sampleRule) String() string {
+	return fmt.Sprintf("%s/%s/%s=%g", r.source, r.category, r.eventType, r.rate)
+}
+
+// sampler thins debug and info events before they are stored. The static
+// rate comes from the most specific rule; when a budget is set and the
+// events that would be kept exceed it per minute, every rate is scaled down
+// by the same factor until the stream fits again. Kept documents carry
+// sampleWeight = 1/rate so readers can scale counts back up.
+type sampler struct {
+	rules  []sampleRule
+	budget float64
+	random func() float64
+
+	mu            sync.Mutex
+	minute        time.Time
+	currentCount  float64
+	previousCount float64
+	kept          map[string]int64
+	dropped       map[string]int64
+	lastFactor    float64
+}
+
+func newSampler(cfg Config) (*sampler, error) {
+	s := &sampler{
+		budget:     float64(cfg.SampleBudgetPerMinute),
+		random:     rand.Float64,
+		kept:       map[string]int64{},
+		dropped:    map[string]int64{},
+		lastFactor: 1,
+	}
+	for _, raw := range cfg.SampleRules {
+		rule, err := parseSampleRule(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OBSERVER_SAMPLE_RULES entry %q: %w", raw, err)
+		}
+		s.rules = append(s.rules, rule)
+	}
+	sort.SliceStable(s.rules, func(i, j int) bool { return s.rules[i].specificity() > s.rules[j].specificity() })
+	return s, nil
+}
+
+// reconfigure takes the rules and budget of a sampler built from a reloaded
+// config, keeping the counters and the current minute's window.
+func (s *sampler) reconfigure(next *sampler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = next.rules
+	s.budget = next.budget
+}
+
+// parseSampleRule reads "source/category/type=rate". Missing trailing parts
+// default to "*", so "pickletour-api-main=0.5" covers the whole source.
+func parseSampleRule(raw string) (sampleRule, error) {
+	selector, rawRate, found := strings.Cut(raw, "=")
+	if !found {
+		return sampleRule{}, fmt.Errorf("expected selector=rate")
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSpace(rawRate), 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return sampleRule{}, fmt.Errorf("rate must be between 0 and 1")
+	}
+	parts := strings.Split(strings.TrimSpace(selector), "/")
+	if len(parts) > 3 {
+		return sampleRule{}, fmt.Errorf("selector has more than source/category/type")
+	}
+	for len(parts) < 3 {
+		parts = append(parts, sampleWildcard)
+	}
+	for index, part := range parts {
+		parts[index] = defaultString(strings.TrimSpace(part), sampleWildcard)
+	}
+	return sampleRule{source: parts[0], category: parts[1], eventType: parts[2], rate: rate}, nil
+}
+
+// sampleExempt events are always stored: warnings, errors, 5xx responses and
+// anything carrying a client fingerprint, so issue tracking never loses data.
+func sampleExempt(doc bson.M) bool {
+	return asString(doc["level"]) == "warn" || isErrorEvent(doc) || asString(doc["fingerprint"]) != ""
+}
+
+func (s *sampler) staticRate(doc bson.M) float64 {
+	for _, rule := range s.rules {
+		if rule.matches(doc) {
+			return rule.rate
+		}
+	}
+	return 1
+}
+
+// filter returns the documents to store and stamps each with sampleWeight.
+func (s *sampler) filter(docs []any, now time.Time) []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	factor := s.budgetFactor(now)
+	kept := make([]any, 0, len(docs))
+	for _, item := range docs {
+		doc, ok := item.(bson.M)
+		if !ok {
+			kept = append(kept, item)
+			continue
+		}
+		source := asString(doc["source"])
+		if sampleExempt(doc) {
+			doc["sampleWeight"] = 1.0
+			s.kept[source]++
+			kept = append(kept, doc)
+			continue
+		}
+		rate := s.staticRate(doc)
+		s.currentCount += rate
+		if rate *= factor; rate > 0 && rate < sampleMinRate {
+			rate = sampleMinRate
+		}
+		if rate <= 0 || (rate < 1 && s.random() >= rate) {
+			s.dropped[source]++
+			continue
+		}
+		doc["sampleWeight"] = 1 / rate
+		s.kept[source]++
+		kept = append(kept, doc)
+	}
+	return kept
+}
+
+// budgetFactor estimates the last minute's would-be-stored volume from the
+// current and previous minute buckets and scales it down to the budget.
+// Callers hold s.mu.
+func (s *sampler) budgetFactor(now time.Time) float64 {
+	minute := now.Truncate(time.Minute)
+	switch {
+	case minute.Equal(s.minute):
+	case minute.Sub(s.minute) == time.Minute:
+		s.previousCount, s.currentCount = s.currentCount, 0
+	default:
+		s.previousCount, s.currentCount = 0, 0
+	}
+	s.minute = minute
+	if s.budget <= 0 {
+		s.lastFactor = 1
+		return 1
+	}
+	elapsed := float64(now.Sub(minute)) / float64(time.Minute)
+	estimate := s.previousCount*(1-elapsed) + s.currentCount
+	s.lastFactor = 1
+	if estimate > s.budget {
+		s.lastFactor = s.budget / estimate
+	}
+	return s.lastFactor
+}
+
+func (s *sampler) stats() gin.H {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rules := make([]string, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, rule.String())
+	}
+	kept := gin.H{}
+	for source, count := range s.kept {
+		kept[source] = count
+	}
+	dropped := gin.H{}
+	for source, count := range s.dropped {
+		dropped[source] = count
+	}
+	return gin.H{
+		"rules":           rules,
+		"budgetPerMinute": s.budget,
+		"budgetFactor":    s.lastFactor,
+		"kept":            kept,
+		"dropped":         dropped,
+	}
+}
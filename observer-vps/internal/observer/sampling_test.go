@@ -0,0 +1,73 @@
+package observer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSamplerFilterExemptionsAndWeights(t *testing.T) {
+	s, err := newSampler(Config{SampleRules: []string{"api=0", "api/http/*=0.5"}})
+	if err != nil {
+		t.Fatalf("new sampler: %v", err)
+	}
+	cases := []struct {
+		name   string
+		doc    bson.M
+		random float64
+		weight float64 // 0 means dropped
+	}{
+		{"warn is exempt", bson.M{"source": "api", "category": "job", "level": "warn"}, 0.9, 1},
+		{"error is exempt", bson.M{"source": "api", "category": "job", "level": "error"}, 0.9, 1},
+		{"5xx is exempt", bson.M{"source": "api", "category": "job", "level": "info", "statusCode": 503}, 0.9, 1},
+		{"fingerprint is exempt", bson.M{"source": "api", "category": "job", "level": "info", "fingerprint": "checkout-timeout"}, 0.9, 1},
+		{"specific rule keeps", bson.M{"source": "api", "category": "http", "level": "info"}, 0.3, 2},
+		{"specific rule drops", bson.M{"source": "api", "category": "http", "level": "debug"}, 0.7, 0},
+		{"zero rate drops", bson.M{"source": "api", "category": "job", "level": "info"}, 0, 0},
+		{"no rule keeps", bson.M{"source": "web", "category": "http", "level": "debug"}, 0.9, 1},
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range cases {
+		random := tc.random
+		s.random = func() float64 { return random }
+		kept := s.filter([]any{tc.doc}, now)
+		switch {
+		case tc.weight == 0 && len(kept) != 0:
+			t.Errorf("%s: kept %v, want dropped", tc.name, kept)
+		case tc.weight != 0 && (len(kept) != 1 || tc.doc["sampleWeight"] != tc.weight):
+			t.Errorf("%s: kept %v, want sampleWeight %v", tc.name, kept, tc.weight)
+		}
+	}
+}
+
+func TestSamplerBudgetFactor(t *testing.T) {
+	s, err := newSampler(Config{SampleBudgetPerMinute: 10})
+	if err != nil {
+		t.Fatalf("new sampler: %v", err)
+	}
+	s.random = func() float64 { return 0.6 }
+	minute := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	burst := make([]any, 0, 20)
+	for index := 0; index < 20; index++ {
+		burst = append(burst, bson.M{"source": "web", "level": "info"})
+	}
+	if kept := s.filter(burst, minute); len(kept) != 20 {
+		t.Fatalf("first burst kept %d, want all 20 while under budget", len(kept))
+	}
+	if kept := s.filter([]any{bson.M{"source": "web", "level": "info"}}, minute.Add(10*time.Second)); len(kept) != 0 {
+		t.Errorf("kept %v, want the halved rate to drop it", kept)
+	}
+	// Dropped events still count toward the would-be-stored volume.
+	if factor := s.budgetFactor(minute.Add(10 * time.Second)); factor != 10.0/21 {
+		t.Errorf("factor = %v, want 10/21", factor)
+	}
+	// Half way through the next minute the previous minute still counts half.
+	if factor := s.budgetFactor(minute.Add(90 * time.Second)); math.Abs(factor-10/10.5) > 1e-9 {
+		t.Errorf("factor = %v, want 10/10.5", factor)
+	}
+	if factor := s.budgetFactor(minute.Add(5 * time.Minute)); factor != 1 {
+		t.Errorf("factor = %v, want 1 after a quiet gap", factor)
+	}
+}
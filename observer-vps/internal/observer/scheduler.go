@@ -0,0 +1,247 @@
+package observer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	mongox "observer-vps/internal/infra/mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	schedulerLeaseName = "observer-jobs"
+
+	schedulerRoleStandalone = "standalone"
+	schedulerRoleLeader     = "leader"
+	schedulerRoleFollower   = "follower"
+)
+
+// errLeaseLost is returned by checkLease once the term a job started
+// under has ended.
+var errLeaseLost = errors.New("scheduler lease lost")
+
+// jobLease is the part of mongox.Lease the scheduler uses.
+type jobLease interface {
+	Acquire(ctx context.Context) (mongox.LeaseState, error)
+	Release(ctx context.Context) error
+	StillHeld(ctx context.Context, token int64) (bool, error)
+}
+
+type leaseTermKey struct{}
+
+// leaseTerm is the lease and fencing token a leader's jobs run under; lead
+// puts it in their context.
+type leaseTerm struct {
+	lease jobLease
+	token int64
+}
+
+// checkLease reports errLeaseLost when ctx belongs to a term of leadership
+// that has ended. Jobs call it right before committing a result, so a
+// replica that lost the lease mid-run does not overwrite what its successor
+// wrote. Contexts without a term (standalone mode, request handlers) pass.
+func checkLease(ctx context.Context) error {
+	term, ok := ctx.Value(leaseTermKey{}).(leaseTerm)
+	if !ok {
+		return nil
+	}
+	held, err := term.lease.StillHeld(ctx, term.token)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return errLeaseLost
+	}
+	return nil
+}
+
+type scheduledJob struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+// jobScheduler runs the registered background jobs on exactly one replica.
+// Every replica competes for one lease and renews it three times per TTL;
+// the holder runs the jobs under a context that is cancelled the moment it
+// loses or cannot renew the lease, and a follower starts them when it takes
+// over. Without a lease (the bolt store is single-process) the jobs simply
+// run.
+type jobScheduler struct {
+	lease      jobLease
+	instanceID string
+	ttl        time.Duration
+	jobs       []scheduledJob
+
+	mu          sync.Mutex
+	role        string
+	leader      string
+	token       int64
+	leaderSince time.Time
+	expiresAt   time.Time
+	lastError   string
+}
+
+func newJobScheduler(lease jobLease, instanceID string, ttl time.Duration) *jobScheduler {
+	role := schedulerRoleFollower
+	if lease == nil {
+		role = schedulerRoleStandalone
+	}
+	return &jobScheduler{lease: lease, instanceID: instanceID, ttl: ttl, role: role}
+}
+
+// register adds a job; call it before run. Each job is a loop that returns
+// when its context is done.
+func (j *jobScheduler) register(name string, run func(ctx context.Context)) {
+	j.jobs = append(j.jobs, scheduledJob{name: name, run: run})
+}
+
+func (j *jobScheduler) run(ctx context.Context) {
+	if j.lease == nil {
+		j.mu.Lock()
+		j.leader = j.instanceID
+		j.leaderSince = time.Now().UTC()
+		j.mu.Unlock()
+		j.start(ctx).Wait()
+		return
+	}
+
+	var current *leaderRun
+	stepDown := func(reason string) {
+		if current == nil {
+			return
+		}
+		log.Printf("observer scheduler: %s is no longer leader (%s), stopping jobs", j.instanceID, reason)
+		current.stop()
+		current = nil
+	}
+	defer func() {
+		stepDown("shutting down")
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := j.lease.Release(releaseCtx); err != nil {
+			log.Printf("observer scheduler release error: %v", err)
+		}
+	}()
+
+	ticker := time.NewTicker(j.ttl / 3)
+	defer ticker.Stop()
+	for {
+		leading := j.tick(ctx)
+		if !leading {
+			stepDown("lease lost")
+		} else if current != nil && current.token != j.fencingToken() {
+			// The lease lapsed and was taken again, possibly after another
+			// replica held it; the jobs' term is over even though we lead.
+			stepDown("lease term changed")
+		}
+		if leading && current == nil {
+			log.Printf("observer scheduler: %s became leader", j.instanceID)
+			current = j.lead(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// leaderRun is one term of leadership: its fencing token, the jobs started
+// under it and the means to stop them.
+type leaderRun struct {
+	token   int64
+	cancel  context.CancelFunc
+	running *sync.WaitGroup
+}
+
+func (j *jobScheduler) lead(ctx context.Context) *leaderRun {
+	term := leaseTerm{lease: j.lease, token: j.fencingToken()}
+	leaderCtx, cancel := context.WithCancel(context.WithValue(ctx, leaseTermKey{}, term))
+	return &leaderRun{token: term.token, cancel: cancel, running: j.start(leaderCtx)}
+}
+
+func (j *jobScheduler) fencingToken() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.token
+}
+
+// stop cancels the jobs and waits for them to return.
+func (r *leaderRun) stop() {
+	r.cancel()
+	r.running.Wait()
+}
+
+// tick renews or tries to take the lease and reports whether this replica
+// should be running the jobs. A failed renewal keeps the jobs running only
+// while the last successful one has more than one renewal interval left, so
+// they stop before anyone else can take over.
+func (j *jobScheduler) tick(ctx context.Context) bool {
+	acquireCtx, cancel := context.WithTimeout(ctx, j.ttl/3)
+	state, err := j.lease.Acquire(acquireCtx)
+	cancel()
+	now := time.Now().UTC()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("observer scheduler lease error: %v", err)
+		}
+		j.lastError = err.Error()
+		if j.role == schedulerRoleLeader && j.expiresAt.Sub(now) > j.ttl/3 {
+			return true
+		}
+		j.role = schedulerRoleFollower
+		return false
+	}
+	j.lastError = ""
+	if state.Held && j.role != schedulerRoleLeader {
+		j.leaderSince = now
+	}
+	j.leader = state.Holder
+	j.token = state.Token
+	j.expiresAt = state.ExpiresAt
+	if state.Held {
+		j.role = schedulerRoleLeader
+	} else {
+		j.role = schedulerRoleFollower
+		j.leaderSince = time.Time{}
+	}
+	return state.Held
+}
+
+func (j *jobScheduler) start(ctx context.Context) *sync.WaitGroup {
+	var running sync.WaitGroup
+	for _, job := range j.jobs {
+		running.Add(1)
+		go func(job scheduledJob) {
+			defer running.Done()
+			job.run(ctx)
+		}(job)
+	}
+	return &running
+}
+
+// status is the scheduler's view for /healthz.
+func (j *jobScheduler) status() gin.H {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jobs := make([]string, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		jobs = append(jobs, job.name)
+	}
+	return gin.H{
+		"role":           j.role,
+		"instanceId":     j.instanceID,
+		"leader":         j.leader,
+		"fencingToken":   j.token,
+		"leaderSince":    nullableTime(j.leaderSince),
+		"leaseExpiresAt": nullableTime(j.expiresAt),
+		"jobs":           jobs,
+		"lastError":      j.lastError,
+	}
+}
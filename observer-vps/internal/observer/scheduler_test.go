@@ -0,0 +1,210 @@
+package observer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mongox "observer-vps/internal/infra/mongo"
+)
+
+// fakeLease hands out the lease while held is true, bumping the token on
+// every takeover the way the Mongo lease does. A failed call counts as the
+// lease lapsing.
+type fakeLease struct {
+	mu       sync.Mutex
+	held     bool
+	fail     bool
+	token    int64
+	had      bool
+	released bool
+}
+
+func (f *fakeLease) set(held, fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.held, f.fail = held, fail
+}
+
+func (f *fakeLease) Acquire(context.Context) (mongox.LeaseState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		f.had = false
+		return mongox.LeaseState{}, errors.New("mongo unreachable")
+	}
+	if !f.held {
+		f.had = false
+		return mongox.LeaseState{Holder: "other", Token: f.token, ExpiresAt: time.Now().Add(time.Minute)}, nil
+	}
+	if !f.had {
+		f.token++
+		f.had = true
+	}
+	return mongox.LeaseState{Held: true, Holder: "me", Token: f.token, ExpiresAt: time.Now().Add(30 * time.Millisecond)}, nil
+}
+
+func (f *fakeLease) StillHeld(_ context.Context, token int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return false, errors.New("mongo unreachable")
+	}
+	return f.had && token == f.token, nil
+}
+
+func (f *fakeLease) Release(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released = true
+	return nil
+}
+
+func TestSchedulerRunsJobsOnlyWhileLeader(t *testing.T) {
+	lease := &fakeLease{}
+	jobs := newJobScheduler(lease, "me", 30*time.Millisecond)
+	started := make(chan struct{}, 4)
+	stopped := make(chan struct{}, 4)
+	jobs.register("probe", func(ctx context.Context) {
+		started <- struct{}{}
+		<-ctx.Done()
+		stopped <- struct{}{}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		jobs.run(ctx)
+		close(done)
+	}()
+	wait := func(ch chan struct{}, what string) {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for the job to %s", what)
+		}
+	}
+
+	select {
+	case <-started:
+		t.Fatal("job started on a follower")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if status := jobs.status(); status["role"] != schedulerRoleFollower || status["leader"] != "other" {
+		t.Errorf("follower status = %v", status)
+	}
+
+	lease.set(true, false)
+	wait(started, "start")
+	if status := jobs.status(); status["role"] != schedulerRoleLeader || status["fencingToken"] != int64(1) {
+		t.Errorf("leader status = %v", status)
+	}
+
+	lease.set(true, true)
+	wait(stopped, "stop after renewals failed")
+	if status := jobs.status(); status["role"] != schedulerRoleFollower || status["lastError"] != "mongo unreachable" {
+		t.Errorf("status after failed renewals = %v", status)
+	}
+
+	lease.set(true, false)
+	wait(started, "restart on re-election")
+	if status := jobs.status(); status["fencingToken"] != int64(2) {
+		t.Errorf("fencing token after re-election = %v, want 2", status["fencingToken"])
+	}
+
+	cancel()
+	wait(stopped, "stop on shutdown")
+	<-done
+	lease.mu.Lock()
+	defer lease.mu.Unlock()
+	if !lease.released {
+		t.Error("lease was not released on shutdown")
+	}
+}
+
+func TestCheckLeaseFencesJobsOfAnEndedTerm(t *testing.T) {
+	lease := &fakeLease{held: true}
+	jobs := newJobScheduler(lease, "me", time.Minute)
+	jobCtx := make(chan context.Context, 1)
+	jobs.register("archiver", func(ctx context.Context) {
+		jobCtx <- ctx
+		<-ctx.Done()
+	})
+
+	ctx := context.Background()
+	if !jobs.tick(ctx) {
+		t.Fatal("tick did not take the lease")
+	}
+	run := jobs.lead(ctx)
+	defer run.stop()
+	leaderCtx := <-jobCtx
+	if err := checkLease(leaderCtx); err != nil {
+		t.Fatalf("checkLease during the term = %v, want nil", err)
+	}
+
+	// Another replica takes the lease over before this one notices.
+	lease.mu.Lock()
+	lease.token++
+	lease.had = false
+	lease.mu.Unlock()
+	if err := checkLease(leaderCtx); !errors.Is(err, errLeaseLost) {
+		t.Errorf("checkLease after a takeover = %v, want errLeaseLost", err)
+	}
+	lease.set(true, true)
+	if err := checkLease(leaderCtx); err == nil || errors.Is(err, errLeaseLost) {
+		t.Errorf("checkLease with Mongo down = %v, want the lookup error", err)
+	}
+	if err := checkLease(ctx); err != nil {
+		t.Errorf("checkLease outside a term = %v, want nil", err)
+	}
+}
+
+func TestSchedulerRestartsJobsWhenTheTermChanges(t *testing.T) {
+	lease := &fakeLease{held: true}
+	jobs := newJobScheduler(lease, "me", 30*time.Millisecond)
+	jobCtx := make(chan context.Context, 4)
+	jobs.register("archiver", func(ctx context.Context) {
+		jobCtx <- ctx
+		<-ctx.Done()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		jobs.run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	next := func(what string) context.Context {
+		t.Helper()
+		select {
+		case started := <-jobCtx:
+			return started
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for the job to %s", what)
+			return nil
+		}
+	}
+
+	first := next("start")
+	// The lease lapsed and this replica took it again between two ticks,
+	// so the role never changed but the term did.
+	lease.mu.Lock()
+	lease.token++
+	lease.mu.Unlock()
+	second := next("restart under the new term")
+	if first.Err() == nil {
+		t.Error("jobs of the old term were not stopped")
+	}
+	if err := checkLease(second); err != nil {
+		t.Errorf("checkLease under the new term = %v, want nil", err)
+	}
+	if status := jobs.status(); status["role"] != schedulerRoleLeader || status["fencingToken"] != int64(2) {
+		t.Errorf("status = %v, want leader with token 2", status)
+	}
+}
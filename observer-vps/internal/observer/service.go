@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -29,30 +31,83 @@ import (
 var dashboardFS embed.FS
 
 const (
-	eventsCollection      = "observer_events"
-	runtimeCollection     = "observer_runtime_snapshots"
-	backupCollection      = "observer_backup_snapshots"
-	liveDevicesCollection = "observer_live_devices"
+	eventsCollection          = "observer_events"
+	runtimeCollection         = "observer_runtime_snapshots"
+	backupCollection          = "observer_backup_snapshots"
+	liveDevicesCollection     = "observer_live_devices"
+	backupPolicyCollection    = "observer_backup_policies"
+	issuesCollection          = "observer_issues"
+	sourcesCollection         = "observer_sources"
+	sourceVolumeCollection    = "observer_source_volume"
+	runtimeFindingsCollection = "observer_runtime_findings"
+	retentionPolicyCollection = "observer_retention_policies"
+	leasesCollection          = "observer_leases"
+	changeStreamsCollection   = "observer_change_streams"
+	probeResultsCollection    = "observer_probe_results"
+	ingestQuotaCollection     = "observer_ingest_quota"
+
+	webhooksCollection            = "observer_webhooks"
+	webhookDeliveriesCollection   = "observer_webhook_deliveries"
+	webhookDeviceStatesCollection = "observer_webhook_device_states"
 )
 
 type service struct {
-	cfg         Config
-	client      *mongo.Client
-	db          *mongo.Database
-	events      *mongo.Collection
-	runtime     *mongo.Collection
-	backups     *mongo.Collection
-	liveDevices *mongo.Collection
-	startedAt   time.Time
-	dashboard   []byte
-}
-
-func Run(ctx context.Context) error {
-	cfg, err := LoadConfig()
+	cfg             Config
+	client          *mongo.Client
+	db              *mongo.Database
+	events          *mongo.Collection
+	runtime         *mongo.Collection
+	backups         *mongo.Collection
+	liveDevices     *mongo.Collection
+	backupPolicies  *mongo.Collection
+	issues          *mongo.Collection
+	runtimeFindings *mongo.Collection
+	limits          *ingestLimiter
+	redact          *redactor
+	syslog          *syslogReceiver
+	verifier        *backupVerifier
+	archive         *archiver
+	registry        *sourceRegistry
+	retention       *retentionStore
+	sampler         *sampler
+	store           storage
+	bolt            *boltStore
+	writes          *writeHealth
+	changes         *changeBus
+	webhooks        *webhookHub
+	jobs            *jobScheduler
+	current         atomic.Pointer[Config]
+	configArgs      []string
+	startedAt       time.Time
+	dashboard       []byte
+}
+
+// Run starts the observer; args are the command-line flags that override the
+// config file and environment.
+func Run(ctx context.Context, args []string) error {
+	cfg, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+	svc, err := newService(cfg, args)
 	if err != nil {
 		return err
 	}
 
+	if cfg.Storage == storageBolt {
+		bolt, err := openBoltStore(cfg.BoltPath)
+		if err != nil {
+			return err
+		}
+		defer bolt.close()
+		svc.attachBolt(bolt)
+		if err := svc.applyConfigSections(ctx, &cfg); err != nil {
+			return err
+		}
+		svc.jobs = svc.newScheduler()
+		return svc.serve(ctx)
+	}
+
 	connectCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 
@@ -65,37 +120,188 @@ func Run(ctx context.Context) error {
 		defer closeCancel()
 		_ = client.Disconnect(closeCtx)
 	}()
-
-	html, err := dashboardFS.ReadFile("dashboard/index.html")
-	if err != nil {
-		return fmt.Errorf("read embedded dashboard: %w", err)
-	}
-
-	svc := &service{
-		cfg:         cfg,
-		client:      client,
-		db:          db,
-		events:      db.Collection(eventsCollection),
-		runtime:     db.Collection(runtimeCollection),
-		backups:     db.Collection(backupCollection),
-		liveDevices: db.Collection(liveDevicesCollection),
-		startedAt:   time.Now().UTC(),
-		dashboard:   html,
-	}
+	svc.attachMongo(client, db)
 
 	indexCtx, indexCancel := context.WithTimeout(ctx, 20*time.Second)
 	defer indexCancel()
 	if err := svc.ensureIndexes(indexCtx); err != nil {
 		return err
 	}
+	if err := svc.retention.refresh(indexCtx); err != nil {
+		return fmt.Errorf("load retention policies: %w", err)
+	}
+	if err := svc.applyConfigSections(indexCtx, &cfg); err != nil {
+		return fmt.Errorf("apply config file sections: %w", err)
+	}
+	if err := svc.changes.openStream(indexCtx, db); err != nil {
+		return fmt.Errorf("open change stream: %w", err)
+	}
+	if err := svc.webhooks.refresh(indexCtx); err != nil {
+		return fmt.Errorf("load webhooks: %w", err)
+	}
+	svc.jobs = svc.newScheduler()
 
 	return svc.serve(ctx)
 }
 
+// newService builds the parts of the service that do not depend on the
+// store; attachBolt or attachMongo completes it. configArgs are the flags
+// config reloads apply again.
+func newService(cfg Config, configArgs []string) (*service, error) {
+	redact, err := newRedactor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := newArchiver(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sampler, err := newSampler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	html, err := dashboardFS.ReadFile("dashboard/index.html")
+	if err != nil {
+		return nil, fmt.Errorf("read embedded dashboard: %w", err)
+	}
+	return &service{
+		cfg:        cfg,
+		limits:     newIngestLimiter(cfg),
+		redact:     redact,
+		verifier:   newBackupVerifier(cfg),
+		archive:    archive,
+		sampler:    sampler,
+		writes:     newWriteHealth(),
+		changes:    newChangeBus(),
+		configArgs: configArgs,
+		startedAt:  time.Now().UTC(),
+		dashboard:  html,
+	}, nil
+}
+
+// attachBolt points the service at the embedded store; the Mongo-only
+// features stay off.
+func (s *service) attachBolt(bolt *boltStore) {
+	s.bolt = bolt
+	s.store = bolt.storage()
+	s.retention = newRetentionStore(nil, s.cfg)
+	s.limits.ledger = storeQuotaLedger{bolt.collection(ingestQuotaCollection)}
+}
+
+// attachMongo points the service at db for storage and for the features
+// that only run against Mongo.
+func (s *service) attachMongo(client *mongo.Client, db *mongo.Database) {
+	s.client = client
+	s.db = db
+	s.events = db.Collection(eventsCollection)
+	s.runtime = db.Collection(runtimeCollection)
+	s.backups = db.Collection(backupCollection)
+	s.liveDevices = db.Collection(liveDevicesCollection)
+	s.backupPolicies = db.Collection(backupPolicyCollection)
+	s.issues = db.Collection(issuesCollection)
+	s.runtimeFindings = db.Collection(runtimeFindingsCollection)
+	s.registry = newSourceRegistry(db)
+	s.retention = newRetentionStore(db, s.cfg)
+	s.webhooks = newWebhookHub(db, s.cfg)
+	s.store = newMongoStorage(db)
+	s.limits.ledger = mongoQuotaLedger{col: db.Collection(ingestQuotaCollection)}
+}
+
+// mongoBacked reports whether the Mongo-only features (issues, traces,
+// trends, export, archives, sources, backup policies and verification,
+// retention policies) are available; with the bolt store they are not.
+func (s *service) mongoBacked() bool {
+	return s.db != nil
+}
+
+// newScheduler registers the background jobs that must run once per
+// deployment. With Mongo they are guarded by a lease so only one replica
+// runs them; the bolt store is single-process and needs none.
+func (s *service) newScheduler() *jobScheduler {
+	if !s.mongoBacked() {
+		jobs := newJobScheduler(nil, s.cfg.InstanceID, 0)
+		if s.bolt != nil {
+			jobs.register("bolt-sweeper", func(ctx context.Context) {
+				s.bolt.runSweeper(ctx, time.Duration(s.cfg.BoltSweepIntervalMs)*time.Millisecond)
+			})
+		}
+		jobs.register("prober", s.runProber)
+		return jobs
+	}
+	ttl := time.Duration(s.cfg.LeaseTTLMs) * time.Millisecond
+	lease := mongox.NewLease(s.db.Collection(leasesCollection), schedulerLeaseName, s.cfg.InstanceID, ttl)
+	jobs := newJobScheduler(lease, s.cfg.InstanceID, ttl)
+	jobs.register("backup-verifier", s.runBackupVerifier)
+	jobs.register("archiver", s.runArchiver)
+	jobs.register("memory-analyzer", s.runMemoryAnalyzer)
+	jobs.register("webhook-dispatcher", s.runWebhookDispatcher)
+	jobs.register("webhook-crash-scan", s.runWebhookCrashScan)
+	jobs.register("prober", s.runProber)
+	return jobs
+}
+
+func (s *service) requireMongo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.mongoBacked() {
+			c.Next()
+			return
+		}
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"ok":      false,
+			"message": "Not available with OBSERVER_STORAGE=" + s.cfg.Storage,
+		})
+		c.Abort()
+	}
+}
+
 func (s *service) serve(ctx context.Context) error {
 	engine := gin.New()
 	engine.Use(gin.Logger(), gin.Recovery())
+	s.registerRoutes(engine)
 
+	server := &http.Server{
+		Addr:              joinAddr(s.cfg.BindHost, s.cfg.Port),
+		Handler:           engine,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	stopCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := s.startSyslog(stopCtx); err != nil {
+		return err
+	}
+	go s.watchConfig(stopCtx)
+	// The quota sync, registry and retention loops flush and refresh this
+	// replica's own in-memory state and the webhook matcher reads this
+	// replica's change bus, so every replica runs them; the scheduler runs
+	// the rest on the leader only.
+	go s.limits.runQuotaSync(stopCtx)
+	if s.mongoBacked() {
+		go s.registry.run(stopCtx)
+		go s.retention.run(stopCtx)
+		go s.runWebhookMatcher(stopCtx, s.changes.subscribeDurable("webhooks", webhookBusBuffer))
+	}
+	go s.jobs.run(stopCtx)
+	go s.changes.run(stopCtx)
+
+	go func() {
+		<-stopCtx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("observer shutdown error: %v", err)
+		}
+	}()
+
+	log.Printf("pickletour-observer-go listening on %s", server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *service) registerRoutes(engine *gin.Engine) {
 	engine.GET("/", func(c *gin.Context) {
 		c.Redirect(http.StatusTemporaryRedirect, "/dashboard")
 	})
@@ -103,16 +309,22 @@ func (s *service) serve(ctx context.Context) error {
 		c.Data(http.StatusOK, "text/html; charset=utf-8", s.dashboard)
 	})
 	engine.GET("/healthz", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
+		body := gin.H{
 			"ok":        true,
 			"service":   "pickletour-observer-go",
 			"host":      s.cfg.BindHost,
 			"port":      s.cfg.Port,
+			"storage":   s.cfg.Storage,
 			"mongoDb":   s.cfg.MongoDatabase,
 			"startedAt": s.startedAt,
 			"now":       time.Now().UTC(),
-		})
+		}
+		if s.jobs != nil {
+			body["scheduler"] = s.jobs.status()
+		}
+		c.JSON(http.StatusOK, body)
 	})
+	engine.GET("/readyz", s.getReadiness)
 
 	api := engine.Group("/api/observer")
 	{
@@ -122,50 +334,96 @@ func (s *service) serve(ctx context.Context) error {
 		api.POST("/ingest/live-devices/heartbeat", s.requireDeviceIngestAuth(), s.ingestLiveDeviceHeartbeat)
 		api.POST("/ingest/live-devices/event", s.requireDeviceIngestAuth(), s.ingestLiveDeviceEvent)
 		api.POST("/ingest/live-devices/events", s.requireDeviceIngestAuth(), s.ingestLiveDeviceEvents)
+		api.POST("/ingest/otlp/v1/logs", s.requireIngestKey(), s.ingestOTLPLogs)
+		api.POST("/ingest/otlp/v1/traces", s.requireIngestKey(), s.ingestOTLPTraces)
 		api.GET("/read/summary", s.requireReadKey(), s.getSummary)
 		api.GET("/read/events", s.requireReadKey(), s.listEvents)
 		api.GET("/read/runtime", s.requireReadKey(), s.listRuntime)
+		api.GET("/read/runtime/series", s.requireReadKey(), s.requireMongo(), s.getRuntimeSeries)
+		api.GET("/read/runtime/diff", s.requireReadKey(), s.requireMongo(), s.getRuntimeDiff)
+		api.GET("/read/runtime/findings", s.requireReadKey(), s.requireMongo(), s.listRuntimeFindings)
 		api.GET("/read/backups", s.requireReadKey(), s.listBackups)
 		api.GET("/read/live-devices", s.requireReadKey(), s.listLiveDevices)
+		api.GET("/read/stream", s.requireReadKey(), s.streamChanges)
+		api.GET("/read/uptime", s.requireReadKey(), s.getUptime)
+		api.GET("/read/ingest-limits", s.requireReadKey(), s.getIngestLimits)
+		api.GET("/read/backups/findings", s.requireReadKey(), s.requireMongo(), s.listBackupFindings)
+		api.GET("/read/backup-policies", s.requireReadKey(), s.requireMongo(), s.listBackupPolicies)
+		api.GET("/read/export/:kind", s.requireReadKey(), s.exportRows)
+		api.GET("/read/archives", s.requireReadKey(), s.requireMongo(), s.listArchives)
+		api.GET("/read/traces/:requestId", s.requireReadKey(), s.requireMongo(), s.getTrace)
+		api.GET("/read/related-requests", s.requireReadKey(), s.requireMongo(), s.listRelatedRequests)
+		api.GET("/read/issues", s.requireReadKey(), s.requireMongo(), s.listIssues)
+		api.GET("/read/issues/:fingerprint", s.requireReadKey(), s.requireMongo(), s.getIssue)
+		api.GET("/read/sources", s.requireReadKey(), s.requireMongo(), s.listSources)
+		api.PUT("/admin/backup-policies", s.requireAdminKey(), s.requireMongo(), s.upsertBackupPolicy)
+		api.DELETE("/admin/backup-policies", s.requireAdminKey(), s.requireMongo(), s.deleteBackupPolicy)
+		api.POST("/admin/backups/:id/verify", s.requireAdminKey(), s.requireMongo(), s.verifyBackupNow)
+		api.POST("/admin/archives/import", s.requireAdminKey(), s.requireMongo(), s.importArchive)
+		api.PATCH("/admin/issues/:fingerprint", s.requireAdminKey(), s.requireMongo(), s.updateIssue)
+		api.PUT("/admin/sources", s.requireAdminKey(), s.requireMongo(), s.upsertSource)
+		api.DELETE("/admin/sources", s.requireAdminKey(), s.requireMongo(), s.deleteSource)
+		api.GET("/admin/retention-policies", s.requireAdminKey(), s.requireMongo(), s.listRetentionPolicies)
+		api.PUT("/admin/retention-policies", s.requireAdminKey(), s.requireMongo(), s.upsertRetentionPolicy)
+		api.DELETE("/admin/retention-policies", s.requireAdminKey(), s.requireMongo(), s.deleteRetentionPolicy)
+		api.POST("/admin/retention-policies/backfill", s.requireAdminKey(), s.requireMongo(), s.backfillRetention)
+		api.GET("/admin/webhooks", s.requireAdminKey(), s.requireMongo(), s.listWebhooks)
+		api.PUT("/admin/webhooks", s.requireAdminKey(), s.requireMongo(), s.upsertWebhook)
+		api.DELETE("/admin/webhooks", s.requireAdminKey(), s.requireMongo(), s.deleteWebhook)
+		api.GET("/admin/webhooks/deliveries", s.requireAdminKey(), s.requireMongo(), s.listWebhookDeliveries)
+		api.GET("/admin/webhooks/dead-letters", s.requireAdminKey(), s.requireMongo(), s.listWebhookDeadLetters)
+		api.POST("/admin/webhooks/deliveries/:id/retry", s.requireAdminKey(), s.requireMongo(), s.retryWebhookDelivery)
 	}
+}
 
-	server := &http.Server{
-		Addr:              joinAddr(s.cfg.BindHost, s.cfg.Port),
-		Handler:           engine,
-		ReadHeaderTimeout: 10 * time.Second,
-	}
-
-	stopCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
-	defer stop()
+type indexGroup struct {
+	col    *mongo.Collection
+	models []mongo.IndexModel
+}
 
-	go func() {
-		<-stopCtx.Done()
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		if err := server.Shutdown(shutdownCtx); err != nil {
-			log.Printf("observer shutdown error: %v", err)
+func (s *service) ensureIndexes(ctx context.Context) error {
+	for _, group := range s.indexGroups() {
+		if _, err := group.col.Indexes().CreateMany(ctx, group.models); err != nil {
+			return fmt.Errorf("ensure indexes for %s: %w", group.col.Name(), err)
 		}
-	}()
-
-	log.Printf("pickletour-observer-go listening on %s", server.Addr)
-	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		return err
 	}
 	return nil
 }
 
-func (s *service) ensureIndexes(ctx context.Context) error {
-	groups := []struct {
-		col    *mongo.Collection
-		models []mongo.IndexModel
-	}{
+// indexGroups lists the indexes ensureIndexes creates and /readyz checks.
+func (s *service) indexGroups() []indexGroup {
+	return []indexGroup{
 		{
 			col: s.events,
 			models: []mongo.IndexModel{
 				{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
 				{Keys: bson.D{{Key: "source", Value: 1}, {Key: "type", Value: 1}, {Key: "occurredAt", Value: -1}}},
+				{Keys: bson.D{{Key: "archivePending", Value: 1}}, Options: options.Index().SetSparse(true)},
 				{Keys: bson.D{{Key: "category", Value: 1}, {Key: "level", Value: 1}, {Key: "occurredAt", Value: -1}}},
 				{Keys: bson.D{{Key: "source", Value: 1}, {Key: "category", Value: 1}, {Key: "payload.deviceId", Value: 1}, {Key: "occurredAt", Value: -1}}},
+				{Keys: bson.D{{Key: "requestId", Value: 1}, {Key: "occurredAt", Value: 1}}},
+				{Keys: bson.D{{Key: "fingerprint", Value: 1}, {Key: "occurredAt", Value: -1}}, Options: options.Index().SetSparse(true)},
+				{Keys: bson.D{{Key: "payload.deviceId", Value: 1}, {Key: "occurredAt", Value: -1}}, Options: options.Index().SetSparse(true)},
+				{Keys: bson.D{{Key: "payload.matchId", Value: 1}, {Key: "occurredAt", Value: -1}}, Options: options.Index().SetSparse(true)},
+				{
+					Keys: bson.D{
+						{Key: "payload.message", Value: "text"},
+						{Key: "payload.reasonText", Value: "text"},
+						{Key: "path", Value: "text"},
+						{Key: "url", Value: "text"},
+						{Key: "tags", Value: "text"},
+					},
+					Options: options.Index().
+						SetName("events_text").
+						SetDefaultLanguage("none").
+						SetWeights(bson.D{
+							{Key: "payload.message", Value: 5},
+							{Key: "payload.reasonText", Value: 5},
+							{Key: "tags", Value: 3},
+							{Key: "path", Value: 2},
+							{Key: "url", Value: 1},
+						}),
+				},
 			},
 		},
 		{
@@ -173,6 +431,7 @@ func (s *service) ensureIndexes(ctx context.Context) error {
 			models: []mongo.IndexModel{
 				{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
 				{Keys: bson.D{{Key: "source", Value: 1}, {Key: "capturedAt", Value: -1}}},
+				{Keys: bson.D{{Key: "archivePending", Value: 1}}, Options: options.Index().SetSparse(true)},
 			},
 		},
 		{
@@ -180,6 +439,8 @@ func (s *service) ensureIndexes(ctx context.Context) error {
 			models: []mongo.IndexModel{
 				{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
 				{Keys: bson.D{{Key: "source", Value: 1}, {Key: "scope", Value: 1}, {Key: "capturedAt", Value: -1}}},
+				{Keys: bson.D{{Key: "verificationStatus", Value: 1}, {Key: "capturedAt", Value: -1}}},
+				{Keys: bson.D{{Key: "archivePending", Value: 1}}, Options: options.Index().SetSparse(true)},
 			},
 		},
 		{
@@ -189,15 +450,95 @@ func (s *service) ensureIndexes(ctx context.Context) error {
 				{Keys: bson.D{{Key: "source", Value: 1}, {Key: "deviceId", Value: 1}}, Options: options.Index().SetUnique(true)},
 				{Keys: bson.D{{Key: "source", Value: 1}, {Key: "lastSeenAt", Value: -1}}},
 				{Keys: bson.D{{Key: "matchId", Value: 1}, {Key: "lastSeenAt", Value: -1}}},
+				{Keys: bson.D{{Key: "archivePending", Value: 1}}, Options: options.Index().SetSparse(true)},
+			},
+		},
+		{
+			col: s.db.Collection(probeResultsCollection),
+			models: []mongo.IndexModel{
+				{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+				{Keys: bson.D{{Key: "probe", Value: 1}, {Key: "checkedAt", Value: -1}}},
+				{Keys: bson.D{{Key: "checkedAt", Value: 1}}},
+			},
+		},
+		{
+			col: s.backupPolicies,
+			models: []mongo.IndexModel{
+				{Keys: bson.D{{Key: "source", Value: 1}, {Key: "scope", Value: 1}}, Options: options.Index().SetUnique(true)},
+			},
+		},
+		{
+			col: s.issues,
+			models: []mongo.IndexModel{
+				{Keys: bson.D{{Key: "fingerprint", Value: 1}}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "status", Value: 1}, {Key: "lastSeenAt", Value: -1}}},
+				{Keys: bson.D{{Key: "sources", Value: 1}, {Key: "lastSeenAt", Value: -1}}},
+			},
+		},
+		{
+			col: s.runtimeFindings,
+			models: []mongo.IndexModel{
+				{Keys: bson.D{{Key: "source", Value: 1}, {Key: "kind", Value: 1}}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "status", Value: 1}, {Key: "projectedExhaustionAt", Value: 1}}},
+			},
+		},
+		{
+			col: s.retention.col,
+			models: []mongo.IndexModel{
+				{
+					Keys: bson.D{
+						{Key: "kind", Value: 1},
+						{Key: "source", Value: 1},
+						{Key: "category", Value: 1},
+						{Key: "type", Value: 1},
+						{Key: "level", Value: 1},
+					},
+					Options: options.Index().SetUnique(true),
+				},
+			},
+		},
+		{
+			col: s.registry.sources,
+			models: []mongo.IndexModel{
+				{Keys: bson.D{{Key: "source", Value: 1}}, Options: options.Index().SetUnique(true)},
+			},
+		},
+		{
+			col: s.registry.volume,
+			models: []mongo.IndexModel{
+				{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+				{Keys: bson.D{{Key: "source", Value: 1}, {Key: "kind", Value: 1}, {Key: "hour", Value: 1}}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "hour", Value: 1}}},
+			},
+		},
+		{
+			col: s.db.Collection(ingestQuotaCollection),
+			models: []mongo.IndexModel{
+				{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+				{Keys: bson.D{{Key: "day", Value: 1}, {Key: "source", Value: 1}}, Options: options.Index().SetUnique(true)},
+			},
+		},
+		{
+			col: s.webhooks.hooks,
+			models: []mongo.IndexModel{
+				{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+			},
+		},
+		{
+			col: s.webhooks.deliveries,
+			models: []mongo.IndexModel{
+				{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+				{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+				{Keys: bson.D{{Key: "webhook", Value: 1}, {Key: "createdAt", Value: -1}}},
+			},
+		},
+		{
+			col: s.webhooks.deviceStates,
+			models: []mongo.IndexModel{
+				{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
 			},
 		},
 	}
-	for _, group := range groups {
-		if _, err := group.col.Indexes().CreateMany(ctx, group.models); err != nil {
-			return fmt.Errorf("ensure indexes for %s: %w", group.col.Name(), err)
-		}
-	}
-	return nil
 }
 
 func (s *service) ingestEvents(c *gin.Context) {
@@ -212,42 +553,59 @@ func (s *service) ingestEvents(c *gin.Context) {
 			incoming = []any{single}
 		}
 	}
-	now := time.Now().UTC()
-	docs := make([]any, 0, minInt(len(incoming), 500))
+	events := make([]map[string]any, 0, minInt(len(incoming), 500))
 	for _, item := range incoming[:minInt(len(incoming), 500)] {
-		event := toMap(item)
-		if len(event) == 0 {
-			continue
-		}
-		occurredAt := parseTime(firstNonNil(event["occurredAt"], event["ts"]))
-		docs = append(docs, bson.M{
-			"source":     source,
-			"category":   defaultString(asString(event["category"]), "generic"),
-			"type":       defaultString(asString(event["type"]), "event"),
-			"level":      normalizeLevel(asString(event["level"]), "info"),
-			"requestId":  asString(event["requestId"]),
-			"method":     strings.ToUpper(asString(event["method"])),
-			"path":       asString(event["path"]),
-			"url":        asString(event["url"]),
-			"statusCode": normalizeIntValue(event["statusCode"]),
-			"durationMs": normalizeNumber(event["durationMs"]),
-			"ip":         asString(event["ip"]),
-			"tags":       normalizeTags(event["tags"]),
-			"occurredAt": occurredAt,
-			"receivedAt": now,
-			"expireAt":   buildExpireAt(s.cfg.EventTTLDays, occurredAt),
-			"payload":    toMap(event["payload"]),
-			"createdAt":  now,
-			"updatedAt":  now,
-		})
-	}
-	if len(docs) > 0 {
-		if _, err := s.events.InsertMany(c.Request.Context(), docs); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to save observer events", "error": err.Error()})
-			return
+		if event := toMap(item); len(event) > 0 {
+			events = append(events, event)
 		}
 	}
-	c.JSON(http.StatusOK, gin.H{"ok": true, "source": source, "accepted": len(docs)})
+	charge := newIngestCharge(true)
+	charge.add(source, "", len(events))
+	if !s.admitIngest(c, charge) {
+		return
+	}
+	now := time.Now().UTC()
+	docs := make([]any, 0, len(events))
+	for _, event := range events {
+		docs = append(docs, s.buildEventDoc(source, event, now))
+	}
+	kept, err := s.insertEvents(c.Request.Context(), docs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to save observer events", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "source": source, "accepted": kept})
+}
+
+// buildEventDoc turns one observerSink-style event into an observer_events
+// document. Other ingest paths translate into the same shape first so every
+// event gets identical normalization, redaction and TTL handling.
+func (s *service) buildEventDoc(source string, event map[string]any, now time.Time) bson.M {
+	occurredAt := parseTime(firstNonNil(event["occurredAt"], event["ts"]))
+	doc := bson.M{
+		"source":     source,
+		"category":   defaultString(asString(event["category"]), "generic"),
+		"type":       defaultString(asString(event["type"]), "event"),
+		"level":      normalizeLevel(asString(event["level"]), "info"),
+		"requestId":  asString(event["requestId"]),
+		"method":     strings.ToUpper(asString(event["method"])),
+		"path":       s.redact.url(source, asString(event["path"])),
+		"url":        s.redact.url(source, asString(event["url"])),
+		"statusCode": normalizeIntValue(event["statusCode"]),
+		"durationMs": normalizeNumber(event["durationMs"]),
+		"ip":         s.redact.ip(source, asString(event["ip"])),
+		"tags":       normalizeTags(event["tags"]),
+		"occurredAt": occurredAt,
+		"receivedAt": now,
+		"expireAt":   buildExpireAt(s.settings().EventTTLDays, occurredAt),
+		"payload":    s.redact.payload(source, toMap(event["payload"])),
+		"createdAt":  now,
+		"updatedAt":  now,
+	}
+	if fingerprint := issueFingerprintOverride(event["fingerprint"]); fingerprint != "" {
+		doc["fingerprint"] = fingerprint
+	}
+	return doc
 }
 
 func (s *service) ingestRuntime(c *gin.Context) {
@@ -260,14 +618,20 @@ func (s *service) ingestRuntime(c *gin.Context) {
 	if len(snapshot) == 0 {
 		snapshot = body
 	}
+	charge := newIngestCharge(false)
+	charge.add(source, "", 1)
+	if !s.admitIngest(c, charge) {
+		return
+	}
+	snapshot = s.redact.payload(source, snapshot)
 	runtimeObj := toMap(snapshot["runtime"])
 	capturedAt := parseTime(firstNonNil(snapshot["capturedAt"], body["capturedAt"]))
 	now := time.Now().UTC()
-	result, err := s.runtime.InsertOne(c.Request.Context(), bson.M{
+	id, err := s.store.runtime.insertOne(c.Request.Context(), bson.M{
 		"source":          source,
 		"capturedAt":      capturedAt,
 		"receivedAt":      now,
-		"expireAt":        buildExpireAt(s.cfg.RuntimeTTLDays, capturedAt),
+		"expireAt":        s.retention.expireAt(retentionKindRuntime, bson.M{"source": source}, capturedAt),
 		"totals":          firstObject(runtimeObj["totals"], snapshot["totals"]),
 		"hotPaths":        firstObject(runtimeObj["hotPaths"], snapshot["hotPaths"]),
 		"process":         firstObject(runtimeObj["process"], snapshot["process"]),
@@ -277,11 +641,13 @@ func (s *service) ingestRuntime(c *gin.Context) {
 		"createdAt":       now,
 		"updatedAt":       now,
 	})
+	s.writes.record(retentionKindRuntime, err, now)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to save runtime snapshot", "error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"ok": true, "source": source, "id": formatID(result.InsertedID)})
+	s.registry.note(source, sourceKindRuntime, 1, now)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "source": source, "id": formatID(id)})
 }
 
 func (s *service) ingestBackups(c *gin.Context) {
@@ -294,16 +660,21 @@ func (s *service) ingestBackups(c *gin.Context) {
 	if len(snapshot) == 0 {
 		snapshot = body
 	}
+	charge := newIngestCharge(false)
+	charge.add(source, "", 1)
+	if !s.admitIngest(c, charge) {
+		return
+	}
 	capturedAt := parseTime(firstNonNil(snapshot["capturedAt"], snapshot["finishedAt"]))
 	now := time.Now().UTC()
-	result, err := s.backups.InsertOne(c.Request.Context(), bson.M{
+	doc := bson.M{
 		"source":      source,
 		"scope":       defaultString(asString(snapshot["scope"]), "generic"),
 		"backupType":  firstString(snapshot["backupType"], snapshot["type"]),
 		"status":      defaultString(strings.ToLower(asString(snapshot["status"])), "unknown"),
 		"capturedAt":  capturedAt,
 		"receivedAt":  now,
-		"expireAt":    buildExpireAt(s.cfg.BackupTTLDays, capturedAt),
+		"expireAt":    s.retention.expireAt(retentionKindBackups, bson.M{"source": source}, capturedAt),
 		"sizeBytes":   normalizeNumber(snapshot["sizeBytes"]),
 		"durationMs":  normalizeNumber(snapshot["durationMs"]),
 		"manifestUrl": asString(snapshot["manifestUrl"]),
@@ -312,12 +683,17 @@ func (s *service) ingestBackups(c *gin.Context) {
 		"payload":     snapshot,
 		"createdAt":   now,
 		"updatedAt":   now,
-	})
+	}
+	id, err := s.store.backups.insertOne(c.Request.Context(), doc)
+	s.writes.record(retentionKindBackups, err, now)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to save backup snapshot", "error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"ok": true, "source": source, "id": formatID(result.InsertedID)})
+	s.registry.note(source, sourceKindBackups, 1, now)
+	doc["_id"] = id
+	s.changes.notify(c.Request.Context(), changeTopicBackups, "insert", doc)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "source": source, "id": formatID(id)})
 }
 
 func (s *service) getSummary(c *gin.Context) {
@@ -329,39 +705,13 @@ func (s *service) getSummary(c *gin.Context) {
 	if source != "" {
 		eventMatch["source"] = source
 	}
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: eventMatch}},
-		{{Key: "$group", Value: bson.M{
-			"_id":      bson.M{"category": "$category", "level": "$level", "type": "$type"},
-			"count":    bson.M{"$sum": 1},
-			"latestAt": bson.M{"$max": "$occurredAt"},
-		}}},
-		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "latestAt", Value: -1}}}},
-		{{Key: "$limit", Value: 25}},
-	}
-	cursor, err := s.events.Aggregate(c.Request.Context(), pipeline)
+	bucketRows, err := s.store.events.summarize(c.Request.Context(), eventMatch, 25)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to aggregate observer events", "error": err.Error()})
 		return
 	}
-	defer cursor.Close(c.Request.Context())
 
-	type bucket struct {
-		ID struct {
-			Category string `bson:"category"`
-			Level    string `bson:"level"`
-			Type     string `bson:"type"`
-		} `bson:"_id"`
-		Count    int64     `bson:"count"`
-		LatestAt time.Time `bson:"latestAt"`
-	}
-	var bucketRows []bucket
-	if err := cursor.All(c.Request.Context(), &bucketRows); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to decode observer buckets", "error": err.Error()})
-		return
-	}
-
-	totalRecentEvents, err := s.events.CountDocuments(c.Request.Context(), eventMatch)
+	totalRecentEvents, storedRecentEvents, err := s.store.events.estimate(c.Request.Context(), eventMatch)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to count observer events", "error": err.Error()})
 		return
@@ -370,7 +720,7 @@ func (s *service) getSummary(c *gin.Context) {
 	if source != "" {
 		errorMatch["source"] = source
 	}
-	errorRecentEvents, err := s.events.CountDocuments(c.Request.Context(), errorMatch)
+	errorRecentEvents, err := s.store.events.count(c.Request.Context(), errorMatch)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to count observer errors", "error": err.Error()})
 		return
@@ -383,46 +733,69 @@ func (s *service) getSummary(c *gin.Context) {
 		runtimeFilter["source"] = source
 		backupFilter["source"] = source
 	}
-	var latestRuntime bson.M
-	_ = s.runtime.FindOne(c.Request.Context(), runtimeFilter, options.FindOne().SetSort(bson.D{{Key: "capturedAt", Value: -1}, {Key: "_id", Value: -1}})).Decode(&latestRuntime)
-
-	backupCursor, err := s.backups.Find(c.Request.Context(), backupFilter, options.Find().SetSort(bson.D{{Key: "capturedAt", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(10))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load backups", "error": err.Error()})
+	latestSort := bson.D{{Key: "capturedAt", Value: -1}, {Key: "_id", Value: -1}}
+	latestRuntime, err := s.store.runtime.findOne(c.Request.Context(), findQuery{filter: runtimeFilter, sort: latestSort})
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load runtime", "error": err.Error()})
 		return
 	}
-	defer backupCursor.Close(c.Request.Context())
-	var latestBackups []bson.M
-	if err := backupCursor.All(c.Request.Context(), &latestBackups); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to decode backups", "error": err.Error()})
+	latestBackups, err := s.store.backups.find(c.Request.Context(), findQuery{filter: backupFilter, sort: latestSort, limit: 10})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load backups", "error": err.Error()})
 		return
 	}
 
 	buckets := make([]gin.H, 0, len(bucketRows))
 	for _, row := range bucketRows {
 		buckets = append(buckets, gin.H{
-			"category": row.ID.Category,
-			"level":    row.ID.Level,
-			"type":     row.ID.Type,
-			"count":    row.Count,
+			"category": row.Category,
+			"level":    row.Level,
+			"type":     row.Type,
+			"count":    int64(math.Round(row.Count)),
+			"stored":   row.Stored,
 			"latestAt": row.LatestAt,
 		})
 	}
 	backups := make([]gin.H, 0, len(latestBackups))
 	for _, row := range latestBackups {
 		backups = append(backups, gin.H{
-			"id":          formatID(row["_id"]),
-			"source":      asString(row["source"]),
-			"scope":       asString(row["scope"]),
-			"backupType":  asString(row["backupType"]),
-			"status":      asString(row["status"]),
-			"capturedAt":  row["capturedAt"],
-			"sizeBytes":   normalizeNumber(row["sizeBytes"]),
-			"manifestUrl": asString(row["manifestUrl"]),
-			"note":        asString(row["note"]),
+			"id":                 formatID(row["_id"]),
+			"source":             asString(row["source"]),
+			"scope":              asString(row["scope"]),
+			"backupType":         asString(row["backupType"]),
+			"status":             asString(row["status"]),
+			"capturedAt":         row["capturedAt"],
+			"sizeBytes":          normalizeNumber(row["sizeBytes"]),
+			"manifestUrl":        asString(row["manifestUrl"]),
+			"note":               asString(row["note"]),
+			"verificationStatus": defaultString(asString(row["verificationStatus"]), verificationUnverified),
+			"verifiedAt":         row["verifiedAt"],
 		})
 	}
 
+	backupFindings := []backupFinding{}
+	openIssues := []gin.H{}
+	silentSources := []gin.H{}
+	runtimeFindings := []gin.H{}
+	if s.mongoBacked() {
+		if findings, err := s.evaluateBackupPolicies(c.Request.Context(), source, time.Now().UTC()); err == nil {
+			backupFindings = findings
+		}
+		if issues, err := s.loadIssueSummary(c.Request.Context(), source, since); err == nil {
+			openIssues = issues
+		}
+		if silent, err := s.loadSilentSources(c.Request.Context(), time.Now().UTC()); err == nil {
+			silentSources = silent
+		}
+		findingFilter := bson.M{"status": runtimeFindingActive}
+		if source != "" {
+			findingFilter["source"] = source
+		}
+		if findings, err := s.loadRuntimeFindings(c.Request.Context(), findingFilter, 20); err == nil {
+			runtimeFindings = findings
+		}
+	}
+
 	var runtimeData any
 	if len(latestRuntime) > 0 {
 		runtimeData = gin.H{
@@ -442,18 +815,56 @@ func (s *service) getSummary(c *gin.Context) {
 		"source":        emptyStringToNil(source),
 		"windowMinutes": minutes,
 		"events": gin.H{
-			"totalRecentEvents": totalRecentEvents,
-			"errorRecentEvents": errorRecentEvents,
-			"buckets":           buckets,
+			"totalRecentEvents":  totalRecentEvents,
+			"storedRecentEvents": storedRecentEvents,
+			"errorRecentEvents":  errorRecentEvents,
+			"buckets":            buckets,
 		},
-		"runtime":     runtimeData,
-		"backups":     backups,
-		"liveDevices": liveDeviceSummary,
-		"updatedAt":   time.Now().UTC(),
+		"runtime":         runtimeData,
+		"backups":         backups,
+		"backupFindings":  backupFindings,
+		"openIssues":      openIssues,
+		"silentSources":   silentSources,
+		"runtimeFindings": runtimeFindings,
+		"liveDevices":     liveDeviceSummary,
+		"updatedAt":       time.Now().UTC(),
 	})
 }
 
 func (s *service) listEvents(c *gin.Context) {
+	filter, err := eventFilter(c)
+	if err != nil {
+		writeQueryError(c, err)
+		return
+	}
+	limit := clampInt(parseInt(c.DefaultQuery("limit", "100"), 100), 1, 500)
+	if _, searching := filter["$text"]; !searching {
+		s.queryCollection(c, s.store.events, filter, limit, eventItem)
+		return
+	}
+
+	// Text matches carry a relevance score; sort=time keeps the usual order.
+	score := bson.M{"$meta": "textScore"}
+	sort := bson.D{{Key: "score", Value: score}, {Key: "occurredAt", Value: -1}, {Key: "_id", Value: -1}}
+	if strings.EqualFold(strings.TrimSpace(c.Query("sort")), "time") {
+		sort = bson.D{{Key: "occurredAt", Value: -1}, {Key: "_id", Value: -1}}
+	}
+	s.queryCollectionWith(c, s.store.events, findQuery{filter: filter, sort: sort, limit: int64(limit), projection: bson.M{"score": score}}, eventItem)
+}
+
+func (s *service) listRuntime(c *gin.Context) {
+	s.queryCollection(c, s.store.runtime, runtimeFilter(c), clampInt(parseInt(c.DefaultQuery("limit", "20"), 20), 1, 100), runtimeItem)
+}
+
+func (s *service) listBackups(c *gin.Context) {
+	s.queryCollection(c, s.store.backups, backupFilter(c), clampInt(parseInt(c.DefaultQuery("limit", "50"), 50), 1, 200), backupItem)
+}
+
+// eventSearchMaxLength caps the search parameter handed to $text.
+const eventSearchMaxLength = 500
+
+// eventFilter combines the equality parameters with the optional q expression.
+func eventFilter(c *gin.Context) (bson.M, error) {
 	filter := bson.M{}
 	if source := strings.TrimSpace(c.Query("source")); source != "" {
 		filter["source"] = source
@@ -470,49 +881,76 @@ func (s *service) listEvents(c *gin.Context) {
 	if deviceID := strings.TrimSpace(c.Query("deviceId")); deviceID != "" {
 		filter["payload.deviceId"] = deviceID
 	}
-	s.queryCollection(c, s.events, filter, clampInt(parseInt(c.DefaultQuery("limit", "100"), 100), 1, 500), func(row bson.M) gin.H {
-		return gin.H{
-			"id":         formatID(row["_id"]),
-			"source":     asString(row["source"]),
-			"category":   asString(row["category"]),
-			"type":       asString(row["type"]),
-			"level":      asString(row["level"]),
-			"requestId":  asString(row["requestId"]),
-			"method":     asString(row["method"]),
-			"path":       asString(row["path"]),
-			"url":        asString(row["url"]),
-			"statusCode": normalizeIntValue(row["statusCode"]),
-			"durationMs": normalizeNumber(row["durationMs"]),
-			"ip":         asString(row["ip"]),
-			"tags":       firstSlice(row["tags"]),
-			"occurredAt": row["occurredAt"],
-			"receivedAt": row["receivedAt"],
-			"payload":    toMap(row["payload"]),
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		if len(search) > eventSearchMaxLength {
+			return nil, fmt.Errorf("search longer than %d characters", eventSearchMaxLength)
 		}
-	})
+		filter["$text"] = bson.M{"$search": search}
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		parsed, err := parseEventQuery(q, time.Now().UTC())
+		if err != nil {
+			return nil, err
+		}
+		filter["$and"] = bson.A{parsed}
+	}
+	return filter, nil
 }
 
-func (s *service) listRuntime(c *gin.Context) {
+func eventItem(row bson.M) gin.H {
+	item := gin.H{
+		"id":         formatID(row["_id"]),
+		"source":     asString(row["source"]),
+		"category":   asString(row["category"]),
+		"type":       asString(row["type"]),
+		"level":      asString(row["level"]),
+		"requestId":  asString(row["requestId"]),
+		"method":     asString(row["method"]),
+		"path":       asString(row["path"]),
+		"url":        asString(row["url"]),
+		"statusCode": normalizeIntValue(row["statusCode"]),
+		"durationMs": normalizeNumber(row["durationMs"]),
+		"ip":         asString(row["ip"]),
+		"tags":       firstSlice(row["tags"]),
+		"occurredAt": row["occurredAt"],
+		"receivedAt": row["receivedAt"],
+		"payload":    toMap(row["payload"]),
+	}
+	if fingerprint := asString(row["fingerprint"]); fingerprint != "" {
+		item["fingerprint"] = fingerprint
+	}
+	if weight := normalizeNumber(row["sampleWeight"]); weight != nil {
+		item["sampleWeight"] = weight
+	}
+	if score, ok := row["score"]; ok {
+		item["score"] = score
+	}
+	return item
+}
+
+func runtimeFilter(c *gin.Context) bson.M {
 	filter := bson.M{}
 	if source := strings.TrimSpace(c.Query("source")); source != "" {
 		filter["source"] = source
 	}
-	s.queryCollection(c, s.runtime, filter, clampInt(parseInt(c.DefaultQuery("limit", "20"), 20), 1, 100), func(row bson.M) gin.H {
-		return gin.H{
-			"id":              formatID(row["_id"]),
-			"source":          asString(row["source"]),
-			"capturedAt":      row["capturedAt"],
-			"receivedAt":      row["receivedAt"],
-			"totals":          firstObject(row["totals"]),
-			"hotPaths":        firstObject(row["hotPaths"]),
-			"process":         firstObject(row["process"]),
-			"endpoints":       firstSlice(row["endpoints"]),
-			"recordingExport": firstObject(row["recordingExport"]),
-		}
-	})
+	return filter
 }
 
-func (s *service) listBackups(c *gin.Context) {
+func runtimeItem(row bson.M) gin.H {
+	return gin.H{
+		"id":              formatID(row["_id"]),
+		"source":          asString(row["source"]),
+		"capturedAt":      row["capturedAt"],
+		"receivedAt":      row["receivedAt"],
+		"totals":          firstObject(row["totals"]),
+		"hotPaths":        firstObject(row["hotPaths"]),
+		"process":         firstObject(row["process"]),
+		"endpoints":       firstSlice(row["endpoints"]),
+		"recordingExport": firstObject(row["recordingExport"]),
+	}
+}
+
+func backupFilter(c *gin.Context) bson.M {
 	filter := bson.M{}
 	if source := strings.TrimSpace(c.Query("source")); source != "" {
 		filter["source"] = source
@@ -523,37 +961,51 @@ func (s *service) listBackups(c *gin.Context) {
 	if status := strings.ToLower(strings.TrimSpace(c.Query("status"))); status != "" {
 		filter["status"] = status
 	}
-	s.queryCollection(c, s.backups, filter, clampInt(parseInt(c.DefaultQuery("limit", "50"), 50), 1, 200), func(row bson.M) gin.H {
-		return gin.H{
-			"id":          formatID(row["_id"]),
-			"source":      asString(row["source"]),
-			"scope":       asString(row["scope"]),
-			"backupType":  asString(row["backupType"]),
-			"status":      asString(row["status"]),
-			"capturedAt":  row["capturedAt"],
-			"receivedAt":  row["receivedAt"],
-			"sizeBytes":   normalizeNumber(row["sizeBytes"]),
-			"durationMs":  normalizeNumber(row["durationMs"]),
-			"manifestUrl": asString(row["manifestUrl"]),
-			"checksum":    asString(row["checksum"]),
-			"note":        asString(row["note"]),
-			"payload":     toMap(row["payload"]),
+	if verification := strings.ToLower(strings.TrimSpace(c.Query("verification"))); verification != "" {
+		if verification == verificationUnverified {
+			filter["verificationStatus"] = bson.M{"$exists": false}
+		} else {
+			filter["verificationStatus"] = verification
 		}
-	})
+	}
+	return filter
+}
+
+func backupItem(row bson.M) gin.H {
+	return gin.H{
+		"id":                 formatID(row["_id"]),
+		"source":             asString(row["source"]),
+		"scope":              asString(row["scope"]),
+		"backupType":         asString(row["backupType"]),
+		"status":             asString(row["status"]),
+		"capturedAt":         row["capturedAt"],
+		"receivedAt":         row["receivedAt"],
+		"sizeBytes":          normalizeNumber(row["sizeBytes"]),
+		"durationMs":         normalizeNumber(row["durationMs"]),
+		"manifestUrl":        asString(row["manifestUrl"]),
+		"checksum":           asString(row["checksum"]),
+		"note":               asString(row["note"]),
+		"payload":            toMap(row["payload"]),
+		"verificationStatus": defaultString(asString(row["verificationStatus"]), verificationUnverified),
+		"verifiedAt":         row["verifiedAt"],
+		"verification":       firstObject(row["verification"]),
+	}
 }
 
-func (s *service) queryCollection(c *gin.Context, col *mongo.Collection, filter bson.M, limit int, mapper func(bson.M) gin.H) {
-	cursor, err := col.Find(c.Request.Context(), filter, options.Find().SetSort(bson.D{{Key: "capturedAt", Value: -1}, {Key: "occurredAt", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(int64(limit)))
+func (s *service) queryCollection(c *gin.Context, store documentStore, filter bson.M, limit int, mapper func(bson.M) gin.H) {
+	s.queryCollectionWith(c, store, findQuery{
+		filter: filter,
+		sort:   bson.D{{Key: "capturedAt", Value: -1}, {Key: "occurredAt", Value: -1}, {Key: "_id", Value: -1}},
+		limit:  int64(limit),
+	}, mapper)
+}
+
+func (s *service) queryCollectionWith(c *gin.Context, store documentStore, query findQuery, mapper func(bson.M) gin.H) {
+	rows, err := store.find(c.Request.Context(), query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load rows", "error": err.Error()})
 		return
 	}
-	defer cursor.Close(c.Request.Context())
-	var rows []bson.M
-	if err := cursor.All(c.Request.Context(), &rows); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to decode rows", "error": err.Error()})
-		return
-	}
 	items := make([]gin.H, 0, len(rows))
 	for _, row := range rows {
 		items = append(items, mapper(row))
@@ -619,10 +1071,14 @@ func parseTime(value any) time.Time {
 }
 
 func buildExpireAt(ttlDays int, base time.Time) time.Time {
+	return base.UTC().Add(ttlDuration(ttlDays))
+}
+
+func ttlDuration(ttlDays int) time.Duration {
 	if ttlDays <= 0 {
 		ttlDays = 7
 	}
-	return base.UTC().Add(time.Duration(ttlDays) * 24 * time.Hour)
+	return time.Duration(ttlDays) * 24 * time.Hour
 }
 
 func normalizeLevel(value, fallback string) string {
@@ -693,6 +1149,22 @@ func normalizeNumber(value any) any {
 	return nil
 }
 
+// asFloat reads any numeric representation as float64, returning 0 when the
+// value is missing or not a number.
+func asFloat(value any) float64 {
+	switch typed := normalizeNumber(value).(type) {
+	case int:
+		return float64(typed)
+	case int32:
+		return float64(typed)
+	case int64:
+		return float64(typed)
+	case float64:
+		return typed
+	}
+	return 0
+}
+
 func toMap(value any) map[string]any {
 	switch typed := value.(type) {
 	case map[string]any:
@@ -0,0 +1,196 @@
+package observer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const testObserverKey = "test-observer-key"
+
+// newTestService wires the handlers to memory storage. The remaining Mongo
+// collections point at an unreachable server with a short selection timeout,
+// so Mongo-only extras (issues, sources, findings) fail fast and fall back
+// to empty lists the way the handlers already allow.
+func newTestService(t *testing.T) (*service, http.Handler) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("NODE_ENV", "test")
+	t.Setenv("MONGO_URI", "mongodb://127.0.0.1:1/observer_test")
+	t.Setenv("OBSERVER_API_KEY", testObserverKey)
+
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	client, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI(cfg.MongoURI).
+		SetServerSelectionTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("create mongo client: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	svc, err := newService(cfg, nil)
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	svc.attachMongo(client, client.Database(cfg.MongoDatabase))
+	svc.store = newMemoryStorage()
+	engine := gin.New()
+	svc.registerRoutes(engine)
+	return svc, engine
+}
+
+// doJSON sends body with the observer key and decodes the JSON response.
+func doJSON(t *testing.T, handler http.Handler, method, path string, body any) (int, map[string]any) {
+	t.Helper()
+	var reader *bytes.Reader
+	if body == nil {
+		reader = bytes.NewReader(nil)
+	} else {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-pkt-observer-key", testObserverKey)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var decoded map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("%s %s: decode response %q: %v", method, path, rec.Body.String(), err)
+	}
+	return rec.Code, decoded
+}
+
+func TestIngestEventsStoresNormalizedDocuments(t *testing.T) {
+	svc, handler := newTestService(t)
+	code, body := doJSON(t, handler, http.MethodPost, "/api/observer/ingest/events", gin.H{
+		"source": "pickletour-api-main",
+		"events": []gin.H{
+			{"category": "http", "type": "request", "level": "INFO", "method": "get", "path": "/api/matches"},
+			{"category": "http", "type": "request", "level": "WARN", "statusCode": "404"},
+			{},
+		},
+	})
+	if code != http.StatusOK || body["accepted"] != float64(2) {
+		t.Fatalf("ingest = %d %v, want 200 with 2 accepted", code, body)
+	}
+
+	rows, err := svc.store.events.find(context.Background(), findQuery{filter: bson.M{"source": "pickletour-api-main"}})
+	if err != nil {
+		t.Fatalf("find events: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("stored %d events, want 2", len(rows))
+	}
+	levels := map[string]bool{}
+	for _, row := range rows {
+		levels[asString(row["level"])] = true
+		if row["expireAt"] == nil || row["sampleWeight"] == nil {
+			t.Errorf("event %v missing expireAt or sampleWeight", row["_id"])
+		}
+	}
+	if !levels["info"] || !levels["warn"] {
+		t.Errorf("levels = %v, want info and warn", levels)
+	}
+}
+
+func TestIngestEventsReportsWhatSamplingKept(t *testing.T) {
+	svc, handler := newTestService(t)
+	rules, err := newSampler(Config{SampleRules: []string{"noisy=0"}})
+	if err != nil {
+		t.Fatalf("new sampler: %v", err)
+	}
+	svc.sampler.reconfigure(rules)
+	code, body := doJSON(t, handler, http.MethodPost, "/api/observer/ingest/events", gin.H{
+		"source": "noisy",
+		"events": []gin.H{{"level": "info"}, {"level": "error"}},
+	})
+	if code != http.StatusOK || body["accepted"] != float64(1) {
+		t.Fatalf("ingest = %d %v, want 200 with only the error accepted", code, body)
+	}
+	if used := svc.limits.quotaUsage["noisy"]; used != 2 {
+		t.Errorf("quota usage = %d, want both events counted before sampling", used)
+	}
+}
+
+func TestSummaryAggregatesRecentEvents(t *testing.T) {
+	svc, handler := newTestService(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	event := func(source, category, level, eventType string, age time.Duration, weight float64) any {
+		return bson.M{
+			"source":       source,
+			"category":     category,
+			"type":         eventType,
+			"level":        level,
+			"occurredAt":   now.Add(-age),
+			"sampleWeight": weight,
+		}
+	}
+	docs := []any{
+		event("api", "http", "info", "request", time.Minute, 4),
+		event("api", "http", "info", "request", 2*time.Minute, 4),
+		event("api", "http", "error", "request", 3*time.Minute, 1),
+		event("api", "auth", "warn", "login_failed", 4*time.Minute, 1),
+		event("api", "http", "info", "request", 3*time.Hour, 1),
+		event("worker", "jobs", "error", "failed", time.Minute, 1),
+	}
+	if err := svc.store.events.insertMany(ctx, docs); err != nil {
+		t.Fatalf("seed events: %v", err)
+	}
+	for _, capturedAt := range []time.Time{now.Add(-10 * time.Minute), now.Add(-time.Minute)} {
+		if _, err := svc.store.runtime.insertOne(ctx, bson.M{"source": "api", "capturedAt": capturedAt, "totals": bson.M{"requests": capturedAt.Unix()}}); err != nil {
+			t.Fatalf("seed runtime: %v", err)
+		}
+	}
+	if _, err := svc.store.backups.insertOne(ctx, bson.M{"source": "api", "scope": "mongo", "status": "success", "capturedAt": now}); err != nil {
+		t.Fatalf("seed backup: %v", err)
+	}
+
+	code, body := doJSON(t, handler, http.MethodGet, "/api/observer/read/summary?source=api&minutes=60", nil)
+	if code != http.StatusOK {
+		t.Fatalf("summary = %d %v", code, body)
+	}
+	events := toMap(body["events"])
+	if got := events["totalRecentEvents"]; got != float64(10) {
+		t.Errorf("totalRecentEvents = %v, want 10 (weighted)", got)
+	}
+	if got := events["storedRecentEvents"]; got != float64(4) {
+		t.Errorf("storedRecentEvents = %v, want 4", got)
+	}
+	if got := events["errorRecentEvents"]; got != float64(1) {
+		t.Errorf("errorRecentEvents = %v, want 1", got)
+	}
+	buckets := toSlice(events["buckets"])
+	if len(buckets) != 3 {
+		t.Fatalf("buckets = %v, want 3 groups", buckets)
+	}
+	top := toMap(buckets[0])
+	if top["category"] != "http" || top["level"] != "info" || top["count"] != float64(8) || top["stored"] != float64(2) {
+		t.Errorf("top bucket = %v, want http/info with count 8 from 2 stored", top)
+	}
+
+	runtime := toMap(body["runtime"])
+	if requests := toMap(runtime["totals"])["requests"]; requests != float64(now.Add(-time.Minute).Unix()) {
+		t.Errorf("runtime totals = %v, want the newest snapshot", runtime["totals"])
+	}
+	if backups := toSlice(body["backups"]); len(backups) != 1 {
+		t.Errorf("backups = %v, want 1", backups)
+	}
+}
@@ -0,0 +1,450 @@
+package observer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	sourceKindEvents  = "events"
+	sourceKindRuntime = "runtime"
+	sourceKindBackups = "backups"
+	sourceKindDevices = "devices"
+
+	sourceRegistryFlushInterval = 10 * time.Second
+	sourceVolumeRetention       = 3 * 24 * time.Hour
+)
+
+var sourceKinds = []string{sourceKindEvents, sourceKindRuntime, sourceKindBackups, sourceKindDevices}
+
+type sourceTallyKey struct {
+	source string
+	kind   string
+	hour   time.Time
+}
+
+type sourceTally struct {
+	count int
+	first time.Time
+	last  time.Time
+}
+
+// sourceRegistry accumulates ingest activity in memory and flushes it every
+// few seconds, so a busy source costs one registry write per interval rather
+// than one per request. observer_sources holds first/last seen per kind;
+// observer_source_volume holds hourly counts that expire after a few days.
+// Tallies a flush could not write are kept per collection and merged into
+// the next flush.
+type sourceRegistry struct {
+	sources *mongo.Collection
+	volume  *mongo.Collection
+
+	mu            sync.Mutex
+	pending       map[sourceTallyKey]*sourceTally
+	unsentSources map[sourceTallyKey]*sourceTally
+	unsentVolume  map[sourceTallyKey]*sourceTally
+}
+
+func newSourceRegistry(db *mongo.Database) *sourceRegistry {
+	return &sourceRegistry{
+		sources:       db.Collection(sourcesCollection),
+		volume:        db.Collection(sourceVolumeCollection),
+		pending:       map[sourceTallyKey]*sourceTally{},
+		unsentSources: map[sourceTallyKey]*sourceTally{},
+		unsentVolume:  map[sourceTallyKey]*sourceTally{},
+	}
+}
+
+// mergeTally adds tally into tallies[key]; tally itself is not kept.
+func mergeTally(tallies map[sourceTallyKey]*sourceTally, key sourceTallyKey, tally sourceTally) {
+	existing := tallies[key]
+	if existing == nil {
+		tallies[key] = &tally
+		return
+	}
+	existing.count += tally.count
+	if tally.first.Before(existing.first) {
+		existing.first = tally.first
+	}
+	if tally.last.After(existing.last) {
+		existing.last = tally.last
+	}
+}
+
+// note records count items of kind received from source at the given time.
+func (r *sourceRegistry) note(source, kind string, count int, at time.Time) {
+	if r == nil || source == "" || count <= 0 {
+		return
+	}
+	key := sourceTallyKey{source: source, kind: kind, hour: at.UTC().Truncate(time.Hour)}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	mergeTally(r.pending, key, sourceTally{count: count, first: at, last: at})
+}
+
+// pendingCount is the number of tallies waiting for the next flush,
+// including those a failed flush kept for either collection.
+func (r *sourceRegistry) pendingCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending) + len(r.unsentSources) + len(r.unsentVolume)
+}
+
+func (r *sourceRegistry) run(ctx context.Context) {
+	ticker := time.NewTicker(sourceRegistryFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := r.flush(flushCtx); err != nil {
+				log.Printf("observer source registry flush error: %v", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := r.flush(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("observer source registry flush error: %v", err)
+			}
+		}
+	}
+}
+
+func (r *sourceRegistry) flush(ctx context.Context) error {
+	r.mu.Lock()
+	sourceTallies, volumeTallies := r.unsentSources, r.unsentVolume
+	for key, tally := range r.pending {
+		mergeTally(sourceTallies, key, *tally)
+		mergeTally(volumeTallies, key, *tally)
+	}
+	r.pending = map[sourceTallyKey]*sourceTally{}
+	r.unsentSources = map[sourceTallyKey]*sourceTally{}
+	r.unsentVolume = map[sourceTallyKey]*sourceTally{}
+	r.mu.Unlock()
+
+	now := time.Now().UTC()
+	sourceErr := r.write(ctx, r.sources, sourceTallies, func(key sourceTallyKey, tally *sourceTally) mongo.WriteModel {
+		prefix := "kinds." + key.kind + "."
+		return mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"source": key.source}).
+			SetUpdate(bson.M{
+				"$setOnInsert": bson.M{"source": key.source, "expected": false, "createdAt": now},
+				"$min":         bson.M{"firstSeenAt": tally.first, prefix + "firstSeenAt": tally.first},
+				"$max":         bson.M{"lastSeenAt": tally.last, prefix + "lastSeenAt": tally.last},
+				"$inc":         bson.M{prefix + "count": tally.count},
+				"$set":         bson.M{"updatedAt": now},
+			}).
+			SetUpsert(true)
+	}, &r.unsentSources)
+	volumeErr := r.write(ctx, r.volume, volumeTallies, func(key sourceTallyKey, tally *sourceTally) mongo.WriteModel {
+		return mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"source": key.source, "kind": key.kind, "hour": key.hour}).
+			SetUpdate(bson.M{
+				"$inc":         bson.M{"count": tally.count},
+				"$setOnInsert": bson.M{"expireAt": key.hour.Add(sourceVolumeRetention)},
+			}).
+			SetUpsert(true)
+	}, &r.unsentVolume)
+	return errors.Join(sourceErr, volumeErr)
+}
+
+// write sends one model per tally and merges the tallies whose write did
+// not apply back into *unsent, under r.mu, for the next flush.
+func (r *sourceRegistry) write(ctx context.Context, col *mongo.Collection, tallies map[sourceTallyKey]*sourceTally, model func(sourceTallyKey, *sourceTally) mongo.WriteModel, unsent *map[sourceTallyKey]*sourceTally) error {
+	if len(tallies) == 0 {
+		return nil
+	}
+	keys := make([]sourceTallyKey, 0, len(tallies))
+	models := make([]mongo.WriteModel, 0, len(tallies))
+	for key, tally := range tallies {
+		keys = append(keys, key)
+		models = append(models, model(key, tally))
+	}
+	_, err := col.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err == nil {
+		return nil
+	}
+	failed := keys
+	var bulk mongo.BulkWriteException
+	if errors.As(err, &bulk) && bulk.WriteConcernError == nil && len(bulk.WriteErrors) > 0 {
+		failed = make([]sourceTallyKey, 0, len(bulk.WriteErrors))
+		for _, writeErr := range bulk.WriteErrors {
+			failed = append(failed, keys[writeErr.Index])
+		}
+	}
+	r.mu.Lock()
+	for _, key := range failed {
+		mergeTally(*unsent, key, *tallies[key])
+	}
+	r.mu.Unlock()
+	return err
+}
+
+func (r *sourceRegistry) sourceVolumes(ctx context.Context, now time.Time) (map[string]map[string]gin.H, error) {
+	currentHour := now.Truncate(time.Hour)
+	cursor, err := r.volume.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"hour": bson.M{"$gt": currentHour.Add(-24 * time.Hour)}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     bson.M{"source": "$source", "kind": "$kind"},
+			"last24h": bson.M{"$sum": "$count"},
+			"currentHour": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$hour", currentHour}}, "$count", 0,
+			}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []bson.M
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	out := map[string]map[string]gin.H{}
+	for _, row := range rows {
+		id := toMap(row["_id"])
+		source := asString(id["source"])
+		if out[source] == nil {
+			out[source] = map[string]gin.H{}
+		}
+		out[source][asString(id["kind"])] = gin.H{
+			"last24h":     normalizeIntValue(row["last24h"]),
+			"currentHour": normalizeIntValue(row["currentHour"]),
+		}
+	}
+	return out, nil
+}
+
+// sourceSilence reports whether an expected source has gone quiet. When the
+// registry entry lists expectedKinds each of them must have reported within
+// the threshold; otherwise any activity counts.
+func sourceSilence(row bson.M, now time.Time, defaultMinutes int) (bool, []string) {
+	if !asBool(row["expected"]) {
+		return false, []string{}
+	}
+	minutes := parseInt(asString(row["silenceAfterMinutes"]), defaultMinutes)
+	threshold := time.Duration(minutes) * time.Minute
+	kinds := toMap(row["kinds"])
+	expectedKinds := normalizeStringList(row["expectedKinds"])
+
+	quiet := []string{}
+	if len(expectedKinds) == 0 {
+		lastSeenAt, ok := row["lastSeenAt"]
+		if !ok || now.Sub(parseTime(lastSeenAt)) > threshold {
+			quiet = append(quiet, "any")
+		}
+		return len(quiet) > 0, quiet
+	}
+	for _, kind := range expectedKinds {
+		lastSeenAt, ok := toMap(kinds[kind])["lastSeenAt"]
+		if !ok || now.Sub(parseTime(lastSeenAt)) > threshold {
+			quiet = append(quiet, kind)
+		}
+	}
+	return len(quiet) > 0, quiet
+}
+
+func (s *service) sourceItem(row bson.M, volumes map[string]gin.H, now time.Time) gin.H {
+	silent, quietKinds := sourceSilence(row, now, s.settings().SourceSilenceMinutes)
+	kinds := gin.H{}
+	storedKinds := toMap(row["kinds"])
+	for _, kind := range sourceKinds {
+		stored := toMap(storedKinds[kind])
+		if len(stored) == 0 {
+			continue
+		}
+		entry := gin.H{
+			"firstSeenAt": stored["firstSeenAt"],
+			"lastSeenAt":  stored["lastSeenAt"],
+			"count":       normalizeIntValue(stored["count"]),
+			"last24h":     0,
+			"currentHour": 0,
+		}
+		for key, value := range volumes[kind] {
+			entry[key] = value
+		}
+		kinds[kind] = entry
+	}
+	var silentForMs any
+	if silent {
+		if lastSeenAt, ok := row["lastSeenAt"]; ok {
+			silentForMs = now.Sub(parseTime(lastSeenAt)).Milliseconds()
+		}
+	}
+	return gin.H{
+		"source":              asString(row["source"]),
+		"firstSeenAt":         row["firstSeenAt"],
+		"lastSeenAt":          row["lastSeenAt"],
+		"expected":            asBool(row["expected"]),
+		"expectedKinds":       normalizeStringList(row["expectedKinds"]),
+		"silenceAfterMinutes": parseInt(asString(row["silenceAfterMinutes"]), s.settings().SourceSilenceMinutes),
+		"note":                asString(row["note"]),
+		"silent":              silent,
+		"silentKinds":         quietKinds,
+		"silentForMs":         silentForMs,
+		"kinds":               kinds,
+	}
+}
+
+func (s *service) loadSourceItems(ctx context.Context, filter bson.M, now time.Time) ([]gin.H, error) {
+	cursor, err := s.registry.sources.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "source", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []bson.M
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	volumes, err := s.registry.sourceVolumes(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, s.sourceItem(row, volumes[asString(row["source"])], now))
+	}
+	return items, nil
+}
+
+func (s *service) listSources(c *gin.Context) {
+	filter := bson.M{}
+	if asBool(c.Query("expectedOnly")) {
+		filter["expected"] = true
+	}
+	now := time.Now().UTC()
+	items, err := s.loadSourceItems(c.Request.Context(), filter, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load sources", "error": err.Error()})
+		return
+	}
+	if asBool(c.Query("silentOnly")) {
+		silent := make([]gin.H, 0, len(items))
+		for _, item := range items {
+			if item["silent"] == true {
+				silent = append(silent, item)
+			}
+		}
+		items = silent
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "items": items})
+}
+
+// upsertSource marks a source as expected (or not) and sets its silence
+// threshold. A source can be registered before it has ever reported.
+func (s *service) upsertSource(c *gin.Context) {
+	body, ok := bindJSONMap(c)
+	if !ok {
+		return
+	}
+	if err := validateSourceSetting(body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": err.Error()})
+		return
+	}
+	now := time.Now().UTC()
+	row, err := s.saveSource(c.Request.Context(), body, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to save source", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "item": s.sourceItem(row, nil, now)})
+}
+
+// validateSourceSetting checks a source registration as posted to the admin
+// API or listed under sources in the config file.
+func validateSourceSetting(body map[string]any) error {
+	if strings.TrimSpace(asString(body["source"])) == "" {
+		return errors.New("source is required")
+	}
+	if value, ok := body["silenceAfterMinutes"]; ok && parseInt(asString(value), 0) <= 0 {
+		return errors.New("silenceAfterMinutes must be a positive number")
+	}
+	if value, ok := body["expectedKinds"]; ok {
+		for _, kind := range normalizeStringList(value) {
+			if !containsString(sourceKinds, kind) {
+				return errors.New("expectedKinds must be from events, runtime, backups, devices")
+			}
+		}
+	}
+	return nil
+}
+
+// saveSource upserts a validated registration, touching only the fields
+// present in body, and returns the stored row.
+func (s *service) saveSource(ctx context.Context, body map[string]any, now time.Time) (bson.M, error) {
+	source := strings.TrimSpace(asString(body["source"]))
+	set := bson.M{"updatedAt": now}
+	if value, ok := body["expected"]; ok {
+		set["expected"] = asBool(value)
+	}
+	if value, ok := body["silenceAfterMinutes"]; ok {
+		set["silenceAfterMinutes"] = parseInt(asString(value), 0)
+	}
+	if value, ok := body["expectedKinds"]; ok {
+		set["expectedKinds"] = normalizeStringList(value)
+	}
+	if value, ok := body["note"]; ok {
+		set["note"] = strings.TrimSpace(asString(value))
+	}
+	setOnInsert := bson.M{"source": source, "createdAt": now}
+	if _, ok := set["expected"]; !ok {
+		setOnInsert["expected"] = false
+	}
+
+	var row bson.M
+	err := s.registry.sources.FindOneAndUpdate(
+		ctx,
+		bson.M{"source": source},
+		bson.M{"$set": set, "$setOnInsert": setOnInsert},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&row)
+	return row, err
+}
+
+func (s *service) deleteSource(c *gin.Context) {
+	source := strings.TrimSpace(c.Query("source"))
+	if source == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "source is required"})
+		return
+	}
+	result, err := s.registry.sources.DeleteOne(c.Request.Context(), bson.M{"source": source})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to delete source", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "deleted": result.DeletedCount})
+}
+
+// loadSilentSources lists expected sources that are currently silent.
+func (s *service) loadSilentSources(ctx context.Context, now time.Time) ([]gin.H, error) {
+	items, err := s.loadSourceItems(ctx, bson.M{"expected": true}, now)
+	if err != nil {
+		return nil, err
+	}
+	silent := make([]gin.H, 0, len(items))
+	for _, item := range items {
+		if item["silent"] == true {
+			silent = append(silent, item)
+		}
+	}
+	return silent, nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package observer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSourceRegistryKeepsTalliesWhenFlushFails(t *testing.T) {
+	svc, _ := newTestService(t)
+	registry := svc.registry
+	at := time.Date(2026, 3, 1, 12, 5, 0, 0, time.UTC)
+
+	registry.note("api", sourceKindEvents, 3, at)
+	if err := registry.flush(context.Background()); err == nil {
+		t.Fatal("flush succeeded against an unreachable server")
+	}
+	registry.note("api", sourceKindEvents, 2, at.Add(time.Minute))
+	if err := registry.flush(context.Background()); err == nil {
+		t.Fatal("flush succeeded against an unreachable server")
+	}
+
+	key := sourceTallyKey{source: "api", kind: sourceKindEvents, hour: at.Truncate(time.Hour)}
+	for name, tallies := range map[string]map[sourceTallyKey]*sourceTally{"sources": registry.unsentSources, "volume": registry.unsentVolume} {
+		tally := tallies[key]
+		if tally == nil || tally.count != 5 || !tally.first.Equal(at) || !tally.last.Equal(at.Add(time.Minute)) {
+			t.Errorf("%s tally = %+v, want both notes merged", name, tally)
+		}
+	}
+	if pending := registry.pendingCount(); pending != 2 {
+		t.Errorf("pendingCount = %d, want the kept tally for each collection", pending)
+	}
+}
@@ -0,0 +1,367 @@
+package observer
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// findQuery is the subset of a Mongo find the ingest and read handlers use.
+// A zero limit returns every match.
+type findQuery struct {
+	filter     bson.M
+	sort       bson.D
+	limit      int64
+	projection bson.M
+}
+
+// documentStore holds one kind of observer document. Filters use the Mongo
+// query syntax produced by the handlers and the q= language; findOne returns
+// mongo.ErrNoDocuments when nothing matches.
+type documentStore interface {
+	insertOne(ctx context.Context, doc bson.M) (any, error)
+	insertMany(ctx context.Context, docs []any) error
+	find(ctx context.Context, query findQuery) ([]bson.M, error)
+	findOne(ctx context.Context, query findQuery) (bson.M, error)
+	count(ctx context.Context, filter bson.M) (int64, error)
+	// each hands matches to fn in query order and stops at the first error
+	// fn returns.
+	each(ctx context.Context, query findQuery, fn func(bson.M) error) error
+	// upsert applies set to the first match, or inserts the equality fields
+	// of filter plus setOnInsert and set when nothing matches.
+	upsert(ctx context.Context, filter, set, setOnInsert bson.M) error
+}
+
+// eventBucket is one category/level/type group of the summary; Count is
+// weighted by sampleWeight and Stored counts documents.
+type eventBucket struct {
+	Category string
+	Level    string
+	Type     string
+	Count    float64
+	Stored   int64
+	LatestAt time.Time
+}
+
+type eventRepository interface {
+	documentStore
+	// summarize groups matching events, largest weighted count first.
+	summarize(ctx context.Context, match bson.M, limit int) ([]eventBucket, error)
+	// estimate returns the weighted event count alongside the stored count.
+	estimate(ctx context.Context, match bson.M) (int64, int64, error)
+}
+
+type runtimeRepository interface {
+	documentStore
+}
+
+type backupRepository interface {
+	documentStore
+}
+
+type liveDeviceRepository interface {
+	documentStore
+}
+
+// probeUptime is one probe's checks in a window. The latency figures cover
+// successful checks only, and Series stays empty unless a bucket is given.
+type probeUptime struct {
+	Probe        string
+	Checks       int64
+	Up           int64
+	AvgLatencyMs float64
+	P95LatencyMs float64
+	MaxLatencyMs float64
+	LastDownAt   time.Time
+	Series       []probeUptimeBucket
+}
+
+type probeUptimeBucket struct {
+	Start  time.Time
+	Checks int64
+	Up     int64
+}
+
+type probeRepository interface {
+	documentStore
+	// uptime groups matching checks per probe, with per-bucket counts when
+	// bucket is positive.
+	uptime(ctx context.Context, match bson.M, bucket time.Duration) ([]probeUptime, error)
+}
+
+// storage is what the ingest and read handlers persist through. Features
+// that lean on Mongo-only machinery (aggregations for traces and trends,
+// issue tracking, archiving, retention backfill) still use the service's
+// collections directly.
+type storage struct {
+	events      eventRepository
+	runtime     runtimeRepository
+	backups     backupRepository
+	liveDevices liveDeviceRepository
+	probes      probeRepository
+}
+
+func newMongoStorage(db *mongo.Database) storage {
+	return storage{
+		events:      mongoEventRepository{mongoDocuments{col: db.Collection(eventsCollection)}},
+		runtime:     mongoDocuments{col: db.Collection(runtimeCollection)},
+		backups:     mongoDocuments{col: db.Collection(backupCollection)},
+		liveDevices: mongoDocuments{col: db.Collection(liveDevicesCollection)},
+		probes:      mongoProbeRepository{mongoDocuments{col: db.Collection(probeResultsCollection)}},
+	}
+}
+
+type mongoDocuments struct {
+	col *mongo.Collection
+}
+
+func (m mongoDocuments) insertOne(ctx context.Context, doc bson.M) (any, error) {
+	result, err := m.col.InsertOne(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	return result.InsertedID, nil
+}
+
+func (m mongoDocuments) insertMany(ctx context.Context, docs []any) error {
+	_, err := m.col.InsertMany(ctx, docs)
+	return err
+}
+
+func mongoFindOptions(query findQuery) *options.FindOptions {
+	findOptions := options.Find()
+	if len(query.sort) > 0 {
+		findOptions.SetSort(query.sort)
+	}
+	if query.limit > 0 {
+		findOptions.SetLimit(query.limit)
+	}
+	if len(query.projection) > 0 {
+		findOptions.SetProjection(query.projection)
+	}
+	return findOptions
+}
+
+func (m mongoDocuments) find(ctx context.Context, query findQuery) ([]bson.M, error) {
+	cursor, err := m.col.Find(ctx, query.filter, mongoFindOptions(query))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []bson.M
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// each decodes one document at a time off the cursor, so a long export
+// never holds the whole result.
+func (m mongoDocuments) each(ctx context.Context, query findQuery, fn func(bson.M) error) error {
+	cursor, err := m.col.Find(ctx, query.filter, mongoFindOptions(query))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var row bson.M
+		if err := cursor.Decode(&row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (m mongoDocuments) findOne(ctx context.Context, query findQuery) (bson.M, error) {
+	findOptions := options.FindOne()
+	if len(query.sort) > 0 {
+		findOptions.SetSort(query.sort)
+	}
+	if len(query.projection) > 0 {
+		findOptions.SetProjection(query.projection)
+	}
+	var row bson.M
+	if err := m.col.FindOne(ctx, query.filter, findOptions).Decode(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+func (m mongoDocuments) count(ctx context.Context, filter bson.M) (int64, error) {
+	return m.col.CountDocuments(ctx, filter)
+}
+
+func (m mongoDocuments) upsert(ctx context.Context, filter, set, setOnInsert bson.M) error {
+	update := bson.M{"$set": set}
+	if len(setOnInsert) > 0 {
+		update["$setOnInsert"] = setOnInsert
+	}
+	_, err := m.col.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+type mongoEventRepository struct {
+	mongoDocuments
+}
+
+func (m mongoEventRepository) summarize(ctx context.Context, match bson.M, limit int) ([]eventBucket, error) {
+	cursor, err := m.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"category": "$category", "level": "$level", "type": "$type"},
+			"count":    bson.M{"$sum": sampleWeightExpr},
+			"stored":   bson.M{"$sum": 1},
+			"latestAt": bson.M{"$max": "$occurredAt"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "latestAt", Value: -1}}}},
+		{{Key: "$limit", Value: limit}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ID struct {
+			Category string `bson:"category"`
+			Level    string `bson:"level"`
+			Type     string `bson:"type"`
+		} `bson:"_id"`
+		Count    float64   `bson:"count"`
+		Stored   int64     `bson:"stored"`
+		LatestAt time.Time `bson:"latestAt"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	buckets := make([]eventBucket, 0, len(rows))
+	for _, row := range rows {
+		buckets = append(buckets, eventBucket{
+			Category: row.ID.Category,
+			Level:    row.ID.Level,
+			Type:     row.ID.Type,
+			Count:    row.Count,
+			Stored:   row.Stored,
+			LatestAt: row.LatestAt,
+		})
+	}
+	return buckets, nil
+}
+
+func (m mongoEventRepository) estimate(ctx context.Context, match bson.M) (int64, int64, error) {
+	cursor, err := m.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "estimated": bson.M{"$sum": sampleWeightExpr}, "stored": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cursor.Close(ctx)
+	var rows []bson.M
+	if err := cursor.All(ctx, &rows); err != nil {
+		return 0, 0, err
+	}
+	if len(rows) == 0 {
+		return 0, 0, nil
+	}
+	return int64(math.Round(asFloat(rows[0]["estimated"]))), int64(asFloat(rows[0]["stored"])), nil
+}
+
+type mongoProbeRepository struct {
+	mongoDocuments
+}
+
+func (m mongoProbeRepository) uptime(ctx context.Context, match bson.M, bucket time.Duration) ([]probeUptime, error) {
+	isUp := bson.M{"$eq": bson.A{"$up", true}}
+	upLatency := bson.M{"$cond": bson.A{isUp, "$latencyMs", nil}}
+	cursor, err := m.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":          "$probe",
+			"checks":       bson.M{"$sum": 1},
+			"up":           bson.M{"$sum": bson.M{"$cond": bson.A{isUp, 1, 0}}},
+			"avgLatencyMs": bson.M{"$avg": upLatency},
+			"p95LatencyMs": bson.M{"$percentile": bson.M{"input": upLatency, "p": bson.A{0.95}, "method": "approximate"}},
+			"maxLatencyMs": bson.M{"$max": upLatency},
+			"lastDownAt":   bson.M{"$max": bson.M{"$cond": bson.A{isUp, nil, "$checkedAt"}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Probe        string    `bson:"_id"`
+		Checks       int64     `bson:"checks"`
+		Up           int64     `bson:"up"`
+		AvgLatencyMs float64   `bson:"avgLatencyMs"`
+		P95LatencyMs []float64 `bson:"p95LatencyMs"`
+		MaxLatencyMs float64   `bson:"maxLatencyMs"`
+		LastDownAt   time.Time `bson:"lastDownAt"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	summaries := make([]probeUptime, 0, len(rows))
+	index := map[string]int{}
+	for _, row := range rows {
+		summary := probeUptime{
+			Probe:        row.Probe,
+			Checks:       row.Checks,
+			Up:           row.Up,
+			AvgLatencyMs: row.AvgLatencyMs,
+			MaxLatencyMs: row.MaxLatencyMs,
+			LastDownAt:   row.LastDownAt,
+		}
+		if len(row.P95LatencyMs) > 0 {
+			summary.P95LatencyMs = row.P95LatencyMs[0]
+		}
+		index[row.Probe] = len(summaries)
+		summaries = append(summaries, summary)
+	}
+	if bucket <= 0 || len(summaries) == 0 {
+		return summaries, nil
+	}
+
+	cursor, err = m.col.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"probe": "$probe",
+				"t":     bson.M{"$dateTrunc": bson.M{"date": "$checkedAt", "unit": "minute", "binSize": int(bucket / time.Minute)}},
+			},
+			"checks": bson.M{"$sum": 1},
+			"up":     bson.M{"$sum": bson.M{"$cond": bson.A{isUp, 1, 0}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.t", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var buckets []struct {
+		ID struct {
+			Probe string    `bson:"probe"`
+			Start time.Time `bson:"t"`
+		} `bson:"_id"`
+		Checks int64 `bson:"checks"`
+		Up     int64 `bson:"up"`
+	}
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, err
+	}
+	for _, row := range buckets {
+		if position, ok := index[row.ID.Probe]; ok {
+			summaries[position].Series = append(summaries[position].Series, probeUptimeBucket{Start: row.ID.Start.UTC(), Checks: row.Checks, Up: row.Up})
+		}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,289 @@
+package observer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// boltStore keeps the storage collections and the ingest quota ledger in one
+// bbolt file for single-box deployments without MongoDB. Each collection is a
+// bucket of BSON documents keyed by _id; queries scan the bucket with the same
+// matcher as the memory store, which is fine at the volumes a small venue
+// produces.
+// A sweeper stands in for Mongo's TTL indexes by deleting documents whose
+// expireAt has passed.
+type boltStore struct {
+	db *bolt.DB
+}
+
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltCollections {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create bolt buckets: %w", err)
+	}
+	return &boltStore{db: db}, nil
+}
+
+var boltCollections = []string{eventsCollection, runtimeCollection, backupCollection, liveDevicesCollection, probeResultsCollection, ingestQuotaCollection}
+
+func (b *boltStore) storage() storage {
+	return storage{
+		events:      boltEventRepository{b.collection(eventsCollection)},
+		runtime:     b.collection(runtimeCollection),
+		backups:     b.collection(backupCollection),
+		liveDevices: b.collection(liveDevicesCollection),
+		probes:      boltProbeRepository{b.collection(probeResultsCollection)},
+	}
+}
+
+func (b *boltStore) collection(name string) boltDocuments {
+	return boltDocuments{db: b.db, bucket: []byte(name)}
+}
+
+// ping opens a read transaction and checks every bucket is present.
+func (b *boltStore) ping() error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		for _, name := range boltCollections {
+			if tx.Bucket([]byte(name)) == nil {
+				return fmt.Errorf("bolt store: bucket %s is missing", name)
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltStore) close() error {
+	return b.db.Close()
+}
+
+// runSweeper deletes expired documents every interval until ctx is done.
+func (b *boltStore) runSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := b.sweep(time.Now().UTC())
+			if err != nil {
+				log.Printf("observer bolt sweep error: %v", err)
+			} else if removed > 0 {
+				log.Printf("observer bolt sweep removed %d expired documents", removed)
+			}
+		}
+	}
+}
+
+func (b *boltStore) sweep(now time.Time) (int, error) {
+	removed := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltCollections {
+			bucket := tx.Bucket([]byte(name))
+			expired := make([][]byte, 0)
+			err := bucket.ForEach(func(key, raw []byte) error {
+				value, err := bson.Raw(raw).LookupErr("expireAt")
+				if err != nil {
+					return nil
+				}
+				if expireAt, ok := value.DateTimeOK(); ok && !time.UnixMilli(expireAt).After(now) {
+					expired = append(expired, append([]byte(nil), key...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, key := range expired {
+				if err := bucket.Delete(key); err != nil {
+					return err
+				}
+			}
+			removed += len(expired)
+		}
+		return nil
+	})
+	return removed, err
+}
+
+type boltDocuments struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+func boltKey(id any) []byte {
+	if oid, ok := id.(primitive.ObjectID); ok {
+		return []byte(oid.Hex())
+	}
+	return []byte(formatID(id))
+}
+
+func (b boltDocuments) insertOne(_ context.Context, doc bson.M) (any, error) {
+	var id any
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		id, err = b.put(tx.Bucket(b.bucket), doc, true)
+		return err
+	})
+	return id, err
+}
+
+func (b boltDocuments) insertMany(_ context.Context, docs []any) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.bucket)
+		for _, item := range docs {
+			doc, ok := item.(bson.M)
+			if !ok {
+				return fmt.Errorf("bolt store: unsupported document type %T", item)
+			}
+			if _, err := b.put(bucket, doc, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// put writes doc under its _id, adding one when missing. Inserts refuse to
+// overwrite, matching Mongo's duplicate key error.
+func (b boltDocuments) put(bucket *bolt.Bucket, doc bson.M, insert bool) (any, error) {
+	stored, id := withDocumentID(doc)
+	key := boltKey(id)
+	if insert && bucket.Get(key) != nil {
+		return nil, fmt.Errorf("bolt store: duplicate _id %s in %s", key, b.bucket)
+	}
+	raw, err := bson.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+	return id, bucket.Put(key, raw)
+}
+
+func (b boltDocuments) find(_ context.Context, query findQuery) ([]bson.M, error) {
+	rows := make([]bson.M, 0)
+	err := b.scan(query.filter, func(row bson.M) {
+		rows = append(rows, row)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortAndLimitRows(rows, query), nil
+}
+
+// each sorts before handing rows out, so unlike scan it holds every match.
+func (b boltDocuments) each(ctx context.Context, query findQuery, fn func(bson.M) error) error {
+	rows, err := b.find(ctx, query)
+	if err != nil {
+		return err
+	}
+	return eachRow(rows, fn)
+}
+
+// scan decodes the bucket one document at a time and hands each match to
+// fn, so callers that only aggregate never hold the whole result.
+func (b boltDocuments) scan(filter bson.M, fn func(row bson.M)) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.bucket).ForEach(func(_, raw []byte) error {
+			var row bson.M
+			if err := bson.Unmarshal(raw, &row); err != nil {
+				return err
+			}
+			if matchDocument(row, filter) {
+				fn(row)
+			}
+			return nil
+		})
+	})
+}
+
+func (b boltDocuments) findOne(ctx context.Context, query findQuery) (bson.M, error) {
+	query.limit = 1
+	rows, err := b.find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return rows[0], nil
+}
+
+func (b boltDocuments) count(ctx context.Context, filter bson.M) (int64, error) {
+	rows, err := b.find(ctx, findQuery{filter: filter})
+	return int64(len(rows)), err
+}
+
+func (b boltDocuments) upsert(_ context.Context, filter, set, setOnInsert bson.M) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.bucket)
+		cursor := bucket.Cursor()
+		for key, raw := cursor.First(); key != nil; key, raw = cursor.Next() {
+			var row bson.M
+			if err := bson.Unmarshal(raw, &row); err != nil {
+				return err
+			}
+			if !matchDocument(row, filter) {
+				continue
+			}
+			for path, value := range set {
+				setPath(row, path, value)
+			}
+			_, err := b.put(bucket, row, false)
+			return err
+		}
+		_, err := b.put(bucket, upsertDocument(filter, set, setOnInsert), true)
+		return err
+	})
+}
+
+type boltEventRepository struct {
+	boltDocuments
+}
+
+func (b boltEventRepository) summarize(ctx context.Context, match bson.M, limit int) ([]eventBucket, error) {
+	rows, err := b.find(ctx, findQuery{filter: match})
+	if err != nil {
+		return nil, err
+	}
+	return summarizeEventRows(rows, limit), nil
+}
+
+func (b boltEventRepository) estimate(ctx context.Context, match bson.M) (int64, int64, error) {
+	rows, err := b.find(ctx, findQuery{filter: match})
+	if err != nil {
+		return 0, 0, err
+	}
+	estimated, stored := estimateEventRows(rows)
+	return estimated, stored, nil
+}
+
+type boltProbeRepository struct {
+	boltDocuments
+}
+
+func (b boltProbeRepository) uptime(_ context.Context, match bson.M, bucket time.Duration) ([]probeUptime, error) {
+	tally := newProbeUptimeTally(bucket)
+	if err := b.scan(match, tally.add); err != nil {
+		return nil, err
+	}
+	return tally.result(), nil
+}
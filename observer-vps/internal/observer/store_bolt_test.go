@@ -0,0 +1,125 @@
+package observer
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// newBoltTestService builds the service the way Run does with
+// OBSERVER_STORAGE=bolt: no Mongo client at all.
+func newBoltTestService(t *testing.T) (*service, http.Handler) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("NODE_ENV", "test")
+	t.Setenv("MONGO_URI", "")
+	t.Setenv("OBSERVER_API_KEY", testObserverKey)
+	t.Setenv("OBSERVER_STORAGE", storageBolt)
+	t.Setenv("OBSERVER_BOLT_PATH", filepath.Join(t.TempDir(), "observer.db"))
+
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	bolt, err := openBoltStore(cfg.BoltPath)
+	if err != nil {
+		t.Fatalf("open bolt: %v", err)
+	}
+	t.Cleanup(func() { _ = bolt.close() })
+	svc, err := newService(cfg, nil)
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	svc.attachBolt(bolt)
+	engine := gin.New()
+	svc.registerRoutes(engine)
+	return svc, engine
+}
+
+func TestBoltServiceRunsWithoutMongo(t *testing.T) {
+	svc, handler := newBoltTestService(t)
+
+	code, body := doJSON(t, handler, http.MethodPost, "/api/observer/ingest/events", gin.H{
+		"source": "venue-box",
+		"events": []gin.H{
+			{"category": "http", "type": "request", "level": "error", "statusCode": 500},
+			{"category": "http", "type": "request", "level": "info"},
+		},
+	})
+	if code != http.StatusOK || body["accepted"] != float64(2) {
+		t.Fatalf("ingest = %d %v", code, body)
+	}
+	for _, state := range []string{"connecting", "live"} {
+		code, body = doJSON(t, handler, http.MethodPost, "/api/observer/ingest/live-devices/heartbeat", gin.H{
+			"source":   "venue-box",
+			"deviceId": "court-1",
+			"status":   gin.H{"stream": gin.H{"state": state}},
+		})
+		if code != http.StatusOK {
+			t.Fatalf("heartbeat = %d %v", code, body)
+		}
+	}
+	if count, err := svc.store.liveDevices.count(context.Background(), bson.M{}); err != nil || count != 1 {
+		t.Fatalf("devices = %d (%v), want one upserted device", count, err)
+	}
+
+	code, body = doJSON(t, handler, http.MethodGet, "/api/observer/read/summary?source=venue-box", nil)
+	if code != http.StatusOK {
+		t.Fatalf("summary = %d %v", code, body)
+	}
+	events := toMap(body["events"])
+	if events["totalRecentEvents"] != float64(2) || events["errorRecentEvents"] != float64(1) {
+		t.Errorf("summary events = %v", events)
+	}
+	if counts := toMap(toMap(body["liveDevices"])["counts"]); counts["live"] != float64(1) {
+		t.Errorf("live device counts = %v", counts)
+	}
+
+	code, body = doJSON(t, handler, http.MethodGet, "/api/observer/read/issues", nil)
+	if code != http.StatusNotImplemented {
+		t.Errorf("issues on bolt = %d %v, want 501", code, body)
+	}
+}
+
+func TestBoltSweepRemovesExpiredDocuments(t *testing.T) {
+	bolt, err := openBoltStore(filepath.Join(t.TempDir(), "observer.db"))
+	if err != nil {
+		t.Fatalf("open bolt: %v", err)
+	}
+	defer bolt.close()
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := bolt.storage()
+
+	docs := []any{
+		bson.M{"source": "a", "expireAt": now.Add(-time.Minute)},
+		bson.M{"source": "b", "expireAt": now.Add(time.Hour)},
+		bson.M{"source": "c"},
+	}
+	if err := store.events.insertMany(ctx, docs); err != nil {
+		t.Fatalf("insert events: %v", err)
+	}
+	if _, err := store.runtime.insertOne(ctx, bson.M{"source": "a", "expireAt": now}); err != nil {
+		t.Fatalf("insert runtime: %v", err)
+	}
+
+	removed, err := bolt.sweep(now)
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed %d, want the expired event and runtime snapshot", removed)
+	}
+	rows, err := store.events.find(ctx, findQuery{sort: bson.D{{Key: "source", Value: 1}}})
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["source"] != "b" || rows[1]["source"] != "c" {
+		t.Errorf("remaining events = %v, want b and c", rows)
+	}
+}
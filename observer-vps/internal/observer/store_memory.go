@@ -0,0 +1,763 @@
+package observer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// newMemoryStorage keeps every document in process. It backs the handler
+// tests and single-node runs without Mongo; nothing expires and projections
+// are ignored, so rows always come back whole.
+func newMemoryStorage() storage {
+	return storage{
+		events:      &memoryEventRepository{memoryDocuments: &memoryDocuments{}},
+		runtime:     &memoryDocuments{},
+		backups:     &memoryDocuments{},
+		liveDevices: &memoryDocuments{},
+		probes:      &memoryProbeRepository{memoryDocuments: &memoryDocuments{}},
+	}
+}
+
+// memoryDocuments stores each document BSON-encoded so reads see the same
+// types a Mongo cursor would decode (primitive.DateTime, bson.A, int32)
+// and callers cannot mutate stored rows.
+type memoryDocuments struct {
+	mu   sync.RWMutex
+	rows [][]byte
+}
+
+func (m *memoryDocuments) insertOne(_ context.Context, doc bson.M) (any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.insertLocked(doc)
+}
+
+func (m *memoryDocuments) insertMany(_ context.Context, docs []any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, item := range docs {
+		doc, ok := item.(bson.M)
+		if !ok {
+			return fmt.Errorf("memory store: unsupported document type %T", item)
+		}
+		if _, err := m.insertLocked(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertLocked adds an _id when the document has none. Callers hold m.mu.
+func (m *memoryDocuments) insertLocked(doc bson.M) (any, error) {
+	stored, id := withDocumentID(doc)
+	raw, err := bson.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+	m.rows = append(m.rows, raw)
+	return id, nil
+}
+
+// withDocumentID copies doc and gives the copy an ObjectID when it has no
+// _id, the way the Mongo driver does on insert.
+func withDocumentID(doc bson.M) (bson.M, any) {
+	id, ok := doc["_id"]
+	if !ok {
+		id = primitive.NewObjectID()
+	}
+	stored := bson.M{"_id": id}
+	for key, value := range doc {
+		stored[key] = value
+	}
+	return stored, id
+}
+
+func (m *memoryDocuments) find(_ context.Context, query findQuery) ([]bson.M, error) {
+	m.mu.RLock()
+	rows, err := m.matchLocked(query.filter)
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return sortAndLimitRows(rows, query), nil
+}
+
+func sortAndLimitRows(rows []bson.M, query findQuery) []bson.M {
+	sortMemoryRows(rows, query.sort)
+	if query.limit > 0 && int64(len(rows)) > query.limit {
+		rows = rows[:query.limit]
+	}
+	return rows
+}
+
+func (m *memoryDocuments) findOne(ctx context.Context, query findQuery) (bson.M, error) {
+	query.limit = 1
+	rows, err := m.find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return rows[0], nil
+}
+
+func (m *memoryDocuments) each(ctx context.Context, query findQuery, fn func(bson.M) error) error {
+	rows, err := m.find(ctx, query)
+	if err != nil {
+		return err
+	}
+	return eachRow(rows, fn)
+}
+
+func eachRow(rows []bson.M, fn func(bson.M) error) error {
+	for _, row := range rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryDocuments) count(_ context.Context, filter bson.M) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rows, err := m.matchLocked(filter)
+	return int64(len(rows)), err
+}
+
+func (m *memoryDocuments) upsert(_ context.Context, filter, set, setOnInsert bson.M) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for index, raw := range m.rows {
+		var row bson.M
+		if err := bson.Unmarshal(raw, &row); err != nil {
+			return err
+		}
+		if !matchDocument(row, filter) {
+			continue
+		}
+		for key, value := range set {
+			setPath(row, key, value)
+		}
+		updated, err := bson.Marshal(row)
+		if err != nil {
+			return err
+		}
+		m.rows[index] = updated
+		return nil
+	}
+
+	_, err := m.insertLocked(upsertDocument(filter, set, setOnInsert))
+	return err
+}
+
+// upsertDocument builds the document an upsert inserts: the equality fields
+// of filter, then setOnInsert, then set.
+func upsertDocument(filter, set, setOnInsert bson.M) bson.M {
+	doc := bson.M{}
+	for key, value := range filter {
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		if nested, ok := value.(bson.M); ok && hasOperatorKeys(nested) {
+			continue
+		}
+		setPath(doc, key, value)
+	}
+	for key, value := range setOnInsert {
+		setPath(doc, key, value)
+	}
+	for key, value := range set {
+		setPath(doc, key, value)
+	}
+	return doc
+}
+
+// matchLocked decodes every stored row matching filter. Callers hold m.mu.
+func (m *memoryDocuments) matchLocked(filter bson.M) ([]bson.M, error) {
+	rows := make([]bson.M, 0)
+	for _, raw := range m.rows {
+		var row bson.M
+		if err := bson.Unmarshal(raw, &row); err != nil {
+			return nil, err
+		}
+		if matchDocument(row, filter) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+type memoryEventRepository struct {
+	*memoryDocuments
+}
+
+func (m *memoryEventRepository) summarize(ctx context.Context, match bson.M, limit int) ([]eventBucket, error) {
+	rows, err := m.find(ctx, findQuery{filter: match})
+	if err != nil {
+		return nil, err
+	}
+	return summarizeEventRows(rows, limit), nil
+}
+
+func (m *memoryEventRepository) estimate(ctx context.Context, match bson.M) (int64, int64, error) {
+	rows, err := m.find(ctx, findQuery{filter: match})
+	if err != nil {
+		return 0, 0, err
+	}
+	estimated, stored := estimateEventRows(rows)
+	return estimated, stored, nil
+}
+
+// summarizeEventRows is the summary $group stage for backends that scan
+// documents themselves.
+func summarizeEventRows(rows []bson.M, limit int) []eventBucket {
+	groups := map[[3]string]*eventBucket{}
+	buckets := make([]*eventBucket, 0)
+	for _, row := range rows {
+		key := [3]string{asString(row["category"]), asString(row["level"]), asString(row["type"])}
+		bucket := groups[key]
+		if bucket == nil {
+			bucket = &eventBucket{Category: key[0], Level: key[1], Type: key[2]}
+			groups[key] = bucket
+			buckets = append(buckets, bucket)
+		}
+		bucket.Count += memorySampleWeight(row)
+		bucket.Stored++
+		if occurredAt, ok := memoryTime(row["occurredAt"]); ok && occurredAt.After(bucket.LatestAt) {
+			bucket.LatestAt = occurredAt
+		}
+	}
+	sort.SliceStable(buckets, func(i, j int) bool {
+		if buckets[i].Count != buckets[j].Count {
+			return buckets[i].Count > buckets[j].Count
+		}
+		return buckets[i].LatestAt.After(buckets[j].LatestAt)
+	})
+	out := make([]eventBucket, 0, minInt(len(buckets), limit))
+	for _, bucket := range buckets[:minInt(len(buckets), limit)] {
+		out = append(out, *bucket)
+	}
+	return out
+}
+
+func estimateEventRows(rows []bson.M) (int64, int64) {
+	estimated := 0.0
+	for _, row := range rows {
+		estimated += memorySampleWeight(row)
+	}
+	return int64(math.Round(estimated)), int64(len(rows))
+}
+
+type memoryProbeRepository struct {
+	*memoryDocuments
+}
+
+func (m *memoryProbeRepository) uptime(ctx context.Context, match bson.M, bucket time.Duration) ([]probeUptime, error) {
+	rows, err := m.find(ctx, findQuery{filter: match})
+	if err != nil {
+		return nil, err
+	}
+	tally := newProbeUptimeTally(bucket)
+	for _, row := range rows {
+		tally.add(row)
+	}
+	return tally.result(), nil
+}
+
+// probeUptimeTally is the uptime $group stage for backends that scan
+// documents themselves. Only the latencies of successful checks are kept,
+// for the p95.
+type probeUptimeTally struct {
+	bucket    time.Duration
+	probes    map[string]*probeUptime
+	latencies map[string][]float64
+	series    map[string]map[time.Time]*probeUptimeBucket
+}
+
+func newProbeUptimeTally(bucket time.Duration) *probeUptimeTally {
+	return &probeUptimeTally{
+		bucket:    bucket,
+		probes:    map[string]*probeUptime{},
+		latencies: map[string][]float64{},
+		series:    map[string]map[time.Time]*probeUptimeBucket{},
+	}
+}
+
+func (t *probeUptimeTally) add(row bson.M) {
+	name := asString(row["probe"])
+	summary := t.probes[name]
+	if summary == nil {
+		summary = &probeUptime{Probe: name}
+		t.probes[name] = summary
+		t.series[name] = map[time.Time]*probeUptimeBucket{}
+	}
+	checkedAt, _ := memoryTime(row["checkedAt"])
+	up := row["up"] == true
+	summary.Checks++
+	if up {
+		summary.Up++
+		t.latencies[name] = append(t.latencies[name], asFloat(row["latencyMs"]))
+	} else if checkedAt.After(summary.LastDownAt) {
+		summary.LastDownAt = checkedAt
+	}
+	if t.bucket <= 0 {
+		return
+	}
+	start := probeBucketStart(checkedAt, t.bucket)
+	entry := t.series[name][start]
+	if entry == nil {
+		entry = &probeUptimeBucket{Start: start}
+		t.series[name][start] = entry
+	}
+	entry.Checks++
+	if up {
+		entry.Up++
+	}
+}
+
+func (t *probeUptimeTally) result() []probeUptime {
+	summaries := make([]probeUptime, 0, len(t.probes))
+	for name, summary := range t.probes {
+		if latencies := t.latencies[name]; len(latencies) > 0 {
+			sort.Float64s(latencies)
+			sum := 0.0
+			for _, latency := range latencies {
+				sum += latency
+			}
+			summary.AvgLatencyMs = sum / float64(len(latencies))
+			summary.P95LatencyMs = latencies[(len(latencies)*95+99)/100-1]
+			summary.MaxLatencyMs = latencies[len(latencies)-1]
+		}
+		for _, entry := range t.series[name] {
+			summary.Series = append(summary.Series, *entry)
+		}
+		sort.Slice(summary.Series, func(i, j int) bool { return summary.Series[i].Start.Before(summary.Series[j].Start) })
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Probe < summaries[j].Probe })
+	return summaries
+}
+
+// probeBucketStart mirrors $dateTrunc with a minute binSize, which counts
+// bins from 2000-01-01T00:00:00Z.
+func probeBucketStart(at time.Time, bucket time.Duration) time.Time {
+	reference := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	offset := at.Sub(reference)
+	bins := offset / bucket
+	if offset < 0 && offset%bucket != 0 {
+		bins--
+	}
+	return reference.Add(bins * bucket)
+}
+
+// memorySampleWeight mirrors sampleWeightExpr.
+func memorySampleWeight(row bson.M) float64 {
+	if value, ok := row["sampleWeight"]; ok && value != nil {
+		return asFloat(value)
+	}
+	return 1
+}
+
+// matchDocument evaluates the part of the Mongo query language observer
+// builds: implicit and explicit $and, $or, $nor, comparisons, $in, $nin,
+// $ne, $not, $exists, regexes, dotted paths into arrays and a substring
+// approximation of $text over the text-indexed event fields.
+func matchDocument(doc bson.M, filter bson.M) bool {
+	for key, condition := range filter {
+		switch key {
+		case "$and":
+			for _, clause := range toSlice(condition) {
+				if !matchDocument(doc, toMap(clause)) {
+					return false
+				}
+			}
+		case "$or":
+			matched := false
+			for _, clause := range toSlice(condition) {
+				if matchDocument(doc, toMap(clause)) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		case "$nor":
+			for _, clause := range toSlice(condition) {
+				if matchDocument(doc, toMap(clause)) {
+					return false
+				}
+			}
+		case "$text":
+			if !matchText(doc, asString(toMap(condition)["$search"])) {
+				return false
+			}
+		default:
+			if !matchField(lookupValues(doc, key), condition) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchField(values []any, condition any) bool {
+	operators, ok := condition.(bson.M)
+	if !ok || !hasOperatorKeys(operators) {
+		return matchEquals(values, condition)
+	}
+	for operator, operand := range operators {
+		switch operator {
+		case "$eq":
+			if !matchEquals(values, operand) {
+				return false
+			}
+		case "$ne":
+			if matchEquals(values, operand) {
+				return false
+			}
+		case "$in":
+			if !matchAny(values, operand) {
+				return false
+			}
+		case "$nin":
+			if matchAny(values, operand) {
+				return false
+			}
+		case "$exists":
+			if (len(values) > 0) != asBool(operand) {
+				return false
+			}
+		case "$not":
+			if matchField(values, operand) {
+				return false
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			if !matchCompare(values, operator, operand) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(values []any, candidates any) bool {
+	for _, candidate := range toSlice(candidates) {
+		if matchEquals(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchEquals treats a nil operand like Mongo does: it matches a missing
+// field as well as an explicit null.
+func matchEquals(values []any, operand any) bool {
+	if operand == nil && len(values) == 0 {
+		return true
+	}
+	regex, isRegex := operand.(primitive.Regex)
+	for _, value := range expandArrays(values) {
+		if isRegex {
+			if text, ok := value.(string); ok && matchRegex(regex, text) {
+				return true
+			}
+			continue
+		}
+		if order, ok := compareValues(value, operand); ok && order == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCompare(values []any, operator string, operand any) bool {
+	for _, value := range expandArrays(values) {
+		order, ok := compareValues(value, operand)
+		if !ok {
+			continue
+		}
+		switch {
+		case operator == "$gt" && order > 0,
+			operator == "$gte" && order >= 0,
+			operator == "$lt" && order < 0,
+			operator == "$lte" && order <= 0:
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegex(regex primitive.Regex, text string) bool {
+	pattern := regex.Pattern
+	if strings.Contains(regex.Options, "i") {
+		pattern = "(?i)" + pattern
+	}
+	compiled, err := regexp.Compile(pattern)
+	return err == nil && compiled.MatchString(text)
+}
+
+// matchText requires every quoted phrase, rejects -negated terms and needs
+// at least one plain term when any are given.
+func matchText(doc bson.M, search string) bool {
+	parts := make([]string, 0)
+	for _, field := range []string{"payload.message", "payload.reasonText", "path", "url", "tags"} {
+		for _, value := range expandArrays(lookupValues(doc, field)) {
+			parts = append(parts, strings.ToLower(asString(value)))
+		}
+	}
+	text := strings.Join(parts, " ")
+
+	search = strings.ToLower(search)
+	for strings.Count(search, `"`) >= 2 {
+		start := strings.Index(search, `"`)
+		end := start + 1 + strings.Index(search[start+1:], `"`)
+		if phrase := strings.TrimSpace(search[start+1 : end]); phrase != "" && !strings.Contains(text, phrase) {
+			return false
+		}
+		search = search[:start] + " " + search[end+1:]
+	}
+	terms := 0
+	matched := false
+	for _, term := range strings.Fields(search) {
+		if negated, ok := strings.CutPrefix(term, "-"); ok {
+			if negated != "" && strings.Contains(text, negated) {
+				return false
+			}
+			continue
+		}
+		terms++
+		if strings.Contains(text, term) {
+			matched = true
+		}
+	}
+	return terms == 0 || matched
+}
+
+// lookupValues resolves a dotted path, fanning out across arrays the way
+// Mongo does. A missing field yields no values.
+func lookupValues(value any, path string) []any {
+	if path == "" {
+		return []any{value}
+	}
+	head, rest, _ := strings.Cut(path, ".")
+	switch typed := value.(type) {
+	case bson.M:
+		next, ok := typed[head]
+		if !ok {
+			return nil
+		}
+		return lookupValues(next, rest)
+	case map[string]any:
+		next, ok := typed[head]
+		if !ok {
+			return nil
+		}
+		return lookupValues(next, rest)
+	case bson.D:
+		return lookupValues(typed.Map(), path)
+	case bson.A:
+		return lookupArray([]any(typed), path)
+	case []any:
+		return lookupArray(typed, path)
+	}
+	return nil
+}
+
+func lookupArray(items []any, path string) []any {
+	out := make([]any, 0)
+	for _, item := range items {
+		out = append(out, lookupValues(item, path)...)
+	}
+	return out
+}
+
+func expandArrays(values []any) []any {
+	out := make([]any, 0, len(values))
+	for _, value := range values {
+		switch typed := value.(type) {
+		case bson.A:
+			out = append(out, typed...)
+		case []any:
+			out = append(out, typed...)
+		case []string:
+			for _, item := range typed {
+				out = append(out, item)
+			}
+		default:
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+func hasOperatorKeys(doc bson.M) bool {
+	for key := range doc {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// compareValues orders numbers, times, strings and booleans against values
+// of the same family; ok is false when the two cannot be compared.
+func compareValues(left, right any) (int, bool) {
+	if left == nil || right == nil {
+		if left == nil && right == nil {
+			return 0, true
+		}
+		return 0, false
+	}
+	if leftTime, ok := memoryTime(left); ok {
+		rightTime, ok := memoryTime(right)
+		if !ok {
+			return 0, false
+		}
+		return leftTime.Compare(rightTime), true
+	}
+	if leftNumber, ok := memoryNumber(left); ok {
+		rightNumber, ok := memoryNumber(right)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case leftNumber < rightNumber:
+			return -1, true
+		case leftNumber > rightNumber:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch typed := left.(type) {
+	case string:
+		other, ok := right.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(typed, other), true
+	case bool:
+		other, ok := right.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case typed == other:
+			return 0, true
+		case !typed:
+			return -1, true
+		}
+		return 1, true
+	case primitive.ObjectID:
+		other, ok := right.(primitive.ObjectID)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(typed.Hex(), other.Hex()), true
+	}
+	return 0, false
+}
+
+func memoryTime(value any) (time.Time, bool) {
+	switch typed := value.(type) {
+	case time.Time:
+		return typed, true
+	case primitive.DateTime:
+		return typed.Time(), true
+	}
+	return time.Time{}, false
+}
+
+func memoryNumber(value any) (float64, bool) {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed), true
+	case int32:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	case float32:
+		return float64(typed), true
+	case float64:
+		return typed, true
+	}
+	return 0, false
+}
+
+// sortMemoryRows applies a Mongo sort spec. $meta keys (text score) are
+// skipped and missing values sort lowest.
+func sortMemoryRows(rows []bson.M, spec bson.D) {
+	if len(spec) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, key := range spec {
+			if _, meta := key.Value.(bson.M); meta {
+				continue
+			}
+			left := firstValue(lookupValues(rows[i], key.Key))
+			right := firstValue(lookupValues(rows[j], key.Key))
+			order, ok := compareValues(left, right)
+			if !ok {
+				order = presenceOrder(left, right)
+			}
+			if order == 0 {
+				continue
+			}
+			if asFloat(key.Value) < 0 {
+				return order > 0
+			}
+			return order < 0
+		}
+		return false
+	})
+}
+
+func firstValue(values []any) any {
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+func presenceOrder(left, right any) int {
+	switch {
+	case left == nil && right != nil:
+		return -1
+	case left != nil && right == nil:
+		return 1
+	}
+	return 0
+}
+
+// setPath writes a dotted $set key, creating intermediate documents.
+func setPath(doc bson.M, path string, value any) {
+	head, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		doc[head] = value
+		return
+	}
+	child, ok := doc[head].(bson.M)
+	if !ok {
+		child = bson.M{}
+		for key, item := range toMap(doc[head]) {
+			child[key] = item
+		}
+		doc[head] = child
+	}
+	setPath(child, rest, value)
+}
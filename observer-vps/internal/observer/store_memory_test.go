@@ -0,0 +1,110 @@
+package observer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMemoryStoreMatchesEventQueries(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := newMemoryStorage().events
+	ctx := context.Background()
+	docs := []any{
+		bson.M{"_id": "a", "source": "api-main", "level": "error", "statusCode": 503, "path": "/api/matches/1", "tags": []string{"db", "slow"}, "occurredAt": now.Add(-time.Minute), "payload": bson.M{"deviceId": "d1", "message": "Mongo timeout on matches"}},
+		bson.M{"_id": "b", "source": "api-main", "level": "info", "statusCode": 200, "path": "/api/users", "tags": []string{}, "occurredAt": now.Add(-2 * time.Hour), "payload": bson.M{"retry": true}},
+		bson.M{"_id": "c", "source": "worker", "level": "warn", "durationMs": 1500.5, "tags": []string{"slow"}, "occurredAt": now.Add(-10 * time.Minute), "payload": bson.M{"message": "queue backlog"}},
+	}
+	if err := store.insertMany(ctx, docs); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	cases := []struct {
+		q    string
+		want []string
+	}{
+		{q: "source:api-*", want: []string{"a", "b"}},
+		{q: "source!=api-*", want: []string{"c"}},
+		{q: "statusCode:5xx", want: []string{"a"}},
+		{q: "level>=warn", want: []string{"a", "c"}},
+		{q: "tags:slow AND NOT level:error", want: []string{"c"}},
+		{q: "occurredAt>-30m", want: []string{"a", "c"}},
+		{q: "durationMs>1000 OR deviceId:d1", want: []string{"a", "c"}},
+		{q: "payload.retry:true", want: []string{"b"}},
+		{q: "payload.retry!=true", want: []string{"a", "c"}},
+		{q: "payload.missing:null", want: []string{"a", "b", "c"}},
+		{q: "(source:worker OR statusCode:200) level!=info", want: []string{"c"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.q, func(t *testing.T) {
+			filter, err := parseEventQuery(tc.q, now)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			rows, err := store.find(ctx, findQuery{filter: filter, sort: bson.D{{Key: "_id", Value: 1}}})
+			if err != nil {
+				t.Fatalf("find: %v", err)
+			}
+			got := make([]string, 0, len(rows))
+			for _, row := range rows {
+				got = append(got, asString(row["_id"]))
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("matched %v, want %v", got, tc.want)
+			}
+			for index := range got {
+				if got[index] != tc.want[index] {
+					t.Fatalf("matched %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+
+	for search, want := range map[string]int64{"timeout": 1, "slow backlog": 2, `"queue backlog"`: 1, "matches -mongo": 0} {
+		count, err := store.count(ctx, bson.M{"$text": bson.M{"$search": search}})
+		if err != nil {
+			t.Fatalf("count %q: %v", search, err)
+		}
+		if count != want {
+			t.Errorf("$text %q matched %d, want %d", search, count, want)
+		}
+	}
+}
+
+func TestMemoryStoreSortLimitAndUpsert(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStorage().liveDevices
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for index, deviceID := range []string{"d1", "d2", "d3"} {
+		err := store.upsert(ctx, bson.M{"source": "app", "deviceId": deviceID}, bson.M{"lastSeenAt": now.Add(time.Duration(index) * time.Minute)}, bson.M{"createdAt": now})
+		if err != nil {
+			t.Fatalf("upsert %s: %v", deviceID, err)
+		}
+	}
+	if err := store.upsert(ctx, bson.M{"source": "app", "deviceId": "d1"}, bson.M{"lastSeenAt": now.Add(time.Hour), "network.type": "wifi"}, bson.M{"createdAt": now.Add(time.Hour)}); err != nil {
+		t.Fatalf("update d1: %v", err)
+	}
+
+	rows, err := store.find(ctx, findQuery{
+		filter: bson.M{"source": "app"},
+		sort:   bson.D{{Key: "lastSeenAt", Value: -1}, {Key: "_id", Value: -1}},
+		limit:  2,
+	})
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["deviceId"] != "d1" || rows[1]["deviceId"] != "d3" {
+		t.Fatalf("rows = %v, want d1 then d3", rows)
+	}
+	if !parseTime(rows[0]["createdAt"]).Equal(now) || toMap(rows[0]["network"])["type"] != "wifi" {
+		t.Errorf("d1 = %v, want createdAt kept and dotted $set applied", rows[0])
+	}
+	if total, _ := store.count(ctx, bson.M{}); total != 3 {
+		t.Errorf("count = %d, want 3", total)
+	}
+	if _, err := store.findOne(ctx, findQuery{filter: bson.M{"deviceId": "missing"}}); err == nil {
+		t.Error("findOne on a missing device succeeded, want mongo.ErrNoDocuments")
+	}
+}
@@ -0,0 +1,433 @@
+package observer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	syslogMaxMessageBytes = 64 * 1024
+	syslogQueueSize       = 10_000
+	syslogFlushBatch      = 200
+	syslogFlushInterval   = time.Second
+	syslogTCPIdleTimeout  = 5 * time.Minute
+)
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+type syslogMessage struct {
+	format         string
+	facility       int
+	severity       int
+	timestamp      time.Time
+	hostname       string
+	appName        string
+	procID         string
+	msgID          string
+	structuredData map[string]any
+	message        string
+}
+
+// syslogReceiver listens for RFC 5424 / RFC 3164 messages over UDP and TCP
+// and writes them to observer_events in small batches.
+type syslogReceiver struct {
+	svc      *service
+	queue    chan bson.M
+	received atomic.Int64
+	dropped  atomic.Int64
+	invalid  atomic.Int64
+}
+
+func (s *service) startSyslog(ctx context.Context) error {
+	if s.cfg.SyslogUDPAddr == "" && s.cfg.SyslogTCPAddr == "" {
+		return nil
+	}
+	receiver := &syslogReceiver{svc: s, queue: make(chan bson.M, syslogQueueSize)}
+	s.syslog = receiver
+
+	if s.cfg.SyslogUDPAddr != "" {
+		conn, err := net.ListenPacket("udp", s.cfg.SyslogUDPAddr)
+		if err != nil {
+			return fmt.Errorf("listen syslog udp: %w", err)
+		}
+		go func() {
+			<-ctx.Done()
+			_ = conn.Close()
+		}()
+		go receiver.serveUDP(conn)
+		log.Printf("observer syslog listening on udp %s", conn.LocalAddr())
+	}
+	if s.cfg.SyslogTCPAddr != "" {
+		listener, err := net.Listen("tcp", s.cfg.SyslogTCPAddr)
+		if err != nil {
+			return fmt.Errorf("listen syslog tcp: %w", err)
+		}
+		go func() {
+			<-ctx.Done()
+			_ = listener.Close()
+		}()
+		go receiver.serveTCP(ctx, listener)
+		log.Printf("observer syslog listening on tcp %s", listener.Addr())
+	}
+	go receiver.flushLoop(ctx)
+	return nil
+}
+
+func (r *syslogReceiver) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, syslogMaxMessageBytes)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("observer syslog udp read error: %v", err)
+			continue
+		}
+		r.handle(string(buf[:n]), hostOf(addr))
+	}
+}
+
+func (r *syslogReceiver) serveTCP(ctx context.Context, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("observer syslog tcp accept error: %v", err)
+			continue
+		}
+		go r.serveTCPConn(ctx, conn)
+	}
+}
+
+// serveTCPConn supports both RFC 6587 framings: octet counting ("LEN MSG")
+// and newline-delimited, detected per frame.
+func (r *syslogReceiver) serveTCPConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	peer := hostOf(conn.RemoteAddr())
+	reader := bufio.NewReaderSize(conn, syslogMaxMessageBytes)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(syslogTCPIdleTimeout))
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+		var frame string
+		if first[0] >= '0' && first[0] <= '9' {
+			lengthText, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			length, err := strconv.Atoi(strings.TrimSpace(lengthText))
+			if err != nil || length <= 0 || length > syslogMaxMessageBytes {
+				r.invalid.Add(1)
+				return
+			}
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			frame = string(payload)
+		} else {
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				return
+			}
+			frame = line
+		}
+		r.handle(frame, peer)
+	}
+}
+
+func (r *syslogReceiver) handle(raw, peer string) {
+	raw = strings.TrimRight(raw, "\r\n\x00")
+	if strings.TrimSpace(raw) == "" {
+		return
+	}
+	r.received.Add(1)
+	msg, err := parseSyslog(raw, time.Now().UTC())
+	if err != nil {
+		r.invalid.Add(1)
+		return
+	}
+
+	svc := r.svc
+	host := defaultString(msg.hostname, peer)
+	source := syslogSourceName(svc.cfg.SyslogSourceTemplate, host, msg.appName)
+	charge := newIngestCharge(true)
+	charge.add(source, "", 1)
+	if decision := svc.limits.admit("syslog:"+peer, charge, time.Now().UTC()); !decision.allowed {
+		r.dropped.Add(1)
+		return
+	}
+
+	facility := "unknown"
+	if msg.facility >= 0 && msg.facility < len(syslogFacilities) {
+		facility = syslogFacilities[msg.facility]
+	}
+	doc := svc.buildEventDoc(source, map[string]any{
+		"category":   "syslog_" + facility,
+		"type":       defaultString(msg.msgID, defaultString(msg.appName, "syslog")),
+		"level":      syslogSeverityLevel(msg.severity),
+		"occurredAt": msg.timestamp,
+		"ip":         peer,
+		"tags":       []any{"syslog", facility, msg.appName},
+		"payload": map[string]any{
+			"message":        msg.message,
+			"format":         msg.format,
+			"facility":       facility,
+			"severity":       msg.severity,
+			"hostname":       msg.hostname,
+			"appName":        msg.appName,
+			"procId":         msg.procID,
+			"msgId":          msg.msgID,
+			"structuredData": msg.structuredData,
+			"peer":           peer,
+		},
+	}, time.Now().UTC())
+
+	select {
+	case r.queue <- doc:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+func (r *syslogReceiver) flushLoop(ctx context.Context) {
+	ticker := time.NewTicker(syslogFlushInterval)
+	defer ticker.Stop()
+	batch := make([]any, 0, syslogFlushBatch)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		writeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := r.svc.insertEvents(writeCtx, batch); err != nil {
+			log.Printf("observer syslog flush error: %v", err)
+			r.dropped.Add(int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case doc := <-r.queue:
+					batch = append(batch, doc)
+				default:
+					flush()
+					return
+				}
+			}
+		case doc := <-r.queue:
+			batch = append(batch, doc)
+			if len(batch) >= syslogFlushBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (r *syslogReceiver) stats() map[string]any {
+	if r == nil {
+		return map[string]any{"enabled": false}
+	}
+	return map[string]any{
+		"enabled":  true,
+		"received": r.received.Load(),
+		"dropped":  r.dropped.Load(),
+		"invalid":  r.invalid.Load(),
+		"queued":   len(r.queue),
+	}
+}
+
+func parseSyslog(raw string, now time.Time) (syslogMessage, error) {
+	if !strings.HasPrefix(raw, "<") {
+		return syslogMessage{}, errors.New("missing PRI")
+	}
+	end := strings.IndexByte(raw, '>')
+	if end < 2 || end > 4 {
+		return syslogMessage{}, errors.New("invalid PRI")
+	}
+	pri, err := strconv.Atoi(raw[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return syslogMessage{}, errors.New("invalid PRI")
+	}
+	rest := raw[end+1:]
+	msg := syslogMessage{facility: pri / 8, severity: pri % 8}
+	if strings.HasPrefix(rest, "1 ") {
+		return parseRFC5424(msg, rest[2:], now)
+	}
+	return parseRFC3164(msg, rest, now), nil
+}
+
+func parseRFC5424(msg syslogMessage, rest string, now time.Time) (syslogMessage, error) {
+	msg.format = "rfc5424"
+	fields := make([]string, 0, 5)
+	for len(fields) < 5 {
+		token, remainder, found := strings.Cut(rest, " ")
+		if !found {
+			return msg, errors.New("truncated RFC 5424 header")
+		}
+		fields = append(fields, token)
+		rest = remainder
+	}
+	msg.timestamp = now
+	if fields[0] != "-" {
+		parsed, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return msg, fmt.Errorf("invalid RFC 5424 timestamp: %w", err)
+		}
+		msg.timestamp = parsed.UTC()
+	}
+	msg.hostname = nilValue(fields[1])
+	msg.appName = nilValue(fields[2])
+	msg.procID = nilValue(fields[3])
+	msg.msgID = nilValue(fields[4])
+
+	sd, remainder, err := parseStructuredData(rest)
+	if err != nil {
+		return msg, err
+	}
+	msg.structuredData = sd
+	msg.message = strings.TrimPrefix(strings.TrimPrefix(remainder, " "), "\ufeff")
+	return msg, nil
+}
+
+// parseStructuredData reads "-" or a run of [id key="value" ...] elements.
+func parseStructuredData(rest string) (map[string]any, string, error) {
+	out := map[string]any{}
+	if strings.HasPrefix(rest, "-") {
+		return out, rest[1:], nil
+	}
+	for strings.HasPrefix(rest, "[") {
+		i := 1
+		for i < len(rest) && rest[i] != ' ' && rest[i] != ']' {
+			i++
+		}
+		id := rest[1:i]
+		params := map[string]any{}
+		for i < len(rest) && rest[i] == ' ' {
+			i++
+			eq := strings.IndexByte(rest[i:], '=')
+			if eq < 0 || i+eq+1 >= len(rest) || rest[i+eq+1] != '"' {
+				return nil, "", errors.New("invalid structured data parameter")
+			}
+			name := rest[i : i+eq]
+			i += eq + 2
+			var value strings.Builder
+			for i < len(rest) && rest[i] != '"' {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				value.WriteByte(rest[i])
+				i++
+			}
+			if i >= len(rest) {
+				return nil, "", errors.New("unterminated structured data value")
+			}
+			params[name] = value.String()
+			i++
+		}
+		if i >= len(rest) || rest[i] != ']' {
+			return nil, "", errors.New("unterminated structured data element")
+		}
+		out[id] = params
+		rest = rest[i+1:]
+	}
+	return out, rest, nil
+}
+
+// parseRFC3164 is deliberately lenient: BSD syslog senders disagree on almost
+// every field, so anything that does not parse is left in the message.
+func parseRFC3164(msg syslogMessage, rest string, now time.Time) syslogMessage {
+	msg.format = "rfc3164"
+	msg.timestamp = now
+	if len(rest) >= 15 {
+		if parsed, err := time.Parse(time.Stamp, rest[:15]); err == nil {
+			stamped := time.Date(now.Year(), parsed.Month(), parsed.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0, time.UTC)
+			if stamped.Sub(now) > 24*time.Hour {
+				stamped = stamped.AddDate(-1, 0, 0)
+			}
+			msg.timestamp = stamped
+			rest = strings.TrimPrefix(rest[15:], " ")
+
+			if host, remainder, found := strings.Cut(rest, " "); found && !strings.HasSuffix(host, ":") && !strings.Contains(host, "[") {
+				msg.hostname = host
+				rest = remainder
+			}
+		}
+	}
+
+	if tag, remainder, found := strings.Cut(rest, ":"); found && tag != "" && !strings.ContainsAny(tag, " \t") {
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			msg.procID = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		msg.appName = tag
+		rest = strings.TrimPrefix(remainder, " ")
+	}
+	msg.message = rest
+	msg.structuredData = map[string]any{}
+	return msg
+}
+
+func syslogSeverityLevel(severity int) string {
+	switch {
+	case severity <= 3:
+		return "error"
+	case severity == 4:
+		return "warn"
+	case severity == 7:
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+// syslogSourceName fills {host} and {app} into the configured template.
+func syslogSourceName(template, host, app string) string {
+	replacer := strings.NewReplacer("{host}", defaultString(host, "unknown"), "{app}", defaultString(app, "syslog"))
+	return replacer.Replace(defaultString(template, "{host}"))
+}
+
+func nilValue(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
+func hostOf(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,185 @@
+package observer
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseSyslog(t *testing.T) {
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		raw  string
+		want syslogMessage
+	}{
+		{
+			name: "rfc5424 with structured data",
+			raw:  `<165>1 2026-01-02T09:59:58.5+07:00 vps-1 nginx 812 ACCESS [meta seq="7" note="a \"quoted\" ]"][origin ip="10.0.0.1"] GET /api`,
+			want: syslogMessage{
+				format: "rfc5424", facility: 20, severity: 5,
+				timestamp: time.Date(2026, 1, 2, 2, 59, 58, 500_000_000, time.UTC),
+				hostname:  "vps-1", appName: "nginx", procID: "812", msgID: "ACCESS",
+				structuredData: map[string]any{
+					"meta":   map[string]any{"seq": "7", "note": `a "quoted" ]`},
+					"origin": map[string]any{"ip": "10.0.0.1"},
+				},
+				message: "GET /api",
+			},
+		},
+		{
+			name: "rfc5424 with nil fields and a BOM",
+			raw:  "<11>1 - - mongod - - - \ufeffconnection refused",
+			want: syslogMessage{
+				format: "rfc5424", facility: 1, severity: 3, timestamp: now,
+				appName: "mongod", structuredData: map[string]any{}, message: "connection refused",
+			},
+		},
+		{
+			name: "rfc3164 with host and pid",
+			raw:  "<86>Jan  2 09:58:00 vps-1 sshd[4021]: Accepted publickey for deploy",
+			want: syslogMessage{
+				format: "rfc3164", facility: 10, severity: 6,
+				timestamp: time.Date(2026, 1, 2, 9, 58, 0, 0, time.UTC),
+				hostname:  "vps-1", appName: "sshd", procID: "4021",
+				structuredData: map[string]any{}, message: "Accepted publickey for deploy",
+			},
+		},
+		{
+			name: "rfc3164 from last year",
+			raw:  "<13>Dec 31 23:59:00 vps-1 cron: tick",
+			want: syslogMessage{
+				format: "rfc3164", facility: 1, severity: 5,
+				timestamp: time.Date(2025, 12, 31, 23, 59, 0, 0, time.UTC),
+				hostname:  "vps-1", appName: "cron",
+				structuredData: map[string]any{}, message: "tick",
+			},
+		},
+		{
+			name: "rfc3164 without a header",
+			raw:  "<12>nginx: upstream timed out",
+			want: syslogMessage{
+				format: "rfc3164", facility: 1, severity: 4, timestamp: now,
+				appName: "nginx", structuredData: map[string]any{}, message: "upstream timed out",
+			},
+		},
+		{
+			name: "rfc3164 free text",
+			raw:  "<14>something went wrong: disk full",
+			want: syslogMessage{
+				format: "rfc3164", facility: 1, severity: 6, timestamp: now,
+				structuredData: map[string]any{}, message: "something went wrong: disk full",
+			},
+		},
+	}
+	for _, tc := range cases {
+		got, err := parseSyslog(tc.raw, now)
+		if err != nil {
+			t.Errorf("%s: parse error %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tc.name, got, tc.want)
+		}
+	}
+
+	for _, raw := range []string{
+		"no pri",
+		"<>1 - - - - - -",
+		"<192>overflow",
+		"<13>1 2026-01-02 vps-1 app - - - bad timestamp",
+		"<13>1 - host app",
+		`<13>1 - host app - - [meta seq="7" msg`,
+	} {
+		if _, err := parseSyslog(raw, now); err == nil {
+			t.Errorf("parseSyslog(%q) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestSyslogSeverityAndFacilityMapping(t *testing.T) {
+	levels := map[int]string{0: "error", 1: "error", 2: "error", 3: "error", 4: "warn", 5: "info", 6: "info", 7: "debug"}
+	for severity, want := range levels {
+		if got := syslogSeverityLevel(severity); got != want {
+			t.Errorf("syslogSeverityLevel(%d) = %s, want %s", severity, got, want)
+		}
+	}
+
+	svc, _ := newTestService(t)
+	receiver := &syslogReceiver{svc: svc, queue: make(chan bson.M, 4)}
+	cases := []struct {
+		raw      string
+		source   string
+		category string
+		level    string
+	}{
+		{"<165>1 - vps-1 nginx - ACCESS - GET /", "vps-1-nginx", "syslog_local4", "info"},
+		{"<34>Jan  2 09:58:00 vps-2 sshd[1]: failed", "vps-2-sshd", "syslog_auth", "error"},
+		{"<156>upstream slow", "10.0.0.9-syslog", "syslog_local3", "warn"},
+	}
+	for _, tc := range cases {
+		receiver.handle(tc.raw+"\r\n", "10.0.0.9")
+		doc := <-receiver.queue
+		if doc["source"] != tc.source || doc["category"] != tc.category || doc["level"] != tc.level {
+			t.Errorf("%q stored as source=%v category=%v level=%v, want %s %s %s",
+				tc.raw, doc["source"], doc["category"], doc["level"], tc.source, tc.category, tc.level)
+		}
+	}
+	receiver.handle("garbage", "10.0.0.9")
+	if stats := receiver.stats(); stats["received"] != int64(4) || stats["invalid"] != int64(1) {
+		t.Errorf("stats = %v, want 4 received with 1 invalid", stats)
+	}
+}
+
+func TestSyslogTCPFraming(t *testing.T) {
+	svc, _ := newTestService(t)
+	receiver := &syslogReceiver{svc: svc, queue: make(chan bson.M, 8)}
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		receiver.serveTCPConn(context.Background(), server)
+		close(done)
+	}()
+
+	first := "<13>1 - vps-1 app - - - octet counted\nwith a newline"
+	frames := "" +
+		"52 " + first +
+		"<13>app: newline delimited\n" +
+		"29 <13>1 - vps-1 app - - - again" +
+		"<13>app: last line without newline"
+	go func() {
+		_, _ = client.Write([]byte(frames))
+		_ = client.Close()
+	}()
+	<-done
+
+	want := []string{"octet counted\nwith a newline", "newline delimited", "again", "last line without newline"}
+	if len(receiver.queue) != len(want) {
+		t.Fatalf("queued %d messages, want %d", len(receiver.queue), len(want))
+	}
+	for _, message := range want {
+		doc := <-receiver.queue
+		if got := toMap(doc["payload"])["message"]; got != message {
+			t.Errorf("message = %q, want %q", got, message)
+		}
+	}
+
+	server, client = net.Pipe()
+	done = make(chan struct{})
+	go func() {
+		receiver.serveTCPConn(context.Background(), server)
+		close(done)
+	}()
+	go func() {
+		_, _ = client.Write([]byte("99999999 <13>app: too long"))
+	}()
+	<-done
+	_ = client.Close()
+	if got := receiver.stats()["invalid"]; got != int64(1) {
+		t.Errorf("invalid = %v, want the oversized frame counted", got)
+	}
+}
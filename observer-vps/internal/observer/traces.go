@@ -0,0 +1,220 @@
+package observer
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	traceMaxEvents         = 2000
+	relatedDefaultMinutes  = 30
+	relatedMaxMinutes      = 24 * 60
+	relatedMaxRequests     = 500
+	relatedDefaultRequests = 100
+)
+
+// getTrace returns every event sharing a request id, oldest first. Each event
+// is treated as covering occurredAt..occurredAt+durationMs, so the trace's
+// total duration spans from the earliest start to the latest end.
+func (s *service) getTrace(c *gin.Context) {
+	requestID := strings.TrimSpace(c.Param("requestId"))
+	if requestID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "requestId is required"})
+		return
+	}
+	filter := bson.M{"requestId": requestID}
+	if source := strings.TrimSpace(c.Query("source")); source != "" {
+		filter["source"] = source
+	}
+
+	cursor, err := s.events.Find(
+		c.Request.Context(),
+		filter,
+		options.Find().SetSort(bson.D{{Key: "occurredAt", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(traceMaxEvents),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load trace", "error": err.Error()})
+		return
+	}
+	defer cursor.Close(c.Request.Context())
+	var rows []bson.M
+	if err := cursor.All(c.Request.Context(), &rows); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to decode trace", "error": err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "message": "No events for that request id"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(rows))
+	sources := []string{}
+	seenSources := map[string]bool{}
+	var startedAt, endedAt time.Time
+	var firstError gin.H
+	for _, row := range rows {
+		item := eventItem(row)
+		occurredAt := parseTime(row["occurredAt"])
+		finishedAt := occurredAt.Add(time.Duration(asFloat(row["durationMs"]) * float64(time.Millisecond)))
+		if startedAt.IsZero() || occurredAt.Before(startedAt) {
+			startedAt = occurredAt
+		}
+		if finishedAt.After(endedAt) {
+			endedAt = finishedAt
+		}
+		item["offsetMs"] = occurredAt.Sub(startedAt).Milliseconds()
+		if source := asString(row["source"]); source != "" && !seenSources[source] {
+			seenSources[source] = true
+			sources = append(sources, source)
+		}
+		if firstError == nil && isErrorEvent(row) {
+			firstError = item
+		}
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":              true,
+		"requestId":       requestID,
+		"count":           len(items),
+		"truncated":       len(items) == traceMaxEvents,
+		"sources":         sources,
+		"startedAt":       startedAt,
+		"endedAt":         endedAt,
+		"totalDurationMs": endedAt.Sub(startedAt).Milliseconds(),
+		"firstError":      firstError,
+		"items":           items,
+	})
+}
+
+// listRelatedRequests finds the request ids that touched a device or match in
+// a time window, so a single failing flow can be picked out and opened with
+// getTrace.
+func (s *service) listRelatedRequests(c *gin.Context) {
+	deviceID := strings.TrimSpace(c.Query("deviceId"))
+	matchID := strings.TrimSpace(c.Query("matchId"))
+	if deviceID == "" && matchID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "deviceId or matchId is required"})
+		return
+	}
+
+	now := time.Now().UTC()
+	from, to, err := relatedWindow(c, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "Invalid time window", "error": err.Error()})
+		return
+	}
+
+	subjects := bson.A{}
+	if deviceID != "" {
+		subjects = append(subjects, bson.M{"payload.deviceId": deviceID})
+	}
+	if matchID != "" {
+		subjects = append(subjects, bson.M{"payload.matchId": matchID})
+	}
+	match := bson.M{
+		"$or":        subjects,
+		"occurredAt": bson.M{"$gte": from, "$lte": to},
+		"requestId":  bson.M{"$nin": bson.A{"", nil}},
+	}
+	if source := strings.TrimSpace(c.Query("source")); source != "" {
+		match["source"] = source
+	}
+	limit := clampInt(parseInt(c.DefaultQuery("limit", "100"), relatedDefaultRequests), 1, relatedMaxRequests)
+
+	cursor, err := s.events.Aggregate(c.Request.Context(), mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$requestId",
+			"firstAt": bson.M{"$min": "$occurredAt"},
+			"lastAt":  bson.M{"$max": "$occurredAt"},
+			"count":   bson.M{"$sum": 1},
+			"sources": bson.M{"$addToSet": "$source"},
+			"types":   bson.M{"$addToSet": "$type"},
+			"errors": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$or": bson.A{
+					bson.M{"$eq": bson.A{"$level", "error"}},
+					bson.M{"$gte": bson.A{"$statusCode", 500}},
+				}},
+				1,
+				0,
+			}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "firstAt", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load related requests", "error": err.Error()})
+		return
+	}
+	defer cursor.Close(c.Request.Context())
+	var rows []bson.M
+	if err := cursor.All(c.Request.Context(), &rows); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to decode related requests", "error": err.Error()})
+		return
+	}
+
+	items := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, gin.H{
+			"requestId": asString(row["_id"]),
+			"firstAt":   row["firstAt"],
+			"lastAt":    row["lastAt"],
+			"count":     normalizeIntValue(row["count"]),
+			"errors":    normalizeIntValue(row["errors"]),
+			"sources":   normalizeStringList(row["sources"]),
+			"types":     normalizeStringList(row["types"]),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok":       true,
+		"deviceId": deviceID,
+		"matchId":  matchID,
+		"from":     from,
+		"to":       to,
+		"items":    items,
+	})
+}
+
+// relatedWindow uses from/to when given, otherwise windowMinutes either side
+// of around (default now).
+func relatedWindow(c *gin.Context, now time.Time) (time.Time, time.Time, error) {
+	rawFrom := strings.TrimSpace(c.Query("from"))
+	rawTo := strings.TrimSpace(c.Query("to"))
+	if rawFrom != "" || rawTo != "" {
+		from, to := now.Add(-relatedDefaultMinutes*time.Minute), now
+		var err error
+		if rawFrom != "" {
+			if from, err = parseTimeParam(rawFrom, now); err != nil {
+				return from, to, err
+			}
+		}
+		if rawTo != "" {
+			if to, err = parseTimeParam(rawTo, now); err != nil {
+				return from, to, err
+			}
+		}
+		return from, to, nil
+	}
+
+	around := now
+	if raw := strings.TrimSpace(c.Query("around")); raw != "" {
+		parsed, err := parseTimeParam(raw, now)
+		if err != nil {
+			return now, now, err
+		}
+		around = parsed
+	}
+	window := time.Duration(clampInt(parseInt(c.Query("windowMinutes"), relatedDefaultMinutes), 1, relatedMaxMinutes)) * time.Minute
+	return around.Add(-window), around.Add(window), nil
+}
+
+func isErrorEvent(row bson.M) bool {
+	return asString(row["level"]) == "error" || asFloat(row["statusCode"]) >= 500
+}
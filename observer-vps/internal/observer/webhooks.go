@@ -0,0 +1,802 @@
+package observer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	webhookTriggerError          = "event.error"
+	webhookTriggerDeviceState    = "device.state_changed"
+	webhookTriggerSuspectedCrash = "device.suspected_crash"
+	webhookTriggerBackupFailed   = "backup.failed"
+
+	webhookStatusPending   = "pending"
+	webhookStatusDelivered = "delivered"
+	webhookStatusDead      = "dead"
+
+	webhookBusBuffer         = 4096
+	webhookRefreshInterval   = 15 * time.Second
+	webhookDispatchInterval  = time.Second
+	webhookDispatchWorkers   = 4
+	webhookCrashScanInterval = 15 * time.Second
+	webhookCrashScanWindow   = time.Hour
+	webhookBackoffBase       = 10 * time.Second
+	webhookBackoffMax        = time.Hour
+	webhookAttemptHistory    = 10
+	webhookResponseLimit     = 64 << 10
+	webhookKnownStatesMax    = 50_000
+)
+
+var webhookTriggers = []string{webhookTriggerError, webhookTriggerDeviceState, webhookTriggerSuspectedCrash, webhookTriggerBackupFailed}
+
+type webhook struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Name     string             `bson:"name"`
+	URL      string             `bson:"url"`
+	Secret   string             `bson:"secret"`
+	Triggers []string           `bson:"triggers"`
+	Source   string             `bson:"source"`
+	Query    string             `bson:"query"`
+	Enabled  bool               `bson:"enabled"`
+	// filter is Query parsed by refresh; relative times in it are
+	// resolved against the refresh time.
+	filter bson.M
+}
+
+// wants reports whether the webhook subscribes to trigger for source.
+func (w webhook) wants(trigger, source string) bool {
+	if !w.Enabled || !containsString(w.Triggers, trigger) {
+		return false
+	}
+	return w.Source == "" || w.Source == source
+}
+
+// view leaves out the secret; it is only returned when it is set.
+func (w webhook) view() gin.H {
+	return gin.H{
+		"id":       w.ID.Hex(),
+		"name":     w.Name,
+		"url":      w.URL,
+		"triggers": w.Triggers,
+		"source":   w.Source,
+		"query":    w.Query,
+		"enabled":  w.Enabled,
+	}
+}
+
+type webhookDelivery struct {
+	ID        string             `bson:"_id"`
+	WebhookID primitive.ObjectID `bson:"webhookId"`
+	Webhook   string             `bson:"webhook"`
+	Trigger   string             `bson:"trigger"`
+	Body      string             `bson:"body"`
+	Attempts  int                `bson:"attempts"`
+}
+
+// webhookHub holds the webhook subscriptions and their delivery queue.
+//
+// Every replica matches the changes it sees on the change bus against the
+// subscriptions and queues a delivery under an id derived from the webhook,
+// the trigger and the change, so replicas that see the same change queue it
+// once. The leader sends the queue: each delivery is claimed atomically,
+// signed with the webhook's secret, and retried with exponential backoff
+// until it succeeds or runs out of attempts and becomes a dead letter.
+type webhookHub struct {
+	hooks        *mongo.Collection
+	deliveries   *mongo.Collection
+	deviceStates *mongo.Collection
+	client       *http.Client
+	maxAttempts  int
+	deliveryTTL  time.Duration
+
+	mu    sync.RWMutex
+	cache []webhook
+	// badQueries holds the query error last logged per webhook, so a stored
+	// query that no longer parses is reported once rather than every
+	// refresh.
+	badQueries map[primitive.ObjectID]string
+
+	// knownStates caches the state this replica last recorded per device,
+	// so heartbeats that repeat it skip the write.
+	statesMu    sync.Mutex
+	knownStates map[string]string
+}
+
+func newWebhookHub(db *mongo.Database, cfg Config) *webhookHub {
+	return &webhookHub{
+		hooks:        db.Collection(webhooksCollection),
+		deliveries:   db.Collection(webhookDeliveriesCollection),
+		deviceStates: db.Collection(webhookDeviceStatesCollection),
+		client:       &http.Client{Timeout: time.Duration(cfg.WebhookTimeoutMs) * time.Millisecond},
+		maxAttempts:  cfg.WebhookMaxAttempts,
+		deliveryTTL:  time.Duration(cfg.WebhookDeliveryTTLDays) * 24 * time.Hour,
+		badQueries:   map[primitive.ObjectID]string{},
+		knownStates:  map[string]string{},
+	}
+}
+
+// refresh reloads the webhooks and parses their queries. A webhook whose
+// stored query does not parse is left out until it is fixed.
+func (h *webhookHub) refresh(ctx context.Context) error {
+	cursor, err := h.hooks.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	var hooks []webhook
+	if err := cursor.All(ctx, &hooks); err != nil {
+		return err
+	}
+	h.setHooks(hooks, time.Now().UTC())
+	return nil
+}
+
+func (h *webhookHub) setHooks(hooks []webhook, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	usable := make([]webhook, 0, len(hooks))
+	badQueries := map[primitive.ObjectID]string{}
+	for _, hook := range hooks {
+		if hook.Query != "" {
+			filter, err := parseEventQuery(hook.Query, now)
+			if err != nil {
+				badQueries[hook.ID] = err.Error()
+				if h.badQueries[hook.ID] != err.Error() {
+					log.Printf("observer webhook %s: ignoring it, query does not parse: %v", hook.Name, err)
+				}
+				continue
+			}
+			hook.filter = filter
+		}
+		usable = append(usable, hook)
+	}
+	h.cache = usable
+	h.badQueries = badQueries
+}
+
+// subscribers returns the cached webhooks that want trigger for source.
+func (h *webhookHub) subscribers(trigger, source string) []webhook {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var out []webhook
+	for _, hook := range h.cache {
+		if hook.wants(trigger, source) {
+			out = append(out, hook)
+		}
+	}
+	return out
+}
+
+// byID looks in the cache first and falls back to Mongo for a webhook
+// created on another replica since the last refresh.
+func (h *webhookHub) byID(ctx context.Context, id primitive.ObjectID) (webhook, bool, error) {
+	h.mu.RLock()
+	for _, hook := range h.cache {
+		if hook.ID == id {
+			h.mu.RUnlock()
+			return hook, true, nil
+		}
+	}
+	h.mu.RUnlock()
+	var hook webhook
+	err := h.hooks.FindOne(ctx, bson.M{"_id": id}).Decode(&hook)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return webhook{}, false, nil
+	}
+	return hook, err == nil, err
+}
+
+// enqueue queues one delivery. key identifies the change within the
+// trigger; queueing the same key twice is a no-op.
+func (h *webhookHub) enqueue(ctx context.Context, hook webhook, trigger, key string, data any, now time.Time) error {
+	sum := sha256.Sum256([]byte(hook.ID.Hex() + "|" + trigger + "|" + key))
+	id := hex.EncodeToString(sum[:12])
+	body, err := json.Marshal(gin.H{"id": id, "trigger": trigger, "webhook": hook.Name, "createdAt": now, "data": data})
+	if err != nil {
+		return err
+	}
+	_, err = h.deliveries.InsertOne(ctx, bson.M{
+		"_id":           id,
+		"webhookId":     hook.ID,
+		"webhook":       hook.Name,
+		"trigger":       trigger,
+		"key":           key,
+		"body":          string(body),
+		"status":        webhookStatusPending,
+		"attempts":      0,
+		"nextAttemptAt": now,
+		"createdAt":     now,
+		"updatedAt":     now,
+		"expireAt":      now.Add(h.deliveryTTL),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// deviceTransition records state as the device's current state for
+// webhooks and reports the state it replaced. The write only applies when
+// the state differs and the change is newer than the last transition, so of
+// several replicas seeing the same heartbeat exactly one gets changed=true.
+// A device seen for the first time only has its state recorded; there is
+// nothing it changed from. A state this replica already recorded is not
+// written again.
+func (h *webhookHub) deviceTransition(ctx context.Context, source, deviceID, state string, at, now time.Time) (string, bool, error) {
+	key := source + "/" + deviceID
+	h.statesMu.Lock()
+	known, seen := h.knownStates[key]
+	h.statesMu.Unlock()
+	if seen && known == state {
+		return "", false, nil
+	}
+	var before bson.M
+	err := h.deviceStates.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": key, "state": bson.M{"$ne": state}, "changedAt": bson.M{"$lt": at}},
+		bson.M{"$set": bson.M{"source": source, "deviceId": deviceID, "state": state, "changedAt": at, "expireAt": now.Add(h.deliveryTTL)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&before)
+	switch {
+	case err == nil:
+		h.rememberState(key, state)
+		return asString(before["state"]), true, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		h.rememberState(key, state)
+		return "", false, nil
+	case mongo.IsDuplicateKeyError(err):
+		return "", false, nil
+	}
+	return "", false, err
+}
+
+func (h *webhookHub) rememberState(key, state string) {
+	h.statesMu.Lock()
+	defer h.statesMu.Unlock()
+	if len(h.knownStates) >= webhookKnownStatesMax {
+		clear(h.knownStates)
+	}
+	h.knownStates[key] = state
+}
+
+// runWebhookMatcher turns the changes this replica sees into deliveries.
+// It runs on every replica; sub is a durable subscription made before
+// serving, so no change is missed. A change is acked, letting the change
+// stream's resume token move past it, only once it has been matched; a
+// failed match is retried, holding the feed back meanwhile.
+func (s *service) runWebhookMatcher(ctx context.Context, sub *changeSubscription) {
+	defer s.changes.unsubscribe(sub)
+	ticker := time.NewTicker(webhookRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.webhooks.refresh(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("observer webhook refresh error: %v", err)
+			}
+		case change := <-sub.events:
+			retry := changeRetryMin
+			for {
+				err := s.matchWebhooks(ctx, change)
+				if err == nil {
+					break
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("observer webhook match error, retrying in %s: %v", retry, err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(retry):
+				}
+				retry = minDuration(retry*2, changeRetryMax)
+			}
+			sub.ack(change)
+		}
+	}
+}
+
+func (s *service) matchWebhooks(ctx context.Context, change changeEvent) error {
+	doc := change.Document
+	source := asString(doc["source"])
+	now := time.Now().UTC()
+	switch change.Topic {
+	case changeTopicEvents:
+		if change.Operation != "insert" || !isErrorEvent(doc) {
+			return nil
+		}
+		key := change.ID
+		if key == "" {
+			key = primitive.NewObjectID().Hex()
+		}
+		for _, hook := range s.webhooks.subscribers(webhookTriggerError, source) {
+			if hook.filter != nil && !matchDocument(doc, hook.filter) {
+				continue
+			}
+			if err := s.webhooks.enqueue(ctx, hook, webhookTriggerError, key, doc, now); err != nil {
+				return err
+			}
+		}
+	case changeTopicLiveDevices:
+		state, ok := doc["streamState"]
+		hooks := s.webhooks.subscribers(webhookTriggerDeviceState, source)
+		if !ok || len(hooks) == 0 {
+			return nil
+		}
+		deviceID := asString(doc["deviceId"])
+		at := parseTime(doc["updatedAt"])
+		from, changed, err := s.webhooks.deviceTransition(ctx, source, deviceID, asString(state), at, now)
+		if err != nil || !changed {
+			return err
+		}
+		data := gin.H{"from": from, "to": asString(state), "device": s.liveDeviceItem(doc, now)}
+		key := fmt.Sprintf("%s/%s/%s/%d", source, deviceID, asString(state), at.UnixMilli())
+		for _, hook := range hooks {
+			if err := s.webhooks.enqueue(ctx, hook, webhookTriggerDeviceState, key, data, now); err != nil {
+				return err
+			}
+		}
+	case changeTopicBackups:
+		reason := ""
+		if change.Operation == "insert" && containsString(backupFailureStatuses, asString(doc["status"])) {
+			reason = "status"
+		} else if change.Operation != "insert" && asString(doc["verificationStatus"]) == verificationFailed {
+			reason = "verification"
+		}
+		if reason == "" {
+			return nil
+		}
+		for _, hook := range s.webhooks.subscribers(webhookTriggerBackupFailed, source) {
+			if err := s.webhooks.enqueue(ctx, hook, webhookTriggerBackupFailed, change.ID+"/"+reason, gin.H{"reason": reason, "backup": doc}, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runWebhookCrashScan queues device.suspected_crash deliveries. A suspected
+// crash is a device that went quiet mid-stream, which no write announces,
+// so the leader looks for them on a timer. Each outage is keyed by the last
+// heartbeat before it and delivered once.
+func (s *service) runWebhookCrashScan(ctx context.Context) {
+	ticker := time.NewTicker(webhookCrashScanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.scanSuspectedCrashes(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("observer webhook crash scan error: %v", err)
+			}
+		}
+	}
+}
+
+func (s *service) scanSuspectedCrashes(ctx context.Context) error {
+	now := time.Now().UTC()
+	rows, err := s.store.liveDevices.find(ctx, findQuery{
+		filter: bson.M{"lastSeenAt": bson.M{"$gte": now.Add(-webhookCrashScanWindow)}},
+	})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		item := s.liveDeviceItem(row, now)
+		if item["suspectedCrash"] != true {
+			continue
+		}
+		source := asString(row["source"])
+		lastSeenAt := parseTime(firstNonNil(row["lastSeenAt"], row["capturedAt"]))
+		key := fmt.Sprintf("%s/%s/%d", source, asString(row["deviceId"]), lastSeenAt.UnixMilli())
+		for _, hook := range s.webhooks.subscribers(webhookTriggerSuspectedCrash, source) {
+			if err := s.webhooks.enqueue(ctx, hook, webhookTriggerSuspectedCrash, key, item, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runWebhookDispatcher sends queued deliveries; it runs on the leader.
+func (s *service) runWebhookDispatcher(ctx context.Context) {
+	var workers sync.WaitGroup
+	for range webhookDispatchWorkers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			ticker := time.NewTicker(webhookDispatchInterval)
+			defer ticker.Stop()
+			for {
+				for {
+					sent, err := s.webhooks.dispatchNext(ctx)
+					if err != nil && !errors.Is(err, context.Canceled) {
+						log.Printf("observer webhook dispatch error: %v", err)
+					}
+					if !sent {
+						break
+					}
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	workers.Wait()
+}
+
+// dispatchNext claims the oldest due delivery, sends it and records the
+// outcome. It reports whether there was one. The claim pushes nextAttemptAt
+// past the send timeout, so a delivery abandoned mid-send (the leader
+// stepped down) is picked up again later. A replica that has lost the lease
+// does not send; finish only records the outcome while the claim is still
+// ours. Delivery is at least once all the same: a send whose outcome is
+// never recorded is repeated, so receivers dedupe on X-Observer-Delivery.
+func (h *webhookHub) dispatchNext(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+	// Mongo keeps milliseconds; the claim is matched again by finish.
+	claimedUntil := now.Add(2*h.client.Timeout + time.Minute).Truncate(time.Millisecond)
+	var delivery webhookDelivery
+	err := h.deliveries.FindOneAndUpdate(
+		ctx,
+		bson.M{"status": webhookStatusPending, "nextAttemptAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"nextAttemptAt": claimedUntil}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}),
+	).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	hook, ok, err := h.byID(ctx, delivery.WebhookID)
+	if err != nil {
+		return true, err
+	}
+	if err := checkLease(ctx); err != nil {
+		return true, err
+	}
+	var statusCode int
+	if !ok {
+		err = errors.New("webhook no longer exists")
+	} else {
+		statusCode, err = h.send(ctx, hook, delivery)
+		if ctx.Err() != nil {
+			return true, ctx.Err()
+		}
+	}
+	return true, h.finish(delivery, claimedUntil, statusCode, err, !ok, time.Since(now))
+}
+
+// send posts the delivery body. The signature is an HMAC-SHA256 of
+// "<timestamp>.<body>" keyed by the webhook secret.
+func (h *webhookHub) send(ctx context.Context, hook webhook, delivery webhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, strings.NewReader(delivery.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pickletour-observer-webhooks")
+	req.Header.Set("X-Observer-Webhook", hook.Name)
+	req.Header.Set("X-Observer-Trigger", delivery.Trigger)
+	req.Header.Set("X-Observer-Delivery", delivery.ID)
+	req.Header.Set("X-Observer-Attempt", strconv.Itoa(delivery.Attempts+1))
+	req.Header.Set("X-Observer-Timestamp", timestamp)
+	req.Header.Set("X-Observer-Signature", "sha256="+signWebhook(hook.Secret, timestamp, delivery.Body))
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, webhookResponseLimit))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func signWebhook(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff is the wait after the given failed attempt: 10s, 20s,
+// 40s and so on, up to an hour.
+func webhookBackoff(attempt int) time.Duration {
+	wait := webhookBackoffBase
+	for index := 1; index < attempt && wait < webhookBackoffMax; index++ {
+		wait *= 2
+	}
+	return minDuration(wait, webhookBackoffMax)
+}
+
+// finish records the outcome of a send, but only while the delivery is
+// still held by this claim. If the send outlasted the claim and another
+// dispatcher took the delivery over, that dispatcher records its own
+// attempt instead.
+func (h *webhookHub) finish(delivery webhookDelivery, claimedUntil time.Time, statusCode int, sendErr error, dead bool, took time.Duration) error {
+	now := time.Now().UTC()
+	attempts := delivery.Attempts + 1
+	attempt := bson.M{"at": now, "statusCode": statusCode, "durationMs": took.Milliseconds()}
+	set := bson.M{"lastAttemptAt": now, "lastStatusCode": statusCode, "updatedAt": now}
+	switch {
+	case sendErr == nil:
+		set["status"] = webhookStatusDelivered
+		set["deliveredAt"] = now
+		set["lastError"] = ""
+	case dead || attempts >= h.maxAttempts:
+		attempt["error"] = sendErr.Error()
+		set["status"] = webhookStatusDead
+		set["deadAt"] = now
+		set["lastError"] = sendErr.Error()
+	default:
+		attempt["error"] = sendErr.Error()
+		set["nextAttemptAt"] = now.Add(webhookBackoff(attempts))
+		set["lastError"] = sendErr.Error()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := h.deliveries.UpdateOne(ctx, bson.M{
+		"_id":           delivery.ID,
+		"status":        webhookStatusPending,
+		"attempts":      delivery.Attempts,
+		"nextAttemptAt": claimedUntil,
+	}, bson.M{
+		"$set":  set,
+		"$inc":  bson.M{"attempts": 1},
+		"$push": bson.M{"attemptLog": bson.M{"$each": bson.A{attempt}, "$slice": -webhookAttemptHistory}},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("delivery %s was claimed again before its attempt was recorded", delivery.ID)
+	}
+	return nil
+}
+
+func (s *service) listWebhooks(c *gin.Context) {
+	cursor, err := s.webhooks.hooks.Find(c.Request.Context(), bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err == nil {
+		var hooks []webhook
+		if err = cursor.All(c.Request.Context(), &hooks); err == nil {
+			items := make([]gin.H, 0, len(hooks))
+			for _, hook := range hooks {
+				items = append(items, hook.view())
+			}
+			c.JSON(http.StatusOK, gin.H{"ok": true, "items": items})
+			return
+		}
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load webhooks", "error": err.Error()})
+}
+
+// upsertWebhook creates or updates the webhook named in the body. A new
+// webhook without a secret gets a generated one; rotateSecret replaces it.
+// The secret is only ever returned by the call that set it.
+func (s *service) upsertWebhook(c *gin.Context) {
+	body, ok := bindJSONMap(c)
+	if !ok {
+		return
+	}
+	set, err := parseWebhookSetting(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": err.Error()})
+		return
+	}
+	secret := strings.TrimSpace(asString(body["secret"]))
+	if secret == "" && asBool(body["rotateSecret"]) {
+		secret = newWebhookSecret()
+	}
+	if secret != "" {
+		set["secret"] = secret
+	}
+	now := time.Now().UTC()
+	set["updatedAt"] = now
+	setOnInsert := bson.M{"createdAt": now}
+	if secret == "" {
+		secret = newWebhookSecret()
+		setOnInsert["secret"] = secret
+	}
+
+	var hook webhook
+	result := s.webhooks.hooks.FindOneAndUpdate(
+		c.Request.Context(),
+		bson.M{"name": set["name"]},
+		bson.M{"$set": set, "$setOnInsert": setOnInsert},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	)
+	if err := result.Decode(&hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to save webhook", "error": err.Error()})
+		return
+	}
+	if err := s.webhooks.refresh(c.Request.Context()); err != nil {
+		log.Printf("observer webhook refresh error: %v", err)
+	}
+	view := hook.view()
+	if hook.Secret == secret {
+		view["secret"] = secret
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "item": view})
+}
+
+// parseWebhookSetting validates a webhook as posted to the admin API and
+// returns the fields to store.
+func parseWebhookSetting(body map[string]any) (bson.M, error) {
+	name := strings.TrimSpace(asString(body["name"]))
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	target, err := url.Parse(strings.TrimSpace(asString(body["url"])))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errors.New("url must be an absolute http or https URL")
+	}
+	triggers := normalizeStringList(body["triggers"])
+	if len(triggers) == 0 {
+		return nil, errors.New("triggers is required")
+	}
+	for _, trigger := range triggers {
+		if !containsString(webhookTriggers, trigger) {
+			return nil, fmt.Errorf("triggers must be from %s", strings.Join(webhookTriggers, ", "))
+		}
+	}
+	query := strings.TrimSpace(asString(body["query"]))
+	if query != "" {
+		if _, err := parseEventQuery(query, time.Now().UTC()); err != nil {
+			return nil, fmt.Errorf("query: %w", err)
+		}
+	}
+	enabled := true
+	if value, ok := body["enabled"]; ok {
+		enabled = asBool(value)
+	}
+	return bson.M{
+		"name":     name,
+		"url":      target.String(),
+		"triggers": triggers,
+		"source":   strings.TrimSpace(asString(body["source"])),
+		"query":    query,
+		"enabled":  enabled,
+	}, nil
+}
+
+func newWebhookSecret() string {
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// deleteWebhook removes the webhook; its pending deliveries become dead
+// letters when they come due.
+func (s *service) deleteWebhook(c *gin.Context) {
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "name is required"})
+		return
+	}
+	result, err := s.webhooks.hooks.DeleteOne(c.Request.Context(), bson.M{"name": name})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to delete webhook", "error": err.Error()})
+		return
+	}
+	if err := s.webhooks.refresh(c.Request.Context()); err != nil {
+		log.Printf("observer webhook refresh error: %v", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "deleted": result.DeletedCount})
+}
+
+// listWebhookDeliveries is the delivery log, newest first, filtered by
+// webhook, trigger and status.
+func (s *service) listWebhookDeliveries(c *gin.Context) {
+	filter := bson.M{}
+	for param, field := range map[string]string{"webhook": "webhook", "trigger": "trigger", "status": "status"} {
+		if value := strings.TrimSpace(c.Query(param)); value != "" {
+			filter[field] = value
+		}
+	}
+	s.respondWebhookDeliveries(c, filter)
+}
+
+// listWebhookDeadLetters lists the deliveries that ran out of attempts.
+func (s *service) listWebhookDeadLetters(c *gin.Context) {
+	filter := bson.M{"status": webhookStatusDead}
+	if value := strings.TrimSpace(c.Query("webhook")); value != "" {
+		filter["webhook"] = value
+	}
+	s.respondWebhookDeliveries(c, filter)
+}
+
+func (s *service) respondWebhookDeliveries(c *gin.Context, filter bson.M) {
+	limit := clampInt(parseInt(c.Query("limit"), 50), 1, 500)
+	cursor, err := s.webhooks.deliveries.Find(
+		c.Request.Context(),
+		filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(int64(limit)),
+	)
+	if err == nil {
+		var rows []bson.M
+		if err = cursor.All(c.Request.Context(), &rows); err == nil {
+			items := make([]gin.H, 0, len(rows))
+			for _, row := range rows {
+				items = append(items, webhookDeliveryItem(row))
+			}
+			c.JSON(http.StatusOK, gin.H{"ok": true, "items": items})
+			return
+		}
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to load webhook deliveries", "error": err.Error()})
+}
+
+func webhookDeliveryItem(row bson.M) gin.H {
+	var payload any
+	_ = json.Unmarshal([]byte(asString(row["body"])), &payload)
+	return gin.H{
+		"id":             asString(row["_id"]),
+		"webhook":        asString(row["webhook"]),
+		"trigger":        asString(row["trigger"]),
+		"status":         asString(row["status"]),
+		"attempts":       row["attempts"],
+		"nextAttemptAt":  row["nextAttemptAt"],
+		"lastAttemptAt":  row["lastAttemptAt"],
+		"lastStatusCode": row["lastStatusCode"],
+		"lastError":      asString(row["lastError"]),
+		"attemptLog":     row["attemptLog"],
+		"createdAt":      row["createdAt"],
+		"deliveredAt":    row["deliveredAt"],
+		"deadAt":         row["deadAt"],
+		"payload":        payload,
+	}
+}
+
+// retryWebhookDelivery puts a dead letter (or a pending delivery) back at
+// the front of the queue with a fresh set of attempts.
+func (s *service) retryWebhookDelivery(c *gin.Context) {
+	now := time.Now().UTC()
+	result, err := s.webhooks.deliveries.UpdateOne(
+		c.Request.Context(),
+		bson.M{"_id": c.Param("id"), "status": bson.M{"$in": bson.A{webhookStatusDead, webhookStatusPending}}},
+		bson.M{
+			"$set":   bson.M{"status": webhookStatusPending, "attempts": 0, "nextAttemptAt": now, "updatedAt": now},
+			"$unset": bson.M{"deadAt": ""},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "message": "Failed to retry webhook delivery", "error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "message": "No dead or pending delivery with that id"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "id": c.Param("id"), "status": webhookStatusPending})
+}
@@ -0,0 +1,119 @@
+package observer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWebhookSendSignsBody(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		got, gotBody = r, string(raw)
+		if r.Header.Get("X-Observer-Attempt") == "2" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	hub := &webhookHub{client: &http.Client{Timeout: time.Second}}
+	hook := webhook{ID: primitive.NewObjectID(), Name: "backend", URL: server.URL, Secret: "s3cret"}
+	delivery := webhookDelivery{ID: "d1", Trigger: webhookTriggerError, Body: `{"trigger":"event.error"}`}
+
+	code, err := hub.send(context.Background(), hook, delivery)
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("send = %d, %v", code, err)
+	}
+	timestamp := got.Header.Get("X-Observer-Timestamp")
+	want := "sha256=" + signWebhook("s3cret", timestamp, delivery.Body)
+	if got.Header.Get("X-Observer-Signature") != want || gotBody != delivery.Body {
+		t.Errorf("signature = %q body = %q, want %q over the body", got.Header.Get("X-Observer-Signature"), gotBody, want)
+	}
+	if got.Header.Get("X-Observer-Delivery") != "d1" || got.Header.Get("X-Observer-Trigger") != webhookTriggerError {
+		t.Errorf("headers = %v", got.Header)
+	}
+
+	delivery.Attempts = 1
+	if code, err := hub.send(context.Background(), hook, delivery); err == nil || code != http.StatusBadGateway {
+		t.Errorf("send to a failing endpoint = %d, %v, want an error", code, err)
+	}
+}
+
+func TestWebhookBackoffDoublesUpToCap(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{1: 10 * time.Second, 2: 20 * time.Second, 4: 80 * time.Second, 30: time.Hour} {
+		if got := webhookBackoff(attempt); got != want {
+			t.Errorf("webhookBackoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestParseWebhookSetting(t *testing.T) {
+	set, err := parseWebhookSetting(map[string]any{
+		"name":     "backend",
+		"url":      "https://api.example.test/hooks/observer",
+		"triggers": []any{webhookTriggerError, webhookTriggerBackupFailed},
+		"query":    "statusCode>=500 source:pickletour-api-main",
+	})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if set["enabled"] != true || len(set["triggers"].([]string)) != 2 {
+		t.Errorf("set = %v", set)
+	}
+
+	for _, body := range []map[string]any{
+		{"url": "https://api.example.test", "triggers": []any{webhookTriggerError}},
+		{"name": "x", "url": "ftp://api.example.test", "triggers": []any{webhookTriggerError}},
+		{"name": "x", "url": "https://api.example.test", "triggers": []any{"event.any"}},
+		{"name": "x", "url": "https://api.example.test", "triggers": []any{webhookTriggerError}, "query": "statusCode>>5"},
+	} {
+		if _, err := parseWebhookSetting(body); err == nil {
+			t.Errorf("parseWebhookSetting(%v) accepted an invalid webhook", body)
+		}
+	}
+
+	hook := webhook{Enabled: true, Triggers: []string{webhookTriggerError}, Source: "venue-box"}
+	if !hook.wants(webhookTriggerError, "venue-box") || hook.wants(webhookTriggerError, "other") || hook.wants(webhookTriggerBackupFailed, "venue-box") {
+		t.Errorf("wants does not honour trigger and source")
+	}
+}
+
+func TestWebhookHubParsesQueriesOnRefresh(t *testing.T) {
+	hub := &webhookHub{badQueries: map[primitive.ObjectID]string{}}
+	filtered := webhook{ID: primitive.NewObjectID(), Name: "payments", Triggers: []string{webhookTriggerError}, Query: "path:/api/payments*", Enabled: true}
+	broken := webhook{ID: primitive.NewObjectID(), Name: "broken", Triggers: []string{webhookTriggerError}, Query: "level:error )", Enabled: true}
+	plain := webhook{ID: primitive.NewObjectID(), Name: "all", Triggers: []string{webhookTriggerError}, Enabled: true}
+	hub.setHooks([]webhook{filtered, broken, plain}, time.Now().UTC())
+
+	hooks := hub.subscribers(webhookTriggerError, "api")
+	if len(hooks) != 2 || hooks[0].Name != "payments" || hooks[1].Name != "all" {
+		t.Fatalf("subscribers = %+v, want payments and all without the broken query", hooks)
+	}
+	if hooks[0].filter == nil || hooks[1].filter != nil {
+		t.Errorf("filters = %v / %v, want only the query parsed", hooks[0].filter, hooks[1].filter)
+	}
+	if !matchDocument(bson.M{"path": "/api/payments/42"}, hooks[0].filter) || matchDocument(bson.M{"path": "/api/users"}, hooks[0].filter) {
+		t.Errorf("filter %v matches the wrong paths", hooks[0].filter)
+	}
+	if hub.badQueries[broken.ID] == "" {
+		t.Errorf("badQueries = %v, want the broken query recorded", hub.badQueries)
+	}
+}
+
+func TestDeviceTransitionSkipsKnownState(t *testing.T) {
+	// deviceStates is nil: a repeated state must not reach Mongo.
+	hub := &webhookHub{knownStates: map[string]string{}}
+	hub.rememberState("venue/court-1", "live")
+	now := time.Now().UTC()
+	if from, changed, err := hub.deviceTransition(context.Background(), "venue", "court-1", "live", now, now); err != nil || changed || from != "" {
+		t.Errorf("deviceTransition = %q %v %v, want no write for an unchanged state", from, changed, err)
+	}
+}